@@ -17,10 +17,12 @@ var _fv float64
 var _uv uintptr
 
 var preloads [int(preloadLimit)]LValue
+var ipreloads [int(preloadLimit)]LValue
 
 func init() {
 	for i := 0; i < int(preloadLimit); i++ {
 		preloads[i] = LNumber(i)
+		ipreloads[i] = LInteger(i)
 	}
 }
 
@@ -29,9 +31,13 @@ type allocator struct {
 	size    int
 	fptrs   []float64
 	fheader *reflect.SliceHeader
+	iptrs   []int64
 
 	scratchValue  LValue
 	scratchValueP *iface
+	// the scratch value of LInteger2I, which needs the itab of LInteger
+	iscratchValue  LValue
+	iscratchValueP *iface
 }
 
 func newAllocator(size int) *allocator {
@@ -43,6 +49,8 @@ func newAllocator(size int) *allocator {
 	al.fheader = (*reflect.SliceHeader)(unsafe.Pointer(&al.fptrs))
 	al.scratchValue = LNumber(0)
 	al.scratchValueP = (*iface)(unsafe.Pointer(&al.scratchValue))
+	al.iscratchValue = LInteger(0)
+	al.iscratchValueP = (*iface)(unsafe.Pointer(&al.iscratchValue))
 
 	return al
 }
@@ -77,3 +85,18 @@ func (al *allocator) LNumber2I(v LNumber) LValue {
 
 	return al.scratchValue
 }
+
+// LInteger2I is like LNumber2I for integers. Integers are allocated in blocks of their own.
+func (al *allocator) LInteger2I(v LInteger) LValue {
+	if v >= 0 && v < LInteger(preloadLimit) {
+		return ipreloads[int(v)]
+	}
+
+	if cap(al.iptrs) == len(al.iptrs) {
+		al.iptrs = make([]int64, 0, al.size)
+	}
+	al.iptrs = append(al.iptrs, int64(v))
+	al.iscratchValueP.word = unsafe.Pointer(&al.iptrs[len(al.iptrs)-1])
+
+	return al.iscratchValue
+}
@@ -66,6 +66,19 @@ type AttrGetExpr struct {
 
 	Object Expr
 	Key    Expr
+	// Paren is true for an index in parentheses, which ends an optional chain.
+	Paren bool
+}
+
+// SafeAttrGetExpr is an optional index, `a?.b` or `a?[b]`. It is nil if Object is nil, without evaluating Key.
+// The indexes and calls following it are skipped too, so `a?.b.c` and `a?.b:c()` are nil if a is nil.
+// Parentheses end the chain, and a stopped chain has a single nil value.
+type SafeAttrGetExpr struct {
+	ExprBase
+
+	Object Expr
+	Key    Expr
+	Paren  bool
 }
 
 type TableExpr struct {
@@ -92,6 +105,14 @@ type LogicalOpExpr struct {
 	Rhs      Expr
 }
 
+// NilCoalesceExpr is `a ?? b`, which is b if a is nil and a otherwise. Unlike `a or b`, a false a is kept.
+type NilCoalesceExpr struct {
+	ExprBase
+
+	Lhs Expr
+	Rhs Expr
+}
+
 type BitwiseOpExpr struct {
 	ExprBase
 
@@ -115,6 +136,14 @@ type StringConcatOpExpr struct {
 	Rhs Expr
 }
 
+// InterpolatedStringExpr is a string literal with embedded expressions, like `a${b}c`.
+// Parts holds the literal pieces as StringExprs and the embedded expressions in source order.
+type InterpolatedStringExpr struct {
+	ExprBase
+
+	Parts []Expr
+}
+
 type ArithmeticOpExpr struct {
 	ExprBase
 
@@ -138,11 +167,18 @@ type UnaryLenOpExpr struct {
 	Expr Expr
 }
 
+type UnaryBitNotOpExpr struct {
+	ExprBase
+	Expr Expr
+}
+
 type FunctionExpr struct {
 	ExprBase
 
 	ParList *ParList
 	Stmts   []Stmt
+	// ReturnType is the type annotation of the first return value, nil if not annotated.
+	ReturnType Expr
 }
 
 type TypeAssertionExpr struct {
@@ -8,6 +8,9 @@ type Field struct {
 type ParList struct {
 	HasVargs bool
 	Names    []string
+	// Types holds the type annotation of each name, nil for names without one.
+	// It is nil if no name is annotated.
+	Types []Expr
 }
 
 type FuncName struct {
@@ -31,6 +31,9 @@ type LocalAssignStmt struct {
 
 	Names []string
 	Exprs []Expr
+	// Types holds the type annotation of each name, nil for names without one.
+	// It is nil if no name is annotated.
+	Types []Expr
 }
 
 type FuncCallStmt struct {
@@ -59,6 +62,22 @@ type RepeatStmt struct {
 	Stmts     []Stmt
 }
 
+type WhileStmtWithIfThru struct {
+	StmtBase
+
+	Condition   Expr
+	Stmts       []Stmt
+	IfThruStmts []Stmt
+}
+
+type RepeatStmtWithIfThru struct {
+	StmtBase
+
+	Condition   Expr
+	Stmts       []Stmt
+	IfThruStmts []Stmt
+}
+
 type IfStmt struct {
 	StmtBase
 
@@ -122,6 +141,11 @@ type BreakStmt struct {
 	StmtBase
 }
 
+// ContinueStmt skips the rest of the body of the innermost loop and starts its next iteration.
+type ContinueStmt struct {
+	StmtBase
+}
+
 type LabelStmt struct {
 	StmtBase
 
@@ -133,3 +157,30 @@ type GotoStmt struct {
 
 	Label string
 }
+
+// DeferStmt delays a function call until the enclosing block is left. The function and its
+// arguments are evaluated when the statement runs.
+type DeferStmt struct {
+	StmtBase
+
+	Call *FuncCallExpr
+}
+
+// SwitchStmt runs the statements of the first case matching the value of Expr, or Default if no case
+// matches. Cases do not fall through, and break leaves the enclosing loop, not the switch.
+type SwitchStmt struct {
+	StmtBase
+
+	Expr    Expr
+	Cases   []*SwitchCase
+	Default []Stmt
+}
+
+// SwitchCase matches the values equal to one of Values. A *BuiltinType in Values matches the values
+// of that type. Values is nil for the default case while parsing.
+type SwitchCase struct {
+	Node
+
+	Values []Expr
+	Stmts  []Stmt
+}
@@ -20,7 +20,10 @@ func (ls *LState) CheckAny(n int) LValue {
 
 func (ls *LState) CheckInt(n int) int {
 	v := ls.Get(n)
-	if intv, ok := v.(LNumber); ok {
+	switch intv := v.(type) {
+	case LInteger:
+		return int(intv)
+	case LNumber:
 		return int(intv)
 	}
 	ls.TypeError(n, LTNumber)
@@ -29,7 +32,10 @@ func (ls *LState) CheckInt(n int) int {
 
 func (ls *LState) CheckInt64(n int) int64 {
 	v := ls.Get(n)
-	if intv, ok := v.(LNumber); ok {
+	switch intv := v.(type) {
+	case LInteger:
+		return int64(intv)
+	case LNumber:
 		return int64(intv)
 	}
 	ls.TypeError(n, LTNumber)
@@ -38,8 +44,8 @@ func (ls *LState) CheckInt64(n int) int64 {
 
 func (ls *LState) CheckNumber(n int) LNumber {
 	v := ls.Get(n)
-	if lv, ok := v.(LNumber); ok {
-		return lv
+	if v.Type() == LTNumber {
+		return LVAsNumber(v)
 	}
 	if lv, ok := v.(LString); ok {
 		if num, err := parseNumber(string(lv)); err == nil {
@@ -147,7 +153,10 @@ func (ls *LState) OptInt(n int, d int) int {
 	if v == LNil {
 		return d
 	}
-	if intv, ok := v.(LNumber); ok {
+	switch intv := v.(type) {
+	case LInteger:
+		return int(intv)
+	case LNumber:
 		return int(intv)
 	}
 	ls.TypeError(n, LTNumber)
@@ -159,7 +168,10 @@ func (ls *LState) OptInt64(n int, d int64) int64 {
 	if v == LNil {
 		return d
 	}
-	if intv, ok := v.(LNumber); ok {
+	switch intv := v.(type) {
+	case LInteger:
+		return int64(intv)
+	case LNumber:
 		return int64(intv)
 	}
 	ls.TypeError(n, LTNumber)
@@ -171,8 +183,8 @@ func (ls *LState) OptNumber(n int, d LNumber) LNumber {
 	if v == LNil {
 		return d
 	}
-	if lv, ok := v.(LNumber); ok {
-		return lv
+	if v.Type() == LTNumber {
+		return LVAsNumber(v)
 	}
 	ls.TypeError(n, LTNumber)
 	return 0
@@ -369,6 +381,13 @@ func (ls *LState) LoadFile(path string) (*LFunction, error) {
 	}
 
 	reader := bufio.NewReader(file)
+	if isBytecode(reader) {
+		proto, err := LoadProto(reader)
+		if err != nil {
+			return nil, newApiErrorE(ApiErrorSyntax, fmt.Errorf("%s: %w", path, err))
+		}
+		return newLFunctionL(proto, ls.currentEnv(), 0), nil
+	}
 	// get the first character.
 	c, err := reader.ReadByte()
 	if err != nil && err != io.EOF {
@@ -27,6 +27,7 @@ var BaseLibFuncDoc = map[string]libFuncDoc{
 		libName: BaseLibName,
 		libFuncName: []string{
 			"Assert",
+			"CollectGarbage",
 			"DoFile",
 			"Error",
 			"GetFEnv",
@@ -57,29 +58,30 @@ var BaseLibFuncDoc = map[string]libFuncDoc{
 }
 
 var baseFuncs = map[string]LGFunction{
-	"Assert":       baseAssert,
-	"DoFile":       baseDoFile,
-	"Error":        baseError,
-	"GetFEnv":      baseGetFEnv,
-	"GetMetatable": baseGetMetatable,
-	"Load":         baseLoad,
-	"LoadFile":     baseLoadFile,
-	"LoadString":   baseLoadString,
-	"Next":         baseNext,
-	"PCall":        basePCall,
-	"PrintLn":      basePrintln,
-	"Print":        basePrint,
-	"Input":        baseInput,
-	"RawEqual":     baseRawEqual,
-	"RawGet":       baseRawGet,
-	"RawSet":       baseRawSet,
-	"Select":       baseSelect,
-	"SetFEnv":      baseSetFEnv,
-	"SetMetatable": baseSetMetatable,
-	"ToNumber":     baseToNumber,
-	"ToString":     baseToString,
-	"Type":         baseType,
-	"XpCall":       baseXPCall,
+	"Assert":         baseAssert,
+	"CollectGarbage": baseCollectGarbage,
+	"DoFile":         baseDoFile,
+	"Error":          baseError,
+	"GetFEnv":        baseGetFEnv,
+	"GetMetatable":   baseGetMetatable,
+	"Load":           baseLoad,
+	"LoadFile":       baseLoadFile,
+	"LoadString":     baseLoadString,
+	"Next":           baseNext,
+	"PCall":          basePCall,
+	"PrintLn":        basePrintln,
+	"Print":          basePrint,
+	"Input":          baseInput,
+	"RawEqual":       baseRawEqual,
+	"RawGet":         baseRawGet,
+	"RawSet":         baseRawSet,
+	"Select":         baseSelect,
+	"SetFEnv":        baseSetFEnv,
+	"SetMetatable":   baseSetMetatable,
+	"ToNumber":       baseToNumber,
+	"ToString":       baseToString,
+	"Type":           baseType,
+	"XpCall":         baseXPCall,
 	// loadlib
 	"Module":  loModule,
 	"Require": loRequire,
@@ -117,6 +119,48 @@ func baseAssert(L *LState) int {
 	return L.GetTop()
 }
 
+// baseCollectGarbage 模块函数，用于控制垃圾回收
+// 参数：
+//  1. opt (string) - 操作（可选，默认为 "collect"）
+//
+// 返回值：
+//  1. "collect" 返回 0，"step" 返回 true，"count" 返回估算的内存使用量（KB）
+//
+// 调用方式：
+//  1. CollectGarbage()
+//  2. CollectGarbage("count")
+//
+// 示例：
+//
+//	local cache = SetMetatable({}, {__mode = "k"})
+//	cache[{}] = 1
+//	CollectGarbage()
+//	PrintLn(Next(cache)) // 输出：nil
+//
+// 备注：
+//  1. "collect" 和 "step" 执行一次完整的回收：清除弱表（__mode 为 "k"、"v" 或 "kv"）中不可达的对象，
+//     并按注册的相反顺序调用不可达 userdata 的 __gc 元方法
+//  2. 运行中的 HTTP/websocket 服务器的处理函数及通道中尚未被接收的值视为可达；
+//     其他只被 Go 代码或其他 goroutine 中运行的线程引用的对象无法被识别，
+//     因此不能在同一状态的其他线程（如正在处理请求的处理函数）运行时调用，此时也没有加锁保护
+//  3. __gc 元方法出错时，会在所有元方法执行完后报错
+//  4. 显式关闭的文件和 websocket 连接不再调用 __gc 元方法；状态关闭时会调用其余尚未调用的 __gc 元方法
+func baseCollectGarbage(L *LState) int {
+	switch opt := L.OptString(1, "collect"); opt {
+	case "collect":
+		L.CollectGarbage()
+		L.Push(LInteger(0))
+	case "step":
+		L.CollectGarbage()
+		L.Push(LTrue)
+	case "count":
+		L.Push(LNumber(float64(L.measureMemory()) / 1024))
+	default:
+		L.ArgError(1, "invalid option '"+opt+"'")
+	}
+	return 1
+}
+
 // baseDoFile 模块函数，用于执行文件
 // 参数：
 //  1. string - 文件路径
@@ -196,7 +240,7 @@ func baseError(L *LState) int {
 func baseGetFEnv(L *LState) int {
 	var value LValue
 	if L.GetTop() == 0 {
-		value = LNumber(1)
+		value = LInteger(1)
 	} else {
 		value = L.Get(1)
 	}
@@ -210,8 +254,8 @@ func baseGetFEnv(L *LState) int {
 		return 1
 	}
 
-	if number, ok := value.(LNumber); ok {
-		level := int(float64(number))
+	if value.Type() == LTNumber {
+		level := int(LVAsNumber(value))
 		if level <= 0 {
 			L.Push(L.Env)
 		} else {
@@ -264,8 +308,8 @@ func ipairsaux(L *LState) int {
 		return 0
 	} else {
 		L.Pop(1)
-		L.Push(LNumber(i))
-		L.Push(LNumber(i))
+		L.Push(LInteger(i))
+		L.Push(LInteger(i))
 		L.Push(v)
 		return 2
 	}
@@ -291,7 +335,7 @@ func baseIpairs(L *LState) int {
 	tb := L.CheckTable(1)
 	L.Push(L.Get(UpvalueIndex(1)))
 	L.Push(tb)
-	L.Push(LNumber(0))
+	L.Push(LInteger(0))
 	return 3
 }
 
@@ -406,6 +450,9 @@ func basePCall(L *LState) int {
 	}
 	nargs := L.GetTop() - 1
 	if err := L.PCall(nargs, MultRet, nil); err != nil {
+		if isBudgetError(err) {
+			panic(err)
+		}
 		L.Push(LFalse)
 		if aerr, ok := err.(*ApiError); ok {
 			L.Push(aerr.Object)
@@ -449,8 +496,11 @@ func baseInput(L *LState) int {
 	}
 
 	reader := bufio.NewReader(os.Stdin)
+	release := interruptReadOnDone(L, os.Stdin)
 	input, err := reader.ReadString('\n')
+	release()
 	if err != nil {
+		L.CheckContext()
 		if err == io.EOF {
 			L.RaiseError("EOF encountered: no input provided")
 			return 0
@@ -485,8 +535,8 @@ func baseRawSet(L *LState) int {
 func baseSelect(L *LState) int {
 	L.CheckTypes(1, LTNumber, LTString)
 	switch lv := L.Get(1).(type) {
-	case LNumber:
-		idx := int(lv)
+	case LNumber, LInteger:
+		idx := int(LVAsNumber(lv))
 		num := L.GetTop()
 		if idx < 0 {
 			idx = num + idx
@@ -501,7 +551,7 @@ func baseSelect(L *LState) int {
 		if string(lv) != "#" {
 			L.ArgError(1, "invalid string '"+string(lv)+"'")
 		}
-		L.Push(LNumber(L.GetTop() - 1))
+		L.Push(LInteger(L.GetTop() - 1))
 		return 1
 	}
 	return 0
@@ -510,7 +560,7 @@ func baseSelect(L *LState) int {
 func baseSetFEnv(L *LState) int {
 	var value LValue
 	if L.GetTop() == 0 {
-		value = LNumber(1)
+		value = LInteger(1)
 	} else {
 		value = L.Get(1)
 	}
@@ -526,8 +576,8 @@ func baseSetFEnv(L *LState) int {
 		}
 	}
 
-	if number, ok := value.(LNumber); ok {
-		level := int(float64(number))
+	if value.Type() == LTNumber {
+		level := int(LVAsNumber(value))
 		if level <= 0 {
 			L.Env = env
 			return 0
@@ -563,7 +613,7 @@ func baseSetMetatable(L *LState) int {
 		}
 	}
 	if mtastbl, ok := mt.(*LTable); ok {
-		if _, ok := mtastbl.RawGetString("__index").(*LTable); !ok {
+		if _, ok := mtastbl.RawGetString("__index").(*LTable); !ok && !mtastbl.frozen {
 			mt.(*LTable).RawSetString("__index", mt)
 		}
 	}
@@ -577,7 +627,7 @@ func baseToNumber(L *LState) int {
 	noBase := L.Get(2) == LNil
 
 	switch lv := L.CheckAny(1).(type) {
-	case LNumber:
+	case LNumber, LInteger:
 		L.Push(lv)
 	case LString:
 		str := strings.Trim(string(lv), " \n\t")
@@ -598,7 +648,7 @@ func baseToNumber(L *LState) int {
 			if v, err := strconv.ParseInt(str, base, LNumberBit); err != nil {
 				L.Push(LNil)
 			} else {
-				L.Push(LNumber(v))
+				L.Push(LInteger(v))
 			}
 		}
 	default:
@@ -625,6 +675,9 @@ func baseXPCall(L *LState) int {
 	top := L.GetTop()
 	L.Push(fn)
 	if err := L.PCall(0, MultRet, errfunc); err != nil {
+		if isBudgetError(err) {
+			panic(err)
+		}
 		L.Push(LFalse)
 		if aerr, ok := err.(*ApiError); ok {
 			L.Push(aerr.Object)
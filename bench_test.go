@@ -0,0 +1,128 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+const benchFibScript = `
+local func fib(n) {
+	if n < 2 { return n }
+	return fib(n - 1) + fib(n - 2)
+}
+return fib(20)
+`
+
+const benchTableChurnScript = `
+local sum = 0
+for i = 1, 2000 {
+	local t = {id = i, name = "item", tags = {}}
+	t.count = i * 2
+	t.tags[1] = t.name
+	sum = sum + t.id + t.count + #t.tags
+}
+return sum
+`
+
+const benchStringBuildingScript = `
+local parts = {}
+for i = 1, 1000 {
+	parts[#parts + 1] = "k" .. i .. "=" .. ` + "`${i * 2};`" + `
+}
+local s = tbllib.Concat(parts)
+return #s
+`
+
+const benchMethodDispatchScript = `
+local Counter = {}
+Counter.__index = Counter
+func Counter.new() { return SetMetatable({n = 0}, Counter) }
+func Counter:inc() { self.n = self.n + 1 }
+func Counter:get() { return self.n }
+local c = Counter.new()
+for i = 1, 5000 {
+	c:inc()
+	if c:get() == -1 { break }
+}
+return c:get()
+`
+
+func benchmarkScript(b *testing.B, src string) {
+	L := NewState()
+	defer L.Close()
+	fn, err := L.Load(strings.NewReader(src), "<bench>")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		L.Push(fn)
+		if err := L.PCall(0, 1, nil); err != nil {
+			b.Fatal(err)
+		}
+		L.Pop(1)
+	}
+}
+
+func BenchmarkFib(b *testing.B)            { benchmarkScript(b, benchFibScript) }
+func BenchmarkTableChurn(b *testing.B)     { benchmarkScript(b, benchTableChurnScript) }
+func BenchmarkStringBuilding(b *testing.B) { benchmarkScript(b, benchStringBuildingScript) }
+func BenchmarkMethodDispatch(b *testing.B) { benchmarkScript(b, benchMethodDispatchScript) }
+
+func TestBenchmarkScripts(t *testing.T) {
+	for src, expected := range map[string]LValue{
+		benchFibScript:            LInteger(6765),
+		benchTableChurnScript:     LInteger(6005000),
+		benchStringBuildingScript: LInteger(9341),
+		benchMethodDispatchScript: LInteger(5000),
+	} {
+		L := NewState()
+		if err := L.DoString(src); err != nil {
+			t.Fatal(err)
+		}
+		if result := L.Get(-1); result != expected {
+			t.Errorf("expected %v, got %v\n%s", expected, result, src)
+		}
+		L.Close()
+	}
+}
+
+func TestInlineCacheInvalidation(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local func get(t) { return t.x }
+		local func set(t, v) { t.x = v }
+		local results = {}
+		local func add(v) { results[#results + 1] = ToString(v) }
+
+		local a, b = {x = 1}, {x = 2}
+		add(get(a)) add(get(b)) add(get(a))
+		set(a, 3) add(get(a))
+		a.x = nil add(get(a))
+
+		local base = {x = "base"}
+		local o = SetMetatable({}, {__index = base})
+		add(get(o))
+		base.x = "changed" add(get(o))
+		o.x = "own" add(get(o))
+		o.x = nil
+		GetMetatable(o).__index = {x = "other"} add(get(o))
+		GetMetatable(o).__index = func(t, k) { return "func" } add(get(o))
+
+		local log = {}
+		local p = SetMetatable({}, {__newindex = func(t, k, v) { log[#log + 1] = k }})
+		set(p, 1) set(p, 2)
+		add(#log .. ":" .. ToString(RawGet(p, "x")))
+
+		g = 1
+		local func bump() { g = g + 1 }
+		bump() bump() add(g)
+		result = tbllib.Concat(results, ",")
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if result := L.GetGlobal("result").String(); result != "1,2,1,3,nil,base,changed,own,other,func,2:nil,3" {
+		t.Errorf("unexpected result %q", result)
+	}
+}
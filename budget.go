@@ -0,0 +1,127 @@
+package lua
+
+import (
+	"fmt"
+	"time"
+)
+
+/* execution budget {{{ */
+
+// BudgetErrorPrefix is the prefix of the error message raised when an execution budget is exhausted.
+const BudgetErrorPrefix = "budget exceeded: "
+
+// Number of instructions executed between two checks of the wall clock.
+const budgetClockInterval = 1024
+
+// execBudget limits the number of VM instructions and the wall-clock time a call may use.
+type execBudget struct {
+	used     int64
+	steps    int64
+	deadline time.Time
+	expired  bool
+	reason   string
+}
+
+// newExecBudget creates a budget of steps instructions and timeout, both 0 for no limit.
+// The budget never exceeds what is left of the outer budget.
+func newExecBudget(steps int64, timeout time.Duration, outer *execBudget) *execBudget {
+	b := &execBudget{steps: steps}
+	if timeout > 0 {
+		b.deadline = time.Now().Add(timeout)
+	}
+	if outer != nil {
+		if outer.steps > 0 {
+			left := max(outer.steps-outer.used, 1)
+			if b.steps <= 0 || left < b.steps {
+				b.steps = left
+			}
+		}
+		if !outer.deadline.IsZero() && (b.deadline.IsZero() || outer.deadline.Before(b.deadline)) {
+			b.deadline = outer.deadline
+		}
+	}
+	return b
+}
+
+func (b *execBudget) step(L *LState) {
+	b.used++
+	if b.expired {
+		L.raiseBudgetError(b.reason)
+	}
+	if b.steps > 0 && b.used > b.steps {
+		b.expire(L, fmt.Sprintf("instruction limit of %d reached", b.steps))
+	}
+	if b.used%budgetClockInterval == 0 && !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		b.expire(L, "time limit reached")
+	}
+}
+
+func (b *execBudget) expire(L *LState, reason string) {
+	b.expired = true
+	b.reason = reason
+	L.raiseBudgetError(reason)
+}
+
+// raiseBudgetError raises an ApiErrorBudget error. Once a budget is exhausted, every following instruction
+// raises the error again, so scripts can not recover from it with pcall.
+func (ls *LState) raiseBudgetError(reason string) {
+	if !ls.hasErrorFunc {
+		ls.closeAllUpvalues()
+	}
+	err := &ApiError{ApiErrorBudget, LString(BudgetErrorPrefix + reason), "", nil}
+	err.StackTrace = ls.stackTrace(0)
+	panic(err)
+}
+
+func isBudgetError(err error) bool {
+	apiErr, ok := err.(*ApiError)
+	return ok && apiErr.Type == ApiErrorBudget
+}
+
+// CallWithBudget calls fn with the nargs arguments on the top of the stack in protected mode, like PCall.
+// The call fails with an ApiErrorBudget error once it has executed more than steps VM instructions or
+// has run longer than timeout; 0 disables the respective limit. Coroutines resumed by fn share the budget.
+// The budget is nested in Options.InstructionLimit and in the budget of an outer CallWithBudget.
+//
+// The timeout is checked by the VM only, Go functions blocking for a long time should be bounded with SetContext.
+func (ls *LState) CallWithBudget(fn LValue, nargs, nret int, steps int64, timeout time.Duration) error {
+	ls.Insert(fn, ls.GetTop()-nargs+1)
+	outer := ls.budget
+	b := newExecBudget(steps, timeout, outer)
+	ls.setBudget(b)
+	defer func() {
+		if outer != nil {
+			outer.used += b.used
+		}
+		ls.setBudget(outer)
+	}()
+	return ls.PCall(nargs, nret, nil)
+}
+
+// InstructionCount returns the number of VM instructions executed under the current budget,
+// or 0 if neither Options.InstructionLimit nor CallWithBudget is in effect.
+func (ls *LState) InstructionCount() int64 {
+	if ls.budget == nil {
+		return 0
+	}
+	return ls.budget.used
+}
+
+func (ls *LState) setBudget(b *execBudget) {
+	ls.budget = b
+	ls.updateMainLoop()
+}
+
+// updateMainLoop selects the VM loop according to the context, the budget and the hook of this LState.
+func (ls *LState) updateMainLoop() {
+	switch {
+	case ls.budget != nil || ls.hook != nil:
+		ls.mainLoop = mainLoopWithHooks
+	case ls.ctx != nil:
+		ls.mainLoop = mainLoopWithContext
+	default:
+		ls.mainLoop = mainLoop
+	}
+}
+
+/* }}} */
@@ -0,0 +1,362 @@
+package lua
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+/* bytecode {{{ */
+
+// BytecodeSignature is the signature at the start of precompiled MilkLua chunks.
+const BytecodeSignature = "\x1bMLK"
+
+// BytecodeVersion is the version of the bytecode format. Chunks of other versions are rejected.
+const BytecodeVersion = 3
+
+// BytecodeExt is the file extension of precompiled MilkLua chunks.
+const BytecodeExt = ".mlkc"
+
+// The header is the signature, the format version, the number of opcodes and the size of LNumber.
+// Chunks compiled with a different instruction set are rejected, as the opcode numbers may differ.
+const bytecodeHeaderSize = len(BytecodeSignature) + 3
+
+// constant tags
+const (
+	bcConstNil byte = iota
+	bcConstFalse
+	bcConstTrue
+	bcConstNumber
+	bcConstString
+	bcConstInteger
+)
+
+var (
+	ErrBytecodeHeader   = errors.New("bytecode: not a precompiled chunk")
+	ErrBytecodeChecksum = errors.New("bytecode: checksum mismatch")
+	ErrBytecodeFormat   = errors.New("bytecode: malformed chunk")
+)
+
+func bytecodeHeader() []byte {
+	header := []byte(BytecodeSignature)
+	return append(header, BytecodeVersion, byte(opCodeMax+1), LNumberBit/8)
+}
+
+// DumpProto writes proto and its nested prototypes to w in the versioned bytecode format.
+// The chunk ends with a CRC-32 checksum of everything before it.
+func DumpProto(w io.Writer, proto *FunctionProto) error {
+	buf := bytecodeHeader()
+	buf, err := appendProto(buf, proto)
+	if err != nil {
+		return err
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	_, err = w.Write(buf)
+	return err
+}
+
+// LoadProto reads a chunk written by DumpProto from r. It fails if the chunk was written by another
+// version of the format or instruction set, or if the checksum does not match.
+// The bytecode is not verified otherwise and must come from a trusted source.
+func LoadProto(r io.Reader) (*FunctionProto, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < bytecodeHeaderSize+4 || string(data[:len(BytecodeSignature)]) != BytecodeSignature {
+		return nil, ErrBytecodeHeader
+	}
+	header := bytecodeHeader()
+	if !bytes.Equal(data[:bytecodeHeaderSize], header) {
+		return nil, fmt.Errorf("bytecode: version mismatch, got format %d with %d opcodes and %d-byte numbers, want format %d with %d opcodes and %d-byte numbers",
+			data[4], data[5], data[6], header[4], header[5], header[6])
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, ErrBytecodeChecksum
+	}
+	d := &protoDecoder{r: bytes.NewReader(body[bytecodeHeaderSize:])}
+	proto := d.proto()
+	if d.err == nil && d.r.Len() != 0 {
+		d.err = ErrBytecodeFormat
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return proto, nil
+}
+
+// isBytecode reports whether the reader starts with the bytecode signature.
+func isBytecode(reader *bufio.Reader) bool {
+	sig, _ := reader.Peek(len(BytecodeSignature))
+	return string(sig) == BytecodeSignature
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// appendConstant appends a constant or a key of a switch table, which are nil, booleans, numbers or strings.
+func appendConstant(buf []byte, cv LValue) ([]byte, error) {
+	switch v := cv.(type) {
+	case *LNilType:
+		buf = append(buf, bcConstNil)
+	case LBool:
+		if v {
+			buf = append(buf, bcConstTrue)
+		} else {
+			buf = append(buf, bcConstFalse)
+		}
+	case LNumber:
+		buf = append(buf, bcConstNumber)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(float64(v)))
+	case LInteger:
+		buf = append(buf, bcConstInteger)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(v))
+	case LString:
+		buf = append(buf, bcConstString)
+		buf = appendString(buf, string(v))
+	default:
+		return nil, fmt.Errorf("bytecode: can not dump constant of type %s", cv.Type().String())
+	}
+	return buf, nil
+}
+
+func appendProto(buf []byte, proto *FunctionProto) ([]byte, error) {
+	buf = appendString(buf, proto.SourceName)
+	buf = binary.AppendVarint(buf, int64(proto.LineDefined))
+	buf = binary.AppendVarint(buf, int64(proto.LastLineDefined))
+	buf = append(buf, proto.NumUpvalues, proto.NumParameters, proto.IsVarArg, proto.NumUsedRegisters)
+
+	buf = binary.AppendUvarint(buf, uint64(len(proto.Code)))
+	for _, inst := range proto.Code {
+		buf = binary.LittleEndian.AppendUint32(buf, inst)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(proto.Constants)))
+	for _, cv := range proto.Constants {
+		var err error
+		if buf, err = appendConstant(buf, cv); err != nil {
+			return nil, err
+		}
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(proto.SwitchTables)))
+	for _, st := range proto.SwitchTables {
+		buf = binary.AppendUvarint(buf, uint64(len(st.Keys)))
+		for i, key := range st.Keys {
+			var err error
+			if buf, err = appendConstant(buf, key); err != nil {
+				return nil, err
+			}
+			buf = binary.AppendVarint(buf, int64(st.Jumps[i]))
+		}
+		for _, jump := range st.TypeJumps {
+			buf = binary.AppendVarint(buf, int64(jump))
+		}
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(proto.FunctionPrototypes)))
+	for _, child := range proto.FunctionPrototypes {
+		var err error
+		if buf, err = appendProto(buf, child); err != nil {
+			return nil, err
+		}
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(proto.DbgSourcePositions)))
+	for _, line := range proto.DbgSourcePositions {
+		buf = binary.AppendVarint(buf, int64(line))
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(proto.DbgLocals)))
+	for _, local := range proto.DbgLocals {
+		buf = appendString(buf, local.Name)
+		buf = binary.AppendVarint(buf, int64(local.StartPc))
+		buf = binary.AppendVarint(buf, int64(local.EndPc))
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(proto.DbgCalls)))
+	for _, call := range proto.DbgCalls {
+		buf = appendString(buf, call.Name)
+		buf = binary.AppendVarint(buf, int64(call.Pc))
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(proto.DbgUpvalues)))
+	for _, name := range proto.DbgUpvalues {
+		buf = appendString(buf, name)
+	}
+	return buf, nil
+}
+
+// protoDecoder decodes prototypes, remembering the first error. Once an error occurs all reads return zero values.
+type protoDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *protoDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *protoDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		d.fail(ErrBytecodeFormat)
+	}
+	return b
+}
+
+func (d *protoDecoder) uint32() uint32 {
+	var b [4]byte
+	if d.err == nil {
+		if _, err := io.ReadFull(d.r, b[:]); err != nil {
+			d.fail(ErrBytecodeFormat)
+		}
+	}
+	return binary.LittleEndian.Uint32(b[:])
+}
+
+func (d *protoDecoder) uint64() uint64 {
+	var b [8]byte
+	if d.err == nil {
+		if _, err := io.ReadFull(d.r, b[:]); err != nil {
+			d.fail(ErrBytecodeFormat)
+		}
+	}
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (d *protoDecoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(ErrBytecodeFormat)
+	}
+	return int(v)
+}
+
+// length reads a count, which can not be larger than the remaining bytes.
+func (d *protoDecoder) length() int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil || v > uint64(d.r.Len()) {
+		d.fail(ErrBytecodeFormat)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *protoDecoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	io.ReadFull(d.r, b)
+	return string(b)
+}
+
+func (d *protoDecoder) constant() LValue {
+	switch tag := d.byte(); tag {
+	case bcConstNil:
+		return LNil
+	case bcConstFalse:
+		return LFalse
+	case bcConstTrue:
+		return LTrue
+	case bcConstNumber:
+		return LNumber(math.Float64frombits(d.uint64()))
+	case bcConstInteger:
+		return LInteger(d.uint64())
+	case bcConstString:
+		return LString(d.string())
+	default:
+		d.fail(ErrBytecodeFormat)
+		return LNil
+	}
+}
+
+func (d *protoDecoder) proto() *FunctionProto {
+	proto := newFunctionProto(d.string())
+	proto.LineDefined = d.int()
+	proto.LastLineDefined = d.int()
+	proto.NumUpvalues = d.byte()
+	proto.NumParameters = d.byte()
+	proto.IsVarArg = d.byte()
+	proto.NumUsedRegisters = d.byte()
+
+	proto.Code = make([]uint32, d.length())
+	for i := range proto.Code {
+		proto.Code[i] = d.uint32()
+	}
+
+	proto.Constants = make([]LValue, d.length())
+	proto.stringConstants = make([]string, len(proto.Constants))
+	for i := range proto.Constants {
+		proto.Constants[i] = d.constant()
+		if s, ok := proto.Constants[i].(LString); ok {
+			proto.stringConstants[i] = string(s)
+		}
+	}
+
+	if n := d.length(); n > 0 {
+		proto.SwitchTables = make([]*SwitchTable, n)
+	}
+	for i := range proto.SwitchTables {
+		st := &SwitchTable{Keys: make([]LValue, d.length())}
+		st.Jumps = make([]int, len(st.Keys))
+		for j := range st.Keys {
+			st.Keys[j] = d.constant()
+			st.Jumps[j] = d.int()
+		}
+		for j := range st.TypeJumps {
+			st.TypeJumps[j] = d.int()
+		}
+		proto.SwitchTables[i] = st
+	}
+
+	proto.FunctionPrototypes = make([]*FunctionProto, d.length())
+	for i := range proto.FunctionPrototypes {
+		proto.FunctionPrototypes[i] = d.proto()
+	}
+
+	proto.DbgSourcePositions = make([]int, d.length())
+	for i := range proto.DbgSourcePositions {
+		proto.DbgSourcePositions[i] = d.int()
+	}
+	proto.DbgLocals = make([]*DbgLocalInfo, d.length())
+	for i := range proto.DbgLocals {
+		proto.DbgLocals[i] = &DbgLocalInfo{Name: d.string(), StartPc: d.int(), EndPc: d.int()}
+	}
+	proto.DbgCalls = make([]DbgCall, d.length())
+	for i := range proto.DbgCalls {
+		proto.DbgCalls[i] = DbgCall{Name: d.string(), Pc: d.int()}
+	}
+	proto.DbgUpvalues = make([]string, d.length())
+	for i := range proto.DbgUpvalues {
+		proto.DbgUpvalues[i] = d.string()
+	}
+
+	if d.err == nil && (len(proto.DbgSourcePositions) != len(proto.Code) || int(proto.NumUpvalues) != len(proto.DbgUpvalues)) {
+		d.fail(ErrBytecodeFormat)
+	}
+	if d.err == nil {
+		proto.quicken()
+	}
+	return proto
+}
+
+/* }}} */
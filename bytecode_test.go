@@ -0,0 +1,171 @@
+package lua
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const bytecodeTestScript = `
+local prefix = "n="
+local func counter(start) {
+	local n = start
+	return func(step) {
+		n = n + step
+		return prefix .. n
+	}
+}
+local c = counter(1.5)
+c(2)
+local flags = (1 | 4) & 5
+local shifted = 1 << 3
+local v = (10).(number)
+return c(0.5), flags, shifted, v, nil, true, false
+`
+
+func compileTestProto(t *testing.T, L *LState, src string) *FunctionProto {
+	t.Helper()
+	fn, err := L.Load(strings.NewReader(src), "<test>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fn.Proto
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	proto := compileTestProto(t, L, bytecodeTestScript)
+
+	var buf bytes.Buffer
+	if err := DumpProto(&buf, proto); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadProto(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(proto, loaded) {
+		t.Fatalf("loaded prototype differs from the dumped one:\n%v\n%v", proto, loaded)
+	}
+
+	L.Push(L.NewFunctionFromProto(loaded))
+	if err := L.PCall(0, MultRet, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []LValue{LString("n=4"), LInteger(5), LInteger(8), LInteger(10), LNil, LTrue, LFalse}
+	if top := L.GetTop(); top != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), top)
+	}
+	for i, want := range expected {
+		if got := L.Get(i + 1); got != want {
+			t.Errorf("result %d: expected %v, got %v", i+1, want, got)
+		}
+	}
+}
+
+func TestBytecodeSwitchTables(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	proto := compileTestProto(t, L, `
+		local func kind(v) {
+			switch v {
+				case 1, 2, 3 { return "small" }
+				case 8, 9.0, -1 { return "large" }
+				case "x", true { return "key" }
+				case table, function { return "object" }
+				default { return "other" }
+			}
+		}
+		local kinds = {}
+		for _, v in IPairs({2, 9, -1, "x", true, {}, kind, 5, "y", 2.5}) { kinds[#kinds + 1] = kind(v) }
+		return tbllib.Concat(kinds, ",")
+	`)
+	if len(proto.FunctionPrototypes) != 1 || len(proto.FunctionPrototypes[0].SwitchTables) != 1 {
+		t.Fatal("expected a switch table in the nested function")
+	}
+
+	var buf bytes.Buffer
+	if err := DumpProto(&buf, proto); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadProto(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(proto, loaded) {
+		t.Fatalf("loaded prototype differs from the dumped one:\n%v\n%v", proto, loaded)
+	}
+
+	L.Push(L.NewFunctionFromProto(loaded))
+	if err := L.PCall(0, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if result := L.Get(-1).String(); result != "small,large,large,key,key,object,object,other,other,other" {
+		t.Errorf("unexpected result %q", result)
+	}
+}
+
+func TestBytecodeRejectsBadChunks(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	var buf bytes.Buffer
+	if err := DumpProto(&buf, compileTestProto(t, L, bytecodeTestScript)); err != nil {
+		t.Fatal(err)
+	}
+	chunk := buf.Bytes()
+	corrupt := func(i int, b byte) []byte {
+		data := append([]byte(nil), chunk...)
+		data[i] = b
+		return data
+	}
+
+	if _, err := LoadProto(strings.NewReader("return 1")); err != ErrBytecodeHeader {
+		t.Errorf("expected ErrBytecodeHeader for source code, got %v", err)
+	}
+	if _, err := LoadProto(bytes.NewReader(corrupt(len(BytecodeSignature), BytecodeVersion+1))); err == nil || !strings.Contains(err.Error(), "version mismatch") {
+		t.Errorf("expected a version mismatch, got %v", err)
+	}
+	if _, err := LoadProto(bytes.NewReader(corrupt(len(BytecodeSignature)+1, byte(opCodeMax)))); err == nil || !strings.Contains(err.Error(), "version mismatch") {
+		t.Errorf("expected a version mismatch for a different instruction set, got %v", err)
+	}
+	last := len(chunk) - 5
+	if _, err := LoadProto(bytes.NewReader(corrupt(last, chunk[last]^0xff))); !errors.Is(err, ErrBytecodeChecksum) {
+		t.Errorf("expected ErrBytecodeChecksum, got %v", err)
+	}
+}
+
+func TestLoadBytecodeFile(t *testing.T) {
+	dir := t.TempDir()
+	L := NewState()
+	defer L.Close()
+
+	var buf bytes.Buffer
+	if err := DumpProto(&buf, compileTestProto(t, L, `return {Double = func(x) { return x * 2 }}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "double"+BytecodeExt), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken"+BytecodeExt), buf.Bytes()[:buf.Len()-1], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := L.DoFile(filepath.Join(dir, "double"+BytecodeExt)); err != nil {
+		t.Fatal(err)
+	}
+	L.SetField(L.GetGlobal("pkglib"), "path", LString(filepath.Join(dir, "?"+BytecodeExt)))
+	if err := L.DoString(`result = Require("double").Double(21)`); err != nil {
+		t.Fatal(err)
+	}
+	if result := L.GetGlobal("result"); result != LInteger(42) {
+		t.Errorf("unexpected result %v", result)
+	}
+	if err := L.DoFile(filepath.Join(dir, "broken"+BytecodeExt)); err == nil {
+		t.Error("loading a truncated chunk should fail")
+	}
+}
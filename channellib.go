@@ -80,6 +80,13 @@ func channelSelect(L *LState) int {
 			cas.Send = reflect.ValueOf(v)
 		case "|<-":
 			ch, ok := tbl.RawGetInt(2).(LChannel)
+			if !ok {
+				// websocket 连接可以直接作为接收分支
+				var ws *wsConn
+				if ws, ok = toWsConn(tbl.RawGetInt(2)); ok {
+					ch = ws.channel()
+				}
+			}
 			if !ok {
 				L.ArgError(i+1, "invalid select case")
 			}
@@ -101,9 +108,20 @@ func channelSelect(L *LState) int {
 		})
 	}
 
+	for _, cas := range cases {
+		if cas.Dir == reflect.SelectSend {
+			holdChannelValue(cas.Send.Interface().(LValue))
+		}
+	}
 	pos, recv, rok := reflect.Select(cases)
+	for i, cas := range cases {
+		if cas.Dir == reflect.SelectSend && i != pos {
+			releaseChannelValue(cas.Send.Interface().(LValue))
+		}
+	}
 
 	if L.ctx != nil && pos == top {
+		L.CheckContext()
 		return 0
 	}
 
@@ -113,6 +131,7 @@ func channelSelect(L *LState) int {
 		if lv == nil {
 			lv = LNil
 		}
+		releaseChannelValue(lv)
 	}
 	tbl := L.Get(pos + 1).(*LTable)
 	last := tbl.RawGetInt(tbl.Len())
@@ -134,7 +153,7 @@ func channelSelect(L *LState) int {
 			L.Call(0, 0)
 		}
 	}
-	L.Push(LNumber(pos + 1))
+	L.Push(LInteger(pos + 1))
 	L.Push(lv)
 	if rok {
 		L.Push(LTrue)
@@ -164,13 +183,19 @@ func channelReceive(L *LState) int {
 			Chan: rch,
 			Send: reflect.ValueOf(nil),
 		}}
-		_, v, ok = reflect.Select(cases)
+		var chosen int
+		chosen, v, ok = reflect.Select(cases)
+		if chosen == 0 {
+			L.CheckContext()
+		}
 	} else {
 		v, ok = rch.Recv()
 	}
 	if ok {
+		lv := v.Interface().(LValue)
+		releaseChannelValue(lv)
 		L.Push(LTrue)
-		L.Push(v.Interface().(LValue))
+		L.Push(lv)
 	} else {
 		L.Push(LFalse)
 		L.Push(LNil)
@@ -181,6 +206,24 @@ func channelReceive(L *LState) int {
 func channelSend(L *LState) int {
 	rch := checkChannel(L, 1)
 	v := checkGoroutineSafe(L, 2)
+	if L.ctx != nil {
+		cases := []reflect.SelectCase{{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(L.ctx.Done()),
+			Send: reflect.ValueOf(nil),
+		}, {
+			Dir:  reflect.SelectSend,
+			Chan: rch,
+			Send: reflect.ValueOf(v),
+		}}
+		holdChannelValue(v)
+		if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+			releaseChannelValue(v)
+			L.CheckContext()
+		}
+		return 0
+	}
+	holdChannelValue(v)
 	rch.Send(reflect.ValueOf(v))
 	return 0
 }
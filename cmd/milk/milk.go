@@ -3,7 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"milklua/dap"
 	"milklua/parse"
+	"net"
 	"os"
 	"runtime/pprof"
 
@@ -17,18 +19,23 @@ func main() {
 }
 
 func mainAux() int {
-	var opt_e, opt_l, opt_p string
-	var opt_i, opt_v, opt_dt, opt_dc, opt_doc bool
+	var opt_e, opt_l, opt_p, opt_o, opt_dap string
+	var opt_i, opt_v, opt_dt, opt_dc, opt_doc, opt_check, opt_strict, opt_noopt bool
 	var opt_m int
 	flag.StringVar(&opt_e, "e", "", "")
 	flag.StringVar(&opt_l, "l", "", "")
 	flag.StringVar(&opt_p, "p", "", "")
+	flag.StringVar(&opt_o, "o", "", "")
+	flag.StringVar(&opt_dap, "dap", "", "")
 	flag.IntVar(&opt_m, "mx", 0, "")
 	flag.BoolVar(&opt_i, "i", false, "")
 	flag.BoolVar(&opt_v, "v", false, "")
 	flag.BoolVar(&opt_dt, "dt", false, "")
 	flag.BoolVar(&opt_dc, "dc", false, "")
 	flag.BoolVar(&opt_doc, "doc", false, "")
+	flag.BoolVar(&opt_check, "check", false, "")
+	flag.BoolVar(&opt_strict, "strict", false, "")
+	flag.BoolVar(&opt_noopt, "noopt", false, "")
 	flag.Usage = func() {
 		fmt.Println(`Usage: milk [options] [script [args]].
 Available options are:
@@ -37,8 +44,13 @@ Available options are:
   -mx MB   memory limit(default: unlimited)
   -dt      dump AST trees
   -dc      dump VM codes
+  -o file  compile 'script' to the bytecode file instead of running it
+  -check   check the type annotations of 'script' instead of running it
+  -strict  raise an error when a type assertion fails
+  -noopt   compile without folding constants and removing dead code
   -i       enter interactive mode after executing 'script'
   -p file  write cpu profiles to the file
+  -dap addr  debug 'script' with a debug adapter (DAP) client connecting to addr
   -v       show version information
   -doc     show document of standard libraries`)
 	}
@@ -52,7 +64,7 @@ Available options are:
 		pprof.StartCPUProfile(f)
 		defer pprof.StopCPUProfile()
 	}
-	if len(opt_e) == 0 && !opt_i && !opt_v && flag.NArg() == 0 {
+	if len(opt_e) == 0 && !opt_i && !opt_v && len(opt_dap) == 0 && flag.NArg() == 0 {
 		opt_i = true
 	}
 	if opt_doc {
@@ -62,7 +74,7 @@ Available options are:
 
 	status := 0
 
-	L := lua.NewState()
+	L := lua.NewState(lua.Options{StrictTypes: opt_strict, SkipOptimization: opt_noopt})
 	defer L.Close()
 	if opt_m > 0 {
 		L.SetMx(opt_m)
@@ -82,9 +94,12 @@ Available options are:
 		script := flag.Arg(0)
 		argtb := L.NewTable()
 		for i := 1; i < nargs; i++ {
-			L.RawSet(argtb, lua.LNumber(i), lua.LString(flag.Arg(i)))
+			L.RawSet(argtb, lua.LInteger(i), lua.LString(flag.Arg(i)))
 		}
 		L.SetGlobal("arg", argtb)
+		if len(opt_dap) > 0 {
+			return serveDAP(L, opt_dap, script)
+		}
 		if opt_dt || opt_dc {
 			file, err := os.Open(script)
 			if err != nil {
@@ -100,6 +115,9 @@ Available options are:
 				fmt.Println(parse.Dump(chunk))
 			}
 			if opt_dc {
+				if !opt_noopt {
+					chunk = lua.Optimize(chunk)
+				}
 				proto, err3 := lua.Compile(chunk, script)
 				if err3 != nil {
 					fmt.Println(err3.Error())
@@ -108,12 +126,22 @@ Available options are:
 				fmt.Println(proto.String())
 			}
 		}
+		if opt_check {
+			return checkFile(script)
+		}
+		if len(opt_o) > 0 {
+			return compileFile(script, opt_o, !opt_noopt)
+		}
 		if err := L.DoFile(script); err != nil {
 			fmt.Println(err.Error())
 			status = 1
 		}
 	}
 
+	if len(opt_dap) > 0 {
+		return serveDAP(L, opt_dap, "")
+	}
+
 	if len(opt_e) > 0 {
 		if err := L.DoString(opt_e); err != nil {
 			fmt.Println(err.Error())
@@ -127,6 +155,83 @@ Available options are:
 	return status
 }
 
+// compile the script to a precompiled chunk
+func compileFile(script, out string, optimize bool) int {
+	file, err := os.Open(script)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	defer file.Close()
+	chunk, err := parse.Parse(file, script)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	if optimize {
+		chunk = lua.Optimize(chunk)
+	}
+	proto, err := lua.Compile(chunk, script)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	outfile, err := os.Create(out)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	if err := lua.DumpProto(outfile, proto); err != nil {
+		outfile.Close()
+		fmt.Println(err.Error())
+		return 1
+	}
+	if err := outfile.Close(); err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	return 0
+}
+
+// report the type errors of the script
+func checkFile(script string) int {
+	file, err := os.Open(script)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	defer file.Close()
+	chunk, err := parse.Parse(file, script)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	errs := lua.CheckTypes(chunk, script)
+	for _, err := range errs {
+		fmt.Println(err.Error())
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// run a debug adapter server for a single client
+func serveDAP(L *lua.LState, addr, script string) int {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	defer ln.Close()
+	fmt.Printf("debug adapter listening on %s\n", ln.Addr())
+	if err := dap.NewServer(L, script).Serve(ln); err != nil {
+		fmt.Println(err.Error())
+		return 1
+	}
+	return 0
+}
+
 // do read/eval/print/loop
 func doREPL(L *lua.LState) {
 	rl, err := readline.New("> ")
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"math"
 	"reflect"
-	"strconv"
 	"unicode/utf8"
 
 	"milklua/ast"
@@ -37,6 +36,8 @@ var typeKindToName = map[string]int{
 	"channel":  7,
 }
 
+var typeKindNames = [...]string{"bool", "number", "string", "table", "function", "userdata", "thread", "channel"}
+
 const regNotDefined = opMaxArgsA + 1
 const labelNoJump = 0
 
@@ -64,6 +65,7 @@ type lblabels struct {
 	b bool
 }
 
+// constLValueExpr is a folded number constant.
 type constLValueExpr struct {
 	ast.ExprBase
 
@@ -137,17 +139,72 @@ func isVarArgReturnExpr(expr ast.Expr) bool {
 	return false
 }
 
-func lnumberValue(expr ast.Expr) (LNumber, bool) {
+// lnumberValue returns the value of a constant number expression, an LInteger or an LNumber.
+func lnumberValue(expr ast.Expr) (LValue, bool) {
 	if ex, ok := expr.(*ast.NumberExpr); ok {
-		lv, err := parseNumber(ex.Value)
+		lv, err := parseNumberValue(ex.Value)
 		if err != nil {
 			lv = LNumber(math.NaN())
 		}
 		return lv, true
-	} else if ex, ok := expr.(*constLValueExpr); ok {
-		return ex.Value.(LNumber), true
+	} else if ex, ok := expr.(*constLValueExpr); ok && ex.Value.Type() == LTNumber {
+		return ex.Value, true
+	}
+	return nil, false
+}
+
+var arithOpcodes = map[string]int{
+	"+":  OP_ADD,
+	"-":  OP_SUB,
+	"*":  OP_MUL,
+	"/":  OP_DIV,
+	"%":  OP_MOD,
+	"^":  OP_POW,
+	"~/": OP_IDIV,
+}
+
+// foldArith evaluates an arithmetic operation on two constant numbers.
+// Divisions by zero are left to the runtime.
+func foldArith(operator string, lhs, rhs LValue) (LValue, bool) {
+	opcode, ok := arithOpcodes[operator]
+	if !ok {
+		panic(fmt.Sprintf("unknown binop: %v", operator))
+	}
+	if (opcode == OP_DIV || opcode == OP_MOD || opcode == OP_IDIV) && LVAsNumber(rhs) == 0 {
+		return nil, false
+	}
+	return arithNumbers(nil, opcode, lhs, rhs), true
+}
+
+// foldBitwise evaluates a bitwise operation on two constant numbers.
+// Operands without an integer representation are left to the runtime, which raises an error.
+func foldBitwise(operator string, lhs, rhs LValue) (LValue, bool) {
+	lvalue, lok := LVAsInteger(lhs)
+	rvalue, rok := LVAsInteger(rhs)
+	if !lok || !rok {
+		return nil, false
+	}
+	switch operator {
+	case "&":
+		return lvalue & rvalue, true
+	case "|":
+		return lvalue | rvalue, true
+	case "~":
+		return lvalue ^ rvalue, true
+	case "<<":
+		return shiftLeft(lvalue, rvalue), true
+	case ">>":
+		return shiftLeft(lvalue, -rvalue), true
+	}
+	return nil, false
+}
+
+// foldNegate negates a constant number.
+func foldNegate(value LValue) LValue {
+	if iv, ok := value.(LInteger); ok {
+		return -iv
 	}
-	return 0, false
+	return -value.(LNumber)
 }
 
 /* utilities }}} */
@@ -158,6 +215,8 @@ type gotoLabelDesc struct { // {{{
 	Pc                 int
 	Line               int
 	NumActiveLocalVars int
+	// pc of the RUNDEFER of a goto, -1 if it has none
+	DeferPc int
 }
 
 func newLabelDesc(id int, name string, pc, line, n int) *gotoLabelDesc {
@@ -167,6 +226,7 @@ func newLabelDesc(id int, name string, pc, line, n int) *gotoLabelDesc {
 		Pc:                 pc,
 		Line:               line,
 		NumActiveLocalVars: n,
+		DeferPc:            -1,
 	}
 }
 
@@ -188,6 +248,9 @@ type codeStore struct { // {{{
 	codes []uint32
 	lines []int
 	pc    int
+	// the instructions before fixed are followed by the target of a jump, so they can not be merged
+	// with the next instruction
+	fixed int
 }
 
 func (cd *codeStore) Add(inst uint32, line int) {
@@ -250,7 +313,7 @@ func (cd *codeStore) PropagateMV(top int, save *int, reg *int, inc int) {
 
 func (cd *codeStore) AddLoadNil(a, b, line int) {
 	last := cd.Last()
-	if opGetOpCode(last) == OP_LOADNIL && (opGetArgB(last)+1) == a {
+	if opGetOpCode(last) == OP_LOADNIL && opGetArgC(last) == 0 && (opGetArgB(last)+1) == a && cd.LastPC() >= cd.fixed {
 		cd.SetB(cd.LastPC(), b)
 	} else {
 		cd.AddABC(OP_LOADNIL, a, b, 0, line)
@@ -376,6 +439,11 @@ type codeBlock struct {
 	LastLine       int
 	labels         map[string]*gotoLabelDesc
 	firstGotoIndex int
+	// the label continue jumps to in the block of a loop, labelNoJump in other blocks
+	ContinueLabel int
+	// the number of locals of the block when its first continue was compiled, -1 if it has none
+	continueVars int
+	continueLine int
 }
 
 func newCodeBlock(
@@ -385,7 +453,7 @@ func newCodeBlock(
 	pos ast.PositionHolder,
 	firstGotoIndex int,
 ) *codeBlock {
-	bl := &codeBlock{localvars, blabel, parent, false, 0, 0, map[string]*gotoLabelDesc{}, firstGotoIndex}
+	bl := &codeBlock{localvars, blabel, parent, false, 0, 0, map[string]*gotoLabelDesc{}, firstGotoIndex, labelNoJump, -1, 0}
 	if pos != nil {
 		bl.LineStart = pos.Line()
 		bl.LastLine = pos.LastLine()
@@ -408,6 +476,15 @@ func (b *codeBlock) GetLabel(label string) *gotoLabelDesc {
 	return nil
 }
 
+// Depth returns the number of blocks enclosing b in its function, which is the level of its deferred calls.
+func (b *codeBlock) Depth() int {
+	depth := 0
+	for block := b.Parent; block != nil; block = block.Parent {
+		depth++
+	}
+	return depth
+}
+
 func (b *codeBlock) LocalVarsCount() int {
 	count := 0
 	for block := b; block != nil; block = block.Parent {
@@ -428,12 +505,18 @@ type funcContext struct {
 	labelPc         map[int]int
 	gotosCount      int
 	unresolvedGotos map[int]*gotoLabelDesc
+	// the function contains defer statements, so leaving a block may have to run deferred calls
+	hasDefer bool
+	// the optional chain being compiled: the label its optional indexes jump to if their object is nil,
+	// and the expression of the chain compiled next
+	chainNil  int
+	chainLink ast.Expr
 }
 
 func newFuncContext(sourcename string, parent *funcContext) *funcContext {
 	fc := &funcContext{
 		Proto:           newFunctionProto(sourcename),
-		Code:            &codeStore{make([]uint32, 0, 1024), make([]int, 0, 1024), 0},
+		Code:            &codeStore{make([]uint32, 0, 1024), make([]int, 0, 1024), 0, 0},
 		Parent:          parent,
 		Upvalues:        newVarNamePool(0),
 		Block:           newCodeBlock(newVarNamePool(0), labelNoJump, nil, nil, 0),
@@ -517,6 +600,10 @@ func (fc *funcContext) ResolveCurrentBlockGotosWithParentBlock() {
 			}
 			gotoLabel.SetNumActiveLocalVars(blockActiveLocalVars)
 		}
+		if gotoLabel.DeferPc > -1 {
+			// the goto leaves this block, so it runs the calls deferred in it
+			fc.Code.SetA(gotoLabel.DeferPc, fc.Block.Depth())
+		}
 		fc.FindLabel(fc.Block.Parent, gotoLabel, i)
 	}
 }
@@ -541,6 +628,9 @@ func (fc *funcContext) NewLabel() int {
 
 func (fc *funcContext) SetLabelPc(label int, pc int) {
 	fc.labelPc[label] = pc
+	if pc >= fc.Code.fixed {
+		fc.Code.fixed = pc + 1
+	}
 }
 
 func (fc *funcContext) GetLabelPc(label int) int {
@@ -561,6 +651,19 @@ func (fc *funcContext) ConstIndex(value LValue) int {
 	}
 	return v
 }
+
+// AddSwitchTable emits an OP_SWITCH testing the register reg with a new empty switch table.
+func (fc *funcContext) AddSwitchTable(reg int, line int) *SwitchTable {
+	table := &SwitchTable{}
+	fc.Proto.SwitchTables = append(fc.Proto.SwitchTables, table)
+	index := len(fc.Proto.SwitchTables) - 1
+	if index > opMaxArgBx {
+		raiseCompileError(fc, line, "too many switch statements")
+	}
+	fc.Code.AddABx(OP_SWITCH, reg, index, line)
+	return table
+}
+
 func (fc *funcContext) BlockLocalVarsCount() int {
 	count := 0
 	for block := fc.Block; block != nil; block = block.Parent {
@@ -603,6 +706,23 @@ func (fc *funcContext) EnterBlock(blabel int, pos ast.PositionHolder) {
 	fc.Blocks = append(fc.Blocks, fc.Block)
 }
 
+// EnterLoopBlock enters the block of the body of a loop. break jumps to blabel and continue to clabel.
+func (fc *funcContext) EnterLoopBlock(blabel, clabel int, pos ast.PositionHolder) {
+	fc.EnterBlock(blabel, pos)
+	fc.Block.ContinueLabel = clabel
+}
+
+// CloseLoopUpvalues emits the instruction closing the upvalues of the locals of the loop block, when the
+// loop is left or continued from the current block. A local declared in a block in between may be one of them.
+func (fc *funcContext) CloseLoopUpvalues(loop *codeBlock, line int) {
+	for block := fc.Block; block != loop.Parent; block = block.Parent {
+		if block.RefUpvalue {
+			fc.Code.AddABC(OP_CLOSE, loop.Parent.LocalVars.LastIndex(), 0, 0, line)
+			return
+		}
+	}
+}
+
 func (fc *funcContext) CloseUpvalues() int {
 	n := -1
 	if fc.Block.RefUpvalue {
@@ -612,6 +732,17 @@ func (fc *funcContext) CloseUpvalues() int {
 	return n
 }
 
+// RunDefers emits the instruction running the calls deferred in the blocks at depth level or deeper.
+func (fc *funcContext) RunDefers(level int, line int) {
+	if !fc.hasDefer {
+		return
+	}
+	if level > opMaxArgsA {
+		raiseCompileError(fc, line, "too many nested blocks")
+	}
+	fc.Code.AddABC(OP_RUNDEFER, level, 0, 0, line)
+}
+
 func (fc *funcContext) LeaveBlock() int {
 	closed := fc.CloseUpvalues()
 	fc.EndScope()
@@ -655,6 +786,7 @@ func compileChunk(context *funcContext, chunk []ast.Stmt, untilFollows bool) { /
 		}
 		compileStmt(context, stmt, lastStmt && !untilFollows)
 	}
+	compileBlockDefers(context, chunk)
 } // }}}
 
 func compileBlock(context *funcContext, chunk []ast.Stmt) { // {{{
@@ -676,9 +808,81 @@ func compileBlock(context *funcContext, chunk []ast.Stmt) { // {{{
 		}
 		compileStmt(context, stmt, lastStmt)
 	}
+	compileBlockDefers(context, chunk)
 	context.LeaveBlock()
 } // }}}
 
+// compileBlockDefers runs the calls deferred by the statements of chunk when the end of its block is reached.
+func compileBlockDefers(context *funcContext, chunk []ast.Stmt) { // {{{
+	for _, stmt := range chunk {
+		if _, ok := stmt.(*ast.DeferStmt); ok {
+			context.RunDefers(context.Block.Depth(), eline(chunk[len(chunk)-1]))
+			return
+		}
+	}
+} // }}}
+
+// containsDefer reports whether stmts have defer statements, directly or in nested blocks.
+// The bodies of nested functions are not searched.
+func containsDefer(stmts []ast.Stmt) bool { // {{{
+	for _, stmt := range stmts {
+		switch st := stmt.(type) {
+		case *ast.DeferStmt:
+			return true
+		case *ast.DoBlockStmt:
+			if containsDefer(st.Stmts) {
+				return true
+			}
+		case *ast.WhileStmt:
+			if containsDefer(st.Stmts) {
+				return true
+			}
+		case *ast.RepeatStmt:
+			if containsDefer(st.Stmts) {
+				return true
+			}
+		case *ast.WhileStmtWithIfThru:
+			if containsDefer(st.Stmts) || containsDefer(st.IfThruStmts) {
+				return true
+			}
+		case *ast.RepeatStmtWithIfThru:
+			if containsDefer(st.Stmts) || containsDefer(st.IfThruStmts) {
+				return true
+			}
+		case *ast.IfStmt:
+			if containsDefer(st.Then) || containsDefer(st.Else) {
+				return true
+			}
+		case *ast.NumberForStmt:
+			if containsDefer(st.Stmts) {
+				return true
+			}
+		case *ast.NumberForStmtWithIfThru:
+			if containsDefer(st.Stmts) || containsDefer(st.IfThruStmts) {
+				return true
+			}
+		case *ast.GenericForStmt:
+			if containsDefer(st.Stmts) {
+				return true
+			}
+		case *ast.GenericForStmtWithIfThru:
+			if containsDefer(st.Stmts) || containsDefer(st.IfThruStmts) {
+				return true
+			}
+		case *ast.SwitchStmt:
+			if containsDefer(st.Default) {
+				return true
+			}
+			for _, cs := range st.Cases {
+				if containsDefer(cs.Stmts) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+} // }}}
+
 func compileStmt(context *funcContext, stmt ast.Stmt, isLastStmt bool) { // {{{
 	switch st := stmt.(type) {
 	case *ast.AssignStmt:
@@ -688,15 +892,23 @@ func compileStmt(context *funcContext, stmt ast.Stmt, isLastStmt bool) { // {{{
 	case *ast.LocalAssignStmt:
 		compileLocalAssignStmt(context, st)
 	case *ast.FuncCallStmt:
-		compileFuncCallExpr(context, context.RegTop(), st.Expr.(*ast.FuncCallExpr), ecnone(-1))
+		if call := st.Expr.(*ast.FuncCallExpr); isOptionalChain(call) {
+			compileOptionalChain(context, context.RegTop(), call, ecnone(-1))
+		} else {
+			compileFuncCallExpr(context, context.RegTop(), call, ecnone(-1))
+		}
 	case *ast.DoBlockStmt:
 		context.EnterBlock(labelNoJump, st)
 		compileChunk(context, st.Stmts, false)
 		context.LeaveBlock()
 	case *ast.WhileStmt:
 		compileWhileStmt(context, st)
+	case *ast.WhileStmtWithIfThru:
+		compileWhileStmtWithIfThru(context, st)
 	case *ast.RepeatStmt:
 		compileRepeatStmt(context, st)
+	case *ast.RepeatStmtWithIfThru:
+		compileRepeatStmtWithIfThru(context, st)
 	case *ast.FuncDefStmt:
 		compileFuncDefStmt(context, st)
 	case *ast.ReturnStmt:
@@ -705,6 +917,8 @@ func compileStmt(context *funcContext, stmt ast.Stmt, isLastStmt bool) { // {{{
 		compileIfStmt(context, st)
 	case *ast.BreakStmt:
 		compileBreakStmt(context, st)
+	case *ast.ContinueStmt:
+		compileContinueStmt(context, st)
 	case *ast.NumberForStmt:
 		compileNumberForStmt(context, st)
 	case *ast.NumberForStmtWithIfThru:
@@ -717,6 +931,10 @@ func compileStmt(context *funcContext, stmt ast.Stmt, isLastStmt bool) { // {{{
 		compileLabelStmt(context, st, isLastStmt)
 	case *ast.GotoStmt:
 		compileGotoStmt(context, st)
+	case *ast.DeferStmt:
+		compileDeferStmt(context, st)
+	case *ast.SwitchStmt:
+		compileSwitchStmt(context, st)
 	}
 } // }}}
 
@@ -788,7 +1006,7 @@ func compileAssignStmtRight(context *funcContext, stmt *ast.AssignStmt, reg int,
 		idx := reg
 		reginc := compileExpr(context, reg, expr, ec)
 		if ec.ctype == ecTable {
-			if _, ok := expr.(*ast.LogicalOpExpr); !ok {
+			if !isBranchingExpr(expr) {
 				context.Code.PropagateKMV(context.RegTop(), &ac.valuerk, &reg, reginc)
 			} else {
 				ac.valuerk = idx
@@ -849,16 +1067,24 @@ func compileAssignStmt(context *funcContext, stmt *ast.AssignStmt) { // {{{
 
 func compileCompoundAssignStmt(context *funcContext, stmt *ast.CompoundAssignStmt) {
 	// convert compound assignment to normal assignment
-	// a ?= b -> a = a ? b, ? can be + - * / % ^
+	// a ?= b -> a = a ? b, ? can be + - * / % ^ ~/ & | << >>
 	opStr := stmt.Operator[:len(stmt.Operator)-1]
-	if !(opStr == "+" || opStr == "-" || opStr == "*" || opStr == "/" || opStr == "%" || opStr == "^") {
+	var rhs ast.Expr
+	if _, ok := arithOpcodes[opStr]; ok {
+		rhs = &ast.ArithmeticOpExpr{
+			Operator: opStr,
+			Lhs:      stmt.Lhs,
+			Rhs:      stmt.Rhs,
+		}
+	} else if opStr == "&" || opStr == "|" || opStr == "<<" || opStr == ">>" {
+		rhs = &ast.BitwiseOpExpr{
+			Operator: opStr,
+			Lhs:      stmt.Lhs,
+			Rhs:      stmt.Rhs,
+		}
+	} else {
 		raiseCompileError(context, sline(stmt), "invalid compound assignment operator '%s'", stmt.Operator)
 	}
-	rhs := &ast.ArithmeticOpExpr{
-		Operator: opStr,
-		Lhs:      stmt.Lhs,
-		Rhs:      stmt.Rhs,
-	}
 	assign := &ast.AssignStmt{
 		Lhs: []ast.Expr{stmt.Lhs},
 		Rhs: []ast.Expr{rhs},
@@ -929,7 +1155,8 @@ func compileReturnStmt(context *funcContext, stmt *ast.ReturnStmt) { // {{{
 	a := reg
 	lastisvaarg := false
 
-	if lenexprs == 1 {
+	// the values are computed before the deferred calls run, and a tail call would leave the frame before them
+	if lenexprs == 1 && !context.hasDefer {
 		switch ex := stmt.Exprs[0].(type) {
 		case *ast.IdentExpr:
 			if idx := context.FindLocalVar(ex.Value); idx > -1 {
@@ -939,6 +1166,9 @@ func compileReturnStmt(context *funcContext, stmt *ast.ReturnStmt) { // {{{
 		case *ast.FuncCallExpr:
 			if ex.AdjustRet { // return (func())
 				reg += compileExpr(context, reg, ex, ecnone(0))
+			} else if isOptionalChain(ex) {
+				// the chain may stop before the call
+				compileExpr(context, reg, ex, ecnone(-2))
 			} else {
 				reg += compileExpr(context, reg, ex, ecnone(-2))
 				code.SetOpCode(code.LastPC(), OP_TAILCALL)
@@ -960,6 +1190,7 @@ func compileReturnStmt(context *funcContext, stmt *ast.ReturnStmt) { // {{{
 	if lastisvaarg {
 		count = 0
 	}
+	context.RunDefers(0, sline(stmt))
 	context.Code.AddABC(OP_RETURN, a, count, 0, sline(stmt))
 } // }}}
 
@@ -998,7 +1229,7 @@ func compileBranchCondition(context *funcContext, reg int, expr ast.Expr, thenla
 			code.AddASbx(OP_JMP, 0, elselabel, sline(expr))
 			return
 		}
-	case *ast.TrueExpr, *ast.NumberExpr, *ast.StringExpr:
+	case *ast.TrueExpr, *ast.NumberExpr, *ast.StringExpr, *constLValueExpr:
 		if !hasnextcond {
 			return
 		}
@@ -1031,31 +1262,67 @@ func compileBranchCondition(context *funcContext, reg int, expr ast.Expr, thenla
 } // }}}
 
 func compileWhileStmt(context *funcContext, stmt *ast.WhileStmt) { // {{{
+	compileWhileLoop(context, stmt, stmt.Condition, stmt.Stmts, nil)
+} // }}}
+
+func compileWhileStmtWithIfThru(context *funcContext, stmt *ast.WhileStmtWithIfThru) { // {{{
+	compileWhileLoop(context, stmt, stmt.Condition, stmt.Stmts, stmt.IfThruStmts)
+} // }}}
+
+func compileWhileLoop(context *funcContext, stmt ast.Stmt, condition ast.Expr, stmts, ifthru []ast.Stmt) { // {{{
 	thenlabel := context.NewLabel()
 	elselabel := context.NewLabel()
 	condlabel := context.NewLabel()
+	breaklabel := elselabel
+	if len(ifthru) > 0 {
+		// break skips the ifthru block, which runs when the condition ends the loop
+		breaklabel = context.NewLabel()
+	}
 
 	context.SetLabelPc(condlabel, context.Code.LastPC())
-	compileBranchCondition(context, context.RegTop(), stmt.Condition, thenlabel, elselabel, false)
+	compileBranchCondition(context, context.RegTop(), condition, thenlabel, elselabel, false)
 	context.SetLabelPc(thenlabel, context.Code.LastPC())
-	context.EnterBlock(elselabel, stmt)
-	compileChunk(context, stmt.Stmts, false)
+	context.EnterLoopBlock(breaklabel, condlabel, stmt)
+	compileChunk(context, stmts, false)
 	context.CloseUpvalues()
 	context.Code.AddASbx(OP_JMP, 0, condlabel, eline(stmt))
 	context.LeaveBlock()
 	context.SetLabelPc(elselabel, context.Code.LastPC())
+	if len(ifthru) > 0 {
+		compileBlock(context, ifthru)
+		context.SetLabelPc(breaklabel, context.Code.LastPC())
+	}
 } // }}}
 
 func compileRepeatStmt(context *funcContext, stmt *ast.RepeatStmt) { // {{{
+	compileRepeatLoop(context, stmt, stmt.Condition, stmt.Stmts, nil)
+} // }}}
+
+func compileRepeatStmtWithIfThru(context *funcContext, stmt *ast.RepeatStmtWithIfThru) { // {{{
+	compileRepeatLoop(context, stmt, stmt.Condition, stmt.Stmts, stmt.IfThruStmts)
+} // }}}
+
+func compileRepeatLoop(context *funcContext, stmt ast.Stmt, condition ast.Expr, stmts, ifthru []ast.Stmt) { // {{{
 	initlabel := context.NewLabel()
 	thenlabel := context.NewLabel()
 	elselabel := context.NewLabel()
+	condlabel := context.NewLabel()
+	breaklabel := thenlabel
+	if len(ifthru) > 0 {
+		breaklabel = context.NewLabel()
+	}
 
 	context.SetLabelPc(initlabel, context.Code.LastPC())
 	context.SetLabelPc(elselabel, context.Code.LastPC())
-	context.EnterBlock(thenlabel, stmt)
-	compileChunk(context, stmt.Stmts, true)
-	compileBranchCondition(context, context.RegTop(), stmt.Condition, thenlabel, elselabel, false)
+	context.EnterLoopBlock(breaklabel, condlabel, stmt)
+	compileChunk(context, stmts, true)
+	// the condition sees the locals of the body, so continue can not skip their declarations
+	if block := context.Block; block.continueVars > -1 && block.continueVars < len(block.LocalVars.Names()) {
+		raiseCompileError(context, sline(condition), "<continue> at line %d jumps into the scope of local '%s'",
+			block.continueLine, block.LocalVars.Names()[block.continueVars])
+	}
+	context.SetLabelPc(condlabel, context.Code.LastPC())
+	compileBranchCondition(context, context.RegTop(), condition, thenlabel, elselabel, false)
 
 	context.SetLabelPc(thenlabel, context.Code.LastPC())
 	n := context.LeaveBlock()
@@ -1068,15 +1335,17 @@ func compileRepeatStmt(context *funcContext, stmt *ast.RepeatStmt) { // {{{
 		context.Code.AddASbx(OP_JMP, 0, initlabel, eline(stmt))
 		context.SetLabelPc(label, context.Code.LastPC())
 	}
-
+	if len(ifthru) > 0 {
+		compileBlock(context, ifthru)
+		context.SetLabelPc(breaklabel, context.Code.LastPC())
+	}
 } // }}}
 
 func compileBreakStmt(context *funcContext, stmt *ast.BreakStmt) { // {{{
 	for block := context.Block; block != nil; block = block.Parent {
 		if label := block.BreakLabel; label != labelNoJump {
-			if block.RefUpvalue {
-				context.Code.AddABC(OP_CLOSE, block.Parent.LocalVars.LastIndex(), 0, 0, sline(stmt))
-			}
+			context.RunDefers(block.Depth(), sline(stmt))
+			context.CloseLoopUpvalues(block, sline(stmt))
 			context.Code.AddASbx(OP_JMP, 0, label, sline(stmt))
 			return
 		}
@@ -1084,6 +1353,22 @@ func compileBreakStmt(context *funcContext, stmt *ast.BreakStmt) { // {{{
 	raiseCompileError(context, sline(stmt), "no loop to break")
 } // }}}
 
+func compileContinueStmt(context *funcContext, stmt *ast.ContinueStmt) { // {{{
+	for block := context.Block; block != nil; block = block.Parent {
+		if label := block.ContinueLabel; label != labelNoJump {
+			if block.continueVars < 0 {
+				block.continueVars = len(block.LocalVars.Names())
+				block.continueLine = sline(stmt)
+			}
+			context.RunDefers(block.Depth(), sline(stmt))
+			context.CloseLoopUpvalues(block, sline(stmt))
+			context.Code.AddASbx(OP_JMP, 0, label, sline(stmt))
+			return
+		}
+	}
+	raiseCompileError(context, sline(stmt), "no loop to continue")
+} // }}}
+
 func compileFuncDefStmt(context *funcContext, stmt *ast.FuncDefStmt) { // {{{
 	if stmt.Name.Func == nil {
 		reg := context.RegTop()
@@ -1103,9 +1388,10 @@ func compileFuncDefStmt(context *funcContext, stmt *ast.FuncDefStmt) { // {{{
 func compileNumberForStmt(context *funcContext, stmt *ast.NumberForStmt) { // {{{
 	code := context.Code
 	endlabel := context.NewLabel()
+	fllabel := context.NewLabel()
 	ec := &expcontext{}
 
-	context.EnterBlock(endlabel, stmt)
+	context.EnterLoopBlock(endlabel, fllabel, stmt)
 	reg := context.RegTop()
 	rindex := context.RegisterLocalVar("(for index)")
 	ecupdate(ec, ecLocal, rindex, 0)
@@ -1134,6 +1420,7 @@ func compileNumberForStmt(context *funcContext, stmt *ast.NumberForStmt) { // {{
 	context.LeaveBlock()
 
 	flpc := code.LastPC()
+	context.SetLabelPc(fllabel, flpc)
 	code.AddASbx(OP_FORLOOP, rindex, bodypc-(flpc+1), sline(stmt))
 
 	context.SetLabelPc(endlabel, code.LastPC())
@@ -1144,9 +1431,10 @@ func compileNumberForStmt(context *funcContext, stmt *ast.NumberForStmt) { // {{
 func compileNumberForStmtWithIfThru(context *funcContext, stmt *ast.NumberForStmtWithIfThru) {
 	code := context.Code
 	endlabel := context.NewLabel()
+	fllabel := context.NewLabel()
 	ec := &expcontext{}
 
-	context.EnterBlock(endlabel, stmt)
+	context.EnterLoopBlock(endlabel, fllabel, stmt)
 	reg := context.RegTop()
 	rindex := context.RegisterLocalVar("(for index)")
 	ecupdate(ec, ecLocal, rindex, 0)
@@ -1176,10 +1464,11 @@ func compileNumberForStmtWithIfThru(context *funcContext, stmt *ast.NumberForStm
 	context.LeaveBlock()
 
 	flpc := code.LastPC()
+	context.SetLabelPc(fllabel, flpc)
 	code.AddASbx(OP_FORLOOP, rindex, bodypc-(flpc+1), sline(stmt))
 
 	// compile the ifthru statements
-	compileChunk(context, stmt.IfThruStmts, false)
+	compileBlock(context, stmt.IfThruStmts)
 
 	context.SetLabelPc(endlabel, code.LastPC())
 	code.SetSbx(bodypc, flpc-bodypc)
@@ -1192,7 +1481,7 @@ func compileGenericForStmt(context *funcContext, stmt *ast.GenericForStmt) { //
 	fllabel := context.NewLabel()
 	nnames := len(stmt.Names)
 
-	context.EnterBlock(endlabel, stmt)
+	context.EnterLoopBlock(endlabel, fllabel, stmt)
 	rgen := context.RegisterLocalVar("(for generator)")
 	context.RegisterLocalVar("(for state)")
 	context.RegisterLocalVar("(for control)")
@@ -1224,7 +1513,7 @@ func compileGenericForStmtWithIfThru(context *funcContext, stmt *ast.GenericForS
 	fllabel := context.NewLabel()
 	nnames := len(stmt.Names)
 
-	context.EnterBlock(endlabel, stmt)
+	context.EnterLoopBlock(endlabel, fllabel, stmt)
 	rgen := context.RegisterLocalVar("(for generator)")
 	context.RegisterLocalVar("(for state)")
 	context.RegisterLocalVar("(for control)")
@@ -1247,7 +1536,7 @@ func compileGenericForStmtWithIfThru(context *funcContext, stmt *ast.GenericForS
 	code.AddASbx(OP_JMP, 0, bodylabel, sline(stmt))
 
 	// Compile the ifthru statements
-	compileChunk(context, stmt.IfThruStmts, false)
+	compileBlock(context, stmt.IfThruStmts)
 
 	context.SetLabelPc(endlabel, code.LastPC())
 } // }}}
@@ -1263,16 +1552,116 @@ func compileLabelStmt(context *funcContext, stmt *ast.LabelStmt, isLastStmt bool
 } // }}}
 
 func compileGotoStmt(context *funcContext, stmt *ast.GotoStmt) { // {{{
+	deferpc := -1
+	if context.hasDefer {
+		// runs nothing until the goto is found to leave blocks, see ResolveCurrentBlockGotosWithParentBlock
+		context.RunDefers(context.Block.Depth()+1, sline(stmt))
+		deferpc = context.Code.LastPC()
+	}
 	context.Code.AddABC(OP_CLOSE, 0, 0, 0, sline(stmt))
 	context.Code.AddASbx(OP_JMP, 0, labelNoJump, sline(stmt))
 	label := newLabelDesc(-1, stmt.Label, context.Code.LastPC(), sline(stmt), context.BlockLocalVarsCount())
+	label.DeferPc = deferpc
 	context.AddUnresolvedGoto(label)
 	context.FindLabel(context.Block, label, context.gotosCount-1)
 } // }}}
 
+func compileDeferStmt(context *funcContext, stmt *ast.DeferStmt) { // {{{
+	// the call is compiled as usual, then turned into a DEFER keeping the function and the arguments
+	compileFuncCallExpr(context, context.RegTop(), stmt.Call, ecnone(-1))
+	pc := context.Code.LastPC()
+	context.Code.SetOpCode(pc, OP_DEFER)
+	context.Code.SetC(pc, context.Block.Depth())
+} // }}}
+
+// compileSwitchStmt emits the tests of all the cases, followed by the default block and the blocks of the cases.
+// Consecutive constant and type cases are looked up by a single OP_SWITCH, other cases are compared in order.
+func compileSwitchStmt(context *funcContext, stmt *ast.SwitchStmt) { // {{{
+	code := context.Code
+	reg := context.RegTop()
+	a := reg
+	if isConstantSwitch(stmt) {
+		// the tests do not run any code, so a local can be tested in its own register
+		compileExprWithMVPropagation(context, stmt.Expr, &reg, &a)
+	} else {
+		reg += compileExpr(context, reg, stmt.Expr, ecnone(0))
+	}
+
+	endlabel := context.NewLabel()
+	caselabels := make([]int, len(stmt.Cases))
+	values := map[LValue]bool{}
+	var types [len(typeKindNames)]bool
+	var table *SwitchTable
+	for i, cs := range stmt.Cases {
+		caselabels[i] = context.NewLabel()
+		for _, value := range cs.Values {
+			if builtinType, ok := value.(*ast.BuiltinType); ok {
+				kind, ok := typeKindToName[builtinType.Kind]
+				if !ok {
+					raiseCompileError(context, sline(cs), "invalid type in switch case")
+				}
+				if types[kind] {
+					raiseCompileError(context, sline(cs), "duplicate case %s in switch statement", builtinType.Kind)
+				}
+				types[kind] = true
+				if table == nil {
+					table = context.AddSwitchTable(a, sline(stmt))
+				}
+				table.TypeJumps[kind] = caselabels[i]
+				continue
+			}
+			if cnst, ok := constValue(constFold(value)); ok {
+				key := switchKey(cnst)
+				if values[key] {
+					raiseCompileError(context, sline(cs), "duplicate case %v in switch statement", cnst)
+				}
+				values[key] = true
+				if kind := switchTypeKinds[cnst.Type()]; kind >= 0 && types[kind] {
+					// a type case before this one matches the value
+					continue
+				}
+				if table == nil {
+					table = context.AddSwitchTable(a, sline(stmt))
+				}
+				table.Keys = append(table.Keys, cnst)
+				table.Jumps = append(table.Jumps, caselabels[i])
+				continue
+			}
+			table = nil
+			treg := reg
+			c := treg
+			compileExprWithKMVPropagation(context, value, &treg, &c)
+			code.AddABC(OP_EQ, 1, a, c, sline(value))
+			code.AddASbx(OP_JMP, 0, caselabels[i], sline(value))
+		}
+	}
+
+	compileBlock(context, stmt.Default)
+	for i, cs := range stmt.Cases {
+		code.AddASbx(OP_JMP, 0, endlabel, sline(cs))
+		context.SetLabelPc(caselabels[i], code.LastPC())
+		compileBlock(context, cs.Stmts)
+	}
+	context.SetLabelPc(endlabel, code.LastPC())
+} // }}}
+
+// isConstantSwitch reports whether all the cases of stmt are constants or types.
+func isConstantSwitch(stmt *ast.SwitchStmt) bool { // {{{
+	for _, cs := range stmt.Cases {
+		for _, value := range cs.Values {
+			if _, ok := value.(*ast.BuiltinType); ok {
+				continue
+			}
+			if _, ok := constValue(constFold(value)); !ok {
+				return false
+			}
+		}
+	}
+	return true
+} // }}}
+
 func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) int { // {{{
 	expr = constFoldinCompile(expr)
-	expr = strengthReduction(expr)
 	code := context.Code
 	sreg := savereg(ec, reg)
 	sused := 1
@@ -1285,10 +1674,7 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 		code.AddABx(OP_LOADK, sreg, context.ConstIndex(LString(ex.Value)), sline(ex))
 		return sused
 	case *ast.NumberExpr:
-		num, err := parseNumber(ex.Value)
-		if err != nil {
-			num = LNumber(math.NaN())
-		}
+		num, _ := lnumberValue(ex)
 		code.AddABx(OP_LOADK, sreg, context.ConstIndex(num), sline(ex))
 		return sused
 	case *constLValueExpr:
@@ -1325,9 +1711,14 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 		}
 		return (sreg + 1 + ec.varargopt) - reg
 	case *ast.AttrGetExpr:
+		if expr != context.chainLink && isOptionalChain(ex) {
+			return compileOptionalChain(context, reg, ex, ec)
+		}
 		a := sreg
 		b := reg
+		context.chainLink = chainLinkOf(context, ex, ex.Object)
 		compileExprWithMVPropagation(context, ex.Object, &reg, &b)
+		context.chainLink = nil
 		c := reg
 		compileExprWithKMVPropagation(context, ex.Key, &reg, &c)
 		opcode := OP_GETTABLE
@@ -1336,6 +1727,12 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 		}
 		code.AddABC(opcode, a, b, c, sline(ex))
 		return sused
+	case *ast.SafeAttrGetExpr:
+		compileSafeAttrGetExpr(context, reg, ex, ec)
+		return sused
+	case *ast.NilCoalesceExpr:
+		compileNilCoalesceExpr(context, reg, ex, ec)
+		return sused
 	case *ast.TableExpr:
 		compileTableExpr(context, reg, ex, ec)
 		return 1
@@ -1345,7 +1742,10 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 	case *ast.StringConcatOpExpr:
 		compileStringConcatOpExpr(context, reg, ex, ec)
 		return sused
-	case *ast.UnaryMinusOpExpr, *ast.UnaryNotOpExpr, *ast.UnaryLenOpExpr:
+	case *ast.InterpolatedStringExpr:
+		compileInterpolatedStringExpr(context, reg, ex, ec)
+		return sused
+	case *ast.UnaryMinusOpExpr, *ast.UnaryNotOpExpr, *ast.UnaryLenOpExpr, *ast.UnaryBitNotOpExpr:
 		compileUnaryOpExpr(context, reg, ex, ec)
 		return sused
 	case *ast.RelationalOpExpr:
@@ -1358,6 +1758,9 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 		compileBitwiseOpExpr(context, reg, ex, ec)
 		return sused
 	case *ast.FuncCallExpr:
+		if expr != context.chainLink && isOptionalChain(ex) {
+			return compileOptionalChain(context, reg, ex, ec)
+		}
 		return compileFuncCallExpr(context, reg, ex, ec)
 	case *ast.FunctionExpr:
 		childcontext := newFuncContext(context.Proto.SourceName, context)
@@ -1404,7 +1807,7 @@ func compileExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) i
 
 func compileExprWithPropagation(context *funcContext, expr ast.Expr, reg *int, save *int, propergator func(int, *int, *int, int)) { // {{{
 	reginc := compileExpr(context, *reg, expr, ecnone(0))
-	if _, ok := expr.(*ast.LogicalOpExpr); ok {
+	if isBranchingExpr(expr) {
 		*save = *reg
 		*reg = *reg + reginc
 	} else {
@@ -1431,29 +1834,15 @@ func constFold(exp ast.Expr) ast.Expr { // {{{
 		lvalue, lisconst := lnumberValue(constFold(expr.Lhs))
 		rvalue, risconst := lnumberValue(constFold(expr.Rhs))
 		if lisconst && risconst {
-			switch expr.Operator {
-			case "+":
-				return &constLValueExpr{Value: lvalue + rvalue}
-			case "-":
-				return &constLValueExpr{Value: lvalue - rvalue}
-			case "*":
-				return &constLValueExpr{Value: lvalue * rvalue}
-			case "/":
-				return &constLValueExpr{Value: lvalue / rvalue}
-			case "%":
-				return &constLValueExpr{Value: luaModulo(lvalue, rvalue)}
-			case "^":
-				return &constLValueExpr{Value: LNumber(math.Pow(float64(lvalue), float64(rvalue)))}
-			default:
-				panic(fmt.Sprintf("unknown binop: %v", expr.Operator))
+			if value, ok := foldArith(expr.Operator, lvalue, rvalue); ok {
+				return &constLValueExpr{Value: value}
 			}
-		} else {
-			return expr
 		}
+		return expr
 	case *ast.UnaryMinusOpExpr:
 		expr.Expr = constFold(expr.Expr)
 		if value, ok := lnumberValue(expr.Expr); ok {
-			return &constLValueExpr{Value: LNumber(-value)}
+			return &constLValueExpr{Value: foldNegate(value)}
 		}
 		return expr
 	default:
@@ -1486,6 +1875,7 @@ func compileFunctionExpr(context *funcContext, funcexpr *ast.FunctionExpr, ec *e
 		context.Proto.IsVarArg |= VarArgIsVarArg
 	}
 
+	context.hasDefer = containsDefer(funcexpr.Stmts)
 	compileChunk(context, funcexpr.Stmts, false)
 
 	context.Code.AddABC(OP_RETURN, 0, 1, 0, eline(funcexpr))
@@ -1503,6 +1893,7 @@ func compileFunctionExpr(context *funcContext, funcexpr *ast.FunctionExpr, ec *e
 		context.Proto.stringConstants = append(context.Proto.stringConstants, sv)
 	}
 	patchCode(context)
+	context.Proto.quicken()
 } // }}}
 
 func compileTableExpr(context *funcContext, reg int, ex *ast.TableExpr, ec *expcontext) { // {{{
@@ -1604,6 +1995,8 @@ func compileArithmeticOpExpr(context *funcContext, reg int, expr *ast.Arithmetic
 		op = OP_MOD
 	case "^":
 		op = OP_POW
+	case "~/":
+		op = OP_IDIV
 	}
 	context.Code.AddABC(op, a, b, c, sline(expr))
 } // }}}
@@ -1623,12 +2016,36 @@ func compileStringConcatOpExpr(context *funcContext, reg int, expr *ast.StringCo
 	basereg := reg
 	reg += compileExpr(context, reg, expr.Lhs, ecnone(0))
 	reg += compileExpr(context, reg, expr.Rhs, ecnone(0))
-	for pc := code.LastPC(); pc != 0 && opGetOpCode(code.At(pc)) == OP_CONCAT; pc-- {
+	if crange > 1 {
+		// the nested concatenation ends with a single CONCAT, which this one replaces
 		code.Pop()
 	}
 	code.AddABC(OP_CONCAT, a, basereg, basereg+crange, sline(expr))
 } // }}}
 
+func compileInterpolatedStringExpr(context *funcContext, reg int, expr *ast.InterpolatedStringExpr, ec *expcontext) { // {{{
+	code := context.Code
+	a := savereg(ec, reg)
+	basereg := reg
+	for _, part := range expr.Parts {
+		compileExpr(context, reg, part, ecnone(0))
+		switch part.(type) {
+		case *ast.StringExpr, *ast.NumberExpr:
+		default:
+			// embedded values are converted like tostring, so tables and nil do not fail the concatenation
+			code.AddABC(OP_TOSTRING, reg, reg, 0, sline(part))
+		}
+		reg++
+	}
+	if len(expr.Parts) == 1 {
+		if a != basereg {
+			code.AddABC(OP_MOVE, a, basereg, 0, sline(expr))
+		}
+	} else {
+		code.AddABC(OP_CONCAT, a, basereg, reg-1, sline(expr))
+	}
+} // }}}
+
 func compileUnaryOpExpr(context *funcContext, reg int, expr ast.Expr, ec *expcontext) { // {{{
 	opcode := 0
 	code := context.Code
@@ -1659,6 +2076,9 @@ func compileUnaryOpExpr(context *funcContext, reg int, expr ast.Expr, ec *expcon
 	case *ast.UnaryLenOpExpr:
 		opcode = OP_LEN
 		operandexpr = ex.Expr
+	case *ast.UnaryBitNotOpExpr:
+		opcode = OP_BNOT
+		operandexpr = ex.Expr
 	}
 
 	a := savereg(ec, reg)
@@ -1700,6 +2120,165 @@ func compileRelationalOpExpr(context *funcContext, reg int, expr *ast.Relational
 	code.AddABC(OP_LOADBOOL, a, 1, 0, sline(expr))
 } // }}}
 
+// isBranchingExpr reports whether the value of expr is stored by more than one path of its code, so that
+// its last instruction can not be removed or retargeted like a single LOADK or MOVE.
+func isBranchingExpr(expr ast.Expr) bool { // {{{
+	switch expr.(type) {
+	case *ast.LogicalOpExpr, *ast.SafeAttrGetExpr, *ast.NilCoalesceExpr:
+		return true
+	}
+	return isOptionalChain(expr)
+} // }}}
+
+// isOptionalChain reports whether expr is an index or a call following an optional index, like `a?.b.c`
+// or `a?.b:c()`. The whole chain is nil if the object of an optional index in it is nil.
+func isOptionalChain(expr ast.Expr) bool { // {{{
+	for {
+		switch ex := expr.(type) {
+		case *ast.AttrGetExpr:
+			expr = ex.Object
+		case *ast.FuncCallExpr:
+			if ex.Func != nil {
+				expr = ex.Func
+			} else {
+				expr = ex.Receiver
+			}
+		case *ast.SafeAttrGetExpr:
+			return true
+		default:
+			return false
+		}
+		if isParenthesized(expr) {
+			return false
+		}
+		if _, ok := expr.(*ast.SafeAttrGetExpr); ok {
+			return true
+		}
+	}
+} // }}}
+
+// isParenthesized reports whether expr is an index or a call in parentheses, which ends an optional chain.
+func isParenthesized(expr ast.Expr) bool { // {{{
+	switch ex := expr.(type) {
+	case *ast.AttrGetExpr:
+		return ex.Paren
+	case *ast.SafeAttrGetExpr:
+		return ex.Paren
+	case *ast.FuncCallExpr:
+		return ex.AdjustRet
+	}
+	return false
+} // }}}
+
+// chainLinkOf returns the object of expr if both belong to the optional chain being compiled, nil otherwise.
+func chainLinkOf(context *funcContext, expr, object ast.Expr) ast.Expr { // {{{
+	if expr != context.chainLink || isParenthesized(object) {
+		return nil
+	}
+	return object
+} // }}}
+
+// compileOptionalChain compiles an optional chain. If one of its optional indexes stops it, the chain has
+// a single nil value, which is padded with nils if more values are wanted.
+func compileOptionalChain(context *funcContext, reg int, expr ast.Expr, ec *expcontext) int { // {{{
+	code := context.Code
+	a := savereg(ec, reg)
+	chainNil, chainLink := context.chainNil, context.chainLink
+	context.chainNil, context.chainLink = context.NewLabel(), expr
+	var n int
+	if call, ok := expr.(*ast.FuncCallExpr); ok {
+		n = compileFuncCallExpr(context, reg, call, ec)
+	} else {
+		n = compileExpr(context, reg, expr, ec)
+	}
+	if ec.varargopt == -1 {
+		// the results are ignored
+		context.SetLabelPc(context.chainNil, code.LastPC())
+	} else {
+		endlabel := context.NewLabel()
+		code.AddASbx(OP_JMP, 0, endlabel, sline(expr))
+		context.SetLabelPc(context.chainNil, code.LastPC())
+		if ec.varargopt == -2 {
+			// the receiver of all results finds them up to the top
+			code.AddABC(OP_LOADNIL, a, a, 1, sline(expr))
+		} else {
+			code.AddABC(OP_LOADNIL, a, a+ec.varargopt, 0, sline(expr))
+		}
+		context.SetLabelPc(endlabel, code.LastPC())
+	}
+	context.chainNil, context.chainLink = chainNil, chainLink
+	return n
+} // }}}
+
+func compileSafeAttrGetExpr(context *funcContext, reg int, expr *ast.SafeAttrGetExpr, ec *expcontext) { // {{{
+	code := context.Code
+	a := savereg(ec, reg)
+	b := reg
+	inchain := expr == context.chainLink
+	context.chainLink = chainLinkOf(context, expr, expr.Object)
+	compileExprWithMVPropagation(context, expr.Object, &reg, &b)
+	context.chainLink = nil
+	nilrk := loadRk(context, &reg, expr, LNil)
+	keylabel := context.NewLabel()
+	endlabel := context.NewLabel()
+	if inchain {
+		// the rest of the chain is skipped, and the chain stores the nil
+		code.AddABC(OP_EQ, 1, b, nilrk, sline(expr))
+		code.AddASbx(OP_JMP, 0, context.chainNil, sline(expr))
+	} else if a == b {
+		// the object is nil, and so is the result
+		code.AddABC(OP_EQ, 1, b, nilrk, sline(expr))
+		code.AddASbx(OP_JMP, 0, endlabel, sline(expr))
+	} else {
+		// the path loading nil comes first, the last instruction is the one of the other path
+		code.AddABC(OP_EQ, 0, b, nilrk, sline(expr))
+		code.AddASbx(OP_JMP, 0, keylabel, sline(expr))
+		code.AddABC(OP_MOVE, a, b, 0, sline(expr))
+		code.AddASbx(OP_JMP, 0, endlabel, sline(expr))
+	}
+	context.SetLabelPc(keylabel, code.LastPC())
+	c := reg
+	compileExprWithKMVPropagation(context, expr.Key, &reg, &c)
+	opcode := OP_GETTABLE
+	if _, ok := expr.Key.(*ast.StringExpr); ok {
+		opcode = OP_GETTABLEKS
+	}
+	code.AddABC(opcode, a, b, c, sline(expr))
+	context.SetLabelPc(endlabel, code.LastPC())
+} // }}}
+
+func compileNilCoalesceExpr(context *funcContext, reg int, expr *ast.NilCoalesceExpr, ec *expcontext) { // {{{
+	if _, ok := expr.Rhs.(*ast.NilExpr); ok {
+		compileExpr(context, reg, expr.Lhs, ec)
+		return
+	}
+	code := context.Code
+	base := reg
+	a := savereg(ec, reg)
+	b := reg
+	compileExprWithMVPropagation(context, expr.Lhs, &reg, &b)
+	nilrk := loadRk(context, &reg, expr, LNil)
+	rhslabel := context.NewLabel()
+	endlabel := context.NewLabel()
+	if a == b {
+		code.AddABC(OP_EQ, 0, b, nilrk, sline(expr))
+		code.AddASbx(OP_JMP, 0, endlabel, sline(expr))
+	} else {
+		code.AddABC(OP_EQ, 1, b, nilrk, sline(expr))
+		code.AddASbx(OP_JMP, 0, rhslabel, sline(expr))
+		code.AddABC(OP_MOVE, a, b, 0, sline(expr))
+		code.AddASbx(OP_JMP, 0, endlabel, sline(expr))
+	}
+	context.SetLabelPc(rhslabel, code.LastPC())
+	// the right operand is only evaluated if the left one is nil, so it may reuse its registers
+	if a == base {
+		compileExpr(context, a, expr.Rhs, ecnone(0))
+	} else {
+		compileExpr(context, reg, expr.Rhs, &expcontext{ecLocal, a, 0})
+	}
+	context.SetLabelPc(endlabel, code.LastPC())
+} // }}}
+
 func compileLogicalOpExpr(context *funcContext, reg int, expr *ast.LogicalOpExpr, ec *expcontext) { // {{{
 	a := savereg(ec, reg)
 	code := context.Code
@@ -1766,7 +2345,7 @@ func compileLogicalOpExprAux(context *funcContext, reg int, expr ast.Expr, ec *e
 			code.AddASbx(OP_JMP, 0, thenlabel, sline(expr))
 		}
 		return
-	case *ast.NumberExpr, *ast.StringExpr:
+	case *ast.NumberExpr, *ast.StringExpr, *constLValueExpr:
 		if thenlabel == lb.e {
 			compileExpr(context, reg, expr, ec)
 			code.AddASbx(OP_JMP, 0, lb.e, sline(expr))
@@ -1819,7 +2398,7 @@ func compileLogicalOpExprAux(context *funcContext, reg int, expr ast.Expr, ec *e
 	} else if !hasnextcond && thenlabel == elselabel {
 		reg += compileExpr(context, reg, expr, &expcontext{ec.ctype, intMax(a, sreg), ec.varargopt})
 		last := context.Code.Last()
-		if opGetOpCode(last) == OP_MOVE && opGetArgA(last) == a {
+		if opGetOpCode(last) == OP_MOVE && opGetArgA(last) == a && !isBranchingExpr(expr) {
 			context.Code.SetA(context.Code.LastPC(), sreg)
 		} else {
 			context.Code.AddABC(OP_MOVE, sreg, a, 0, sline(expr))
@@ -1849,6 +2428,8 @@ func compileBitwiseOpExpr(context *funcContext, reg int, expr *ast.BitwiseOpExpr
 		opcode = OP_BOR
 	case "&":
 		opcode = OP_BAND
+	case "~":
+		opcode = OP_BXOR
 	case "<<":
 		opcode = OP_SHL
 	case ">>":
@@ -1871,11 +2452,15 @@ func compileFuncCallExpr(context *funcContext, reg int, expr *ast.FuncCallExpr,
 	name := "(anonymous)"
 
 	if expr.Func != nil { // hoge.func()
+		context.chainLink = chainLinkOf(context, expr, expr.Func)
 		reg += compileExpr(context, reg, expr.Func, ecnone(0))
+		context.chainLink = nil
 		name = getExprName(context, expr.Func)
 	} else { // hoge:method()
 		b := reg
+		context.chainLink = chainLinkOf(context, expr, expr.Receiver)
 		compileExprWithMVPropagation(context, expr.Receiver, &reg, &b)
+		context.chainLink = nil
 		c := loadRk(context, &reg, expr, LString(expr.Method))
 		context.Code.AddABC(OP_SELF, funcreg, b, c, sline(expr))
 		// increments a register for an implicit "self"
@@ -1947,6 +2532,12 @@ func getExprName(_ *funcContext, expr ast.Expr) string { // {{{
 			return kex.Value
 		}
 		return "?"
+	case *ast.SafeAttrGetExpr:
+		switch kex := ex.Key.(type) {
+		case *ast.StringExpr:
+			return kex.Value
+		}
+		return "?"
 	}
 	return "?"
 } // }}}
@@ -1968,8 +2559,22 @@ func patchCode(context *funcContext) { // {{{
 			continue
 		case OP_SETGLOBAL, OP_SETUPVAL, OP_EQ, OP_LT, OP_LE, OP_TEST,
 			OP_TAILCALL, OP_RETURN, OP_FORPREP, OP_FORLOOP, OP_TFORLOOP,
-			OP_SETLIST, OP_CLOSE:
+			OP_SETLIST, OP_CLOSE, OP_RUNDEFER:
 			/* nothing to do */
+		case OP_SWITCH:
+			// the jumps of the table are labels until now
+			st := context.Proto.SwitchTables[opGetArgBx(inst)]
+			for i, label := range st.Jumps {
+				st.Jumps[i] = context.GetLabelPc(label) - pc
+			}
+			for i, label := range st.TypeJumps {
+				if label != labelNoJump {
+					st.TypeJumps[i] = context.GetLabelPc(label) - pc
+				}
+			}
+			if reg := opGetArgA(inst); reg > maxreg {
+				maxreg = reg
+			}
 		case OP_CALL:
 			if reg := opGetArgA(inst) + opGetArgC(inst) - 2; reg > maxreg {
 				maxreg = reg
@@ -2061,36 +2666,29 @@ func constFoldinCompile(exp ast.Expr) ast.Expr {
 		lvalue, lisconst := lnumberValue(expr.Lhs)
 		rvalue, risconst := lnumberValue(expr.Rhs)
 		if lisconst && risconst {
-			switch expr.Operator {
-			case "+":
-				return &constLValueExpr{Value: lvalue + rvalue}
-			case "-":
-				return &constLValueExpr{Value: lvalue - rvalue}
-			case "*":
-				return &constLValueExpr{Value: lvalue * rvalue}
-			case "/":
-				if rvalue != 0 {
-					return &constLValueExpr{Value: lvalue / rvalue}
-				}
-			case "%":
-				if rvalue != 0 {
-					return &constLValueExpr{Value: luaModulo(lvalue, rvalue)}
-				}
-			case "^":
-				return &constLValueExpr{Value: LNumber(math.Pow(float64(lvalue), float64(rvalue)))}
+			if value, ok := foldArith(expr.Operator, lvalue, rvalue); ok {
+				return &constLValueExpr{Value: value}
 			}
 		}
 		return expr
 	case *ast.UnaryLenOpExpr:
 		if _, ok := expr.Expr.(*ast.StringExpr); ok {
-			return &constLValueExpr{Value: LNumber(utf8.RuneCountInString(string(expr.Expr.(*ast.StringExpr).Value)))}
+			return &constLValueExpr{Value: LInteger(utf8.RuneCountInString(string(expr.Expr.(*ast.StringExpr).Value)))}
 		} else {
 			return expr
 		}
 	case *ast.UnaryMinusOpExpr:
 		expr.Expr = constFoldinCompile(expr.Expr)
 		if value, ok := lnumberValue(expr.Expr); ok {
-			return &constLValueExpr{Value: LNumber(-value)}
+			return &constLValueExpr{Value: foldNegate(value)}
+		}
+		return expr
+	case *ast.UnaryBitNotOpExpr:
+		expr.Expr = constFoldinCompile(expr.Expr)
+		if value, ok := lnumberValue(expr.Expr); ok {
+			if ivalue, ok := LVAsInteger(value); ok {
+				return &constLValueExpr{Value: ^ivalue}
+			}
 		}
 		return expr
 	case *ast.UnaryNotOpExpr:
@@ -2101,7 +2699,7 @@ func constFoldinCompile(exp ast.Expr) ast.Expr {
 		case *ast.TrueExpr:
 			return &ast.FalseExpr{}
 		case *constLValueExpr:
-			return &constLValueExpr{Value: LBool(!LVAsBool(v.Value))}
+			return constValueExpr(LBool(!LVAsBool(v.Value)))
 		}
 		return expr
 	case *ast.StringConcatOpExpr:
@@ -2116,167 +2714,21 @@ func constFoldinCompile(exp ast.Expr) ast.Expr {
 	case *ast.LogicalOpExpr:
 		expr.Lhs = constFoldinCompile(expr.Lhs)
 		expr.Rhs = constFoldinCompile(expr.Rhs)
-		lbool, lok := constBoolValue(expr.Lhs)
-		rbool, rok := constBoolValue(expr.Rhs)
-		if lok && rok {
-			switch expr.Operator {
-			case "and":
-				return &constLValueExpr{Value: LBool(lbool && rbool)}
-			case "or":
-				return &constLValueExpr{Value: LBool(lbool || rbool)}
-			}
-		} else if lok {
-			if expr.Operator == "and" && !lbool {
-				return &ast.FalseExpr{}
-			} else if expr.Operator == "or" && lbool {
-				return &ast.TrueExpr{}
-			}
-		}
-		return expr
+		return foldLogical(expr)
 	case *ast.BitwiseOpExpr:
-		switch expr.Operator {
-		case "&":
-			lvalue, lisconst := lnumberValue(constFoldinCompile(expr.Lhs))
-			rvalue, risconst := lnumberValue(constFoldinCompile(expr.Rhs))
-			if lisconst && risconst {
-				return &constLValueExpr{Value: LNumber(int64(lvalue) & int64(rvalue))}
-			}
-		case "|":
-			lvalue, lisconst := lnumberValue(constFoldinCompile(expr.Lhs))
-			rvalue, risconst := lnumberValue(constFoldinCompile(expr.Rhs))
-			if lisconst && risconst {
-				return &constLValueExpr{Value: LNumber(int64(lvalue) | int64(rvalue))}
-			}
-		case "<<":
-			lvalue, lisconst := lnumberValue(constFoldinCompile(expr.Lhs))
-			rvalue, risconst := lnumberValue(constFoldinCompile(expr.Rhs))
-			if lisconst && risconst {
-				return &constLValueExpr{Value: LNumber(int64(lvalue) << uint64(rvalue))}
-			}
-		case ">>":
-			lvalue, lisconst := lnumberValue(constFoldinCompile(expr.Lhs))
-			rvalue, risconst := lnumberValue(constFoldinCompile(expr.Rhs))
-			if lisconst && risconst {
-				return &constLValueExpr{Value: LNumber(int64(lvalue) >> uint64(rvalue))}
+		expr.Lhs = constFoldinCompile(expr.Lhs)
+		expr.Rhs = constFoldinCompile(expr.Rhs)
+		lvalue, lisconst := lnumberValue(expr.Lhs)
+		rvalue, risconst := lnumberValue(expr.Rhs)
+		if lisconst && risconst {
+			if value, ok := foldBitwise(expr.Operator, lvalue, rvalue); ok {
+				return &constLValueExpr{Value: value}
 			}
-		default:
-			return expr
 		}
+		return expr
 	default:
 		return exp
 	}
-	return exp
 }
 
-func constBoolValue(expr ast.Expr) (bool, bool) {
-	switch e := expr.(type) {
-	case *ast.TrueExpr:
-		return true, true
-	case *ast.FalseExpr:
-		return false, true
-	case *ast.NilExpr:
-		return false, true
-	case *constLValueExpr:
-		return LVAsBool(e.Value), true
-	}
-	return false, false
-}
-
-// }}}
-
-// strength reduction {{{
-
-func strengthReduction(expr ast.Expr) ast.Expr {
-	switch e := expr.(type) {
-	case *ast.ArithmeticOpExpr:
-		e.Lhs = strengthReduction(e.Lhs)
-		e.Rhs = strengthReduction(e.Rhs)
-
-		// replace multiplication with shift operation
-		if e.Operator == "*" {
-			if rnum, ok := e.Rhs.(*ast.NumberExpr); ok {
-				if isPowerOfTwo(rnum.Value) {
-					shift := log2(rnum.Value)
-					return &ast.BitwiseOpExpr{
-						Lhs:      e.Lhs,
-						Operator: "<<",
-						Rhs:      &ast.NumberExpr{Value: strconv.Itoa(shift)},
-					}
-				}
-			}
-		}
-
-		// optimize power operation
-		if e.Operator == "^" {
-			if rnum, ok := e.Rhs.(*ast.NumberExpr); ok {
-				rnumval := parseIntOrZero(rnum.Value)
-				if rnumval == 0 {
-					return &ast.NumberExpr{Value: "1"}
-				}
-				if rnumval == 1 {
-					return e.Lhs
-				}
-				// if the exponent is smaller than 5 and is a natural number, replace with multiplication
-				if rnumval > 1 && rnumval < 5 && float64(rnumval) == float64(int(rnumval)) {
-					lhs := e.Lhs
-					for i := 1; i < rnumval; i++ {
-						lhs = &ast.ArithmeticOpExpr{
-							Lhs:      lhs,
-							Operator: "*",
-							Rhs:      e.Lhs,
-						}
-					}
-					return lhs
-				}
-			}
-		}
-
-		// optimize modulo operation
-		if e.Operator == "%" {
-			if rnum, ok := e.Rhs.(*ast.NumberExpr); ok {
-				if isPowerOfTwo(rnum.Value) {
-					mask := parseIntOrZero(rnum.Value) - 1
-					return &ast.BitwiseOpExpr{
-						Lhs:      e.Lhs,
-						Operator: "&",
-						Rhs:      &ast.NumberExpr{Value: strconv.Itoa(mask)},
-					}
-				}
-			}
-		}
-	}
-
-	return expr
-}
-
-func isPowerOfTwo(s string) bool {
-	n := parseIntOrZero(s)
-	return n > 0 && (n&(n-1)) == 0
-}
-
-func log2(s string) int {
-	n := parseIntOrZero(s)
-	return int(math.Log2(float64(n)))
-}
-
-func parseIntOrZero(s string) int {
-	n, err := strconv.Atoi(s)
-	if err != nil {
-		return 0
-	}
-	return n
-}
-
-/*
-func isConstantString(expr ast.Expr) bool {
-	_, ok := expr.(*ast.StringExpr)
-	return ok
-}
-
-func evalConstantStringConcat(lhs, rhs ast.Expr) string {
-	lstr := lhs.(*ast.StringExpr).Value
-	rstr := rhs.(*ast.StringExpr).Value
-	return lstr + rstr
-}*/
-
 // }}}
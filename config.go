@@ -15,6 +15,10 @@ var MaxLoopUnrollCount = 8
 
 type LNumber float64
 
+// LInteger is the integer subtype of numbers. Integer literals and arithmetic on integers yield LIntegers,
+// which hold 64-bit values exactly.
+type LInteger int64
+
 const LNumberBit = 64
 const LNumberScanFormat = "%f"
 const LuaCompVersion = "Lua 5.1"
@@ -34,11 +38,13 @@ func init() {
 		MilkOS = "unix"
 		MilkLDir = "/usr/local/share/milk"
 		MilkDirSep = "/"
-		MilkPathDefault = "./?.mlk;" + MilkLDir + "/?.mlk;" + MilkLDir + "/?/init.mlk"
+		MilkPathDefault = "./?.mlk;./?.mlkc;" + MilkLDir + "/?.mlk;" + MilkLDir + "/?.mlkc;" +
+			MilkLDir + "/?/init.mlk;" + MilkLDir + "/?/init.mlkc"
 	} else { // windows
 		MilkOS = "windows"
 		MilkLDir = "!\\milk"
 		MilkDirSep = "\\"
-		MilkPathDefault = ".\\?.mlk;" + MilkLDir + "\\?.mlk;" + MilkLDir + "\\?\\init.mlk"
+		MilkPathDefault = ".\\?.mlk;.\\?.mlkc;" + MilkLDir + "\\?.mlk;" + MilkLDir + "\\?.mlkc;" +
+			MilkLDir + "\\?\\init.mlk;" + MilkLDir + "\\?\\init.mlkc"
 	}
 }
@@ -111,6 +111,9 @@ func coResume(L *LState) int {
 		return 2
 	}
 	th.Parent = L
+	if th.budget != L.budget {
+		th.setBudget(L.budget)
+	}
 	L.G.CurrentThread = th
 	if !th.isStarted() {
 		cf := th.stack.Last()
@@ -0,0 +1,694 @@
+// Package dap implements a Debug Adapter Protocol server for MilkLua scripts.
+//
+// The server accepts a single client, runs the program named by the launch request (or the program given to
+// NewServer) in the LState, and supports breakpoints by file and line, stepping, stack traces, local and
+// upvalue inspection, and evaluating expressions in a stack frame.
+package dap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	lua "milklua"
+)
+
+// the only thread reported to clients; coroutines are shown as part of its stack
+const mainThreadId = 1
+
+var errNotStopped = errors.New("the program is not stopped")
+
+type stepMode int
+
+const (
+	stepNone stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+type varKind int
+
+const (
+	varLocals varKind = iota
+	varUpvalues
+	varTable
+)
+
+// varRef is what a variablesReference given to the client refers to
+type varRef struct {
+	kind  varKind
+	level int
+	value lua.LValue
+}
+
+// vmCommand runs on the goroutine of the LState while the program is stopped.
+// It returns true if the program should resume.
+type vmCommand func(L *lua.LState) bool
+
+// Server is a debug adapter for an LState.
+type Server struct {
+	L       *lua.LState
+	program string
+
+	conn   *conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	breakpoints map[string]map[int]bool
+	bpLines     map[int]int
+
+	started     bool
+	done        chan struct{}
+	cmds        chan vmCommand
+	paused      atomic.Bool
+	pauseReq    atomic.Bool
+	stopOnEntry bool
+
+	// the following fields are only used on the goroutine of the LState
+	step      stepMode
+	stepL     *lua.LState
+	stepDepth int
+	refs      []*varRef
+	absPaths  map[string]string
+	// set while an evaluate request runs, the program is stopped and must not stop again
+	evaluating bool
+}
+
+// NewServer returns a debug adapter for L. program is run if the launch request does not name one.
+func NewServer(L *lua.LState, program string) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		L:           L,
+		program:     program,
+		ctx:         ctx,
+		cancel:      cancel,
+		breakpoints: make(map[string]map[int]bool),
+		bpLines:     make(map[int]int),
+		done:        make(chan struct{}),
+		cmds:        make(chan vmCommand),
+		absPaths:    make(map[string]string),
+	}
+}
+
+// Serve accepts a single client on ln and runs a debug session for L.
+func Serve(L *lua.LState, ln net.Listener) error {
+	return NewServer(L, "").Serve(ln)
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	return s.Serve(ln)
+}
+
+// Serve accepts a single client on ln and runs the debug session. It returns when the client disconnects,
+// after the program has been stopped.
+func (s *Server) Serve(ln net.Listener) error {
+	nc, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+	return s.ServeConn(nc)
+}
+
+// ServeConn runs the debug session on an established connection.
+func (s *Server) ServeConn(rw io.ReadWriter) error {
+	s.conn = newConn(rw)
+	defer s.terminate()
+	for {
+		req, err := s.conn.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if s.handle(req) {
+			return nil
+		}
+	}
+}
+
+// terminate stops the program and waits for it to exit.
+func (s *Server) terminate() {
+	s.cancel()
+	if !s.started {
+		return
+	}
+	s.resume(stepNone)
+	<-s.done
+}
+
+/* requests {{{ */
+
+// handle handles a request and reports whether the session is over.
+func (s *Server) handle(req *request) bool {
+	switch req.Command {
+	case "initialize":
+		s.conn.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil)
+		s.conn.event("initialized", nil)
+	case "launch":
+		s.conn.respond(req, nil, s.launch(req.Arguments))
+	case "setBreakpoints":
+		body, err := s.setBreakpoints(req.Arguments)
+		s.conn.respond(req, body, err)
+	case "setExceptionBreakpoints":
+		s.conn.respond(req, nil, nil)
+	case "configurationDone":
+		if s.program == "" {
+			s.conn.respond(req, nil, errors.New("no program to launch"))
+			break
+		}
+		s.conn.respond(req, nil, nil)
+		if !s.started {
+			s.started = true
+			go s.run()
+		}
+	case "threads":
+		s.conn.respond(req, map[string]interface{}{"threads": []thread{{Id: mainThreadId, Name: "main"}}}, nil)
+	case "stackTrace":
+		var frames []stackFrame
+		err := s.inVM(func(L *lua.LState) { frames = s.stackTrace(L) })
+		s.conn.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, err)
+	case "scopes":
+		var args struct {
+			FrameId int `json:"frameId"`
+		}
+		var scopes []scope
+		err := s.inVMWithArgs(req.Arguments, &args, func(L *lua.LState) { scopes = s.scopes(args.FrameId - 1) })
+		s.conn.respond(req, map[string]interface{}{"scopes": scopes}, err)
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		var vars []variable
+		err := s.inVMWithArgs(req.Arguments, &args, func(L *lua.LState) { vars = s.variables(L, args.VariablesReference) })
+		s.conn.respond(req, map[string]interface{}{"variables": vars}, err)
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+			FrameId    int    `json:"frameId"`
+		}
+		var result variable
+		var evalErr error
+		err := s.inVMWithArgs(req.Arguments, &args, func(L *lua.LState) {
+			result, evalErr = s.evaluate(L, max(args.FrameId-1, 0), args.Expression)
+		})
+		if err == nil {
+			err = evalErr
+		}
+		s.conn.respond(req, map[string]interface{}{"result": result.Value, "type": result.Type, "variablesReference": result.VariablesReference}, err)
+	case "continue":
+		s.conn.respond(req, map[string]interface{}{"allThreadsContinued": true}, nil)
+		s.resume(stepNone)
+	case "next":
+		s.conn.respond(req, nil, nil)
+		s.resume(stepOver)
+	case "stepIn":
+		s.conn.respond(req, nil, nil)
+		s.resume(stepIn)
+	case "stepOut":
+		s.conn.respond(req, nil, nil)
+		s.resume(stepOut)
+	case "pause":
+		s.pauseReq.Store(true)
+		s.conn.respond(req, nil, nil)
+	case "disconnect", "terminate":
+		s.conn.respond(req, nil, nil)
+		return true
+	default:
+		s.conn.respond(req, nil, fmt.Errorf("unsupported command %q", req.Command))
+	}
+	return false
+}
+
+func (s *Server) launch(raw json.RawMessage) error {
+	var args struct {
+		Program     string `json:"program"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+	}
+	if err := unmarshalArgs(raw, &args); err != nil {
+		return err
+	}
+	if args.Program != "" {
+		s.program = args.Program
+	}
+	if s.program == "" {
+		return errors.New("launch requires a program")
+	}
+	program, err := filepath.Abs(s.program)
+	if err != nil {
+		return err
+	}
+	s.program = program
+	s.stopOnEntry = args.StopOnEntry
+	return nil
+}
+
+func (s *Server) setBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source      source `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := unmarshalArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for line := range s.breakpoints[path] {
+		s.bpLines[line]--
+	}
+	lines := make(map[int]bool)
+	result := []breakpoint{}
+	for _, bp := range args.Breakpoints {
+		if !lines[bp.Line] {
+			lines[bp.Line] = true
+			s.bpLines[bp.Line]++
+		}
+		result = append(result, breakpoint{Verified: true, Line: bp.Line})
+	}
+	s.breakpoints[path] = lines
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+func unmarshalArgs(raw json.RawMessage, args interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// inVM runs fn on the goroutine of the LState, which must be stopped.
+func (s *Server) inVM(fn func(L *lua.LState)) error {
+	if !s.paused.Load() {
+		return errNotStopped
+	}
+	done := make(chan struct{})
+	if !s.send(func(L *lua.LState) bool {
+		defer close(done)
+		fn(L)
+		return false
+	}) {
+		return errNotStopped
+	}
+	<-done
+	return nil
+}
+
+func (s *Server) inVMWithArgs(raw json.RawMessage, args interface{}, fn func(L *lua.LState)) error {
+	if err := unmarshalArgs(raw, args); err != nil {
+		return err
+	}
+	return s.inVM(fn)
+}
+
+// resume continues the stopped program in the given step mode.
+func (s *Server) resume(mode stepMode) {
+	if !s.paused.Swap(false) {
+		return
+	}
+	s.send(func(L *lua.LState) bool {
+		s.step = mode
+		s.stepL = L
+		s.stepDepth = stackDepth(L)
+		return true
+	})
+}
+
+// send sends cmd to the stopped program, and reports false if the program has exited instead.
+func (s *Server) send(cmd vmCommand) bool {
+	select {
+	case s.cmds <- cmd:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+/* }}} */
+
+/* running the program {{{ */
+
+func (s *Server) run() {
+	defer close(s.done)
+	L := s.L
+	L.SetContext(s.ctx)
+	L.SetHook(s.hook, lua.HookMaskLine, 0)
+	err := L.DoFile(s.program)
+	L.SetHook(nil, 0, 0)
+	L.RemoveContext()
+
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+		s.conn.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+	}
+	s.conn.event("exited", map[string]interface{}{"exitCode": exitCode})
+	s.conn.event("terminated", nil)
+}
+
+func (s *Server) hook(L *lua.LState, ev lua.HookEvent) {
+	if ev.Type != lua.HookLine || s.evaluating || s.ctx.Err() != nil {
+		return
+	}
+	reason := ""
+	switch {
+	case s.stopOnEntry:
+		s.stopOnEntry = false
+		reason = "entry"
+	case s.pauseReq.Swap(false):
+		reason = "pause"
+	case s.hasBreakpoint(L, ev.Line):
+		reason = "breakpoint"
+	case s.stepDone(L):
+		reason = "step"
+	}
+	if reason != "" {
+		s.stop(L, reason)
+	}
+}
+
+// stop blocks the program and runs the commands of the client until it resumes the program.
+func (s *Server) stop(L *lua.LState, reason string) {
+	s.step = stepNone
+	s.stepL = nil
+	s.refs = s.refs[:0]
+	s.paused.Store(true)
+	s.conn.event("stopped", map[string]interface{}{"reason": reason, "threadId": mainThreadId, "allThreadsStopped": true})
+	for {
+		select {
+		case cmd := <-s.cmds:
+			if cmd(L) {
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) hasBreakpoint(L *lua.LState, line int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bpLines[line] == 0 {
+		return false
+	}
+	dbg, ok := L.GetStack(0)
+	if !ok {
+		return false
+	}
+	if _, err := L.GetInfo("S", dbg, lua.LNil); err != nil {
+		return false
+	}
+	return s.breakpoints[s.absPath(dbg.Source)][line]
+}
+
+func (s *Server) stepDone(L *lua.LState) bool {
+	switch s.step {
+	case stepIn:
+		return true
+	case stepOver:
+		return L == s.stepL && stackDepth(L) <= s.stepDepth
+	case stepOut:
+		return L == s.stepL && stackDepth(L) < s.stepDepth
+	}
+	return false
+}
+
+func (s *Server) absPath(path string) string {
+	if abs, ok := s.absPaths[path]; ok {
+		return abs
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	s.absPaths[path] = abs
+	return abs
+}
+
+func stackDepth(L *lua.LState) int {
+	depth := 0
+	for {
+		if _, ok := L.GetStack(depth); !ok {
+			return depth
+		}
+		depth++
+	}
+}
+
+/* }}} */
+
+/* inspection {{{ */
+
+func (s *Server) stackTrace(L *lua.LState) []stackFrame {
+	frames := []stackFrame{}
+	for level := 0; ; level++ {
+		dbg, ok := L.GetStack(level)
+		if !ok {
+			break
+		}
+		if _, err := L.GetInfo("Sln", dbg, lua.LNil); err != nil {
+			break
+		}
+		frame := stackFrame{Id: level + 1, Name: dbg.Name, Line: dbg.CurrentLine, Column: 1}
+		if frame.Name == "" {
+			switch dbg.What {
+			case "main":
+				frame.Name = "main chunk"
+			case "G":
+				frame.Name = "?"
+			default:
+				frame.Name = fmt.Sprintf("function <%s:%d>", filepath.Base(dbg.Source), dbg.LineDefined)
+			}
+		}
+		if dbg.What != "G" {
+			path := s.absPath(dbg.Source)
+			frame.Source = &source{Name: filepath.Base(path), Path: path}
+		} else {
+			frame.Line = 0
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func (s *Server) scopes(level int) []scope {
+	return []scope{
+		{Name: "Locals", VariablesReference: s.newRef(&varRef{kind: varLocals, level: level})},
+		{Name: "Upvalues", VariablesReference: s.newRef(&varRef{kind: varUpvalues, level: level})},
+	}
+}
+
+func (s *Server) newRef(ref *varRef) int {
+	s.refs = append(s.refs, ref)
+	return len(s.refs)
+}
+
+func (s *Server) variables(L *lua.LState, reference int) []variable {
+	vars := []variable{}
+	if reference < 1 || reference > len(s.refs) {
+		return vars
+	}
+	ref := s.refs[reference-1]
+	switch ref.kind {
+	case varLocals:
+		locals, _ := frameLocals(L, ref.level)
+		for _, local := range locals {
+			vars = append(vars, s.toVariable(local.name, local.value))
+		}
+	case varUpvalues:
+		if fn := frameFunction(L, ref.level); fn != nil {
+			for i := 1; ; i++ {
+				name, value := L.GetUpvalue(fn, i)
+				if name == "" {
+					break
+				}
+				vars = append(vars, s.toVariable(name, value))
+			}
+		}
+	case varTable:
+		tbl := ref.value.(*lua.LTable)
+		tbl.ForEach(func(key, value lua.LValue) {
+			name := key.String()
+			if _, ok := key.(lua.LString); !ok {
+				name = "[" + name + "]"
+			}
+			vars = append(vars, s.toVariable(name, value))
+		})
+		sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	}
+	return vars
+}
+
+func (s *Server) toVariable(name string, value lua.LValue) variable {
+	v := variable{Name: name, Value: formatValue(value), Type: value.Type().String()}
+	if tbl, ok := value.(*lua.LTable); ok {
+		v.VariablesReference = s.newRef(&varRef{kind: varTable, value: tbl})
+	}
+	return v
+}
+
+func formatValue(value lua.LValue) string {
+	if str, ok := value.(lua.LString); ok {
+		return strconv.Quote(string(str))
+	}
+	return value.String()
+}
+
+type localVar struct {
+	name  string
+	index int
+	value lua.LValue
+}
+
+// frameLocals returns the active local variables of the function at level, without temporaries.
+func frameLocals(L *lua.LState, level int) ([]localVar, *lua.Debug) {
+	dbg, ok := L.GetStack(level)
+	if !ok {
+		return nil, nil
+	}
+	locals := []localVar{}
+	for i := 1; ; i++ {
+		name, value := L.GetLocal(dbg, i)
+		if name == "" {
+			break
+		}
+		if !strings.HasPrefix(name, "(") {
+			locals = append(locals, localVar{name: name, index: i, value: value})
+		}
+	}
+	return locals, dbg
+}
+
+func frameFunction(L *lua.LState, level int) *lua.LFunction {
+	dbg, ok := L.GetStack(level)
+	if !ok {
+		return nil
+	}
+	fn, err := L.GetInfo("f", dbg, lua.LNil)
+	if err != nil {
+		return nil
+	}
+	f, _ := fn.(*lua.LFunction)
+	return f
+}
+
+// evaluate evaluates expr, or runs it as a statement, with the local variables and upvalues of the function at
+// level visible. Assignments to them change the variables of the function. Breakpoints and steps are ignored
+// while it runs.
+func (s *Server) evaluate(L *lua.LState, level int, expr string) (variable, error) {
+	fn, err := L.LoadString("return " + expr)
+	if err != nil {
+		if fn, err = L.LoadString(expr); err != nil {
+			return variable{}, err
+		}
+	}
+	L.SetFEnv(fn, frameEnv(L, level))
+	L.Push(fn)
+	s.evaluating = true
+	err = L.PCall(0, 1, nil)
+	s.evaluating = false
+	if err != nil {
+		return variable{}, err
+	}
+	value := L.Get(-1)
+	L.Pop(1)
+	return s.toVariable("", value), nil
+}
+
+// frameEnv returns an environment table resolving names to the locals and upvalues of the function at level,
+// then to the environment of the function.
+func frameEnv(L *lua.LState, level int) *lua.LTable {
+	locals, dbg := frameLocals(L, level)
+	fn := frameFunction(L, level)
+	var globals lua.LValue = L.Get(lua.GlobalsIndex)
+	if fn != nil && !fn.IsG && fn.Env != nil {
+		globals = fn.Env
+	}
+
+	lookup := func(name string) (set func(lua.LValue), value lua.LValue, ok bool) {
+		for i := len(locals) - 1; i >= 0; i-- {
+			if local := locals[i]; local.name == name {
+				return func(v lua.LValue) {
+					L.SetLocal(dbg, local.index, v)
+					locals[i].value = v
+				}, local.value, true
+			}
+		}
+		if fn != nil {
+			for i := 1; ; i++ {
+				upname, value := L.GetUpvalue(fn, i)
+				if upname == "" {
+					break
+				}
+				if upname == name {
+					return func(v lua.LValue) { L.SetUpvalue(fn, i, v) }, value, true
+				}
+			}
+		}
+		return nil, lua.LNil, false
+	}
+
+	env := L.NewTable()
+	mt := L.NewTable()
+	mt.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+		key := L.Get(2)
+		if name, isString := key.(lua.LString); isString {
+			if _, value, ok := lookup(string(name)); ok {
+				L.Push(value)
+				return 1
+			}
+		}
+		L.Push(L.GetTable(globals, key))
+		return 1
+	}))
+	mt.RawSetString("__newindex", L.NewFunction(func(L *lua.LState) int {
+		key, value := L.Get(2), L.Get(3)
+		if name, isString := key.(lua.LString); isString {
+			if set, _, ok := lookup(string(name)); ok {
+				set(value)
+				return 0
+			}
+		}
+		L.SetTable(globals, key, value)
+		return 0
+	}))
+	L.SetMetatable(env, mt)
+	return env
+}
+
+/* }}} */
@@ -0,0 +1,227 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lua "milklua"
+)
+
+const testScript = `local func add(a, b) {
+	local sum = a + b
+	return sum
+}
+local x = 10
+local y = add(x, 5)
+local t = {name = "milk", n = y}
+result = t.n
+`
+
+// testClient is a minimal DAP client
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	r      *bufio.Reader
+	seq    int
+	events []map[string]interface{}
+}
+
+func (c *testClient) read() map[string]interface{} {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	length := 0
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("read header: %v", err)
+		}
+		if line == "\r\n" {
+			break
+		}
+		fmt.Sscanf(line, "Content-Length: %d", &length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		c.t.Fatalf("read body: %v", err)
+	}
+	msg := map[string]interface{}{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatalf("invalid message %s: %v", data, err)
+	}
+	return msg
+}
+
+func (c *testClient) request(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	if _, err := fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.read()
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if int(msg["request_seq"].(float64)) != c.seq {
+			c.t.Fatalf("unexpected response %v", msg)
+		}
+		if msg["success"] != true {
+			c.t.Fatalf("%s failed: %v", command, msg["message"])
+		}
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+}
+
+func (c *testClient) waitEvent(name string) map[string]interface{} {
+	c.t.Helper()
+	for {
+		var msg map[string]interface{}
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg["type"] == "event" && msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+func (c *testClient) waitStopped(reason string, line int) {
+	c.t.Helper()
+	if body := c.waitEvent("stopped"); body["reason"] != reason {
+		c.t.Fatalf("expected stop reason %q, got %v", reason, body["reason"])
+	}
+	if top := c.topFrame(); int(top["line"].(float64)) != line {
+		c.t.Fatalf("expected to stop at line %d, got %v", line, top["line"])
+	}
+}
+
+func (c *testClient) topFrame() map[string]interface{} {
+	c.t.Helper()
+	frames := c.request("stackTrace", map[string]interface{}{"threadId": 1})["stackFrames"].([]interface{})
+	return frames[0].(map[string]interface{})
+}
+
+func (c *testClient) evaluate(expr string) string {
+	c.t.Helper()
+	return c.request("evaluate", map[string]interface{}{"expression": expr, "frameId": 1})["result"].(string)
+}
+
+func (c *testClient) variables(ref interface{}) map[string]string {
+	c.t.Helper()
+	vars := map[string]string{}
+	for _, v := range c.request("variables", map[string]interface{}{"variablesReference": ref})["variables"].([]interface{}) {
+		variable := v.(map[string]interface{})
+		vars[variable["name"].(string)] = variable["value"].(string)
+	}
+	return vars
+}
+
+func TestDebugSession(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "test.milk")
+	if err := os.WriteFile(program, []byte(testScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	L := lua.NewState()
+	defer L.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	served := make(chan error, 1)
+	go func() { served <- Serve(L, ln) }()
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	c := &testClient{t: t, conn: nc, r: bufio.NewReader(nc)}
+
+	c.request("initialize", map[string]interface{}{"adapterID": "milk"})
+	c.waitEvent("initialized")
+	c.request("launch", map[string]interface{}{"program": program})
+	bps := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": program},
+		"breakpoints": []map[string]interface{}{{"line": 5}, {"line": 8}},
+	})["breakpoints"].([]interface{})
+	if len(bps) != 2 || bps[0].(map[string]interface{})["verified"] != true {
+		t.Fatalf("unexpected breakpoints: %v", bps)
+	}
+	c.request("configurationDone", nil)
+
+	c.waitStopped("breakpoint", 5)
+	if path := c.topFrame()["source"].(map[string]interface{})["path"]; path != program {
+		t.Errorf("unexpected source path %v", path)
+	}
+
+	c.request("next", map[string]interface{}{"threadId": 1})
+	c.waitStopped("step", 6)
+	scopes := c.request("scopes", map[string]interface{}{"frameId": 1})["scopes"].([]interface{})
+	locals := c.variables(scopes[0].(map[string]interface{})["variablesReference"])
+	if locals["x"] != "10" {
+		t.Errorf("unexpected locals: %v", locals)
+	}
+	if v := c.evaluate("x * 2"); v != "20" {
+		t.Errorf("x * 2 evaluated to %s", v)
+	}
+
+	c.request("stepIn", map[string]interface{}{"threadId": 1})
+	c.waitStopped("step", 2)
+	if name := c.topFrame()["name"]; name != "add" {
+		t.Errorf("unexpected frame name %v", name)
+	}
+	if v := c.evaluate("a + b"); v != "15" {
+		t.Errorf("a + b evaluated to %s", v)
+	}
+	c.evaluate("b = 6")
+
+	c.request("stepOut", map[string]interface{}{"threadId": 1})
+	c.waitStopped("step", 7)
+	if v := c.evaluate("y"); v != "16" {
+		t.Errorf("setting a local from evaluate failed, y is %s", v)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	c.waitStopped("breakpoint", 8)
+	ref := c.request("evaluate", map[string]interface{}{"expression": "t", "frameId": 1})["variablesReference"]
+	if fields := c.variables(ref); fields["name"] != `"milk"` || fields["n"] != "16" {
+		t.Errorf("unexpected table fields: %v", fields)
+	}
+	// a breakpoint in a function called by evaluate does not stop the program again, even in a coroutine
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": program},
+		"breakpoints": []map[string]interface{}{{"line": 2}},
+	})
+	if v := c.evaluate("add(1, 2) + coroutlib.Wrap(add)(3, 4)"); v != "10" {
+		t.Errorf("add(1, 2) + coroutlib.Wrap(add)(3, 4) evaluated to %s", v)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": 1})
+	if body := c.waitEvent("exited"); body["exitCode"] != float64(0) {
+		t.Errorf("unexpected exit code %v", body["exitCode"])
+	}
+	c.waitEvent("terminated")
+	c.request("disconnect", nil)
+
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if result := L.GetGlobal("result"); result != lua.LInteger(16) {
+		t.Errorf("unexpected result %v", result)
+	}
+}
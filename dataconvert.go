@@ -1,18 +1,14 @@
 package lua
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"reflect"
-	"sync"
 )
 
-var tablePool = sync.Pool{
-	New: func() interface{} {
-		return &LTable{array: make([]LValue, 0, 16), strdict: make(map[string]LValue)}
-	},
-}
-
 // 递归转换Go数据结构到LValue
 func goToLValue(L *LState, v interface{}) (LValue, error) {
 	switch v := v.(type) {
@@ -24,17 +20,22 @@ func goToLValue(L *LState, v interface{}) (LValue, error) {
 	case float64:
 		return LNumber(v), nil
 	case int:
-		return LNumber(v), nil
+		return LInteger(v), nil
+	case int64:
+		return LInteger(v), nil
+	case uint64:
+		// 超出 int64 范围的整数只能以浮点数表示
+		if v > math.MaxInt64 {
+			return LNumber(v), nil
+		}
+		return LInteger(v), nil
+	case json.Number:
+		return parseNumberValue(string(v))
 	case string:
 		return LString(v), nil
 
 	case []interface{}:
-		tbl := tablePool.Get().(*LTable)
-		tbl.Clear()
-		tbl.array = make([]LValue, 0, len(v))
-
-		defer tablePool.Put(tbl)
-
+		tbl := L.CreateTable(len(v), 0)
 		for i, elem := range v {
 			lv, err := goToLValue(L, elem)
 			if err != nil {
@@ -68,6 +69,7 @@ func goToLValue(L *LState, v interface{}) (LValue, error) {
 
 func (t *LTable) Clear() {
 	t.array = t.array[:0]
+	t.version++
 	for k := range t.strdict {
 		delete(t.strdict, k)
 	}
@@ -81,7 +83,7 @@ func tableToGo(L *LState, tbl *LTable) interface{} {
 	if isArray {
 		arr := make([]interface{}, maxIndex)
 		tbl.ForEach(func(k LValue, v LValue) {
-			if idx, ok := k.(LNumber); ok {
+			if idx, ok := k.(LInteger); ok {
 				if i := int(idx); i >= 1 && i <= maxIndex {
 					arr[i-1] = lvalueToGo(L, v)
 				}
@@ -104,7 +106,7 @@ func isArrayTable(tbl *LTable) (bool, int) {
 	maxIndex := 0
 	count := 0
 	tbl.ForEach(func(k LValue, _ LValue) {
-		if n, ok := k.(LNumber); ok && n > 0 {
+		if n, ok := k.(LInteger); ok && n > 0 {
 			index := int(n)
 			if index == count+1 {
 				count++
@@ -132,6 +134,8 @@ func lvalueToGo(L *LState, lv LValue) interface{} {
 		return string(v)
 	case LNumber:
 		return float64(v)
+	case LInteger:
+		return int64(v)
 	case LBool:
 		return bool(v)
 	case *LNilType:
@@ -148,6 +152,8 @@ func lvalueToString(L *LState, lv LValue) string {
 		return string(v)
 	case LNumber:
 		return fmt.Sprintf("%v", float64(v))
+	case LInteger:
+		return v.String()
 	case LBool:
 		return fmt.Sprintf("%v", bool(v))
 	default:
@@ -163,10 +169,10 @@ func tableToHeader(L *LState, tbl *LTable) http.Header {
 		key := lvalueToString(L, k)
 		if values, ok := v.(*LTable); ok {
 			values.ForEach(func(_, item LValue) { // 批量处理数组值
-				headers.Add(key, lvalueToGo(L, item).(string))
+				headers.Add(key, lvalueToString(L, item))
 			})
 		} else {
-			headers.Add(key, lvalueToGo(L, v).(string))
+			headers.Add(key, lvalueToString(L, v))
 		}
 	})
 	return headers
@@ -186,3 +192,41 @@ func isValidHeader(headers *LTable) bool {
 	})
 	return valid
 }
+
+// http.Header/url.Values 转 Lua table
+// 单个值转为 string，多个值转为数组式 table
+func headerToTable(L *LState, header map[string][]string) *LTable {
+	tbl := L.CreateTable(0, len(header))
+	for key, values := range header {
+		switch len(values) {
+		case 0:
+			continue
+		case 1:
+			tbl.RawSetString(key, LString(values[0]))
+		default:
+			arr := L.CreateTable(len(values), 0)
+			for _, v := range values {
+				arr.Append(LString(v))
+			}
+			tbl.RawSetString(key, arr)
+		}
+	}
+	return tbl
+}
+
+// Lua table转url.Values
+// 值可以是 string、number 或由它们组成的数组式 table
+func tableToValues(L *LState, tbl *LTable) url.Values {
+	values := make(url.Values, tbl.Len())
+	tbl.ForEach(func(k LValue, v LValue) {
+		key := lvalueToString(L, k)
+		if items, ok := v.(*LTable); ok {
+			items.ForEach(func(_, item LValue) {
+				values.Add(key, lvalueToString(L, item))
+			})
+		} else {
+			values.Add(key, lvalueToString(L, v))
+		}
+	})
+	return values
+}
@@ -16,11 +16,13 @@ var DbgLibFuncDoc = map[string]libFuncDoc{
 		libName: DebugLibName,
 		libFuncName: []string{
 			"GetFEnv",
+			"GetHook",
 			"GetInfo",
 			"GetLocal",
 			"GetMetatable",
 			"GetUpvalue",
 			"SetFEnv",
+			"SetHook",
 			"SetLocal",
 			"SetMetatable",
 			"SetUpvalue",
@@ -31,11 +33,13 @@ var DbgLibFuncDoc = map[string]libFuncDoc{
 
 var debugFuncs = map[string]LGFunction{
 	"GetFEnv":      debugGetFEnv,
+	"GetHook":      debugGetHook,
 	"GetInfo":      debugGetInfo,
 	"GetLocal":     debugGetLocal,
 	"GetMetatable": debugGetMetatable,
 	"GetUpvalue":   debugGetUpvalue,
 	"SetFEnv":      debugSetFEnv,
+	"SetHook":      debugSetHook,
 	"SetLocal":     debugSetLocal,
 	"SetMetatable": debugSetMetatable,
 	"SetUpvalue":   debugSetUpvalue,
@@ -64,6 +68,38 @@ func debugGetFEnv(L *LState) int {
 	return 1
 }
 
+// debugGetHook 模块函数，用于获取当前协程的钩子函数
+// 参数：
+//
+//	无
+//
+// 返回值：
+//
+//  1. function - 钩子函数，没有设置时为 nil
+//  2. string - 事件掩码
+//  3. number - 指令计数
+//
+// 调用方式：
+//  1. local fn, mask, count = debuglib.GetHook()
+//
+// 注意：
+//  1. 由 Go 代码通过 LState.SetHook 设置的钩子返回字符串 "external hook"
+func debugGetHook(L *LState) int {
+	hook := L.hook
+	if hook == nil {
+		L.Push(LNil)
+		return 1
+	}
+	if hook.value != nil {
+		L.Push(hook.value)
+	} else {
+		L.Push(LString("external hook"))
+	}
+	L.Push(LString(hookMaskToString(hook.mask)))
+	L.Push(LInteger(hook.count))
+	return 3
+}
+
 // debugGetInfo 模块函数，用于获取函数的信息
 // 参数：
 //  1. function|number - 函数或调用栈层级
@@ -90,8 +126,8 @@ func debugGetInfo(L *LState) int {
 	case *LFunction:
 		dbg = &Debug{}
 		fn, err = L.GetInfo(">"+what, dbg, lv)
-	case LNumber:
-		dbg, ok = L.GetStack(int(lv))
+	case LNumber, LInteger:
+		dbg, ok = L.GetStack(int(LVAsNumber(lv)))
 		if !ok {
 			L.Push(LNil)
 			return 1
@@ -111,10 +147,10 @@ func debugGetInfo(L *LState) int {
 	}
 	tbl.RawSetString("what", LString(dbg.What))
 	tbl.RawSetString("source", LString(dbg.Source))
-	tbl.RawSetString("currentline", LNumber(dbg.CurrentLine))
-	tbl.RawSetString("nups", LNumber(dbg.NUpvalues))
-	tbl.RawSetString("linedefined", LNumber(dbg.LineDefined))
-	tbl.RawSetString("lastlinedefined", LNumber(dbg.LastLineDefined))
+	tbl.RawSetString("currentline", LInteger(dbg.CurrentLine))
+	tbl.RawSetString("nups", LInteger(dbg.NUpvalues))
+	tbl.RawSetString("linedefined", LInteger(dbg.LineDefined))
+	tbl.RawSetString("lastlinedefined", LInteger(dbg.LastLineDefined))
 	tbl.RawSetString("func", fn)
 	L.Push(tbl)
 	return 1
@@ -232,6 +268,41 @@ func debugSetFEnv(L *LState) int {
 	return 0
 }
 
+// debugSetHook 模块函数，用于设置当前协程的钩子函数
+// 参数：
+//  1. function - 钩子函数（可选，省略时移除钩子）
+//  2. string - 事件掩码，由 "c"（调用）、"r"（返回）、"l"（新的一行）组合而成
+//  3. number - 指令计数，大于 0 时每执行 count 条指令调用一次钩子（可选）
+//
+// 返回值：
+//
+//	无
+//
+// 调用方式：
+//  1. debuglib.SetHook(fn, mask)
+//  2. debuglib.SetHook(fn, mask, count)
+//  3. debuglib.SetHook()
+//
+// 示例：
+//  1. debuglib.SetHook(func(event, line) { PrintLn(event, line) }, "crl")
+//  2. debuglib.SetHook(func(event) { PrintLn("1000 instructions") }, "", 1000)
+//
+// 注意：
+//  1. 钩子函数的第一个参数为事件名："call"、"return"、"line" 或 "count"，line 事件的第二个参数为行号
+//  2. 在钩子函数执行期间不会再触发钩子
+//  3. 新建的协程继承当前协程的钩子
+func debugSetHook(L *LState) int {
+	if L.GetTop() == 0 || L.Get(1) == LNil {
+		L.SetHook(nil, 0, 0)
+		return 0
+	}
+	fn := L.CheckFunction(1)
+	mask := hookMaskFromString(L.OptString(2, ""))
+	count := L.OptInt(3, 0)
+	L.setHook(luaHookFunc(fn), mask, count, fn)
+	return 0
+}
+
 // debugSetLocal 模块函数，用于设置函数的局部变量
 // 参数：
 //  1. number - 调用栈层级
@@ -374,3 +445,31 @@ func debugTraceback(L *LState) int {
 	L.Push(LString(traceback))
 	return 1
 }
+
+func hookMaskFromString(s string) HookMask {
+	var mask HookMask
+	if strings.Contains(s, "c") {
+		mask |= HookMaskCall
+	}
+	if strings.Contains(s, "r") {
+		mask |= HookMaskReturn
+	}
+	if strings.Contains(s, "l") {
+		mask |= HookMaskLine
+	}
+	return mask
+}
+
+func hookMaskToString(mask HookMask) string {
+	s := ""
+	if mask&HookMaskCall != 0 {
+		s += "c"
+	}
+	if mask&HookMaskReturn != 0 {
+		s += "r"
+	}
+	if mask&HookMaskLine != 0 {
+		s += "l"
+	}
+	return s
+}
@@ -33,6 +33,7 @@ type FunctionProto struct {
 	Code               []uint32
 	Constants          []LValue
 	FunctionPrototypes []*FunctionProto
+	SwitchTables       []*SwitchTable
 
 	DbgSourcePositions []int
 	DbgLocals          []*DbgLocalInfo
@@ -40,6 +41,13 @@ type FunctionProto struct {
 	DbgUpvalues        []string
 
 	stringConstants []string
+
+	// code is Code with superinstructions, which the VM executes unless hooks are set.
+	code []uint32
+	// cacheSlots maps the pcs of instructions with an inline cache to their index in the caches of
+	// the function, see LState.inlineCache. numCaches is the number of such instructions.
+	cacheSlots []int32
+	numCaches  int
 }
 
 /* Upvalue {{{ */
@@ -99,6 +107,7 @@ func newFunctionProto(name string) *FunctionProto {
 		Code:               make([]uint32, 0, 128),
 		Constants:          make([]LValue, 0, 32),
 		FunctionPrototypes: make([]*FunctionProto, 0, 16),
+		SwitchTables:       nil,
 
 		DbgSourcePositions: make([]int, 0, 128),
 		DbgLocals:          make([]*DbgLocalInfo, 0, 16),
@@ -109,6 +118,150 @@ func newFunctionProto(name string) *FunctionProto {
 	}
 }
 
+// quicken prepares the code the VM executes: it fuses frequent pairs of instructions into
+// superinstructions and assigns inline cache slots to string-key table accesses.
+// It must be called once the code is complete, before the prototype is shared.
+func (fp *FunctionProto) quicken() {
+	fp.code = append([]uint32(nil), fp.Code...)
+	fp.cacheSlots = make([]int32, len(fp.Code))
+	fp.numCaches = 0
+	for pc := 0; pc < len(fp.code); pc++ {
+		inst := fp.code[pc]
+		op := opGetOpCode(inst)
+		switch op {
+		case OP_GETTABLEKS, OP_SETTABLEKS, OP_SELF, OP_GETGLOBAL, OP_SETGLOBAL:
+			fp.cacheSlots[pc] = int32(fp.numCaches)
+			fp.numCaches++
+		}
+		next := OP_NOP
+		if pc+1 < len(fp.code) {
+			next = opGetOpCode(fp.code[pc+1])
+		}
+		switch {
+		case op == OP_EQ && next == OP_JMP:
+			opSetOpCode(&fp.code[pc], OP_EQJMP)
+		case op == OP_LT && next == OP_JMP:
+			opSetOpCode(&fp.code[pc], OP_LTJMP)
+		case op == OP_LE && next == OP_JMP:
+			opSetOpCode(&fp.code[pc], OP_LEJMP)
+		case op == OP_TEST && next == OP_JMP:
+			opSetOpCode(&fp.code[pc], OP_TESTJMP)
+		case op == OP_GETTABLEKS && next == OP_CALL:
+			opSetOpCode(&fp.code[pc], OP_GETTABLEKSCALL)
+		case op == OP_SELF && next == OP_CALL:
+			opSetOpCode(&fp.code[pc], OP_SELFCALL)
+		case op == OP_SETLIST && opGetArgC(inst) == 0:
+			// the next word is the block number, not an instruction
+			pc++
+		case op == OP_CLOSURE:
+			// the upvalue pseudo instructions are read by OP_CLOSURE
+			if bx := opGetArgBx(inst); bx < len(fp.FunctionPrototypes) {
+				pc += int(fp.FunctionPrototypes[bx].NumUpvalues)
+			}
+		}
+	}
+	for _, st := range fp.SwitchTables {
+		st.index()
+	}
+}
+
+/* SwitchTable {{{ */
+
+// SwitchTable is the jump table of an OP_SWITCH instruction. It maps the constant values and the types
+// of the cases of a switch statement to the offsets of their code from the instruction, like the sBx of OP_JMP.
+type SwitchTable struct {
+	Keys  []LValue
+	Jumps []int
+	// TypeJumps are the offsets of the type cases indexed by the type numbers of OP_TYPEASSERT,
+	// 0 for the types without a case.
+	TypeJumps [len(typeKindNames)]int
+
+	// dense integer keys are looked up in intJumps, the other keys in keyJumps
+	intMin   int64
+	intJumps []int
+	keyJumps map[LValue]int
+}
+
+// switchTypeKinds maps the value types to the type numbers of OP_TYPEASSERT, -1 for nil.
+var switchTypeKinds = [...]int{LTNil: -1, LTBool: 0, LTNumber: 1, LTString: 2, LTTable: 3,
+	LTFunction: 4, LTUserData: 5, LTThread: 6, LTChannel: 7}
+
+// switchKey returns lv as a key of a switch table. Floats with an integer value are looked up as integers.
+func switchKey(lv LValue) LValue {
+	if f, ok := lv.(LNumber); ok {
+		return numberKey(f)
+	}
+	return lv
+}
+
+// index builds the lookup structures of the table. Integer keys are stored in an array if they are
+// dense enough, that is if they fill at least half of the range between the smallest and the largest.
+func (st *SwitchTable) index() {
+	st.intJumps = nil
+	st.keyJumps = make(map[LValue]int, len(st.Keys))
+	var ints []int
+	var min, max int64
+	for i, key := range st.Keys {
+		if v, ok := switchKey(key).(LInteger); ok {
+			if len(ints) == 0 || int64(v) < min {
+				min = int64(v)
+			}
+			if len(ints) == 0 || int64(v) > max {
+				max = int64(v)
+			}
+			ints = append(ints, i)
+		} else {
+			st.keyJumps[switchKey(key)] = st.Jumps[i]
+		}
+	}
+	if len(ints) < 2 || uint64(max-min) >= uint64(2*len(ints)) {
+		for _, i := range ints {
+			st.keyJumps[switchKey(st.Keys[i])] = st.Jumps[i]
+		}
+		return
+	}
+	st.intMin = min
+	st.intJumps = make([]int, max-min+1)
+	for _, i := range ints {
+		st.intJumps[int64(switchKey(st.Keys[i]).(LInteger))-min] = st.Jumps[i]
+	}
+}
+
+// jump returns the offset of the case matching lv, 0 if no case matches.
+func (st *SwitchTable) jump(lv LValue) int {
+	key := switchKey(lv)
+	if v, ok := key.(LInteger); ok && st.intJumps != nil {
+		if i := int64(v) - st.intMin; i >= 0 && i < int64(len(st.intJumps)) && st.intJumps[i] != 0 {
+			return st.intJumps[i]
+		}
+	} else if jump, ok := st.keyJumps[key]; ok {
+		return jump
+	}
+	if kind := switchTypeKinds[lv.Type()]; kind >= 0 {
+		return st.TypeJumps[kind]
+	}
+	return 0
+}
+
+func (st *SwitchTable) String() string {
+	cases := []string{}
+	for i, key := range st.Keys {
+		if str, ok := key.(LString); ok {
+			cases = append(cases, fmt.Sprintf("%q:%+d", string(str), st.Jumps[i]))
+		} else {
+			cases = append(cases, fmt.Sprintf("%v:%+d", key, st.Jumps[i]))
+		}
+	}
+	for kind, jump := range st.TypeJumps {
+		if jump != 0 {
+			cases = append(cases, fmt.Sprintf("%v:%+d", typeKindNames[kind], jump))
+		}
+	}
+	return strings.Join(cases, " ")
+}
+
+/* }}} */
+
 func (fp *FunctionProto) String() string {
 	return fp.str(1, 0)
 }
@@ -129,6 +282,9 @@ func (fp *FunctionProto) str(level int, count int) string {
 	for reg, conzt := range fp.Constants {
 		buf = append(buf, fmt.Sprintf("%v.const %v ; %v\n", indent, conzt.String(), reg))
 	}
+	for no, st := range fp.SwitchTables {
+		buf = append(buf, fmt.Sprintf("%v.switch %v ; %v\n", indent, st.String(), no))
+	}
 	buf = append(buf, "\n")
 
 	protono := 0
@@ -179,7 +335,7 @@ func (fn *LFunction) LocalName(regno, pc int) (string, bool) {
 		return "", false
 	}
 	p := fn.Proto
-	for i := 0; i < len(p.DbgLocals) && p.DbgLocals[i].StartPc < pc; i++ {
+	for i := 0; i < len(p.DbgLocals) && p.DbgLocals[i].StartPc <= pc; i++ {
 		if pc < p.DbgLocals[i].EndPc {
 			regno--
 			if regno == 0 {
@@ -0,0 +1,378 @@
+package lua
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+/* garbage collection {{{ */
+
+// The Go garbage collector frees the LValues nothing refers to, but it does not know about weak tables and
+// __gc metamethods. Both are handled by collection cycles, which mark the objects reachable from the registry,
+// the globals and the stacks of the threads of the state, the same way measureMemory does.
+// Go code that keeps LValues outside of the state, like the handlers of a running server, pins them with
+// pinValue, and the values waiting in channels are counted by holdChannelValue. Everything else only
+// referenced by Go code or by threads running in other goroutines is not seen by a cycle, so a cycle must
+// not run while other threads of the state are executing. There is no locking to enforce that.
+
+// pinValue keeps lv reachable for collection cycles while Go code refers to it. Each call must be
+// matched by a call to unpinValue.
+func (ls *LState) pinValue(lv LValue) {
+	g := ls.G
+	g.gcMutex.Lock()
+	if g.gcRoots == nil {
+		g.gcRoots = make(map[LValue]int)
+	}
+	g.gcRoots[lv]++
+	g.gcMutex.Unlock()
+}
+
+func (ls *LState) unpinValue(lv LValue) {
+	g := ls.G
+	g.gcMutex.Lock()
+	if g.gcRoots[lv] > 1 {
+		g.gcRoots[lv]--
+	} else {
+		delete(g.gcRoots, lv)
+	}
+	g.gcMutex.Unlock()
+}
+
+// channelValues counts the collectable values sent to channels and not received yet. The buffers of Go
+// channels cannot be inspected, so collection cycles treat these values as reachable. Channels are passed
+// between states of different globals, hence the counts are shared by all of them.
+// A value left in a channel nobody receives from stays reachable.
+var channelValues = struct {
+	sync.Mutex
+	counts map[LValue]int
+}{counts: make(map[LValue]int)}
+
+// holdChannelValue records lv as being sent to a channel. Each call must be matched by a call to
+// releaseChannelValue once the value has been received or the send has been given up.
+func holdChannelValue(lv LValue) {
+	if !isCollectable(lv) {
+		return
+	}
+	channelValues.Lock()
+	channelValues.counts[lv]++
+	channelValues.Unlock()
+}
+
+// releaseChannelValue forgets a value recorded by holdChannelValue. Values sent to the channel by Go code
+// were never recorded and are ignored.
+func releaseChannelValue(lv LValue) {
+	if !isCollectable(lv) {
+		return
+	}
+	channelValues.Lock()
+	if channelValues.counts[lv] > 1 {
+		channelValues.counts[lv]--
+	} else {
+		delete(channelValues.counts, lv)
+	}
+	channelValues.Unlock()
+}
+
+// registerFinalizer records a userdata whose metatable has a __gc metamethod, so that the metamethod is
+// called by the first collection cycle which finds the userdata unreachable.
+func (ls *LState) registerFinalizer(ud *LUserData) {
+	g := ls.G
+	g.gcMutex.Lock()
+	g.registerFinalizer(ud)
+	g.gcMutex.Unlock()
+}
+
+func (g *Global) registerFinalizer(ud *LUserData) {
+	if _, ok := g.finalizers[ud]; ok {
+		return
+	}
+	if g.finalizers == nil {
+		g.finalizers = make(map[*LUserData]uint64)
+	}
+	g.gcSeq++
+	g.finalizers[ud] = g.gcSeq
+}
+
+// cancelFinalizer forgets a userdata registered by registerFinalizer. Libraries call it when a resource
+// is closed, as its finalizer has nothing left to do, so that the userdata is not kept until the next
+// collection cycle.
+func (ls *LState) cancelFinalizer(ud *LUserData) {
+	g := ls.G
+	g.gcMutex.Lock()
+	delete(g.finalizers, ud)
+	g.gcMutex.Unlock()
+}
+
+// runFinalizers calls the __gc metamethods of all the registered userdata, in the reverse order of their
+// registration, when the state is closed. Errors raised by the metamethods are ignored.
+func (ls *LState) runFinalizers() {
+	g := ls.G
+	g.gcMutex.Lock()
+	seqs := g.finalizers
+	g.finalizers = nil
+	g.gcMutex.Unlock()
+	pending := make([]*LUserData, 0, len(seqs))
+	for ud := range seqs {
+		pending = append(pending, ud)
+		ud.finalized = true
+	}
+	sort.Slice(pending, func(i, j int) bool { return seqs[pending[i]] > seqs[pending[j]] })
+	for _, ud := range pending {
+		fn := ls.metaOp1(ud, "__gc")
+		if fn == LNil {
+			continue
+		}
+		ls.Push(fn)
+		ls.Push(ud)
+		ls.PCall(1, 0, nil)
+	}
+}
+
+func hasFinalizer(mt LValue) bool {
+	tb, ok := mt.(*LTable)
+	return ok && tb.RawGetString("__gc") != LNil
+}
+
+// weakMode returns whether the keys and the values of tb are weak references.
+func weakMode(tb *LTable) (weakKeys, weakValues bool) {
+	mt, ok := tb.Metatable.(*LTable)
+	if !ok {
+		return false, false
+	}
+	mode, ok := mt.RawGetString("__mode").(LString)
+	if !ok {
+		return false, false
+	}
+	return strings.Contains(string(mode), "k"), strings.Contains(string(mode), "v")
+}
+
+// isCollectable returns true for the values a weak table does not keep alive.
+// Strings, numbers and channels are values and are never removed from weak tables.
+func isCollectable(lv LValue) bool {
+	switch lv.(type) {
+	case *LTable, *LFunction, *LUserData, *LState:
+		return true
+	}
+	return false
+}
+
+// CollectGarbage runs a full collection cycle: it removes the unreachable objects from weak tables and
+// calls the __gc metamethods of the unreachable userdata, in the reverse order of their registration.
+// Errors raised by the metamethods are reported after all of them have run.
+// It must not be called while other threads of the state are executing in other goroutines, since the
+// objects only they refer to would be collected, and their stacks are read without synchronization.
+func (ls *LState) CollectGarbage() {
+	g := ls.G
+	m := &gcMarker{marked: make(map[LValue]struct{})}
+	g.gcMutex.Lock()
+	for lv := range g.gcRoots {
+		m.mark(lv)
+	}
+	g.gcMutex.Unlock()
+	channelValues.Lock()
+	for lv := range channelValues.counts {
+		m.mark(lv)
+	}
+	channelValues.Unlock()
+	m.mark(g.Registry)
+	m.mark(g.Global)
+	for _, mt := range g.builtinMts {
+		m.mark(mt)
+	}
+	if ls.Env != nil {
+		m.mark(ls.Env)
+	}
+	m.mark(g.MainThread)
+	m.mark(g.CurrentThread)
+	m.mark(ls)
+	m.propagate()
+
+	g.gcMutex.Lock()
+	for _, ud := range m.finalizable {
+		g.registerFinalizer(ud)
+	}
+	var dead []*LUserData
+	seqs := make(map[*LUserData]uint64)
+	for ud, seq := range g.finalizers {
+		if !m.isMarked(ud) {
+			dead = append(dead, ud)
+			seqs[ud] = seq
+			delete(g.finalizers, ud)
+			ud.finalized = true
+		}
+	}
+	g.gcMutex.Unlock()
+
+	// like Lua, weak values are cleared before the objects being finalized are resurrected,
+	// and weak keys after, so that the finalizers can still use the tables keyed by their objects
+	m.clearWeak(false)
+	for _, ud := range dead {
+		m.mark(ud)
+	}
+	m.propagate()
+	m.clearWeak(true)
+
+	sort.Slice(dead, func(i, j int) bool { return seqs[dead[i]] > seqs[dead[j]] })
+	var gcerr error
+	for _, ud := range dead {
+		fn := ls.metaOp1(ud, "__gc")
+		if fn == LNil {
+			continue
+		}
+		ls.Push(fn)
+		ls.Push(ud)
+		if err := ls.PCall(1, 0, nil); err != nil && gcerr == nil {
+			gcerr = err
+		}
+	}
+	if gcerr != nil {
+		ls.RaiseError("error in __gc metamethod (%v)", gcerr.Error())
+	}
+}
+
+type gcMarker struct {
+	marked map[LValue]struct{}
+	gray   []LValue
+	// tables with weak keys or values
+	weak []*LTable
+	// tables with weak keys only, whose values are marked once their keys are marked
+	ephemerons []*LTable
+	// reachable userdata with a __gc metamethod
+	finalizable []*LUserData
+}
+
+func (m *gcMarker) isMarked(lv LValue) bool {
+	_, ok := m.marked[lv]
+	return ok || !isCollectable(lv)
+}
+
+func (m *gcMarker) mark(lv LValue) {
+	if lv == nil || m.isMarked(lv) {
+		return
+	}
+	m.marked[lv] = struct{}{}
+	m.gray = append(m.gray, lv)
+}
+
+// propagate marks everything reachable from the marked objects.
+func (m *gcMarker) propagate() {
+	for {
+		for len(m.gray) > 0 {
+			lv := m.gray[len(m.gray)-1]
+			m.gray = m.gray[:len(m.gray)-1]
+			m.traverse(lv)
+		}
+		// an ephemeron value is reachable if its key is, which may change as more objects are marked
+		for _, tb := range m.ephemerons {
+			tb.ForEach(func(key, value LValue) {
+				if m.isMarked(key) {
+					m.mark(value)
+				}
+			})
+		}
+		if len(m.gray) == 0 {
+			return
+		}
+	}
+}
+
+func (m *gcMarker) traverse(lv LValue) {
+	switch v := lv.(type) {
+	case *LTable:
+		if v == nil {
+			return
+		}
+		m.mark(v.Metatable)
+		weakKeys, weakValues := weakMode(v)
+		if weakKeys || weakValues {
+			m.weak = append(m.weak, v)
+		}
+		switch {
+		case weakKeys && weakValues:
+		case weakKeys:
+			m.ephemerons = append(m.ephemerons, v)
+		case weakValues:
+			v.ForEach(func(key, _ LValue) { m.mark(key) })
+		default:
+			v.ForEach(func(key, value LValue) {
+				m.mark(key)
+				m.mark(value)
+			})
+		}
+	case *LFunction:
+		if v == nil {
+			return
+		}
+		if v.Env != nil {
+			m.mark(v.Env)
+		}
+		for _, uv := range v.Upvalues {
+			if uv != nil {
+				m.mark(uv.Value())
+			}
+		}
+	case *LUserData:
+		if v == nil {
+			return
+		}
+		if v.Env != nil {
+			m.mark(v.Env)
+		}
+		m.mark(v.Metatable)
+		if value, ok := v.Value.(LValue); ok {
+			m.mark(value)
+		}
+		if !v.finalized && hasFinalizer(v.Metatable) {
+			m.finalizable = append(m.finalizable, v)
+		}
+	case *LState:
+		if v == nil {
+			return
+		}
+		if v.Env != nil {
+			m.mark(v.Env)
+		}
+		if v.Parent != nil {
+			m.mark(v.Parent)
+		}
+		if v.reg != nil {
+			for i := 0; i < v.reg.Top(); i++ {
+				m.mark(v.reg.array[i])
+			}
+		}
+		if v.stack != nil {
+			for i := 0; i < v.stack.Sp(); i++ {
+				cf := v.stack.At(i)
+				if cf.Fn != nil {
+					m.mark(cf.Fn)
+				}
+				for _, dc := range cf.defers {
+					m.mark(dc.fn)
+					for _, arg := range dc.args {
+						m.mark(arg)
+					}
+				}
+			}
+		}
+	}
+}
+
+// clearWeak removes the entries of the weak tables which refer to unmarked objects,
+// by their weak values if keys is false and by their weak keys otherwise.
+func (m *gcMarker) clearWeak(keys bool) {
+	for _, tb := range m.weak {
+		weakKeys, weakValues := weakMode(tb)
+		var dead []LValue
+		tb.ForEach(func(key, value LValue) {
+			if keys && weakKeys && !m.isMarked(key) || !keys && weakValues && !m.isMarked(value) {
+				dead = append(dead, key)
+			}
+		})
+		for _, key := range dead {
+			tb.RawSet(key, LNil)
+		}
+	}
+}
+
+/* }}} */
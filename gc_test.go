@@ -0,0 +1,184 @@
+package lua
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWeakTables(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local keep = {}
+		local keys = SetMetatable({}, {__mode = "k"})
+		keys[keep], keys[{}], keys.s = 1, 2, 3
+		local values = SetMetatable({}, {__mode = "v"})
+		values[1], values[2], values.s = {}, keep, "str"
+		local both = SetMetatable({}, {__mode = "kv"})
+		both[keep], both[{}], both.f = keep, 1, func() { }
+		// a value referring to its own key does not keep the entry alive
+		local ephemerons = SetMetatable({}, {__mode = "k"})
+		local obj = {}
+		ephemerons[obj] = {ref = obj}
+		ephemerons[keep] = {ref = keep}
+		obj = nil
+		CollectGarbage()
+
+		local func count(t) {
+			local n = 0
+			for _ in Pairs(t) { n = n + 1 }
+			return n
+		}
+		result = tbllib.Concat({
+			count(keys), keys[keep], keys.s,
+			count(values), ToString(values[2] == keep), values.s,
+			count(both), count(ephemerons),
+		}, ",")
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if result := L.GetGlobal("result").String(); result != "2,1,3,2,true,str,1,1" {
+		t.Errorf("unexpected result %q", result)
+	}
+}
+
+func TestFinalizers(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	path := filepath.Join(t.TempDir(), "gc.txt")
+	L.SetGlobal("path", LString(path))
+	if err := L.DoString(`
+		local log = {}
+		local proto = NewProxy(true)
+		GetMetatable(proto).__gc = func(u) { log[#log + 1] = names[u] }
+		names = SetMetatable({}, {__mode = "k"})
+		for i = 1, 3 { names[NewProxy(proto)] = "u" .. i }
+		local live = NewProxy(proto)
+		names[live] = "live"
+		CollectGarbage()
+		first = tbllib.Concat(log, ",")
+		live = nil
+		CollectGarbage()
+		CollectGarbage()
+		second = tbllib.Concat(log, ",")
+
+		{
+			local f = iolib.Open(path, "w")
+			f:Write("data")
+		}
+		CollectGarbage()
+		local f = iolib.Open(path, "r")
+		content = f:Read("*a")
+		f:Close()
+	`); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"first": "u3,u2,u1", "second": "u3,u2,u1,live", "content": "data"} {
+		if v := L.GetGlobal(name).String(); v != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, v)
+		}
+	}
+
+	err := L.DoString(`
+		local ud = NewProxy(true)
+		GetMetatable(ud).__gc = func() { Error("boom") }
+		SetMetatable(ud, GetMetatable(ud))
+		ud = nil
+		CollectGarbage()
+	`)
+	if err == nil || !strings.Contains(err.Error(), "error in __gc metamethod") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCollectGarbageRoots(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local keys = SetMetatable({}, {__mode = "k"})
+		local ch = chnlib.Make(1)
+		{
+			local key = {}
+			keys[key] = "sent"
+			ch:Send(key)
+		}
+		CollectGarbage()
+		inTransit = Next(keys) ~= nil
+		local _, key = ch:Receive()
+		Assert(keys[key] == "sent")
+		key = nil
+		CollectGarbage()
+		received = Next(keys) == nil
+
+		// the handlers of a running server are reachable, and so are their upvalues
+		local log = {}
+		local srv = httplib.NewServer("127.0.0.1:0")
+		{
+			local proxy = NewProxy(true)
+			GetMetatable(proxy).__gc = func() { log[#log + 1] = "gc" }
+			srv:Handle("/", func() { return ToString(proxy) })
+		}
+		srv:Start()
+		CollectGarbage()
+		running = #log == 0
+		srv:Shutdown()
+		srv = nil
+		CollectGarbage()
+		stopped = #log == 1
+	`); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"inTransit", "received", "running", "stopped"} {
+		if L.GetGlobal(name) != LTrue {
+			t.Errorf("%s: expected true", name)
+		}
+	}
+}
+
+func TestFinalizersReleased(t *testing.T) {
+	L := NewState()
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	L.SetGlobal("path", LString(path))
+	if err := L.DoString(`
+		local f = iolib.Open(path, "w")
+		f:Write("a\nb\n")
+		f:Close()
+	`); err != nil {
+		t.Fatal(err)
+	}
+	before := len(L.G.finalizers)
+	// files closed by Lines or Close are not kept until a collection cycle
+	if err := L.DoString(`
+		for i = 1, 100 {
+			for line in iolib.Lines(path) { }
+			iolib.Open(path, "r"):Close()
+		}
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(L.G.finalizers); n != before {
+		t.Errorf("expected %d finalizers, got %d", before, n)
+	}
+
+	// closing the state runs the remaining finalizers
+	if err := L.DoString(`
+		log = {}
+		local proto = NewProxy(true)
+		GetMetatable(proto).__gc = func(u) { log[#log + 1] = names[u] }
+		names = {}
+		keep = {}
+		for i = 1, 2 {
+			local u = NewProxy(proto)
+			names[u] = "u" .. i
+			keep[i] = u
+		}
+	`); err != nil {
+		t.Fatal(err)
+	}
+	log := L.GetGlobal("log").(*LTable)
+	L.Close()
+	if s := log.RawGetInt(1).String() + "," + log.RawGetInt(2).String(); s != "u2,u1" {
+		t.Errorf("unexpected finalizer calls %q", s)
+	}
+}
@@ -0,0 +1,187 @@
+package lua
+
+/* debug hooks {{{ */
+
+// HookEventType is the type of the event a hook is called for.
+type HookEventType int
+
+const (
+	// HookCall is fired when a function is called, before its first instruction runs.
+	HookCall HookEventType = iota
+	// HookReturn is fired when a function is about to return.
+	HookReturn
+	// HookLine is fired when the VM starts executing a new line, or jumps back to the same line.
+	HookLine
+	// HookCount is fired after every Count instructions.
+	HookCount
+)
+
+var hookEventNames = [...]string{"call", "return", "line", "count"}
+
+func (t HookEventType) String() string {
+	return hookEventNames[t]
+}
+
+// HookEvent describes the event a hook is called for.
+type HookEvent struct {
+	Type HookEventType
+	// Line is the line about to be executed, or -1 if the running function is a Go function.
+	Line int
+}
+
+// HookMask selects the events a hook is called for.
+type HookMask int
+
+const (
+	HookMaskCall HookMask = 1 << iota
+	HookMaskReturn
+	HookMaskLine
+	HookMaskCount
+)
+
+// HookFunc is called by the VM for the events selected by the HookMask.
+// Hooks are not called recursively: functions called from a hook do not fire events.
+type HookFunc func(L *LState, ev HookEvent)
+
+type lHook struct {
+	fn    HookFunc
+	mask  HookMask
+	count int
+	// the Lua function set by dbglib.SetHook, nil for hooks set from Go
+	value LValue
+
+	counter   int
+	lastFrame *callFrame
+	lastFn    *LFunction
+	lastPc    int
+	running   bool
+}
+
+// SetHook sets a hook function for this LState, replacing the previous one. mask selects the events the hook
+// is called for, and if count is greater than 0 the hook is also called after every count instructions.
+// A nil fn, or a zero mask with no count, removes the hook.
+// Threads created by NewThread inherit the hook of this LState.
+func (ls *LState) SetHook(fn HookFunc, mask HookMask, count int) {
+	ls.setHook(fn, mask, count, nil)
+}
+
+// GetHook returns the hook function, mask and count set by SetHook.
+func (ls *LState) GetHook() (HookFunc, HookMask, int) {
+	if ls.hook == nil {
+		return nil, 0, 0
+	}
+	return ls.hook.fn, ls.hook.mask, ls.hook.count
+}
+
+func (ls *LState) setHook(fn HookFunc, mask HookMask, count int, value LValue) {
+	if count > 0 {
+		mask |= HookMaskCount
+	} else {
+		mask &^= HookMaskCount
+	}
+	if fn == nil || mask == 0 {
+		ls.hook = nil
+	} else {
+		ls.hook = &lHook{fn: fn, mask: mask, count: count, value: value}
+	}
+	ls.updateMainLoop()
+}
+
+// inheritHook copies the hook of ls to the thread th, with the tracing state reset.
+func (ls *LState) inheritHook(th *LState) {
+	if ls.hook != nil {
+		th.setHook(ls.hook.fn, ls.hook.mask, ls.hook.count, ls.hook.value)
+	}
+}
+
+// trace fires the hook events for the instruction at pc of the Lua function in frame cf.
+func (h *lHook) trace(L *LState, cf *callFrame, pc int) {
+	if h.running {
+		return
+	}
+	proto := cf.Fn.Proto
+	newFrame := cf != h.lastFrame || cf.Fn != h.lastFn
+	prevPc := h.lastPc
+	if newFrame {
+		prevPc = pc - 1
+	}
+	h.lastFrame, h.lastFn, h.lastPc = cf, cf.Fn, pc
+
+	line := protoLine(proto, pc)
+	if h.mask&HookMaskCount != 0 {
+		h.counter++
+		if h.counter >= h.count {
+			h.counter = 0
+			if !h.fire(L, cf, HookCount, line) {
+				return
+			}
+		}
+	}
+	if h.mask&HookMaskCall != 0 && pc == 0 && newFrame {
+		if !h.fire(L, cf, HookCall, line) {
+			return
+		}
+	}
+	if h.mask&HookMaskLine != 0 && (prevPc < 0 || pc <= prevPc || protoLine(proto, prevPc) != line) {
+		if !h.fire(L, cf, HookLine, line) {
+			return
+		}
+	}
+	if h.mask&HookMaskReturn != 0 && opGetOpCode(proto.Code[pc]) == OP_RETURN {
+		h.fire(L, cf, HookReturn, line)
+	}
+}
+
+// traceG fires the call or return event of a Go function.
+func (h *lHook) traceG(L *LState, typ HookEventType) {
+	if h.running {
+		return
+	}
+	if (typ == HookCall && h.mask&HookMaskCall != 0) || (typ == HookReturn && h.mask&HookMaskReturn != 0) {
+		h.fire(L, nil, typ, -1)
+	}
+}
+
+// fire calls the hook function and reports whether the hook is still set afterwards.
+func (h *lHook) fire(L *LState, cf *callFrame, typ HookEventType, line int) bool {
+	// registers of the running Lua function may lie above the top, protect them from the hook
+	top := L.reg.Top()
+	if cf != nil {
+		if maxreg := cf.LocalBase + int(cf.Fn.Proto.NumUsedRegisters); top < maxreg {
+			if maxreg > cap(L.reg.array) {
+				L.reg.resize(maxreg)
+			}
+			L.reg.top = maxreg
+		}
+	}
+	h.running = true
+	defer func() {
+		h.running = false
+		L.reg.top = top
+	}()
+	h.fn(L, HookEvent{Type: typ, Line: line})
+	return L.hook == h
+}
+
+func protoLine(proto *FunctionProto, pc int) int {
+	if pc < len(proto.DbgSourcePositions) {
+		return proto.DbgSourcePositions[pc]
+	}
+	return -1
+}
+
+// luaHookFunc calls the Lua function fn with the event name, and the line number for line events.
+func luaHookFunc(fn *LFunction) HookFunc {
+	return func(L *LState, ev HookEvent) {
+		L.Push(fn)
+		L.Push(LString(ev.Type.String()))
+		if ev.Type == HookLine {
+			L.Push(LInteger(ev.Line))
+			L.Call(2, 0)
+		} else {
+			L.Call(1, 0)
+		}
+	}
+}
+
+/* }}} */
@@ -0,0 +1,389 @@
+package lua
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	httpClientClass = "HTTPCLIENT*"
+)
+
+// 默认超时时间与最大重定向次数
+const (
+	httpDefaultTimeout      = 30 * time.Second
+	httpDefaultMaxRedirects = 10
+)
+
+// httpClientMethods 定义 http 客户端的实例方法（面向对象调用）
+var httpClientMethods = map[string]LGFunction{
+	"Get":           httpClientGet,
+	"Post":          httpClientPost,
+	"Put":           httpClientPut,
+	"Patch":         httpClientPatch,
+	"Delete":        httpClientDelete,
+	"Head":          httpClientHead,
+	"Options":       httpClientOptions,
+	"Request":       httpClientRequest,
+	"PostForm":      httpClientPostForm,
+	"PostMultipart": httpClientPostMultipart,
+	"SetTimeout":    httpClientSetTimeout,
+}
+
+// httpClient 用于封装 http.Client 对象及其超时设置
+type httpClient struct {
+	client  *http.Client
+	timeout time.Duration
+}
+
+func newHttpClient() *httpClient {
+	return &httpClient{
+		client:  &http.Client{Transport: http.DefaultTransport},
+		timeout: httpDefaultTimeout,
+	}
+}
+
+func newHttpClientUserData(L *LState, c *httpClient) *LUserData {
+	ud := L.NewUserData()
+	ud.Value = c
+	L.SetMetatable(ud, L.GetTypeMetatable(httpClientClass))
+	return ud
+}
+
+func checkHttpClient(L *LState) *httpClient {
+	ud := L.CheckUserData(1)
+	if c, ok := ud.Value.(*httpClient); ok && c != nil {
+		return c
+	}
+	L.ArgError(1, "http client expected")
+	return nil
+}
+
+// httpBody 描述请求体，size 为 -1 表示长度未知
+type httpBody struct {
+	reader      io.Reader
+	size        int64
+	contentType string
+}
+
+// send 发送请求并返回未读取的响应，调用方负责关闭响应体并调用 cancel
+func (c *httpClient) send(L *LState, method, url string, body *httpBody, headers *LTable, timeout time.Duration) (*http.Response, context.CancelFunc, error) {
+	// 使用 context.WithTimeout 控制请求超时，超时覆盖读取响应体的过程
+	// LState 的 context 结束时请求也会被取消
+	ctx, cancel := context.WithTimeout(L.contextOrBackground(), timeout)
+
+	var reader io.Reader
+	if body != nil {
+		reader = body.reader
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("create request failed: %v", err)
+	}
+
+	if headers != nil && isValidHeader(headers) {
+		req.Header = tableToHeader(L, headers)
+	}
+
+	if body != nil {
+		if body.size >= 0 {
+			req.ContentLength = body.size
+		}
+		// 带请求体时默认 Content-Type
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", body.contentType)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		cancel()
+		L.CheckContext()
+		return nil, nil, fmt.Errorf("HTTP %s error: %v", strings.ToLower(method), err)
+	}
+	return resp, cancel, nil
+}
+
+// do 发送请求并读取完整的响应体，非 2xx 响应不视为错误
+func (c *httpClient) do(L *LState, method, url string, body *httpBody, headers *LTable, timeout time.Duration) (*http.Response, []byte, error) {
+	resp, cancel, err := c.send(L, method, url, body, headers, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		L.CheckContext()
+		return nil, nil, fmt.Errorf("HTTP read error: %v", err)
+	}
+	return resp, data, nil
+}
+
+// toHttpBody 将字符串或 iolib 的文件句柄转换为请求体，其他类型返回 nil
+func toHttpBody(L *LState, lv LValue) *httpBody {
+	switch v := lv.(type) {
+	case LString, LNumber, LInteger:
+		str := LVAsString(v)
+		return &httpBody{reader: strings.NewReader(str), size: int64(len(str)), contentType: "application/json"}
+	case *LUserData:
+		if file, ok := v.Value.(*lFile); ok {
+			return fileToHttpBody(L, file)
+		}
+	}
+	return nil
+}
+
+// fileToHttpBody 将可读的文件句柄转换为请求体，普通文件从当前位置读到末尾
+func fileToHttpBody(L *LState, file *lFile) *httpBody {
+	if file.closed {
+		L.RaiseError("%s is closed", file.Name())
+	}
+	if file.reader == nil {
+		L.RaiseError("%s is opened for only writing", file.Name())
+	}
+	body := &httpBody{reader: file.reader, size: -1, contentType: "application/octet-stream"}
+	if file.Type() == lFileFile {
+		if err := file.AbandonReadBuffer(); err == nil {
+			pos, perr := file.fp.Seek(0, io.SeekCurrent)
+			st, serr := file.fp.Stat()
+			if perr == nil && serr == nil && st.Mode().IsRegular() {
+				body.size = st.Size() - pos
+				body.reader = io.LimitReader(file.fp, body.size)
+			}
+		}
+	}
+	return body
+}
+
+// httpStream 在关闭响应体时同时释放请求的 context
+type httpStream struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (s *httpStream) Close() error {
+	defer s.cancel()
+	return s.ReadCloser.Close()
+}
+
+// newHttpStream 将响应体包装为只读的 iolib 文件句柄，支持 Read、Lines、Close 方法
+func newHttpStream(L *LState, resp *http.Response, cancel context.CancelFunc) *LUserData {
+	stream := &httpStream{ReadCloser: resp.Body, cancel: cancel}
+	ud := L.NewUserData()
+	ud.Value = &lFile{
+		stdout: stream,
+		reader: bufio.NewReaderSize(stream, fileDefaultReadBuffer),
+		name:   resp.Request.URL.String(),
+	}
+	L.SetMetatable(ud, L.GetTypeMetatable(lFileClass))
+	return ud
+}
+
+// httpNewClient 模块函数，用于创建独立配置的 http 客户端
+// 参数：
+//  1. options (table) - 客户端配置（可选），包含以下字段：
+//     timeout (number) - 超时时间，单位为默认时间单位（可选，默认 30 秒）
+//     follow_redirects (bool) - 是否跟随重定向（可选，默认为 true）
+//     max_redirects (number) - 最大重定向次数（可选，默认为 10）
+//     proxy (string) - 代理地址，例如 "http://127.0.0.1:8080"（可选，默认读取环境变量）
+//     tls (table) - TLS 配置（可选），包含 ca_file、insecure、cert、key 字段
+//     cookie_jar (bool) - 是否在多次请求之间保存 cookie（可选，默认为 false）
+//
+// 返回值：
+//  1. userdata（封装了 *httpClient 对象，可调用 Get、Post、Put、Patch、Delete、Head、Options、Request、PostForm、PostMultipart、SetTimeout 方法）
+//
+// 调用方式：
+//  1. local client = httplib.NewClient({timeout=10, cookie_jar=true})
+//
+// 示例：
+//  1. local client = httplib.NewClient({follow_redirects=false, tls={ca_file="ca.pem"}})
+//     local body, resp = client:Get("https://example.com")
+//
+// 备注：
+//  1. 客户端方法的参数与返回值与同名模块函数一致
+//  2. 每个客户端的设置互不影响，也不受 httplib.SetTimeout 影响
+//  3. tls.cert 与 tls.key 需同时提供，用于客户端证书认证
+func httpNewClient(L *LState) int {
+	opts := L.OptTable(1, L.NewTable())
+
+	c := newHttpClient()
+	if lv := opts.RawGetString("timeout"); lv != LNil {
+		n, ok := LVAsNumber(lv), lv.Type() == LTNumber
+		if !ok {
+			L.ArgError(1, "timeout must be a number")
+		}
+		c.timeout = time.Duration(float64(n) * float64(timeUnit[defaultTimeUnit]))
+	}
+
+	followRedirects := true
+	if lv := opts.RawGetString("follow_redirects"); lv != LNil {
+		followRedirects = LVAsBool(lv)
+	}
+	maxRedirects := httpDefaultMaxRedirects
+	if lv := opts.RawGetString("max_redirects"); lv != LNil {
+		n, ok := LVAsNumber(lv), lv.Type() == LTNumber
+		if !ok {
+			L.ArgError(1, "max_redirects must be a number")
+		}
+		maxRedirects = int(n)
+	}
+	c.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !followRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if lv := opts.RawGetString("proxy"); lv != LNil {
+		str, ok := lv.(LString)
+		if !ok {
+			L.ArgError(1, "proxy must be a string")
+		}
+		proxy, err := url.Parse(string(str))
+		if err != nil {
+			L.RaiseError("invalid proxy %q: %v", string(str), err)
+			return 0
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if lv := opts.RawGetString("tls"); lv != LNil {
+		tbl, ok := lv.(*LTable)
+		if !ok {
+			L.ArgError(1, "tls must be a table")
+		}
+		cfg, err := tableToTLSConfig(tbl)
+		if err != nil {
+			L.RaiseError("invalid tls config: %v", err)
+			return 0
+		}
+		transport.TLSClientConfig = cfg
+	}
+	c.client.Transport = transport
+
+	if LVAsBool(opts.RawGetString("cookie_jar")) {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			L.RaiseError("create cookie jar failed: %v", err)
+			return 0
+		}
+		c.client.Jar = jar
+	}
+
+	L.Push(newHttpClientUserData(L, c))
+	return 1
+}
+
+// tableToTLSConfig 将 tls 配置表转换为 tls.Config
+func tableToTLSConfig(tbl *LTable) (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: LVAsBool(tbl.RawGetString("insecure")),
+	}
+	if caFile := LVAsString(tbl.RawGetString("ca_file")); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %q", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	certFile := LVAsString(tbl.RawGetString("cert"))
+	keyFile := LVAsString(tbl.RawGetString("key"))
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("cert and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// httpClientGet 为 httpClient 的实例方法，用于发送 HTTP GET 请求
+// 调用方式：local body, resp = client:Get(url, headers)
+func httpClientGet(L *LState) int {
+	return httpNoBodyAux(L, checkHttpClient(L), 2, "GET")
+}
+
+// httpClientPost 为 httpClient 的实例方法，用于发送 HTTP POST 请求
+// 调用方式：local body, resp = client:Post(url, body, headers)
+func httpClientPost(L *LState) int {
+	return httpBodyAux(L, checkHttpClient(L), 2, "POST")
+}
+
+// httpClientPut 为 httpClient 的实例方法，用于发送 HTTP PUT 请求
+// 调用方式：local body, resp = client:Put(url, body, headers)
+func httpClientPut(L *LState) int {
+	return httpBodyAux(L, checkHttpClient(L), 2, "PUT")
+}
+
+// httpClientPatch 为 httpClient 的实例方法，用于发送 HTTP PATCH 请求
+// 调用方式：local body, resp = client:Patch(url, body, headers)
+func httpClientPatch(L *LState) int {
+	return httpBodyAux(L, checkHttpClient(L), 2, "PATCH")
+}
+
+// httpClientDelete 为 httpClient 的实例方法，用于发送 HTTP DELETE 请求
+// 调用方式：local body, resp = client:Delete(url, headers)
+func httpClientDelete(L *LState) int {
+	return httpNoBodyAux(L, checkHttpClient(L), 2, "DELETE")
+}
+
+// httpClientHead 为 httpClient 的实例方法，用于发送 HTTP HEAD 请求
+// 调用方式：local body, resp = client:Head(url, headers)
+func httpClientHead(L *LState) int {
+	return httpNoBodyAux(L, checkHttpClient(L), 2, "HEAD")
+}
+
+// httpClientOptions 为 httpClient 的实例方法，用于发送 HTTP OPTIONS 请求
+// 调用方式：local body, resp = client:Options(url, headers)
+func httpClientOptions(L *LState) int {
+	return httpNoBodyAux(L, checkHttpClient(L), 2, "OPTIONS")
+}
+
+// httpClientRequest 为 httpClient 的实例方法，用于发送任意方法的 HTTP 请求
+// 调用方式：local resp, err = client:Request({method="GET", url=url})
+func httpClientRequest(L *LState) int {
+	return httpRequestAux(L, checkHttpClient(L), 2)
+}
+
+// httpClientPostForm 为 httpClient 的实例方法，用于以 url 编码格式提交表单
+// 调用方式：local body, resp = client:PostForm(url, fields, headers)
+func httpClientPostForm(L *LState) int {
+	return httpPostFormAux(L, checkHttpClient(L), 2)
+}
+
+// httpClientPostMultipart 为 httpClient 的实例方法，用于以 multipart 格式提交表单和上传文件
+// 调用方式：local body, resp = client:PostMultipart(url, fields, files, headers)
+func httpClientPostMultipart(L *LState) int {
+	return httpPostMultipartAux(L, checkHttpClient(L), 2)
+}
+
+// httpClientSetTimeout 为 httpClient 的实例方法，用于设置该客户端的超时时间
+// 调用方式：client:SetTimeout(timelength, timeunit)
+func httpClientSetTimeout(L *LState) int {
+	return httpSetTimeoutAux(L, checkHttpClient(L), 2)
+}
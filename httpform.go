@@ -0,0 +1,288 @@
+package lua
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 表单相关的 Content-Type
+const (
+	httpFormContentType      = "application/x-www-form-urlencoded"
+	httpMultipartContentType = "multipart/form-data"
+)
+
+// 解析 multipart 请求体时保存在内存中的最大字节数，超出部分写入临时文件
+var httpMaxMultipartMemory int64 = 32 << 20
+
+// httpPostForm 模块函数，用于以 application/x-www-form-urlencoded 格式提交表单
+// 参数：
+//  1. url (string) - 请求地址
+//  2. fields (table) - 表单字段，值可以是 string、number 或由它们组成的数组
+//  3. headers (table) - 请求头（可选）
+//
+// 返回值：
+//  1. string（响应体）
+//  2. table（响应表，见 httplib.Request）
+//
+// 调用方式：
+//  1. local body, resp = httplib.PostForm(url, fields, headers)
+//
+// 示例：
+//  1. httplib.PostForm("http://127.0.0.1:8080/login", {user="milk", password="lua"})
+//
+// 备注：
+//  1. 字段的编码方式与 urllib.EncodeQuery 相同
+func httpPostForm(L *LState) int {
+	return httpPostFormAux(L, defaultHttpClient(L), 1)
+}
+
+// httpPostMultipart 模块函数，用于以 multipart/form-data 格式提交表单和上传文件
+// 参数：
+//  1. url (string) - 请求地址
+//  2. fields (table) - 普通表单字段（可选）
+//  3. files (table) - 文件字段，值为文件路径或 iolib 的文件句柄（可选）
+//  4. headers (table) - 请求头（可选）
+//
+// 返回值：
+//  1. string（响应体）
+//  2. table（响应表，见 httplib.Request）
+//
+// 调用方式：
+//  1. local body, resp = httplib.PostMultipart(url, fields, files, headers)
+//
+// 示例：
+//  1. httplib.PostMultipart("http://127.0.0.1:8080/upload", {name="report"}, {file="./report.txt"})
+//
+// 备注：
+//  1. 文件内容边读边发送，不会一次性读入内存
+//  2. 传入的文件句柄不会被关闭，由路径打开的文件在发送完成后自动关闭
+func httpPostMultipart(L *LState) int {
+	return httpPostMultipartAux(L, defaultHttpClient(L), 1)
+}
+
+// httpParseMultipart 模块函数，用于将 multipart/form-data 请求体解析为 table
+// 参数：
+//  1. body (string) - 请求体
+//  2. content_type (string) - Content-Type 请求头，需要包含 boundary 参数
+//
+// 返回值：
+//  1. table（普通表单字段）
+//  2. table（文件字段，每个文件为包含 filename、content_type、headers、size、body 字段的 table）
+//  3. string（错误信息）
+//
+// 调用方式：
+//  1. local fields, files, err = httplib.ParseMultipart(req.body, req.headers["Content-Type"])
+//
+// 备注：
+//  1. 同名的多个字段或文件解析为数组
+//  2. 服务器处理函数收到的请求表已自动包含解析后的 form 和 files 字段
+func httpParseMultipart(L *LState) int {
+	body := L.CheckString(1)
+	contentType := L.CheckString(2)
+	form, files, err := parseMultipartToTable(L, []byte(body), contentType)
+	if err != nil {
+		L.Push(LNil)
+		L.Push(LNil)
+		L.Push(LString(err.Error()))
+		return 3
+	}
+	L.Push(form)
+	L.Push(files)
+	return 2
+}
+
+func httpPostFormAux(L *LState, c *httpClient, idx int) int {
+	url := L.CheckString(idx)
+	fields := L.CheckTable(idx + 1)
+	headers := L.OptTable(idx+2, nil)
+	encoded := tableToValues(L, fields).Encode()
+	body := &httpBody{reader: strings.NewReader(encoded), size: int64(len(encoded)), contentType: httpFormContentType}
+	return httpSend(L, c, "POST", url, body, headers)
+}
+
+func httpPostMultipartAux(L *LState, c *httpClient, idx int) int {
+	url := L.CheckString(idx)
+	fields := L.OptTable(idx+1, L.NewTable())
+	files := L.OptTable(idx+2, L.NewTable())
+	headers := L.OptTable(idx+3, nil)
+
+	values := tableToValues(L, fields)
+	parts := checkMultipartFiles(L, files, idx+2)
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := writeMultipart(mw, values, parts)
+		for _, part := range parts {
+			if part.closer != nil {
+				part.closer.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+
+	body := &httpBody{reader: pr, size: -1, contentType: mw.FormDataContentType()}
+	defer pr.Close()
+	return httpSend(L, c, "POST", url, body, headers)
+}
+
+// multipartFile 描述待上传的文件字段
+type multipartFile struct {
+	field    string
+	filename string
+	reader   io.Reader
+	closer   io.Closer
+}
+
+// checkMultipartFiles 打开 files 表中的所有文件，出错时关闭已打开的文件并抛出错误
+func checkMultipartFiles(L *LState, files *LTable, idx int) []*multipartFile {
+	parts := []*multipartFile{}
+	var ferr error
+	files.ForEach(func(k, v LValue) {
+		if ferr != nil {
+			return
+		}
+		field, ok := k.(LString)
+		if !ok {
+			ferr = errors.New("file field name must be a string")
+			return
+		}
+		switch lv := v.(type) {
+		case LString:
+			fp, err := os.Open(string(lv))
+			if err != nil {
+				ferr = err
+				return
+			}
+			parts = append(parts, &multipartFile{field: string(field), filename: filepath.Base(string(lv)), reader: fp, closer: fp})
+		case *LUserData:
+			file, ok := lv.Value.(*lFile)
+			if !ok {
+				ferr = fmt.Errorf("file %q must be a path or file", string(field))
+				return
+			}
+			if file.closed || file.reader == nil {
+				ferr = fmt.Errorf("%s is not readable", file.Name())
+				return
+			}
+			filename := string(field)
+			if file.Type() == lFileFile {
+				filename = filepath.Base(file.fp.Name())
+			}
+			parts = append(parts, &multipartFile{field: string(field), filename: filename, reader: fileToHttpBody(L, file).reader})
+		default:
+			ferr = fmt.Errorf("file %q must be a path or file", string(field))
+		}
+	})
+	if ferr != nil {
+		for _, part := range parts {
+			if part.closer != nil {
+				part.closer.Close()
+			}
+		}
+		L.ArgError(idx, ferr.Error())
+	}
+	return parts
+}
+
+// writeMultipart 依次写入普通字段与文件字段
+func writeMultipart(mw *multipart.Writer, values map[string][]string, parts []*multipartFile) error {
+	for key, vs := range values {
+		for _, v := range vs {
+			if err := mw.WriteField(key, v); err != nil {
+				return err
+			}
+		}
+	}
+	for _, part := range parts {
+		w, err := mw.CreateFormFile(part.field, part.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, part.reader); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// parseMultipartToTable 将 multipart/form-data 请求体解析为字段表和文件表
+func parseMultipartToTable(L *LState, body []byte, contentType string) (*LTable, *LTable, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid content type: %v", err)
+	}
+	if mediaType != httpMultipartContentType {
+		return nil, nil, fmt.Errorf("unexpected content type %q", mediaType)
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, nil, errors.New("missing multipart boundary")
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	form, err := mr.ReadForm(httpMaxMultipartMemory)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse multipart failed: %v", err)
+	}
+	defer form.RemoveAll()
+
+	files := L.CreateTable(0, len(form.File))
+	for field, headers := range form.File {
+		items := make([]LValue, 0, len(headers))
+		for _, fh := range headers {
+			f, err := fh.Open()
+			if err != nil {
+				return nil, nil, err
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			item := L.CreateTable(0, 5)
+			item.RawSetString("filename", LString(fh.Filename))
+			item.RawSetString("content_type", LString(fh.Header.Get("Content-Type")))
+			item.RawSetString("headers", headerToTable(L, fh.Header))
+			item.RawSetString("size", LInteger(fh.Size))
+			item.RawSetString("body", LString(string(data)))
+			items = append(items, item)
+		}
+		if len(items) == 1 {
+			files.RawSetString(field, items[0])
+		} else {
+			arr := L.CreateTable(len(items), 0)
+			for _, item := range items {
+				arr.Append(item)
+			}
+			files.RawSetString(field, arr)
+		}
+	}
+	return headerToTable(L, form.Value), files, nil
+}
+
+// parseRequestForm 根据 Content-Type 解析请求体中的表单，返回 form 和 files 表
+func parseRequestForm(L *LState, contentType string, body []byte) (*LTable, *LTable) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case httpFormContentType:
+		values, err := url.ParseQuery(string(body))
+		if err == nil {
+			return headerToTable(L, values), L.NewTable()
+		}
+	case httpMultipartContentType:
+		form, files, err := parseMultipartToTable(L, body, contentType)
+		if err == nil {
+			return form, files
+		}
+	}
+	return L.NewTable(), L.NewTable()
+}
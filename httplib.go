@@ -1,22 +1,31 @@
 package lua
 
 import (
-	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 )
 
-// 默认超时时间和时间单位配置
-var (
-	// 初始超时设为 30 秒
-	requestTimeout = 30 * time.Second
-)
+// 默认客户端在注册表中的键名
+const httpDefaultClientKey = "_HTTPCLIENT"
 
 // OpenHttp 模块入口，注册所有 http 模块函数
 func OpenHttp(L *LState) int {
 	httpmod := L.RegisterModule(HttpLibName, httpModuleFuncs)
+	// 建立 httpServer 类型的元表
+	mt := L.NewTypeMetatable(httpServerClass)
+	mt.RawSetString("__index", mt)
+	L.SetFuncs(mt, httpServerMethods)
+	// 建立 httpClient 类型的元表
+	mt = L.NewTypeMetatable(httpClientClass)
+	mt.RawSetString("__index", mt)
+	L.SetFuncs(mt, httpClientMethods)
+	// 模块函数使用的默认客户端，每个 LState 独立一份
+	if _, ok := L.G.Registry.RawGetString(httpDefaultClientKey).(*LUserData); !ok {
+		L.G.Registry.RawSetString(httpDefaultClientKey, newHttpClientUserData(L, newHttpClient()))
+	}
 	L.Push(httpmod)
 	return 1
 }
@@ -33,288 +42,270 @@ var HttpLibFuncDoc = map[string]libFuncDoc{
 			"Delete",
 			"Head",
 			"Options",
+			"Request",
+			"PostForm",
+			"PostMultipart",
+			"ParseMultipart",
 			"SetTimeout",
+			"NewClient",
+			"NewServer",
+			"Serve",
 		},
 	},
 }
 
 // 模块函数映射
 var httpModuleFuncs = map[string]LGFunction{
-	"Get":        httpGet,
-	"Post":       httpPost,
-	"Put":        httpPut,
-	"Patch":      httpPatch,
-	"Delete":     httpDelete,
-	"Head":       httpHead,
-	"Options":    httpOptions,
-	"SetTimeout": httpSetTimeout,
+	"Get":            httpGet,
+	"Post":           httpPost,
+	"Put":            httpPut,
+	"Patch":          httpPatch,
+	"Delete":         httpDelete,
+	"Head":           httpHead,
+	"Options":        httpOptions,
+	"Request":        httpRequest,
+	"PostForm":       httpPostForm,
+	"PostMultipart":  httpPostMultipart,
+	"ParseMultipart": httpParseMultipart,
+	"SetTimeout":     httpSetTimeout,
+	"NewClient":      httpNewClient,
+	"NewServer":      httpNewServer,
+	"Serve":          httpServe,
 }
 
 // httpGet 模块函数，用于发送 HTTP GET 请求
+// 返回响应体字符串以及完整的响应表（见 httpRequest）
 func httpGet(L *LState) int {
-	url := L.CheckString(1)
-	headers := L.OptTable(2, nil)
-
-	// 使用 context.WithTimeout 控制请求超时
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		L.RaiseError("create request failed: %v", err)
-		return 0
-	}
-
-	if headers != nil && isValidHeader(headers) {
-		req.Header = tableToHeader(L, headers)
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		L.RaiseError("HTTP get error: %v", err)
-		return 0
-	}
-	defer func() {
-		if resp != nil && resp.Body != nil {
-			resp.Body.Close()
-		}
-	}()
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		L.RaiseError("HTTP read error: %v", err)
-		return 0
-	}
-	L.Push(LString(string(data)))
-	return 1
+	return httpNoBodyAux(L, defaultHttpClient(L), 1, "GET")
 }
 
 // httpPost 模块函数，用于发送 HTTP POST 请求
 func httpPost(L *LState) int {
-	url := L.CheckString(1)
-	body := L.CheckString(2)
-	headers := L.OptTable(3, nil)
-
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(body))
-	if err != nil {
-		L.RaiseError("create request failed: %v", err)
-		return 0
-	}
-
-	if headers != nil && isValidHeader(headers) {
-		req.Header = tableToHeader(L, headers)
-	}
-
-	// 默认 Content-Type
-	if req.Header.Get("Content-Type") == "" {
-		req.Header.Set("Content-Type", "application/json")
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		L.RaiseError("HTTP post error: %v", err)
-		return 0
-	}
-	defer func() {
-		if resp != nil && resp.Body != nil {
-			resp.Body.Close()
-		}
-	}()
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		L.RaiseError("HTTP read error: %v", err)
-		return 0
-	}
-	L.Push(LString(string(data)))
-	return 1
+	return httpBodyAux(L, defaultHttpClient(L), 1, "POST")
 }
 
 // httpPut 模块函数，用于发送 HTTP PUT 请求
 func httpPut(L *LState) int {
-	url := L.CheckString(1)
-	body := L.CheckString(2)
-	headers := L.OptTable(3, nil)
-
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "PUT", url, strings.NewReader(body))
-	if err != nil {
-		L.RaiseError("create request failed: %v", err)
-		return 0
-	}
-
-	if headers != nil && isValidHeader(headers) {
-		req.Header = tableToHeader(L, headers)
-	}
-
-	if req.Header.Get("Content-Type") == "" {
-		req.Header.Set("Content-Type", "application/json")
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		L.RaiseError("HTTP put error: %v", err)
-		return 0
-	}
-	defer resp.Body.Close()
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		L.RaiseError("HTTP read error: %v", err)
-		return 0
-	}
-	L.Push(LString(string(data)))
-	return 1
+	return httpBodyAux(L, defaultHttpClient(L), 1, "PUT")
 }
 
 // httpPatch 模块函数，用于发送 HTTP PATCH 请求
 func httpPatch(L *LState) int {
-	url := L.CheckString(1)
-	body := L.CheckString(2)
-	headers := L.OptTable(3, nil)
-
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "PATCH", url, strings.NewReader(body))
-	if err != nil {
-		L.RaiseError("create request failed: %v", err)
-		return 0
-	}
-
-	if headers != nil && isValidHeader(headers) {
-		req.Header = tableToHeader(L, headers)
-	}
+	return httpBodyAux(L, defaultHttpClient(L), 1, "PATCH")
+}
 
-	if req.Header.Get("Content-Type") == "" {
-		req.Header.Set("Content-Type", "application/json")
-	}
+// httpDelete 模块函数，用于发送 HTTP DELETE 请求
+func httpDelete(L *LState) int {
+	return httpNoBodyAux(L, defaultHttpClient(L), 1, "DELETE")
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		L.RaiseError("HTTP patch error: %v", err)
-		return 0
-	}
-	defer resp.Body.Close()
+// httpHead 模块函数，用于发送 HTTP HEAD 请求
+func httpHead(L *LState) int {
+	return httpNoBodyAux(L, defaultHttpClient(L), 1, "HEAD")
+}
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		L.RaiseError("HTTP read error: %v", err)
-		return 0
-	}
-	L.Push(LString(string(data)))
-	return 1
+// httpOptions 模块函数，用于发送 HTTP OPTIONS 请求
+func httpOptions(L *LState) int {
+	return httpNoBodyAux(L, defaultHttpClient(L), 1, "OPTIONS")
 }
 
-// httpDelete 模块函数，用于发送 HTTP DELETE 请求
-func httpDelete(L *LState) int {
-	url := L.CheckString(1)
-	headers := L.OptTable(2, nil)
+// httpRequest 模块函数，用于发送任意方法的 HTTP 请求
+// 参数：
+//  1. options (table) - 请求参数，包含以下字段：
+//     method (string) - 请求方法（可选，默认为 "GET"）
+//     url (string) - 请求地址
+//     headers (table) - 请求头（可选）
+//     body (string|file) - 请求体，可以是字符串或 iolib 的文件句柄（可选）
+//     timeout (number) - 超时时间，单位为默认时间单位（可选，默认使用客户端的设置）
+//     stream (bool) - 为 true 时响应表的 body 为只读的流对象，不一次性读入内存（可选）
+//     output (file) - 将响应体直接写入该 iolib 文件句柄（可选）
+//
+// 返回值：
+//  1. table（响应表，包含 status、status_text、ok、headers、body、url、proto、content_length 字段）
+//  2. string（错误信息）
+//
+// 调用方式：
+//  1. local resp, err = httplib.Request({method="PUT", url=url, headers=headers, body=body, timeout=10})
+//
+// 备注：
+//  1. 非 2xx 的响应同样返回响应表，可通过 status 或 ok 字段判断
+//  2. 网络错误、超时等无法得到响应的情况返回 nil 和错误信息
+//  3. url 字段为跟随重定向后的最终地址
+//  4. content_length 未知时为 -1
+//  5. stream 为 true 时 body 支持 Read、Lines、Close 方法，用法与 iolib 的文件句柄相同，读取完毕后需要调用 Close
+//  6. 指定 output 时响应表的 body 为 nil，written 字段为写入的字节数
+//  7. 超时时间包含读取响应体的时间，下载大文件时需要适当调大
+func httpRequest(L *LState) int {
+	return httpRequestAux(L, defaultHttpClient(L), 1)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
+// httpSetTimeout 模块函数，用于设置默认客户端的超时时间
+// 接受两个参数：超时时间长度（数字）和可选的时间单位（默认 "s"）
+// 只影响当前 LState 的模块函数，不影响 NewClient 创建的客户端
+func httpSetTimeout(L *LState) int {
+	return httpSetTimeoutAux(L, defaultHttpClient(L), 1)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
-	if err != nil {
-		L.RaiseError("create request failed: %v", err)
-		return 0
+// defaultHttpClient 获取当前 LState 的默认客户端
+func defaultHttpClient(L *LState) *httpClient {
+	if ud, ok := L.G.Registry.RawGetString(httpDefaultClientKey).(*LUserData); ok {
+		if c, ok := ud.Value.(*httpClient); ok {
+			return c
+		}
 	}
+	c := newHttpClient()
+	L.G.Registry.RawSetString(httpDefaultClientKey, newHttpClientUserData(L, c))
+	return c
+}
 
-	if headers != nil && isValidHeader(headers) {
-		req.Header = tableToHeader(L, headers)
-	}
+func httpNoBodyAux(L *LState, c *httpClient, idx int, method string) int {
+	url := L.CheckString(idx)
+	headers := L.OptTable(idx+1, nil)
+	return httpSend(L, c, method, url, nil, headers)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		L.RaiseError("HTTP delete error: %v", err)
-		return 0
+func httpBodyAux(L *LState, c *httpClient, idx int, method string) int {
+	url := L.CheckString(idx)
+	body := toHttpBody(L, L.Get(idx+1))
+	if body == nil {
+		L.ArgError(idx+1, "string or file expected, got "+L.Get(idx+1).Type().String())
 	}
-	defer resp.Body.Close()
+	headers := L.OptTable(idx+2, nil)
+	return httpSend(L, c, method, url, body, headers)
+}
 
-	data, err := io.ReadAll(resp.Body)
+// httpSend 为 Get/Post 等快捷函数的公共实现
+// 请求失败时抛出错误，成功时返回响应体字符串和响应表
+func httpSend(L *LState, c *httpClient, method, url string, body *httpBody, headers *LTable) int {
+	resp, data, err := c.do(L, method, url, body, headers, c.timeout)
 	if err != nil {
-		L.RaiseError("HTTP read error: %v", err)
+		L.RaiseError("%v", err)
 		return 0
 	}
 	L.Push(LString(string(data)))
-	return 1
+	L.Push(httpResponseToTable(L, resp, data))
+	return 2
 }
 
-// httpHead 模块函数，用于发送 HTTP HEAD 请求
-func httpHead(L *LState) int {
-	url := L.CheckString(1)
-	headers := L.OptTable(2, nil)
-
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
+func httpRequestAux(L *LState, c *httpClient, idx int) int {
+	opts := L.CheckTable(idx)
 
-	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
-	if err != nil {
-		L.RaiseError("create request failed: %v", err)
-		return 0
+	method := "GET"
+	if lv := opts.RawGetString("method"); lv != LNil {
+		if !LVCanConvToString(lv) {
+			L.ArgError(idx, "method must be a string")
+		}
+		method = strings.ToUpper(LVAsString(lv))
 	}
 
-	if headers != nil && isValidHeader(headers) {
-		req.Header = tableToHeader(L, headers)
+	url, ok := opts.RawGetString("url").(LString)
+	if !ok {
+		L.ArgError(idx, "url must be a string")
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		L.RaiseError("HTTP head error: %v", err)
-		return 0
+	var headers *LTable
+	if lv := opts.RawGetString("headers"); lv != LNil {
+		if headers, ok = lv.(*LTable); !ok {
+			L.ArgError(idx, "headers must be a table")
+		}
 	}
-	defer resp.Body.Close()
 
-	data, _ := io.ReadAll(resp.Body)
-	L.Push(LString(string(data)))
-	return 1
-}
-
-// httpOptions 模块函数，用于发送 HTTP OPTIONS 请求
-func httpOptions(L *LState) int {
-	url := L.CheckString(1)
-	headers := L.OptTable(2, nil)
+	var body *httpBody
+	if lv := opts.RawGetString("body"); lv != LNil {
+		if body = toHttpBody(L, lv); body == nil {
+			L.ArgError(idx, "body must be a string or file")
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
+	var output *lFile
+	if lv := opts.RawGetString("output"); lv != LNil {
+		ud, ok := lv.(*LUserData)
+		if ok {
+			output, ok = ud.Value.(*lFile)
+		}
+		if !ok {
+			L.ArgError(idx, "output must be a file")
+		}
+		if output.closed {
+			L.RaiseError("%s is closed", output.Name())
+		}
+		if output.writer == nil {
+			L.RaiseError("%s is opened for only reading", output.Name())
+		}
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "OPTIONS", url, nil)
-	if err != nil {
-		L.RaiseError("create request failed: %v", err)
-		return 0
+	timeout := c.timeout
+	if lv := opts.RawGetString("timeout"); lv != LNil {
+		n, ok := LVAsNumber(lv), lv.Type() == LTNumber
+		if !ok {
+			L.ArgError(idx, "timeout must be a number")
+		}
+		timeout = time.Duration(float64(n) * float64(timeUnit[defaultTimeUnit]))
 	}
 
-	if headers != nil && isValidHeader(headers) {
-		req.Header = tableToHeader(L, headers)
+	if output != nil || LVAsBool(opts.RawGetString("stream")) {
+		resp, cancel, err := c.send(L, method, string(url), body, headers, timeout)
+		if err != nil {
+			L.Push(LNil)
+			L.Push(LString(err.Error()))
+			return 2
+		}
+		tbl := httpResponseToTable(L, resp, nil)
+		if output == nil {
+			tbl.RawSetString("body", newHttpStream(L, resp, cancel))
+			L.Push(tbl)
+			return 1
+		}
+		defer cancel()
+		defer resp.Body.Close()
+		n, err := io.Copy(output.writer, resp.Body)
+		if err != nil {
+			L.CheckContext()
+			L.Push(LNil)
+			L.Push(LString(fmt.Sprintf("HTTP read error: %v", err)))
+			return 2
+		}
+		output.AbandonReadBuffer()
+		tbl.RawSetString("body", LNil)
+		tbl.RawSetString("written", LInteger(n))
+		L.Push(tbl)
+		return 1
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, data, err := c.do(L, method, string(url), body, headers, timeout)
 	if err != nil {
-		L.RaiseError("HTTP options error: %v", err)
-		return 0
+		L.Push(LNil)
+		L.Push(LString(err.Error()))
+		return 2
 	}
-	defer resp.Body.Close()
-
-	data, _ := io.ReadAll(resp.Body)
-	L.Push(LString(string(data)))
+	L.Push(httpResponseToTable(L, resp, data))
 	return 1
 }
 
-// httpSetTimeout 模块函数，用于设置 HTTP 请求的超时时间
-// 接受两个参数：超时时间长度（数字）和可选的时间单位（默认 "s"）
-func httpSetTimeout(L *LState) int {
-	timelength := L.OptNumber(1, LNumber(float64(requestTimeout/time.Second)))
-	timeunit := L.OptString(2, defaultTimeUnit)
+func httpSetTimeoutAux(L *LState, c *httpClient, idx int) int {
+	timelength := L.OptNumber(idx, LNumber(float64(c.timeout/time.Second)))
+	timeunit := L.OptString(idx+1, defaultTimeUnit)
 	dur, ok := timeUnit[timeunit]
 	if !ok {
 		L.RaiseError("invalid time unit %q", timeunit)
 		return 0
 	}
-	requestTimeout = time.Duration(float64(timelength) * float64(dur))
+	c.timeout = time.Duration(float64(timelength) * float64(dur))
 	return 0
 }
+
+// httpResponseToTable 将 http.Response 转换为 Lua table
+func httpResponseToTable(L *LState, resp *http.Response, data []byte) *LTable {
+	tbl := L.CreateTable(0, 8)
+	tbl.RawSetString("status", LInteger(resp.StatusCode))
+	tbl.RawSetString("status_text", LString(resp.Status))
+	tbl.RawSetString("ok", LBool(resp.StatusCode >= 200 && resp.StatusCode < 300))
+	tbl.RawSetString("headers", headerToTable(L, resp.Header))
+	if data != nil {
+		tbl.RawSetString("body", LString(string(data)))
+	}
+	tbl.RawSetString("url", LString(resp.Request.URL.String()))
+	tbl.RawSetString("proto", LString(resp.Proto))
+	tbl.RawSetString("content_length", LInteger(resp.ContentLength))
+	return tbl
+}
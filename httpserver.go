@@ -0,0 +1,406 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	httpServerClass = "HTTPSERVER*"
+)
+
+// 默认的优雅关闭超时时间
+var httpShutdownTimeout = 5 * time.Second
+
+// httpServerMethods 定义 http 服务器的实例方法（面向对象调用）
+var httpServerMethods = map[string]LGFunction{
+	"Handle":   httpServerHandle,
+	"Start":    httpServerStart,
+	"Serve":    httpServerServe,
+	"Addr":     httpServerAddr,
+	"Shutdown": httpServerShutdown,
+}
+
+// httpServer 用于封装 http.Server 对象
+type httpServer struct {
+	L    *LState
+	srv  *http.Server
+	mux  *http.ServeMux
+	addr string
+
+	mu      sync.Mutex
+	ln      net.Listener
+	started bool
+	done    chan struct{}
+	// 已注册的处理函数，服务器运行期间被 pin 住，避免 CollectGarbage 回收其引用的对象
+	handlers []*LFunction
+}
+
+func newHttpServer(L *LState, addr string) *httpServer {
+	mux := http.NewServeMux()
+	return &httpServer{
+		L:    L,
+		srv:  &http.Server{Addr: addr, Handler: mux},
+		mux:  mux,
+		addr: addr,
+		done: make(chan struct{}),
+	}
+}
+
+func checkHttpServer(L *LState) *httpServer {
+	ud := L.CheckUserData(1)
+	if s, ok := ud.Value.(*httpServer); ok && s != nil {
+		return s
+	}
+	L.ArgError(1, "http server expected")
+	return nil
+}
+
+// listen 绑定监听地址并在后台开始处理请求，重复调用时直接返回
+func (s *httpServer) listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return nil
+	}
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	s.started = true
+	for _, fn := range s.handlers {
+		s.L.pinValue(fn)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.srv.Serve(ln)
+	}()
+	go func() {
+		var ctxDone <-chan struct{}
+		if ctx := s.L.Context(); ctx != nil {
+			ctxDone = ctx.Done()
+		}
+		select {
+		case <-ctxDone:
+			s.shutdown(httpShutdownTimeout)
+			<-errc
+		case <-errc:
+		}
+		s.mu.Lock()
+		for _, fn := range s.handlers {
+			s.L.unpinValue(fn)
+		}
+		s.handlers = nil
+		close(s.done)
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+// addHandler 记录注册的处理函数，服务器已启动时立即 pin 住
+func (s *httpServer) addHandler(fn *LFunction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		// 服务器已关闭，处理函数不会再被调用
+		return
+	default:
+	}
+	s.handlers = append(s.handlers, fn)
+	if s.started {
+		s.L.pinValue(fn)
+	}
+}
+
+// shutdown 优雅关闭服务器，超时后强制关闭所有连接
+func (s *httpServer) shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.srv.Close()
+	}
+}
+
+// handler 将 Lua 函数包装为 http.Handler，每个请求在独立的 LState 中执行
+func (s *httpServer) handler(fn *LFunction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		L, cancel := s.L.NewThread()
+		if cancel != nil {
+			defer cancel()
+		} else {
+			L.SetContext(r.Context())
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if err := L.CallByParam(P{Fn: fn, NRet: 3, Protect: true}, httpRequestToTable(L, r, body)); err != nil {
+			if isCancelError(err) {
+				// 服务器关闭或客户端断开时不再输出错误
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "httplib: %s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		status, headers, content := L.Get(-3), L.Get(-2), L.Get(-1)
+		L.Pop(3)
+
+		// 只返回一个字符串时视为状态码 200 的响应体
+		if str, ok := status.(LString); ok && headers == LNil && content == LNil {
+			status, content = LInteger(http.StatusOK), str
+		}
+
+		code := http.StatusOK
+		if status.Type() == LTNumber {
+			code = int(LVAsNumber(status))
+		} else if status != LNil {
+			fmt.Fprintf(os.Stderr, "httplib: %s %s: invalid status %v\n", r.Method, r.URL.Path, status)
+			code = http.StatusInternalServerError
+		}
+		if code < 100 || code > 999 {
+			fmt.Fprintf(os.Stderr, "httplib: %s %s: invalid status %d\n", r.Method, r.URL.Path, code)
+			code = http.StatusInternalServerError
+		}
+
+		if tbl, ok := headers.(*LTable); ok {
+			for key, values := range tableToHeader(L, tbl) {
+				for _, v := range values {
+					w.Header().Add(key, v)
+				}
+			}
+		}
+		w.WriteHeader(code)
+		if content != LNil {
+			io.WriteString(w, LVAsString(content))
+		}
+	}
+}
+
+// 匹配路由模式中的通配符，例如 {id} 或 {path...}
+var httpPatternWildcard = regexp.MustCompile(`\{([^{}.$]+)(?:\.\.\.)?\}`)
+
+// httpRequestToTable 将 http.Request 转换为传给处理函数的 Lua table
+func httpRequestToTable(L *LState, r *http.Request, body []byte) *LTable {
+	req := L.CreateTable(0, 12)
+	req.RawSetString("method", LString(r.Method))
+	req.RawSetString("path", LString(r.URL.Path))
+	req.RawSetString("url", LString(r.URL.String()))
+	req.RawSetString("host", LString(r.Host))
+	req.RawSetString("remote_addr", LString(r.RemoteAddr))
+	req.RawSetString("query", headerToTable(L, r.URL.Query()))
+	req.RawSetString("headers", headerToTable(L, r.Header))
+	req.RawSetString("body", LString(string(body)))
+	form, files := parseRequestForm(L, r.Header.Get("Content-Type"), body)
+	req.RawSetString("form", form)
+	req.RawSetString("files", files)
+
+	params := L.NewTable()
+	for _, m := range httpPatternWildcard.FindAllStringSubmatch(r.Pattern, -1) {
+		params.RawSetString(m[1], LString(r.PathValue(m[1])))
+	}
+	req.RawSetString("params", params)
+	return req
+}
+
+// httpNewServer 模块函数，用于创建 http 服务器
+// 参数：
+//  1. addr (string) - 监听地址，例如 ":8080" 或 "127.0.0.1:0"
+//
+// 返回值：
+//  1. userdata（封装了 *httpServer 对象，可调用 Handle、Start、Serve、Addr、Shutdown 方法）
+//
+// 调用方式：
+//  1. local srv = httplib.NewServer(addr)
+//
+// 示例：
+//  1. local srv = httplib.NewServer(":8080")
+//     srv:Handle("GET /hello/{name}", func(req) { return 200, {["Content-Type"]="text/plain"}, "hello " .. req.params.name })
+//     srv:Serve()
+//
+// 备注：
+//  1. 每个请求都在由 LState.NewThread 创建的独立 LState 中执行
+//  2. 如果 LState 设置了 context，context 结束时服务器会自动关闭
+func httpNewServer(L *LState) int {
+	addr := L.CheckString(1)
+	ud := L.NewUserData()
+	ud.Value = newHttpServer(L, addr)
+	L.SetMetatable(ud, L.GetTypeMetatable(httpServerClass))
+	L.Push(ud)
+	return 1
+}
+
+// httpServe 模块函数，用于按路由表启动 http 服务器并阻塞直到服务器关闭
+// 参数：
+//  1. addr (string) - 监听地址
+//  2. routes (table) - 路由表，键为路由模式，值为处理函数
+//
+// 返回值：无
+// 调用方式：
+//  1. httplib.Serve(addr, routes)
+//
+// 示例：
+//  1. httplib.Serve(":8080", {
+//     ["/"] = func(req) { return "hello" },
+//     ["POST /echo"] = func(req) { return 200, req.headers, req.body },
+//     })
+//
+// 备注：
+//  1. 路由模式与 Go 的 http.ServeMux 一致，支持 "METHOD /path/{name}" 形式
+//  2. 处理函数参数为请求表，包含 method、path、url、host、remote_addr、query、headers、params、body、form、files 字段
+//     form 与 files 为解析后的 url 编码或 multipart 表单，格式见 httplib.ParseMultipart
+//  3. 处理函数依次返回状态码、响应头（table）、响应体；只返回一个字符串时视为 200 的响应体
+//  4. 处理函数出错时返回 500，错误信息输出到标准错误
+func httpServe(L *LState) int {
+	addr := L.CheckString(1)
+	routes := L.CheckTable(2)
+	s := newHttpServer(L, addr)
+	registerHttpRoutes(L, s, routes, 2)
+	serveHttpServer(L, s)
+	return 0
+}
+
+func registerHttpRoutes(L *LState, s *httpServer, routes *LTable, idx int) {
+	routes.ForEach(func(k, v LValue) {
+		pattern, ok := k.(LString)
+		if !ok {
+			L.ArgError(idx, "route pattern must be a string")
+		}
+		fn, ok := v.(*LFunction)
+		if !ok {
+			L.ArgError(idx, fmt.Sprintf("handler for %q must be a function", string(pattern)))
+		}
+		addHttpRoute(L, s, string(pattern), fn)
+	})
+}
+
+func addHttpRoute(L *LState, s *httpServer, pattern string, fn *LFunction) {
+	defer func() {
+		// http.ServeMux 对非法或重复的路由模式会 panic
+		if rcv := recover(); rcv != nil {
+			L.RaiseError("invalid route %q: %v", pattern, rcv)
+		}
+	}()
+	s.mux.Handle(pattern, s.handler(fn))
+	s.addHandler(fn)
+}
+
+func serveHttpServer(L *LState, s *httpServer) {
+	if err := s.listen(); err != nil {
+		L.RaiseError("HTTP listen error: %v", err)
+		return
+	}
+	<-s.done
+}
+
+// httpServerHandle 为 httpServer 的实例方法，用于注册路由
+// 参数：
+//  1. pattern (string) - 路由模式
+//  2. handler (function) - 处理函数
+//
+// 返回值：无
+// 调用方式：
+//  1. srv:Handle(pattern, handler)
+func httpServerHandle(L *LState) int {
+	s := checkHttpServer(L)
+	pattern := L.CheckString(2)
+	fn := L.CheckFunction(3)
+	addHttpRoute(L, s, pattern, fn)
+	return 0
+}
+
+// httpServerStart 为 httpServer 的实例方法，用于在后台启动服务器
+// 参数：无
+// 返回值：
+//  1. string（实际监听的地址，监听端口为 0 时可由此获得分配的端口）
+//
+// 调用方式：
+//  1. local addr = srv:Start()
+func httpServerStart(L *LState) int {
+	s := checkHttpServer(L)
+	if err := s.listen(); err != nil {
+		L.RaiseError("HTTP listen error: %v", err)
+		return 0
+	}
+	L.Push(LString(s.ln.Addr().String()))
+	return 1
+}
+
+// httpServerServe 为 httpServer 的实例方法，用于启动服务器并阻塞直到服务器关闭
+// 参数：无
+// 返回值：无
+// 调用方式：
+//  1. srv:Serve()
+func httpServerServe(L *LState) int {
+	s := checkHttpServer(L)
+	serveHttpServer(L, s)
+	return 0
+}
+
+// httpServerAddr 为 httpServer 的实例方法，用于获取实际监听的地址
+// 参数：无
+// 返回值：
+//  1. string（监听地址，服务器未启动时返回 nil）
+//
+// 调用方式：
+//  1. local addr = srv:Addr()
+func httpServerAddr(L *LState) int {
+	s := checkHttpServer(L)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		L.Push(LNil)
+		return 1
+	}
+	L.Push(LString(s.ln.Addr().String()))
+	return 1
+}
+
+// httpServerShutdown 为 httpServer 的实例方法，用于关闭服务器
+// 参数：
+//  1. timelength (number) - 等待处理中请求完成的时间（可选，默认 5 秒）
+//  2. timeunit (string) - 时间单位（可选，默认为 "s"）
+//
+// 返回值：无
+// 调用方式：
+//  1. srv:Shutdown()
+//
+// 备注：
+//  1. 超时后仍未完成的连接会被强制关闭
+//  2. 在处理函数中调用时会等待到超时，因为当前请求本身尚未完成
+func httpServerShutdown(L *LState) int {
+	s := checkHttpServer(L)
+	timeout := httpShutdownTimeout
+	if L.GetTop() >= 2 {
+		timelength := L.CheckNumber(2)
+		timeunit := L.OptString(3, defaultTimeUnit)
+		dur, ok := timeUnit[timeunit]
+		if !ok {
+			L.RaiseError("invalid time unit %q", timeunit)
+			return 0
+		}
+		timeout = time.Duration(float64(timelength) * float64(dur))
+	}
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	s.shutdown(timeout)
+	if started {
+		<-s.done
+	}
+	return 0
+}
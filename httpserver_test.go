@@ -0,0 +1,248 @@
+package lua
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHttpServerLocalhost(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	err := L.DoString(`
+		local srv = httplib.NewServer("127.0.0.1:0")
+		srv:Handle("GET /hello/{name}", func(req) {
+			return 201, {["X-Query"]=req.query.q}, "hello " .. req.params.name
+		})
+		srv:Handle("POST /echo", func(req) { return req.body })
+		srv:Handle("/fail", func(req) { Error("boom") })
+		addr = srv:Start()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := L.GetGlobal("addr").String()
+
+	resp, err := http.Get("http://" + addr + "/hello/milk?q=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 201 || string(body) != "hello milk" || resp.Header.Get("X-Query") != "1" {
+		t.Errorf("unexpected response: %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+
+	resp, err = http.Post("http://"+addr+"/echo", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "ping" {
+		t.Errorf("unexpected response: %d %q", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get("http://" + addr + "/fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected 500, got %d", resp.StatusCode)
+	}
+
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("server still accepting connections after context cancel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHttpServeStopsOnContextCancel(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	L.SetContext(ctx)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- L.DoString(`httplib.Serve("127.0.0.1:0", { ["/"] = func(req) { return "ok" } })`)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after context cancel")
+	}
+}
+
+func TestHttpRequestResponse(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	err := L.DoString(`
+		local srv = httplib.NewServer("127.0.0.1:0")
+		srv:Handle("PUT /item", func(req) { return 404, {["X-Method"]=req.method}, "missing " .. req.body })
+		local base = "http://" .. srv:Start()
+
+		local resp, err = httplib.Request({method="put", url=base .. "/item", body="abc", timeout=5})
+		Assert(err == nil, err)
+		Assert(resp.status == 404 and not resp.ok, "status")
+		Assert(resp.headers["X-Method"] == "PUT", "headers")
+		Assert(resp.body == "missing abc", "body")
+		Assert(resp.url == base .. "/item", "url")
+
+		local body, r = httplib.Get(base .. "/nothing")
+		Assert(r.status == 404, "get status")
+
+		local none, err = httplib.Request({url="http://127.0.0.1:1/"})
+		Assert(none == nil && Type(err) == "string", "transport error")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHttpClientIsolation(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	err := L.DoString(`
+		local srv = httplib.NewServer("127.0.0.1:0")
+		srv:Handle("/login", func(req) { return 302, {["Set-Cookie"]="sid=42", ["Location"]="/me"}, "" })
+		srv:Handle("/me", func(req) { return 200, {}, req.headers["Cookie"] || "anonymous" })
+		local base = "http://" .. srv:Start()
+
+		local client = httplib.NewClient({timeout=5, cookie_jar=true})
+		local body = client:Get(base .. "/login")
+		Assert(body == "sid=42", "cookie jar: " .. body)
+		body = client:Get(base .. "/me")
+		Assert(body == "sid=42", "cookie kept: " .. body)
+
+		local noredirect = httplib.NewClient({follow_redirects=false})
+		local _, resp = noredirect:Get(base .. "/login")
+		Assert(resp.status == 302, "no redirect")
+
+		body = httplib.Get(base .. "/login")
+		Assert(body == "anonymous", "default client has no jar")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHttpStreamingBodies(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	dir := t.TempDir()
+	L.SetGlobal("upload", LString(dir+"/upload.txt"))
+	L.SetGlobal("download", LString(dir+"/download.txt"))
+	err := L.DoString(`
+		local srv = httplib.NewServer("127.0.0.1:0")
+		srv:Handle("/lines", func(req) { return "one\ntwo\nthree\n" })
+		srv:Handle("POST /echo", func(req) { return 200, {["X-Length"]=req.headers["Content-Length"]}, req.body })
+		local base = "http://" .. srv:Start()
+
+		local resp = httplib.Request({url=base .. "/lines", stream=true})
+		local lines = {}
+		for line in resp.body:Lines() {
+			lines[#lines+1] = line
+		}
+		resp.body:Close()
+		Assert(#lines == 3 and lines[3] == "three", "lines")
+
+		resp = httplib.Request({url=base .. "/lines", stream=true})
+		Assert(resp.body:Read(3) == "one", "read")
+		resp.body:Close()
+
+		local f = iolib.Open(upload, "w")
+		f:Write("file content")
+		f:Close()
+		f = iolib.Open(upload, "r")
+		local body, r = httplib.Post(base .. "/echo", f)
+		f:Close()
+		Assert(body == "file content", "upload: " .. body)
+		Assert(r.headers["X-Length"] == "12", "content length")
+
+		local out = iolib.Open(download, "w")
+		resp = httplib.Request({url=base .. "/lines", output=out})
+		out:Close()
+		Assert(resp.written == 14, "written")
+		local check = iolib.Open(download, "r")
+		Assert(check:Read("*a") == "one\ntwo\nthree\n", "download")
+		check:Close()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHttpForms(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	L.SetGlobal("upload", LString(t.TempDir()+"/report.txt"))
+	err := L.DoString(`
+		local srv = httplib.NewServer("127.0.0.1:0")
+		srv:Handle("POST /form", func(req) { return req.form.user .. "|" .. req.form.tag[2] })
+		srv:Handle("POST /echo", func(req) { return 200, {["X-Count"]=req.headers["X-Count"] * 1}, req.body })
+		srv:Handle("POST /upload", func(req) {
+			local fields, files = httplib.ParseMultipart(req.body, req.headers["Content-Type"])
+			Assert(fields.name == req.form.name, "parse")
+			return req.form.name .. "|" .. req.files.file.filename .. "|" .. req.files.file.body .. "|" .. files.other.body
+		})
+		local base = "http://" .. srv:Start()
+
+		local body = httplib.PostForm(base .. "/form", {user="milk", tag={"a", "b"}})
+		Assert(body == "milk|b", "form: " .. body)
+		body = httplib.PostForm(base .. "/form", {user=7, tag={1, 2.5}})
+		Assert(body == "7|2.5", "integer form: " .. body)
+		local resp = httplib.Request({method="POST", url=base .. "/echo", body=42, headers={["X-Count"]=3}})
+		Assert(resp.body == "42" and resp.headers["X-Count"] == "3", "integer body and headers")
+
+		local f = iolib.Open(upload, "w")
+		f:Write("report body")
+		f:Close()
+		local other = iolib.Open(upload, "r")
+		body = httplib.PostMultipart(base .. "/upload", {name="weekly"}, {file=upload, other=other})
+		other:Close()
+		Assert(body == "weekly|report.txt|report body|report body", "multipart: " .. body)
+
+		Assert(urllib.EncodeQuery({q="milk lua", tag={"a", "b"}}) == "q=milk+lua&tag=a&tag=b", "encode query")
+		Assert(urllib.DecodeQuery("a=1&b=2&b=3").b[2] == "3", "decode query")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,174 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIntegerArithmetic(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected LValue
+	}{
+		{`return 9007199254740993`, LInteger(9007199254740993)},
+		{`return 9007199254740992 + 1`, LInteger(9007199254740993)},
+		{`return 9223372036854775807 + 1`, LInteger(-9223372036854775808)},
+		{`return 0xffffffffffffffff`, LInteger(-1)},
+		{`return 1 + 1.5`, LNumber(2.5)},
+		{`return 7 / 2`, LNumber(3.5)},
+		{`return 4 / 2`, LNumber(2)},
+		{`return 2 ^ 2`, LNumber(4)},
+		{`return 7 ~/ 2`, LInteger(3)},
+		{`return -7 ~/ 2`, LInteger(-4)},
+		{`return 7.5 ~/ 2`, LNumber(3)},
+		{`return -7 % 3`, LInteger(2)},
+		{`return 7 % -3`, LInteger(-2)},
+		{`return 5 ~ 3`, LInteger(6)},
+		{`return ~0`, LInteger(-1)},
+		{`return 1 << 63`, LInteger(-9223372036854775808)},
+		{`return -1 >> 1`, LInteger(0x7fffffffffffffff)},
+		{`local a = -1 a >>= 60 return a`, LInteger(15)},
+		{`local a, n = -1, 64 return (a >> n) | (a << n)`, LInteger(0)},
+		{`return 2 >> -1 == 4 and 2 << -1 == 1 and 1 << -64 == 0`, LTrue},
+		{`local a, n = -1, matlib.mininteger return a >> n`, LInteger(0)},
+		{`return 2.0 | 1`, LInteger(3)},
+		{`local a, b = 0x7fffffffffffffff, 0x7ffffffffffffffe return a > b`, LTrue},
+		{`return 1 == 1.0`, LTrue},
+		{`return 9007199254740993 == 9007199254740992.0`, LFalse},
+		{`return 9007199254740993 > 9007199254740992.0`, LTrue},
+		{`return "10" + 1`, LInteger(11)},
+		{`return #"abc"`, LInteger(3)},
+		{`local n = 0 for i = 9223372036854775806, 9223372036854775807 { n = n + 1 } return n`, LInteger(2)},
+		{`local n = 0 for i = 1, 2, 0.5 { n = n + i } return n`, LNumber(4.5)},
+		{`local t = {} for i = 10, 1, -3 { t[#t + 1] = i } return tbllib.Concat(t, ",")`, LString("10,7,4,1")},
+		{`return matlib.Type(1), matlib.Type(1.0), matlib.Type("1")`, LString("integer")},
+		{`return matlib.Type(1.0)`, LString("float")},
+		{`return matlib.ToInteger(3.0)`, LInteger(3)},
+		{`return matlib.ToInteger(3.5)`, LNil},
+		{`return matlib.Floor(3.7)`, LInteger(3)},
+		{`return matlib.Max(1, 2.5, 2)`, LNumber(2.5)},
+		{`return matlib.maxinteger + 1 == matlib.mininteger`, LTrue},
+		{`return strlib.Format("%x %X %o %d", -1, 255, 8, -1)`, LString("ffffffffffffffff FF 10 -1")},
+		{`return strlib.Format("%x", -2.0)`, LString("fffffffffffffffe")},
+	}
+	for _, c := range cases {
+		L := NewState()
+		if err := L.DoString(strings.Replace(c.src, "return", "result =", 1)); err != nil {
+			t.Errorf("%s: %v", c.src, err)
+		} else if result := L.GetGlobal("result"); result != c.expected {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", c.src, c.expected, c.expected, result, result)
+		}
+		L.Close()
+	}
+}
+
+func TestIntegerErrors(t *testing.T) {
+	for src, msg := range map[string]string{
+		`local a, b = 1, 0 return a % b`:  "attempt to perform 'n%0'",
+		`local a, b = 1, 0 return a ~/ b`: "attempt to perform 'n~/0'",
+		`local a = 1.5 return a | 1`:      "number has no integer representation",
+		`local a = {} return ~a`:          "attempt to perform bitwise operation on a table value",
+		`for i = 1, 10, 0 { }`:            "for statement step is zero",
+	} {
+		L := NewState()
+		if err := L.DoString(src); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected error %q, got %v", src, msg, err)
+		}
+		L.Close()
+	}
+}
+
+func TestIntegerTableKeys(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local t = {}
+		t[1] = "a"
+		t[2.0] = "b"
+		t[2^53] = "c"
+		n, a, b, c = #t, t[1.0], t[2], t[9007199254740992]
+	`); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]LValue{"n": LInteger(2), "a": LString("a"), "b": LString("b"), "c": LString("c")} {
+		if v := L.GetGlobal(name); v != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, v)
+		}
+	}
+}
+
+func TestDecodeLargeIntegers(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		j = jsonlib.Decode('{"id": 9007199254740993, "f": 1.5}')
+		y = yamllib.Decode("id: 9007199254740993")
+		m = tomllib.Decode("id = 9007199254740993")
+		s = jsonlib.Encode({id = 9007199254740993})
+	`); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"j", "y", "m"} {
+		if id := L.GetField(L.GetGlobal(name), "id"); id != LInteger(9007199254740993) {
+			t.Errorf("%s: unexpected id %v (%T)", name, id, id)
+		}
+	}
+	if f := L.GetField(L.GetGlobal("j"), "f"); f != LNumber(1.5) {
+		t.Errorf("unexpected float %v", f)
+	}
+	if s := L.GetGlobal("s"); s != LString(`{"id":9007199254740993}`) {
+		t.Errorf("unexpected JSON %v", s)
+	}
+}
+
+func TestLVToNumber(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`return 1, 2.5, "3"`); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := L.Get(-3).(LNumber); ok {
+		t.Errorf("1 must be an LInteger")
+	}
+	for i, expected := range []LNumber{1, 2.5} {
+		if n, ok := LVToNumber(L.Get(i + 1)); !ok || n != expected {
+			t.Errorf("%d: expected %v, got %v %v", i+1, expected, n, ok)
+		}
+	}
+	if _, ok := LVToNumber(L.Get(3)); ok {
+		t.Errorf("strings must not be converted")
+	}
+}
+
+func TestBitwiseAssignmentsAndMetamethods(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local a = 12
+		a &= 10
+		a |= 5
+		a <<= 2
+		a >>= 1
+		a ~/= 4
+		assign = a
+
+		local mt = {}
+		for _, event in IPairs({"band", "bor", "bxor", "shl", "shr", "bnot"}) {
+			mt["__" .. event] = func(x, y) { return event }
+		}
+		local o = SetMetatable({}, mt)
+		meta = tbllib.Concat({o & 1, 1 | o, o ~ 2, o << 1, 1 >> o, ~o}, ",")
+		coerced = "3" | 4.0
+	`); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]LValue{
+		"assign":  LInteger(6),
+		"meta":    LString("band,bor,bxor,shl,shr,bnot"),
+		"coerced": LInteger(7),
+	} {
+		if v := L.GetGlobal(name); v != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, v)
+		}
+	}
+}
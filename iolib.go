@@ -2,12 +2,14 @@ package lua
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"syscall"
+	"time"
 )
 
 var ioFuncs = map[string]LGFunction{
@@ -52,6 +54,7 @@ type lFile struct {
 	reader *bufio.Reader
 	stdout io.ReadCloser
 	closed bool
+	name   string
 }
 
 type lFileType int
@@ -59,6 +62,7 @@ type lFileType int
 const (
 	lFileFile lFileType = iota
 	lFileProcess
+	lFileStream
 )
 
 const fileDefOutIndex = 1
@@ -130,10 +134,13 @@ func newProcess(L *LState, cmd string, writable, readable bool) (*LUserData, err
 }
 
 func (file *lFile) Type() lFileType {
-	if file.fp == nil {
+	if file.fp != nil {
+		return lFileFile
+	}
+	if file.pp != nil {
 		return lFileProcess
 	}
-	return lFileFile
+	return lFileStream
 }
 
 func (file *lFile) Name() string {
@@ -142,6 +149,8 @@ func (file *lFile) Name() string {
 		return fmt.Sprintf("file %s", file.fp.Name())
 	case lFileProcess:
 		return fmt.Sprintf("process %s", file.pp.Path)
+	case lFileStream:
+		return fmt.Sprintf("stream %s", file.name)
 	}
 	return ""
 }
@@ -157,6 +166,38 @@ func (file *lFile) AbandonReadBuffer() error {
 	return nil
 }
 
+// readDeadliner is implemented by readers whose blocking reads can be interrupted (pipes, terminals, sockets).
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// interruptReadOnDone makes a blocking read on r return when the context of L is done.
+// The returned function must be called after the read.
+func interruptReadOnDone(L *LState, r interface{}) func() {
+	f, ok := r.(readDeadliner)
+	if !ok || L.ctx == nil {
+		return func() {}
+	}
+	fired := make(chan struct{})
+	stop := context.AfterFunc(L.ctx, func() {
+		defer close(fired)
+		f.SetReadDeadline(time.Now())
+	})
+	return func() {
+		if !stop() {
+			<-fired
+			f.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
+func (file *lFile) interruptReadOnDone(L *LState) func() {
+	if file.fp != nil {
+		return interruptReadOnDone(L, file.fp)
+	}
+	return interruptReadOnDone(L, file.stdout)
+}
+
 func fileDefOut(L *LState) *LUserData {
 	return L.Get(UpvalueIndex(1)).(*LTable).RawGetInt(fileDefOutIndex).(*LUserData)
 }
@@ -169,7 +210,7 @@ func fileIsWritable(L *LState, file *lFile) int {
 	if file.writer == nil {
 		L.Push(LNil)
 		L.Push(LString(fmt.Sprintf("%s is opened for only reading.", file.Name())))
-		L.Push(LNumber(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
+		L.Push(LInteger(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
 		return 3
 	}
 	return 0
@@ -179,7 +220,7 @@ func fileIsReadable(L *LState, file *lFile) int {
 	if file.reader == nil {
 		L.Push(LNil)
 		L.Push(LString(fmt.Sprintf("%s is opened for only writing.", file.Name())))
-		L.Push(LNumber(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
+		L.Push(LInteger(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
 		return 3
 	}
 	return 0
@@ -221,6 +262,7 @@ func OpenIo(L *LState) int {
 
 var fileMethods = map[string]LGFunction{
 	"__tostring": fileToString,
+	"__gc":       fileGC,
 	"Write":      fileWrite,
 	"Close":      fileClose,
 	"Flush":      fileFlush,
@@ -238,6 +280,8 @@ func fileToString(L *LState) int {
 		fileTypeStr = "file"
 	case lFileProcess:
 		fileTypeStr = "process"
+	case lFileStream:
+		fileTypeStr = "stream"
 	}
 	if file.closed {
 		fileTypeStr += " (closed)"
@@ -270,12 +314,14 @@ errreturn:
 	file.AbandonReadBuffer()
 	L.Push(LNil)
 	L.Push(LString(err.Error()))
-	L.Push(LNumber(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
+	L.Push(LInteger(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
 	return 3
 }
 
-func fileCloseAux(L *LState, file *lFile) int {
+func fileCloseAux(L *LState, ud *LUserData) int {
+	file := ud.Value.(*lFile)
 	file.closed = true
+	L.cancelFinalizer(ud)
 	var err error
 	if file.writer != nil {
 		if bwriter, ok := file.writer.(*bufio.Writer); ok {
@@ -301,7 +347,7 @@ func fileCloseAux(L *LState, file *lFile) int {
 		var exitStatus int
 		if err == nil {
 			exitStatus = 0
-			L.Push(LNumber(exitStatus))
+			L.Push(LInteger(exitStatus))
 			return 1
 		}
 		if e2, ok := err.(*exec.ExitError); ok {
@@ -311,9 +357,15 @@ func fileCloseAux(L *LState, file *lFile) int {
 				err = errors.New("Unimplemented for system where exec.ExitError.Sys() is not syscall.WaitStatus.")
 				goto errreturn
 			}
-			L.Push(LNumber(exitStatus))
+			L.Push(LInteger(exitStatus))
 			return 1
 		}
+	case lFileStream:
+		if err = file.stdout.Close(); err != nil {
+			goto errreturn
+		}
+		L.Push(LTrue)
+		return 1
 	}
 
 errreturn:
@@ -348,10 +400,11 @@ func fileReadAux(L *LState, file *lFile, idx int) int {
 	}
 	var err error
 	top := L.GetTop()
+	defer file.interruptReadOnDone(L)()
 	for i := idx; i <= top; i++ {
 		switch lv := L.Get(i).(type) {
-		case LNumber:
-			size := int64(lv)
+		case LNumber, LInteger:
+			size := int64(LVAsNumber(lv))
 			if size == 0 {
 				_, err = file.reader.ReadByte()
 				if err == io.EOF {
@@ -361,6 +414,7 @@ func fileReadAux(L *LState, file *lFile, idx int) int {
 				}
 				file.reader.UnreadByte()
 			}
+			L.reserveMemory(memStringSize + size)
 			var buf []byte
 			var iseof bool
 			buf, err, iseof = readBufioSize(file.reader, size)
@@ -394,7 +448,7 @@ func fileReadAux(L *LState, file *lFile, idx int) int {
 					L.Push(v)
 				case 'a':
 					var buf []byte
-					buf, err = io.ReadAll(file.reader)
+					buf, err = L.readAll(file.reader)
 					if err == io.EOF {
 						L.Push(emptyLString)
 						goto normalreturn
@@ -425,9 +479,10 @@ normalreturn:
 	return L.GetTop() - top
 
 errreturn:
+	L.CheckContext()
 	L.Push(LNil)
 	L.Push(LString(err.Error()))
-	L.Push(LNumber(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
+	L.Push(LInteger(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
 	return 3
 }
 
@@ -435,18 +490,23 @@ var fileSeekOptions = []string{"set", "cur", "end"}
 
 func fileSeek(L *LState) int {
 	file := checkFile(L)
-	if file.Type() != lFileFile {
+	switch file.Type() {
+	case lFileProcess:
 		L.Push(LNil)
 		L.Push(LString("can not seek a process."))
 		return 2
+	case lFileStream:
+		L.Push(LNil)
+		L.Push(LString("can not seek a stream."))
+		return 2
 	}
 
 	top := L.GetTop()
 	if top == 1 {
 		L.Push(LString("cur"))
-		L.Push(LNumber(0))
+		L.Push(LInteger(0))
 	} else if top == 2 {
-		L.Push(LNumber(0))
+		L.Push(LInteger(0))
 	}
 
 	var pos int64
@@ -462,7 +522,7 @@ func fileSeek(L *LState) int {
 		goto errreturn
 	}
 
-	L.Push(LNumber(pos))
+	L.Push(LInteger(pos))
 	return 1
 
 errreturn:
@@ -476,7 +536,18 @@ func fileWrite(L *LState) int {
 }
 
 func fileClose(L *LState) int {
-	return fileCloseAux(L, checkFile(L))
+	checkFile(L)
+	return fileCloseAux(L, L.CheckUserData(1))
+}
+
+// fileGC closes a file which has not been closed when it is collected, except the standard streams.
+func fileGC(L *LState) int {
+	file := checkFile(L)
+	if file.closed || file.fp == os.Stdin || file.fp == os.Stdout || file.fp == os.Stderr {
+		return 0
+	}
+	fileCloseAux(L, L.CheckUserData(1))
+	return 0
 }
 
 func fileFlush(L *LState) int {
@@ -490,8 +561,11 @@ func fileLinesIter(L *LState) int {
 	} else {
 		file = L.Get(UpvalueIndex(2)).(*LUserData).Value.(*lFile)
 	}
+	release := file.interruptReadOnDone(L)
 	buf, _, err := file.reader.ReadLine()
+	release()
 	if err != nil {
+		L.CheckContext()
 		if err == io.EOF {
 			L.Push(LNil)
 			return 1
@@ -585,7 +659,7 @@ func ioInput(L *LState) int {
 
 func ioClose(L *LState) int {
 	if L.GetTop() == 0 {
-		return fileCloseAux(L, fileDefOut(L).Value.(*lFile))
+		return fileCloseAux(L, fileDefOut(L))
 	}
 	return fileClose(L)
 }
@@ -595,19 +669,17 @@ func ioFlush(L *LState) int {
 }
 
 func ioLinesIter(L *LState) int {
-	var file *lFile
-	toclose := false
-	if ud, ok := L.Get(1).(*LUserData); ok {
-		file = ud.Value.(*lFile)
-	} else {
-		file = L.Get(UpvalueIndex(2)).(*LUserData).Value.(*lFile)
-		toclose = true
+	ud, ok := L.Get(1).(*LUserData)
+	toclose := !ok
+	if toclose {
+		ud = L.Get(UpvalueIndex(2)).(*LUserData)
 	}
+	file := ud.Value.(*lFile)
 	buf, _, err := file.reader.ReadLine()
 	if err != nil {
 		if err == io.EOF {
 			if toclose {
-				fileCloseAux(L, file)
+				fileCloseAux(L, ud)
 			}
 			L.Push(LNil)
 			return 1
@@ -665,7 +737,7 @@ func ioOpenFile(L *LState) int {
 	if err != nil {
 		L.Push(LNil)
 		L.Push(LString(err.Error()))
-		L.Push(LNumber(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
+		L.Push(LInteger(1)) // C-Lua compatibility: Original Lua pushes errno to the stack
 		return 3
 	}
 	L.Push(file)
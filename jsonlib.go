@@ -3,6 +3,8 @@ package lua
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 )
 
 func OpenJson(L *LState) int {
@@ -69,8 +71,17 @@ func jsonEncode(L *LState) int {
 //  2. 返回的 table可以是 table、字符串、数值或布尔值等，具体取决于 JSON 内容
 func jsonDecode(L *LState) int {
 	data := L.CheckString(1)
+	// 使用 json.Number 以保留超出浮点数精度的整数
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
 	var goValue interface{}
-	if err := json.Unmarshal([]byte(data), &goValue); err != nil {
+	err := decoder.Decode(&goValue)
+	if err == nil {
+		if _, terr := decoder.Token(); terr != io.EOF {
+			err = fmt.Errorf("invalid data after top-level value")
+		}
+	}
+	if err != nil {
 		L.Push(LNil)
 		L.Push(LString(fmt.Sprintf("JSON decode error in parsing JSON: %v", err)))
 		return 2
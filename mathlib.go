@@ -13,6 +13,8 @@ func OpenMath(L *LState) int {
 	mod := L.RegisterModule(MathLibName, mathFuncs).(*LTable)
 	mod.RawSetString("pi", LNumber(math.Pi))
 	mod.RawSetString("huge", LNumber(math.MaxFloat64))
+	mod.RawSetString("maxinteger", LInteger(math.MaxInt64))
+	mod.RawSetString("mininteger", LInteger(math.MinInt64))
 	L.Push(mod)
 	return 1
 }
@@ -48,6 +50,8 @@ var MatLibFuncDoc = map[string]libFuncDoc{
 			"Sqrt",
 			"Tan",
 			"Tanh",
+			"ToInteger",
+			"Type",
 		},
 	},
 }
@@ -80,9 +84,42 @@ var mathFuncs = map[string]LGFunction{
 	"Sqrt":  mathSqrt,
 	"Tan":   mathTan,
 	"Tanh":  mathTanh,
+
+	"ToInteger": mathToInteger,
+	"Type":      mathType,
+}
+
+// checkNumberValue is like CheckNumber, but keeps the subtype of the number.
+func checkNumberValue(L *LState, n int) LValue {
+	v := L.Get(n)
+	if v.Type() == LTNumber {
+		return v
+	}
+	if lv, ok := v.(LString); ok {
+		if num, err := parseNumberValue(string(lv)); err == nil {
+			return num
+		}
+	}
+	L.TypeError(n, LTNumber)
+	return nil
+}
+
+// floatToIntegerValue converts an integral float to an integer if it fits in 64 bits.
+func floatToIntegerValue(v float64) LValue {
+	if iv, ok := float2integer(LNumber(v)); ok {
+		return iv
+	}
+	return LNumber(v)
 }
 
 func mathAbs(L *LState) int {
+	if iv, ok := checkNumberValue(L, 1).(LInteger); ok {
+		if iv < 0 {
+			iv = -iv
+		}
+		L.Push(iv)
+		return 1
+	}
 	L.Push(LNumber(math.Abs(float64(L.CheckNumber(1)))))
 	return 1
 }
@@ -108,7 +145,11 @@ func mathAtan2(L *LState) int {
 }
 
 func mathCeil(L *LState) int {
-	L.Push(LNumber(math.Ceil(float64(L.CheckNumber(1)))))
+	if iv, ok := checkNumberValue(L, 1).(LInteger); ok {
+		L.Push(iv)
+		return 1
+	}
+	L.Push(floatToIntegerValue(math.Ceil(float64(L.CheckNumber(1)))))
 	return 1
 }
 
@@ -133,7 +174,11 @@ func mathExp(L *LState) int {
 }
 
 func mathFloor(L *LState) int {
-	L.Push(LNumber(math.Floor(float64(L.CheckNumber(1)))))
+	if iv, ok := checkNumberValue(L, 1).(LInteger); ok {
+		L.Push(iv)
+		return 1
+	}
+	L.Push(floatToIntegerValue(math.Floor(float64(L.CheckNumber(1)))))
 	return 1
 }
 
@@ -175,11 +220,11 @@ func mathMax(L *LState) int {
 		L.Push(LString(fmt.Sprintf("wrong number of arguments")))
 		return 2
 	}
-	max := L.CheckNumber(1)
+	max := checkNumberValue(L, 1)
 	top := L.GetTop()
 	for i := 2; i <= top; i++ {
-		v := L.CheckNumber(i)
-		if v > max {
+		v := checkNumberValue(L, i)
+		if numberLess(max, v, false) {
 			max = v
 		}
 	}
@@ -193,11 +238,11 @@ func mathMin(L *LState) int {
 		L.Push(LString(fmt.Sprintf("wrong number of arguments")))
 		return 2
 	}
-	min := L.CheckNumber(1)
+	min := checkNumberValue(L, 1)
 	top := L.GetTop()
 	for i := 2; i <= top; i++ {
-		v := L.CheckNumber(i)
-		if v < min {
+		v := checkNumberValue(L, i)
+		if numberLess(v, min, false) {
 			min = v
 		}
 	}
@@ -206,9 +251,9 @@ func mathMin(L *LState) int {
 }
 
 func mathMod(L *LState) int {
-	lhs := L.CheckNumber(1)
-	rhs := L.CheckNumber(2)
-	L.Push(luaModulo(lhs, rhs))
+	lhs := checkNumberValue(L, 1)
+	rhs := checkNumberValue(L, 2)
+	L.Push(arithNumbers(L, OP_MOD, lhs, rhs))
 	return 1
 }
 
@@ -253,3 +298,26 @@ func mathTanh(L *LState) int {
 	L.Push(LNumber(math.Tanh(float64(L.CheckNumber(1)))))
 	return 1
 }
+
+func mathToInteger(L *LState) int {
+	if L.Get(1).Type() == LTNumber {
+		if iv, ok := LVAsInteger(L.Get(1)); ok {
+			L.Push(iv)
+			return 1
+		}
+	}
+	L.Push(LNil)
+	return 1
+}
+
+func mathType(L *LState) int {
+	switch L.CheckAny(1).(type) {
+	case LInteger:
+		L.Push(LString("integer"))
+	case LNumber:
+		L.Push(LString("float"))
+	default:
+		L.Push(LNil)
+	}
+	return 1
+}
@@ -0,0 +1,248 @@
+package lua
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+/* memory accounting {{{ */
+
+// Estimated sizes in bytes used for memory accounting. They are approximations of the Go heap usage,
+// not exact values.
+const (
+	memTableSize      = 96
+	memTableSlotSize  = 16
+	memTableEntrySize = 48
+	memStringSize     = 16
+	memFunctionSize   = 80
+	memUpvalueSize    = 48
+	memUserDataSize   = 64
+	memThreadSize     = 512
+)
+
+// MemoryErrorPrefix is the prefix of the error message raised when the memory limit is exceeded.
+const MemoryErrorPrefix = "memory limit exceeded"
+
+func tableMemSize(acap, hcap int) int64 {
+	return memTableSize + int64(acap)*memTableSlotSize + int64(hcap)*memTableEntrySize
+}
+
+func stringMemSize(s string) int64 {
+	return memStringSize + int64(len(s))
+}
+
+func functionMemSize(nupvalues int) int64 {
+	return memFunctionSize + int64(nupvalues)*memUpvalueSize
+}
+
+// allocMemory records an allocation of n bytes. If the accounted memory goes over Options.MemoryLimit,
+// the reachable memory is measured again, and an ApiErrorMemory error is raised if it is still over the limit.
+// To keep the cost of measuring low, the next measurement happens after at least 1/16 of the limit has been
+// allocated, so the reachable memory may briefly exceed the limit by that amount.
+func (ls *LState) allocMemory(n int64) {
+	ls.addMemory(n, n)
+}
+
+// addMemory records n allocated bytes, of which pending bytes are not reachable from the state yet.
+func (ls *LState) addMemory(n, pending int64) {
+	g := ls.G
+	if g.memLimit.Load() <= 0 {
+		return
+	}
+	if g.memUsed.Add(n) <= g.memCheck.Load() {
+		return
+	}
+	ls.resetMemory(pending)
+}
+
+// resetMemory measures the reachable memory plus the pending bytes which are about to become reachable,
+// and raises an error if it exceeds the limit.
+func (ls *LState) resetMemory(pending int64) {
+	g := ls.G
+	limit := g.memLimit.Load()
+	used := ls.measureMemory() + pending
+	g.memUsed.Store(used)
+	g.memCheck.Store(max(limit, used+limit/16))
+	if used > limit {
+		ls.raiseMemoryError(used)
+	}
+}
+
+// reserveMemory raises the memory error if n more bytes do not fit under the limit. Library functions call it
+// before building a large result, which is recorded by allocStrings once it is returned, so that the limit
+// prevents the allocation instead of reporting it afterwards.
+func (ls *LState) reserveMemory(n int64) {
+	limit := ls.G.memLimit.Load()
+	if limit <= 0 || ls.G.memUsed.Load()+n <= limit {
+		return
+	}
+	// the accounted memory may include garbage
+	if used := ls.measureUsage(); used+n > limit {
+		ls.raiseMemoryError(used + n)
+	}
+}
+
+// memoryLeft returns how many more bytes fit under the memory limit, or -1 if there is no limit.
+func (ls *LState) memoryLeft() int64 {
+	limit := ls.G.memLimit.Load()
+	if limit <= 0 {
+		return -1
+	}
+	return max(limit-ls.measureUsage(), 0)
+}
+
+// measureUsage measures the reachable memory and makes it the accounted memory.
+func (ls *LState) measureUsage() int64 {
+	g := ls.G
+	limit := g.memLimit.Load()
+	used := ls.measureMemory()
+	g.memUsed.Store(used)
+	g.memCheck.Store(max(limit, used+limit/16))
+	return used
+}
+
+// readAll reads r to its end like io.ReadAll, but raises the memory error as soon as the data
+// does not fit under the memory limit.
+func (ls *LState) readAll(r io.Reader) ([]byte, error) {
+	left := ls.memoryLeft()
+	if left < 0 {
+		return io.ReadAll(r)
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, left-memStringSize+1))
+	if err == nil && int64(len(buf)) > left-memStringSize {
+		ls.raiseMemoryError(ls.G.memLimit.Load() - left + stringMemSize(string(buf)))
+	}
+	return buf, err
+}
+
+// allocStrings records the strings in the n values on top of the stack. They are already reachable,
+// so a measurement does not count them twice.
+func (ls *LState) allocStrings(n int) {
+	if ls.G.memLimit.Load() <= 0 {
+		return
+	}
+	var size int64
+	top := ls.reg.Top()
+	for i := top - n; i < top; i++ {
+		if s, ok := ls.reg.array[i].(LString); ok {
+			size += stringMemSize(string(s))
+		}
+	}
+	if size > 0 {
+		ls.addMemory(size, 0)
+	}
+}
+
+func (ls *LState) raiseMemoryError(used int64) {
+	if !ls.hasErrorFunc {
+		ls.closeAllUpvalues()
+	}
+	message := fmt.Sprintf("%s: %d bytes in use, limit is %d bytes", MemoryErrorPrefix, used, ls.G.memLimit.Load())
+	err := &ApiError{ApiErrorMemory, LString(message), "", nil}
+	err.StackTrace = ls.stackTrace(0)
+	panic(err)
+}
+
+// MemoryUsage returns the accounted memory usage in bytes of the Global this LState belongs to.
+// The value is an estimate which is only tracked while a memory limit is set.
+func (ls *LState) MemoryUsage() int64 {
+	return ls.G.memUsed.Load()
+}
+
+// SetMemoryLimit sets the memory limit in bytes of the Global this LState belongs to. 0 means no limit.
+// If the current usage is already over the limit, the error is raised by the next allocation.
+func (ls *LState) SetMemoryLimit(limit int64) {
+	ls.G.memLimit.Store(limit)
+	ls.G.memCheck.Store(limit)
+	if limit > 0 {
+		ls.G.memUsed.Store(ls.measureMemory())
+	}
+}
+
+// measureMemory estimates the memory reachable from the registry, the globals and the stack of this LState.
+func (ls *LState) measureMemory() int64 {
+	m := &memMeasure{seen: make(map[unsafe.Pointer]struct{})}
+	m.value(ls.G.Registry)
+	m.value(ls.G.Global)
+	if ls.Env != nil {
+		m.value(ls.Env)
+	}
+	m.thread(ls)
+	return m.size
+}
+
+type memMeasure struct {
+	seen map[unsafe.Pointer]struct{}
+	size int64
+}
+
+func (m *memMeasure) visit(p unsafe.Pointer) bool {
+	if _, ok := m.seen[p]; ok {
+		return false
+	}
+	m.seen[p] = struct{}{}
+	return true
+}
+
+func (m *memMeasure) thread(L *LState) {
+	m.size += memThreadSize
+	for i := 0; i < L.reg.Top(); i++ {
+		m.value(L.reg.array[i])
+	}
+}
+
+func (m *memMeasure) value(lv LValue) {
+	switch v := lv.(type) {
+	case LString:
+		if len(v) > 0 && m.visit(unsafe.Pointer(unsafe.StringData(string(v)))) {
+			m.size += stringMemSize(string(v))
+		}
+	case *LTable:
+		if v == nil || !m.visit(unsafe.Pointer(v)) {
+			return
+		}
+		m.size += tableMemSize(cap(v.array), len(v.dict)+len(v.strdict))
+		for _, item := range v.array {
+			m.value(item)
+		}
+		for key, item := range v.dict {
+			m.value(key)
+			m.value(item)
+		}
+		for key, item := range v.strdict {
+			m.value(LString(key))
+			m.value(item)
+		}
+		m.value(v.Metatable)
+	case *LFunction:
+		if v == nil || !m.visit(unsafe.Pointer(v)) {
+			return
+		}
+		m.size += functionMemSize(len(v.Upvalues))
+		for _, uv := range v.Upvalues {
+			if uv != nil && uv.IsClosed() {
+				m.value(uv.value)
+			}
+		}
+		if v.Env != nil {
+			m.value(v.Env)
+		}
+	case *LUserData:
+		if v == nil || !m.visit(unsafe.Pointer(v)) {
+			return
+		}
+		m.size += memUserDataSize
+		if v.Env != nil {
+			m.value(v.Env)
+		}
+		m.value(v.Metatable)
+	case *LState:
+		if v == nil || !m.visit(unsafe.Pointer(v)) {
+			return
+		}
+		m.thread(v)
+	}
+}
+
+/* }}} */
@@ -30,7 +30,7 @@ import (
 	 1  MOVEN      (A B C)   R(A) := R(B); followed by R(C) MOVE ops
 	 2  LOADK      (A Bx)    R(A) := Kst(Bx)
 	 3  LOADBOOL   (A B C)   R(A) := (Bool)B; if (C) pc++
-	 4  LOADNIL    (A B)     R(A) := ... := R(B) := nil
+	 4  LOADNIL    (A B C)   R(A) := ... := R(B) := nil; if C then top := B+1
 	 5  GETUPVAL   (A B)     R(A) := UpValue[B]
 	 6  GETGLOBAL  (A Bx)    R(A) := Gbl[Kst(Bx)]
 	 7  GETTABLE   (A B C)   R(A) := R(B)[RK(C)]
@@ -96,7 +96,7 @@ const (
 	OP_MOVEN               /*   A B       R(A) := R(B); followed by R(C) MOVE ops           */
 	OP_LOADK               /*   A Bx      R(A) := Kst(Bx)                                   */
 	OP_LOADBOOL            /*   A B C     R(A) := (Bool)B; if (C) pc++                      */
-	OP_LOADNIL             /*   A B       R(A) := ... := R(B) := nil                        */
+	OP_LOADNIL             /*   A B C     R(A) := ... := R(B) := nil; if C then top := B+1  */
 	OP_GETUPVAL            /*   A B       R(A) := UpValue[B]                                */
 
 	OP_GETGLOBAL  /*   A Bx      R(A) := Gbl[Kst(Bx)]                                  */
@@ -141,6 +141,8 @@ const (
 	if R(A) <?= R(A+1) then { pc += sBx; R(A+3) = R(A) } */
 
 	OP_FORPREP /*   A sBx       R(A)-=R(A+2); pc += sBx                                */
+	/* integer loops keep the remaining iteration count in R(A+1) instead of the limit;
+	   FORPREP then sets R(A+3) := R(A) and falls into the loop body, or skips the loop */
 
 	OP_TFORLOOP /*   A C         R(A+3) ... R(A+3+C) := R(A)(R(A+1), R(A+2));
 	if R(A+3) ~= nil then { pc++; R(A+2) = R(A+3); } */
@@ -156,13 +158,38 @@ const (
 	OP_BOR  /*   A B C         R(A) := RK(B) | RK(C)                                   */
 	OP_SHL  /*   A B C         R(A) := RK(B) << RK(C)                                  */
 	OP_SHR  /*   A B C         R(A) := RK(B) >> RK(C)                                  */
+	OP_BXOR /*   A B C         R(A) := RK(B) ~ RK(C)                                   */
+	OP_BNOT /*   A B           R(A) := ~R(B)                                           */
+	OP_IDIV /*   A B C         R(A) := RK(B) ~/ RK(C)                                  */
 
 	OP_TYPEASSERT /*   A B C       R(A) := typeassert(R(B), RK(C))                       */
+	OP_TOSTRING   /*   A B         R(A) := tostring(R(B))                                  */
+
+	OP_DEFER    /*   A B C       defer R(A)(R(A+1) ... R(A+B-1)) in the block at depth C     */
+	OP_RUNDEFER /*   A           call the deferred functions of the blocks at depth >= A    */
+
+	OP_SWITCH /*   A Bx        pc += SWITCHTABLE[Bx][R(A)] (see note)                    */
+	/* the switch table also maps the types of R(A) to offsets; if neither the value nor the type
+	   has one, the next instruction is executed */
 
 	OP_NOP /* NOP */
 )
 const opCodeMax = OP_NOP
 
+// Superinstructions fuse an instruction with the one following it. They only appear in the code
+// the VM executes (see FunctionProto.quicken), never in compiled or dumped chunks. A superinstruction
+// keeps the operands of the first instruction and the second one stays in place, so jumps to it still work.
+// The pairs are the most frequent ones in the benchmarks of bench_test.go.
+const (
+	OP_EQJMP          = opCodeMax + 1 + iota /* EQ followed by JMP */
+	OP_LTJMP                                 /* LT followed by JMP */
+	OP_LEJMP                                 /* LE followed by JMP */
+	OP_TESTJMP                               /* TEST followed by JMP */
+	OP_GETTABLEKSCALL                        /* GETTABLEKS followed by CALL */
+	OP_SELFCALL                              /* SELF followed by CALL */
+)
+const opSuperMax = OP_SELFCALL
+
 type opArgMode int
 
 const (
@@ -194,7 +221,7 @@ var opProps = []opProp{
 	{"MOVEN", false, true, opArgModeR, opArgModeN, opTypeABC},
 	{"LOADK", false, true, opArgModeK, opArgModeN, opTypeABx},
 	{"LOADBOOL", false, true, opArgModeU, opArgModeU, opTypeABC},
-	{"LOADNIL", false, true, opArgModeR, opArgModeN, opTypeABC},
+	{"LOADNIL", false, true, opArgModeR, opArgModeU, opTypeABC},
 	{"GETUPVAL", false, true, opArgModeU, opArgModeN, opTypeABC},
 	{"GETGLOBAL", false, true, opArgModeK, opArgModeN, opTypeABx},
 	{"GETTABLE", false, true, opArgModeR, opArgModeK, opTypeABC},
@@ -235,7 +262,14 @@ var opProps = []opProp{
 	{"BOR", false, true, opArgModeK, opArgModeK, opTypeABC},
 	{"SHL", false, true, opArgModeK, opArgModeK, opTypeABC},
 	{"SHR", false, true, opArgModeK, opArgModeK, opTypeABC},
+	{"BXOR", false, true, opArgModeK, opArgModeK, opTypeABC},
+	{"BNOT", false, true, opArgModeR, opArgModeN, opTypeABC},
+	{"IDIV", false, true, opArgModeK, opArgModeK, opTypeABC},
 	{"TYPEASSERT", false, true, opArgModeR, opArgModeK, opTypeABC},
+	{"TOSTRING", false, true, opArgModeR, opArgModeN, opTypeABC},
+	{"DEFER", false, false, opArgModeU, opArgModeU, opTypeABC},
+	{"RUNDEFER", false, false, opArgModeN, opArgModeN, opTypeABC},
+	{"SWITCH", false, false, opArgModeU, opArgModeN, opTypeABx},
 	{"NOP", false, false, opArgModeR, opArgModeN, opTypeASbx},
 }
 
@@ -363,6 +397,9 @@ func opToString(inst uint32) string {
 		buf += fmt.Sprintf("; R(%v) := (Bool)%v; if (%v) pc++", arga, argb, argc)
 	case OP_LOADNIL:
 		buf += fmt.Sprintf("; R(%v) := ... := R(%v) := nil", arga, argb)
+		if argc != 0 {
+			buf += fmt.Sprintf("; top := %v", argb+1)
+		}
 	case OP_GETUPVAL:
 		buf += fmt.Sprintf("; R(%v) := UpValue[%v]", arga, argb)
 	case OP_GETGLOBAL:
@@ -456,8 +493,22 @@ func opToString(inst uint32) string {
 		buf += fmt.Sprintf("; R(%v) := RK(%v) << RK(%v)", arga, argb, argc)
 	case OP_SHR:
 		buf += fmt.Sprintf("; R(%v) := RK(%v) >> RK(%v)", arga, argb, argc)
+	case OP_BXOR:
+		buf += fmt.Sprintf("; R(%v) := RK(%v) ~ RK(%v)", arga, argb, argc)
+	case OP_BNOT:
+		buf += fmt.Sprintf("; R(%v) := ~R(%v)", arga, argb)
+	case OP_IDIV:
+		buf += fmt.Sprintf("; R(%v) := RK(%v) ~/ RK(%v)", arga, argb, argc)
 	case OP_TYPEASSERT:
 		buf += fmt.Sprintf("; R(%v) := typeassert(R(%v), RK(%v))", arga, argb, argc)
+	case OP_TOSTRING:
+		buf += fmt.Sprintf("; R(%v) := tostring(R(%v))", arga, argb)
+	case OP_DEFER:
+		buf += fmt.Sprintf("; defer R(%v)(R(%v+1) ... R(%v+%v-1)) at depth %v", arga, arga, arga, argb, argc)
+	case OP_RUNDEFER:
+		buf += fmt.Sprintf("; run deferred calls at depth >= %v", arga)
+	case OP_SWITCH:
+		buf += fmt.Sprintf("; pc += SWITCHTABLE[%v][R(%v)]", argbx, arga)
 	case OP_NOP:
 		/* nothing to do */
 	}
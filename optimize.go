@@ -0,0 +1,654 @@
+package lua
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"milklua/ast"
+)
+
+/* optimizer {{{ */
+
+// Optimize rewrites a parsed chunk before it is compiled. Operations on constants are folded,
+// branches with constant conditions are pruned and statements that can never run are removed.
+// The optimized chunk behaves exactly like the original one, only with less bytecode. Code that
+// never runs but holds a goto, a label, a break or a continue is kept, so that the compiler
+// reports the same errors with and without the optimization.
+// The statements of the chunk are modified in place.
+func Optimize(chunk []ast.Stmt) []ast.Stmt {
+	return optimizeBlock(chunk)
+}
+
+func optimizeBlock(stmts []ast.Stmt) []ast.Stmt {
+	result := make([]ast.Stmt, 0, len(stmts))
+	for i, stmt := range stmts {
+		stmt = optimizeStmt(stmt)
+		if stmt == nil {
+			continue
+		}
+		result = append(result, stmt)
+		if isTerminalStmt(stmt) && !hasLabel(stmts[i+1:]) {
+			// the rest of the block is unreachable. With a label it could be reached by a goto,
+			// and removing locals would change which gotos jump into their scope.
+			return append(result, deadStmts(stmts[i+1:])...)
+		}
+	}
+	return result
+}
+
+// deadStmts returns the unreachable statements the compiler still has to see: the ones containing
+// jumps, which are checked even if they never run, and the local declarations, which decide
+// whether a continue jumps into the scope of a local.
+func deadStmts(stmts []ast.Stmt) []ast.Stmt {
+	var result []ast.Stmt
+	for _, stmt := range stmts {
+		if _, ok := stmt.(*ast.LocalAssignStmt); ok || stmtContainsJump(stmt) {
+			if stmt = optimizeStmt(stmt); stmt != nil {
+				result = append(result, stmt)
+			}
+		}
+	}
+	return result
+}
+
+func hasLabel(stmts []ast.Stmt) bool {
+	for _, stmt := range stmts {
+		if _, ok := stmt.(*ast.LabelStmt); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerminalStmt reports whether the statements after stmt in the same block are unreachable.
+func isTerminalStmt(stmt ast.Stmt) bool {
+	switch st := stmt.(type) {
+	case *ast.ReturnStmt, *ast.BreakStmt, *ast.ContinueStmt, *ast.GotoStmt:
+		return true
+	case *ast.DoBlockStmt:
+		return len(st.Stmts) > 0 && isTerminalStmt(st.Stmts[len(st.Stmts)-1])
+	case *ast.IfStmt:
+		return len(st.Then) > 0 && isTerminalStmt(st.Then[len(st.Then)-1]) &&
+			len(st.Else) > 0 && isTerminalStmt(st.Else[len(st.Else)-1])
+	case *ast.SwitchStmt:
+		if len(st.Default) == 0 || !isTerminalStmt(st.Default[len(st.Default)-1]) {
+			return false
+		}
+		for _, cs := range st.Cases {
+			if len(cs.Stmts) == 0 || !isTerminalStmt(cs.Stmts[len(cs.Stmts)-1]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// containsJump reports whether the statements hold a goto, a label, a break or a continue, also in
+// nested functions. The compiler checks these even in code that never runs, so it is not removed.
+func containsJump(stmts []ast.Stmt) bool {
+	for _, stmt := range stmts {
+		if stmtContainsJump(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+func stmtContainsJump(stmt ast.Stmt) bool {
+	switch st := stmt.(type) {
+	case *ast.GotoStmt, *ast.LabelStmt, *ast.BreakStmt, *ast.ContinueStmt:
+		return true
+	case *ast.AssignStmt:
+		return exprsContainJump(st.Lhs) || exprsContainJump(st.Rhs)
+	case *ast.CompoundAssignStmt:
+		return exprContainsJump(st.Lhs) || exprContainsJump(st.Rhs)
+	case *ast.LocalAssignStmt:
+		return exprsContainJump(st.Exprs)
+	case *ast.FuncCallStmt:
+		return exprContainsJump(st.Expr)
+	case *ast.DeferStmt:
+		return exprContainsJump(st.Call)
+	case *ast.ReturnStmt:
+		return exprsContainJump(st.Exprs)
+	case *ast.FuncDefStmt:
+		return containsJump(st.Func.Stmts)
+	case *ast.DoBlockStmt:
+		return containsJump(st.Stmts)
+	case *ast.WhileStmt:
+		return exprContainsJump(st.Condition) || containsJump(st.Stmts)
+	case *ast.WhileStmtWithIfThru:
+		return exprContainsJump(st.Condition) || containsJump(st.Stmts) || containsJump(st.IfThruStmts)
+	case *ast.RepeatStmt:
+		return exprContainsJump(st.Condition) || containsJump(st.Stmts)
+	case *ast.RepeatStmtWithIfThru:
+		return exprContainsJump(st.Condition) || containsJump(st.Stmts) || containsJump(st.IfThruStmts)
+	case *ast.IfStmt:
+		return exprContainsJump(st.Condition) || containsJump(st.Then) || containsJump(st.Else)
+	case *ast.NumberForStmt:
+		return exprsContainJump([]ast.Expr{st.Init, st.Limit, st.Step}) || containsJump(st.Stmts)
+	case *ast.NumberForStmtWithIfThru:
+		return exprsContainJump([]ast.Expr{st.Init, st.Limit, st.Step}) || containsJump(st.Stmts) ||
+			containsJump(st.IfThruStmts)
+	case *ast.GenericForStmt:
+		return exprsContainJump(st.Exprs) || containsJump(st.Stmts)
+	case *ast.GenericForStmtWithIfThru:
+		return exprsContainJump(st.Exprs) || containsJump(st.Stmts) || containsJump(st.IfThruStmts)
+	case *ast.SwitchStmt:
+		if exprContainsJump(st.Expr) || containsJump(st.Default) {
+			return true
+		}
+		for _, cs := range st.Cases {
+			if exprsContainJump(cs.Values) || containsJump(cs.Stmts) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func exprsContainJump(exprs []ast.Expr) bool {
+	for _, expr := range exprs {
+		if exprContainsJump(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// exprContainsJump reports whether a function in expr holds a goto, a label, a break or a continue.
+func exprContainsJump(expr ast.Expr) bool {
+	switch ex := expr.(type) {
+	case *ast.FunctionExpr:
+		return containsJump(ex.Stmts)
+	case *ast.AttrGetExpr:
+		return exprContainsJump(ex.Object) || exprContainsJump(ex.Key)
+	case *ast.SafeAttrGetExpr:
+		return exprContainsJump(ex.Object) || exprContainsJump(ex.Key)
+	case *ast.TableExpr:
+		for _, field := range ex.Fields {
+			if exprContainsJump(field.Key) || exprContainsJump(field.Value) {
+				return true
+			}
+		}
+	case *ast.FuncCallExpr:
+		return exprContainsJump(ex.Func) || exprContainsJump(ex.Receiver) || exprsContainJump(ex.Args)
+	case *ast.LogicalOpExpr:
+		return exprContainsJump(ex.Lhs) || exprContainsJump(ex.Rhs)
+	case *ast.NilCoalesceExpr:
+		return exprContainsJump(ex.Lhs) || exprContainsJump(ex.Rhs)
+	case *ast.BitwiseOpExpr:
+		return exprContainsJump(ex.Lhs) || exprContainsJump(ex.Rhs)
+	case *ast.RelationalOpExpr:
+		return exprContainsJump(ex.Lhs) || exprContainsJump(ex.Rhs)
+	case *ast.StringConcatOpExpr:
+		return exprContainsJump(ex.Lhs) || exprContainsJump(ex.Rhs)
+	case *ast.ArithmeticOpExpr:
+		return exprContainsJump(ex.Lhs) || exprContainsJump(ex.Rhs)
+	case *ast.InterpolatedStringExpr:
+		return exprsContainJump(ex.Parts)
+	case *ast.UnaryMinusOpExpr:
+		return exprContainsJump(ex.Expr)
+	case *ast.UnaryNotOpExpr:
+		return exprContainsJump(ex.Expr)
+	case *ast.UnaryLenOpExpr:
+		return exprContainsJump(ex.Expr)
+	case *ast.UnaryBitNotOpExpr:
+		return exprContainsJump(ex.Expr)
+	case *ast.TypeAssertionExpr:
+		return exprContainsJump(ex.Expr)
+	}
+	return false
+}
+
+// optimizeStmt returns the optimized statement, or nil if the statement does nothing.
+func optimizeStmt(stmt ast.Stmt) ast.Stmt {
+	switch st := stmt.(type) {
+	case *ast.AssignStmt:
+		optimizeExprs(st.Lhs)
+		optimizeExprs(st.Rhs)
+	case *ast.CompoundAssignStmt:
+		st.Lhs = optimizeExpr(st.Lhs)
+		st.Rhs = optimizeExpr(st.Rhs)
+	case *ast.LocalAssignStmt:
+		optimizeExprs(st.Exprs)
+	case *ast.FuncCallStmt:
+		st.Expr = optimizeExpr(st.Expr)
+		if _, ok := st.Expr.(*ast.FuncCallExpr); !ok {
+			// an optional chain which is always nil
+			return nil
+		}
+	case *ast.DeferStmt:
+		optimizeExpr(st.Call)
+	case *ast.DoBlockStmt:
+		st.Stmts = optimizeBlock(st.Stmts)
+	case *ast.WhileStmt:
+		st.Condition = optimizeExpr(st.Condition)
+		if truth, ok := constTruth(st.Condition); ok && !truth && !containsJump(st.Stmts) {
+			return nil
+		}
+		st.Stmts = optimizeBlock(st.Stmts)
+	case *ast.WhileStmtWithIfThru:
+		st.Condition = optimizeExpr(st.Condition)
+		if truth, ok := constTruth(st.Condition); ok && !truth && !containsJump(st.Stmts) {
+			// the loop ends at once without a break
+			block := optimizeBlock(st.IfThruStmts)
+			if len(block) == 0 {
+				return nil
+			}
+			do := &ast.DoBlockStmt{Stmts: block}
+			do.SetLine(st.Line())
+			do.SetLastLine(st.LastLine())
+			return do
+		}
+		st.Stmts = optimizeBlock(st.Stmts)
+		st.IfThruStmts = optimizeBlock(st.IfThruStmts)
+	case *ast.RepeatStmt:
+		st.Stmts = optimizeBlock(st.Stmts)
+		st.Condition = optimizeExpr(st.Condition)
+	case *ast.RepeatStmtWithIfThru:
+		st.Stmts = optimizeBlock(st.Stmts)
+		st.Condition = optimizeExpr(st.Condition)
+		st.IfThruStmts = optimizeBlock(st.IfThruStmts)
+	case *ast.IfStmt:
+		st.Condition = optimizeExpr(st.Condition)
+		if truth, ok := constTruth(st.Condition); ok {
+			// the taken branch keeps its own scope
+			block, dead := st.Else, st.Then
+			if truth {
+				block, dead = st.Then, st.Else
+			}
+			if containsJump(dead) {
+				st.Then = optimizeBlock(st.Then)
+				st.Else = optimizeBlock(st.Else)
+				break
+			}
+			block = optimizeBlock(block)
+			if len(block) == 0 {
+				return nil
+			}
+			do := &ast.DoBlockStmt{Stmts: block}
+			do.SetLine(st.Line())
+			do.SetLastLine(st.LastLine())
+			return do
+		}
+		st.Then = optimizeBlock(st.Then)
+		st.Else = optimizeBlock(st.Else)
+	case *ast.NumberForStmt:
+		st.Init, st.Limit, st.Step = optimizeExpr(st.Init), optimizeExpr(st.Limit), optimizeExpr(st.Step)
+		st.Stmts = optimizeBlock(st.Stmts)
+	case *ast.NumberForStmtWithIfThru:
+		st.Init, st.Limit, st.Step = optimizeExpr(st.Init), optimizeExpr(st.Limit), optimizeExpr(st.Step)
+		st.Stmts = optimizeBlock(st.Stmts)
+		st.IfThruStmts = optimizeBlock(st.IfThruStmts)
+	case *ast.GenericForStmt:
+		optimizeExprs(st.Exprs)
+		st.Stmts = optimizeBlock(st.Stmts)
+	case *ast.GenericForStmtWithIfThru:
+		optimizeExprs(st.Exprs)
+		st.Stmts = optimizeBlock(st.Stmts)
+		st.IfThruStmts = optimizeBlock(st.IfThruStmts)
+	case *ast.FuncDefStmt:
+		st.Func.Stmts = optimizeBlock(st.Func.Stmts)
+	case *ast.ReturnStmt:
+		optimizeExprs(st.Exprs)
+	case *ast.SwitchStmt:
+		st.Expr = optimizeExpr(st.Expr)
+		for _, cs := range st.Cases {
+			optimizeExprs(cs.Values)
+			cs.Stmts = optimizeBlock(cs.Stmts)
+		}
+		st.Default = optimizeBlock(st.Default)
+		if block, ok := foldSwitch(st); ok {
+			if len(block) == 0 {
+				return nil
+			}
+			do := &ast.DoBlockStmt{Stmts: block}
+			do.SetLine(st.Line())
+			do.SetLastLine(st.LastLine())
+			return do
+		}
+	}
+	return stmt
+}
+
+func optimizeExprs(exprs []ast.Expr) {
+	for i, expr := range exprs {
+		exprs[i] = optimizeExpr(expr)
+	}
+}
+
+// optimizeExpr returns the expression with the operations on constants folded.
+// Operations that may raise an error or call a metamethod are left to the runtime.
+func optimizeExpr(expr ast.Expr) ast.Expr {
+	if expr == nil {
+		return nil
+	}
+	var folded ast.Expr
+	switch ex := expr.(type) {
+	case *ast.AttrGetExpr:
+		chain := isOptionalChain(ex)
+		ex.Object = optimizeExpr(ex.Object)
+		ex.Key = optimizeExpr(ex.Key)
+		// an optional index before this one stops the chain
+		if _, ok := ex.Object.(*ast.NilExpr); ok && chain && !exprContainsJump(ex.Key) {
+			folded = &ast.NilExpr{}
+		}
+	case *ast.SafeAttrGetExpr:
+		ex.Object = optimizeExpr(ex.Object)
+		ex.Key = optimizeExpr(ex.Key)
+		if _, ok := ex.Object.(*ast.NilExpr); ok && !exprContainsJump(ex.Key) {
+			folded = &ast.NilExpr{}
+		}
+	case *ast.TableExpr:
+		for _, field := range ex.Fields {
+			field.Key = optimizeExpr(field.Key)
+			field.Value = optimizeExpr(field.Value)
+		}
+	case *ast.FuncCallExpr:
+		chain := isOptionalChain(ex)
+		ex.Func = optimizeExpr(ex.Func)
+		ex.Receiver = optimizeExpr(ex.Receiver)
+		optimizeExprs(ex.Args)
+		_, nilFunc := ex.Func.(*ast.NilExpr)
+		_, nilReceiver := ex.Receiver.(*ast.NilExpr)
+		if (nilFunc || nilReceiver) && chain && !exprsContainJump(ex.Args) {
+			folded = &ast.NilExpr{}
+		}
+	case *ast.FunctionExpr:
+		ex.Stmts = optimizeBlock(ex.Stmts)
+	case *ast.ArithmeticOpExpr:
+		ex.Lhs, ex.Rhs = optimizeExpr(ex.Lhs), optimizeExpr(ex.Rhs)
+		lvalue, lok := lnumberValue(ex.Lhs)
+		rvalue, rok := lnumberValue(ex.Rhs)
+		if lok && rok {
+			if value, ok := foldArith(ex.Operator, lvalue, rvalue); ok {
+				folded = constValueExpr(value)
+			}
+		}
+	case *ast.BitwiseOpExpr:
+		ex.Lhs, ex.Rhs = optimizeExpr(ex.Lhs), optimizeExpr(ex.Rhs)
+		lvalue, lok := lnumberValue(ex.Lhs)
+		rvalue, rok := lnumberValue(ex.Rhs)
+		if lok && rok {
+			if value, ok := foldBitwise(ex.Operator, lvalue, rvalue); ok {
+				folded = constValueExpr(value)
+			}
+		}
+	case *ast.StringConcatOpExpr:
+		ex.Lhs, ex.Rhs = optimizeExpr(ex.Lhs), optimizeExpr(ex.Rhs)
+		lvalue, lok := constValue(ex.Lhs)
+		rvalue, rok := constValue(ex.Rhs)
+		if lok && rok && LVCanConvToString(lvalue) && LVCanConvToString(rvalue) {
+			folded = &ast.StringExpr{Value: LVAsString(lvalue) + LVAsString(rvalue)}
+		}
+	case *ast.InterpolatedStringExpr:
+		folded = optimizeInterpolatedString(ex)
+	case *ast.RelationalOpExpr:
+		ex.Lhs, ex.Rhs = optimizeExpr(ex.Lhs), optimizeExpr(ex.Rhs)
+		lvalue, lok := constValue(ex.Lhs)
+		rvalue, rok := constValue(ex.Rhs)
+		if lok && rok {
+			if value, ok := foldRelational(ex.Operator, lvalue, rvalue); ok {
+				folded = constValueExpr(LBool(value))
+			}
+		}
+	case *ast.LogicalOpExpr:
+		ex.Lhs, ex.Rhs = optimizeExpr(ex.Lhs), optimizeExpr(ex.Rhs)
+		if result := foldLogical(ex); result != ex {
+			return result
+		}
+	case *ast.NilCoalesceExpr:
+		ex.Lhs, ex.Rhs = optimizeExpr(ex.Lhs), optimizeExpr(ex.Rhs)
+		if result := foldNilCoalesce(ex); result != ex {
+			return result
+		}
+	case *ast.UnaryMinusOpExpr:
+		ex.Expr = optimizeExpr(ex.Expr)
+		if value, ok := lnumberValue(ex.Expr); ok {
+			folded = constValueExpr(foldNegate(value))
+		}
+	case *ast.UnaryBitNotOpExpr:
+		ex.Expr = optimizeExpr(ex.Expr)
+		if value, ok := lnumberValue(ex.Expr); ok {
+			if ivalue, ok := LVAsInteger(value); ok {
+				folded = constValueExpr(^ivalue)
+			}
+		}
+	case *ast.UnaryNotOpExpr:
+		ex.Expr = optimizeExpr(ex.Expr)
+		if truth, ok := constTruth(ex.Expr); ok {
+			folded = constValueExpr(LBool(!truth))
+		}
+	case *ast.UnaryLenOpExpr:
+		ex.Expr = optimizeExpr(ex.Expr)
+		if str, ok := ex.Expr.(*ast.StringExpr); ok {
+			folded = constValueExpr(LInteger(utf8.RuneCountInString(str.Value)))
+		}
+	case *ast.TypeAssertionExpr:
+		ex.Expr = optimizeExpr(ex.Expr)
+		// only assertions that hold are removed, failed ones may raise an error in strict mode
+		if builtinType, ok := ex.Type.(*ast.BuiltinType); ok && literalType(ex.Expr) == builtinType.Kind {
+			return ex.Expr
+		}
+	}
+	if folded != nil {
+		folded.SetLine(expr.Line())
+		folded.SetLastLine(expr.LastLine())
+		return folded
+	}
+	return expr
+}
+
+// optimizeInterpolatedString merges the constant parts of an interpolated string. It returns
+// a StringExpr if every part is constant and nil otherwise.
+func optimizeInterpolatedString(expr *ast.InterpolatedStringExpr) ast.Expr {
+	parts := make([]ast.Expr, 0, len(expr.Parts))
+	var buf strings.Builder
+	literal := func() {
+		if buf.Len() > 0 {
+			part := &ast.StringExpr{Value: buf.String()}
+			part.SetLine(expr.Line())
+			parts = append(parts, part)
+			buf.Reset()
+		}
+	}
+	for _, part := range expr.Parts {
+		part = optimizeExpr(part)
+		// tostring of a constant does not depend on metatables
+		if value, ok := constValue(part); ok {
+			buf.WriteString(value.String())
+			continue
+		}
+		literal()
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return &ast.StringExpr{Value: buf.String()}
+	}
+	literal()
+	expr.Parts = parts
+	return nil
+}
+
+// foldRelational compares two constants. Comparisons that raise an error are left to the runtime.
+func foldRelational(operator string, lhs, rhs LValue) (bool, bool) {
+	switch operator {
+	case "==":
+		return equals(nil, lhs, rhs, true), true
+	case "~=":
+		return !equals(nil, lhs, rhs, true), true
+	case ">", ">=":
+		lhs, rhs = rhs, lhs
+	}
+	orEqual := operator == "<=" || operator == ">="
+	if lhs.Type() == LTNumber && rhs.Type() == LTNumber {
+		return numberLess(lhs, rhs, orEqual), true
+	}
+	if lstr, ok := lhs.(LString); ok {
+		if rstr, ok := rhs.(LString); ok {
+			cmp := strings.Compare(string(lstr), string(rstr))
+			return cmp < 0 || orEqual && cmp == 0, true
+		}
+	}
+	return false, false
+}
+
+// foldSwitch returns the block a switch statement on a constant runs, if the cases before
+// the one that matches are constants or types too.
+func foldSwitch(stmt *ast.SwitchStmt) ([]ast.Stmt, bool) {
+	value, ok := constValue(stmt.Expr)
+	if !ok {
+		return nil, false
+	}
+	taken := -1
+	for i := 0; i < len(stmt.Cases) && taken < 0; i++ {
+		for _, expr := range stmt.Cases[i].Values {
+			if builtinType, ok := expr.(*ast.BuiltinType); ok {
+				if literalType(stmt.Expr) == builtinType.Kind {
+					taken = i
+					break
+				}
+				continue
+			}
+			cnst, ok := constValue(expr)
+			if !ok {
+				return nil, false
+			}
+			if equal, _ := foldRelational("==", value, cnst); equal {
+				taken = i
+				break
+			}
+		}
+	}
+	block := stmt.Default
+	if taken >= 0 {
+		block = stmt.Cases[taken].Stmts
+	} else {
+		taken = len(stmt.Cases)
+	}
+	// the cases that are removed must not hold jumps the compiler checks
+	for i, cs := range stmt.Cases {
+		if i != taken && containsJump(cs.Stmts) {
+			return nil, false
+		}
+	}
+	if taken < len(stmt.Cases) && containsJump(stmt.Default) {
+		return nil, false
+	}
+	return block, true
+}
+
+// foldLogical returns the operand that an and/or expression with a constant left operand
+// evaluates to, or expr itself.
+func foldLogical(expr *ast.LogicalOpExpr) ast.Expr {
+	truth, ok := constTruth(expr.Lhs)
+	if !ok {
+		return expr
+	}
+	if truth == (expr.Operator == "or") {
+		if exprContainsJump(expr.Rhs) {
+			return expr
+		}
+		return expr.Lhs
+	}
+	// the right operand still yields a single value
+	switch ex := expr.Rhs.(type) {
+	case *ast.FuncCallExpr:
+		ex.AdjustRet = true
+	case *ast.Comma3Expr:
+		ex.AdjustRet = true
+	}
+	return expr.Rhs
+}
+
+// foldNilCoalesce returns the operand that a ?? expression with a constant left operand
+// evaluates to, or expr itself.
+func foldNilCoalesce(expr *ast.NilCoalesceExpr) ast.Expr {
+	if _, ok := expr.Lhs.(*ast.FunctionExpr); ok && !exprContainsJump(expr.Rhs) {
+		return expr.Lhs
+	}
+	value, ok := constValue(expr.Lhs)
+	if !ok {
+		return expr
+	}
+	if value != LNil {
+		if exprContainsJump(expr.Rhs) {
+			return expr
+		}
+		return expr.Lhs
+	}
+	switch ex := expr.Rhs.(type) {
+	case *ast.FuncCallExpr:
+		ex.AdjustRet = true
+	case *ast.Comma3Expr:
+		ex.AdjustRet = true
+	}
+	return expr.Rhs
+}
+
+// constValue returns the value of a nil, bool, number or string constant.
+func constValue(expr ast.Expr) (LValue, bool) {
+	switch ex := expr.(type) {
+	case *ast.NilExpr:
+		return LNil, true
+	case *ast.TrueExpr:
+		return LTrue, true
+	case *ast.FalseExpr:
+		return LFalse, true
+	case *ast.StringExpr:
+		return LString(ex.Value), true
+	case *ast.NumberExpr:
+		return lnumberValue(ex)
+	case *constLValueExpr:
+		return ex.Value, true
+	}
+	return nil, false
+}
+
+// constTruth reports whether a constant expression is true in a condition.
+// Function constructors are constants that are always true.
+func constTruth(expr ast.Expr) (bool, bool) {
+	if _, ok := expr.(*ast.FunctionExpr); ok {
+		return true, true
+	}
+	if value, ok := constValue(expr); ok {
+		return LVAsBool(value), true
+	}
+	return false, false
+}
+
+// constValueExpr returns the expression for a constant. Numbers are kept as values, so that
+// integers and floats keep their subtype.
+func constValueExpr(value LValue) ast.Expr {
+	switch v := value.(type) {
+	case *LNilType:
+		return &ast.NilExpr{}
+	case LBool:
+		if v {
+			return &ast.TrueExpr{}
+		}
+		return &ast.FalseExpr{}
+	case LString:
+		return &ast.StringExpr{Value: string(v)}
+	}
+	return &constLValueExpr{Value: value}
+}
+
+// literalType returns the type name of a literal as used by type assertions, or "" if expr is not a literal.
+func literalType(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.TableExpr:
+		return "table"
+	case *ast.FunctionExpr:
+		return "function"
+	case *ast.TrueExpr, *ast.FalseExpr:
+		return "bool"
+	}
+	if value, ok := constValue(expr); ok && value != LNil {
+		return value.Type().String()
+	}
+	return ""
+}
+
+/* }}} */
@@ -0,0 +1,116 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+
+	"milklua/parse"
+)
+
+// dumpCode returns the -dc listing of src, compiled with or without the optimization pass.
+func dumpCode(t *testing.T, src string, optimize bool) string {
+	t.Helper()
+	chunk, err := parse.Parse(strings.NewReader(src), "<dump>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if optimize {
+		chunk = Optimize(chunk)
+	}
+	proto, err := Compile(chunk, "<dump>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proto.String()
+}
+
+func TestOptimize(t *testing.T) {
+	cases := []struct {
+		src string
+		// the optimized src compiles to the same code as expected
+		expected string
+	}{
+		{`local a = (2 * 3 + 1) << 1`, `local a = 14`},
+		{`local a = 7 / 2 + 2 ^ 2`, `local a = 7.5`},
+		{`local s = "n" .. 1 .. "." .. 2.5`, `local s = "n1.2.5"`},
+		{`local b = 1 < 2 and "x" ~= "y" and 1 == 1.0`, `local b = true`},
+		{`local v = nil or (1).(number)`, `local v = 1`},
+		{`local v = not "a" or #"héllo"`, `local v = 5`},
+		{"local s = `${1}-${\"a\"}-${true}`", `local s = "1-a-true"`},
+		{"local x = 1 local s = `a${1 + 1}b${x}`", "local x = 1 local s = `a2b${x}`"},
+		{`if 1 > 2 { f() } elseif false { g() } else { local x = 1 h(x) }`, `{ { local x = 1 h(x) } }`},
+		{`if "" { f() }`, `{ f() }`},
+		{`while nil { f() } g()`, `g()`},
+		{`func f() { if true { return 1 } g() }`, `func f() { { return 1 } }`},
+		{`for i = 1, 2 { { break } f() }`, `for i = 1, 2 { { break } }`},
+		{`while x { { continue } f() } while nil { f() } ifthru { g() }`, `while x { { continue } } { g() }`},
+		{`local x = f() and 1 + 1`, `local x = f() and 2`},
+		{`local a, b, c = nil ?? f(), false ?? 1, (nil)?.x`, `local a, b, c = (f()), false, nil`},
+		{`switch -1 { case 1 { f() } case number { local x = 1 g(x) } default { h() } }`, `{ local x = 1 g(x) }`},
+		{`switch "b" { case "a" { f() } default { g() } } switch nil { case bool { f() } }`, `{ g() }`},
+		// the cases before the matching one must be constants
+		{`switch 2 { case x { f() } case 2 { g() } }`, `switch 2 { case x { f() } case 2 { g() } }`},
+		// a goto may jump to the label, so nothing is removed
+		{`goto done f() ::done::`, `goto done f() ::done::`},
+		// errors and type assertions that fail are left to the runtime
+		{`local a, b = 1 ~/ 0, 1.5 | 1`, `local a, b = 1 ~/ 0, 1.5 | 1`},
+		{`local a, b = 1 < "2", ("a").(number)`, `local a, b = 1 < "2", ("a").(number)`},
+	}
+	for _, c := range cases {
+		if got, want := dumpCode(t, c.src, true), dumpCode(t, c.expected, false); got != want {
+			t.Errorf("%s: expected the code of %s\n%s\ngot\n%s", c.src, c.expected, want, got)
+		}
+	}
+}
+
+func TestOptimizeKeepsResults(t *testing.T) {
+	src := `
+		local func pair() { return 1, 2 }
+		local t = {true and pair()}
+		local s = "a" .. 2 .. 0.5 .. ` + "`${-0.0}`" + `
+		result = tbllib.Concat({#t, 1 and 2, ToString(nil and 1), ToString(false or nil), s, 3 ~/ 2.0}, ",")
+	`
+	var results []LValue
+	for _, skip := range []bool{false, true} {
+		L := NewState(Options{SkipOptimization: skip})
+		if err := L.DoString(src); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, L.GetGlobal("result"))
+		L.Close()
+	}
+	if results[0] != results[1] {
+		t.Errorf("optimized result %v differs from %v", results[0], results[1])
+	}
+}
+
+func TestOptimizeKeepsErrors(t *testing.T) {
+	srcs := []string{
+		`if false { goto nowhere }`,
+		`if false { continue }`,
+		`while false { ::a:: ::a:: }`,
+		`local f = false and func() { break }`,
+		`switch 1 { case 1 { f() } case 2 { continue } }`,
+		// the dead statements after a break still declare locals the until condition could see
+		`repeat { { break } { continue } local y = 1 } until y`,
+		`repeat { if x { continue } { break } local y = 1 } until y`,
+		`func f() { { return } goto done }`,
+	}
+	for _, src := range srcs {
+		var errs []string
+		for _, skip := range []bool{false, true} {
+			L := NewState(Options{SkipOptimization: skip})
+			if _, err := L.LoadString(src); err != nil {
+				errs = append(errs, err.Error())
+			} else {
+				errs = append(errs, "")
+			}
+			L.Close()
+		}
+		if errs[1] == "" {
+			t.Errorf("%s: expected an error", src)
+		} else if errs[0] != errs[1] {
+			t.Errorf("%s: optimized error %q differs from %q", src, errs[0], errs[1])
+		}
+	}
+}
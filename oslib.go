@@ -24,6 +24,8 @@ func getIntField(_ *LState, tb *LTable, key string, v int) int {
 	switch lv := ret.(type) {
 	case LNumber:
 		return int(lv)
+	case LInteger:
+		return int(lv)
 	case LString:
 		slv := string(lv)
 		slv = strings.TrimLeft(slv, " ")
@@ -126,16 +128,16 @@ func osExecute(L *LState) int {
 	args = append([]string{cmd}, args...)
 	process, err := os.StartProcess(cmd, args, &procAttr)
 	if err != nil {
-		L.Push(LNumber(1))
+		L.Push(LInteger(1))
 		return 1
 	}
 
 	ps, err := process.Wait()
 	if err != nil || !ps.Success() {
-		L.Push(LNumber(1))
+		L.Push(LInteger(1))
 		return 1
 	}
-	L.Push(LNumber(0))
+	L.Push(LInteger(0))
 	return 1
 }
 
@@ -440,7 +442,7 @@ func osRelPath(L *LState) int {
 // 备注：
 //  1. 返回的 ID 是当前进程的 ID
 func osGetPID(L *LState) int {
-	L.Push(LNumber(os.Getpid()))
+	L.Push(LInteger(os.Getpid()))
 	return 1
 }
 
@@ -461,7 +463,7 @@ func osGetPID(L *LState) int {
 func osGetPPID(L *LState) int {
 	if MilkOS == "windows" {
 		if ppid := getWindowsPPID(); ppid != 0 {
-			L.Push(LNumber(ppid))
+			L.Push(LInteger(ppid))
 			return 1
 		} else {
 			L.Push(LNil)
@@ -469,7 +471,7 @@ func osGetPPID(L *LState) int {
 			return 2
 		}
 	}
-	L.Push(LNumber(syscall.Getppid()))
+	L.Push(LInteger(syscall.Getppid()))
 	return 1
 }
 
@@ -576,9 +578,9 @@ func osStat(L *LState) int {
 		return 2
 	}
 	tb := L.NewTable()
-	tb.RawSetString("size", LNumber(info.Size()))
-	tb.RawSetString("mode", LNumber(info.Mode()))
-	tb.RawSetString("modifytime", LNumber(info.ModTime().Unix()))
+	tb.RawSetString("size", LInteger(info.Size()))
+	tb.RawSetString("mode", LInteger(info.Mode()))
+	tb.RawSetString("modifytime", LInteger(info.ModTime().Unix()))
 	tb.RawSetString("isdir", LBool(info.IsDir()))
 	L.Push(tb)
 	return 1
@@ -621,8 +623,8 @@ func osExists(L *LState) int {
 //  1. 返回的信息包括 CPU 数量和 GOMAXPROCS 值
 func osMCpus(L *LState) int {
 	tbl := L.NewTable()
-	tbl.RawSetString("num", LNumber(runtime.NumCPU()))
-	tbl.RawSetString("gomaxprocs", LNumber(runtime.GOMAXPROCS(0)))
+	tbl.RawSetString("num", LInteger(runtime.NumCPU()))
+	tbl.RawSetString("gomaxprocs", LInteger(runtime.GOMAXPROCS(0)))
 	L.Push(tbl)
 	return 1
 }
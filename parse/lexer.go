@@ -53,6 +53,9 @@ func isOct(ch rune) bool {
 type Scanner struct {
 	Pos    ast.Position
 	reader *bufio.Reader
+
+	// the expression of the last TInterpString token
+	interpolation ast.Expr
 }
 
 func NewScanner(reader io.Reader, source string) *Scanner {
@@ -327,19 +330,118 @@ func (sc *Scanner) countSep(ch rune) (int, rune) {
 	return count, ch
 }
 
-func (sc *Scanner) scanMultilineString(ch rune, buf *bytes.Buffer) error {
+// scanMultilineString scans a backtick string. If the string embeds expressions with ${...},
+// it returns them with the literal pieces as an *ast.InterpolatedStringExpr; otherwise it
+// returns nil and buf holds the string. A literal ${ is written as \${.
+func (sc *Scanner) scanMultilineString(ch rune, buf *bytes.Buffer) (ast.Expr, error) {
 	if ch != '`' {
-		return sc.Error(string(rune(ch)), "invalid multiline string")
+		return nil, sc.Error(string(rune(ch)), "invalid multiline string")
+	}
+	line := sc.Pos.Line
+	var parts []ast.Expr
+	literal := func() {
+		if buf.Len() > 0 {
+			part := &ast.StringExpr{Value: buf.String()}
+			part.SetLine(line)
+			parts = append(parts, part)
+			buf.Reset()
+		}
 	}
 	for {
 		ch = sc.Next()
-		if ch == EOF {
-			return sc.Error(buf.String(), "unterminated multiline string")
-		} else if ch == '`' {
-			return nil
+		switch {
+		case ch == EOF:
+			return nil, sc.Error(buf.String(), "unterminated multiline string")
+		case ch == '`':
+			if parts == nil {
+				return nil, nil
+			}
+			literal()
+			expr := &ast.InterpolatedStringExpr{Parts: parts}
+			expr.SetLine(line)
+			return expr, nil
+		case ch == '\\' && sc.Peek() == '$':
+			sc.Next()
+			if sc.Peek() == '{' {
+				sc.Next()
+				buf.WriteString("${")
+			} else {
+				buf.WriteString(`\$`)
+			}
+		case ch == '$' && sc.Peek() == '{':
+			sc.Next()
+			literal()
+			expr, err := sc.scanInterpolation()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, expr)
+		default:
+			writeRune(buf, ch)
+		}
+	}
+}
+
+// scanInterpolation scans the expression of a ${...} up to the matching brace and parses it.
+func (sc *Scanner) scanInterpolation() (ast.Expr, error) {
+	pos := sc.Pos
+	var src bytes.Buffer
+	depth := 1
+	for {
+		ch := sc.Next()
+		switch ch {
+		case EOF:
+			return nil, sc.Error(src.String(), "unterminated string interpolation")
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return parseInterpolation(src.String(), pos, sc.Pos)
+			}
+		case '"', '\'', '`':
+			// quoted strings are copied as is, so braces inside them are not counted
+			quote := ch
+			writeRune(&src, ch)
+			for ch = sc.Next(); ch != quote; ch = sc.Next() {
+				if ch == '\\' && quote != '`' {
+					writeRune(&src, ch)
+					ch = sc.Next()
+				}
+				if ch == EOF {
+					return nil, sc.Error(src.String(), "unterminated string interpolation")
+				}
+				writeRune(&src, ch)
+			}
+		}
+		writeRune(&src, ch)
+	}
+}
+
+// parseInterpolation parses src, the expression of a ${...} whose opening brace is at pos
+// and whose closing brace is at end. The expression is parsed as a return statement, with
+// the scanner starting before pos so that errors carry the position in the enclosing source.
+func parseInterpolation(src string, pos, end ast.Position) (expr ast.Expr, err error) {
+	const prefix = "return "
+	scanner := NewScanner(strings.NewReader(prefix+src), pos.Source)
+	scanner.Pos.Line = pos.Line
+	scanner.Pos.Column = pos.Column - len(prefix)
+	lexer := &Lexer{scanner, nil, false, ast.Token{Str: ""}, TNil}
+	defer func() {
+		if e := recover(); e != nil {
+			err, _ = e.(error)
+			if perr, ok := e.(*Error); ok && perr.Pos.Line == EOF {
+				perr.Pos, perr.Token = end, "}"
+			}
+		}
+	}()
+	yyParse(lexer)
+	if len(lexer.Stmts) == 1 {
+		if ret, ok := lexer.Stmts[0].(*ast.ReturnStmt); ok && len(ret.Exprs) == 1 {
+			return ret.Exprs[0], nil
 		}
-		writeRune(buf, ch)
 	}
+	return nil, &Error{pos, "string interpolation must contain exactly one expression", src}
 }
 
 var reservedWords = map[string]int{
@@ -348,7 +450,8 @@ var reservedWords = map[string]int{
 	"in": TIn, "local": TLocal, "nil": TNil, "and": TAnd, "not": TNot, "or": TOr,
 	"return": TReturn, "repeat": TRepeat, "true": TTrue,
 	"until": TUntil, "while": TWhile, "goto": TGoto, "ifthru": TIfThru,
-	"break": TBreak,
+	"break": TBreak, "continue": TContinue, "defer": TDefer,
+	"switch": TSwitch, "case": TCase, "default": TDefault,
 
 	"bool": TTBool, "number": TTNumber, "string": TTString, "table": TTTable,
 	"function": TTFunction, "userdata": TTUserdata, "thread": TTThread, "channel": TTChannel,
@@ -401,7 +504,10 @@ redo:
 			tok.Str = buf.String()
 		case '`':
 			tok.Type = TString
-			err = sc.scanMultilineString(ch, buf)
+			sc.interpolation, err = sc.scanMultilineString(ch, buf)
+			if sc.interpolation != nil {
+				tok.Type = TInterpString
+			}
 			tok.Str = buf.String()
 		case '=':
 			if sc.Peek() == '=' {
@@ -417,8 +523,19 @@ redo:
 				tok.Type = TNeq
 				tok.Str = "~="
 				sc.Next()
+			} else if sc.Peek() == '/' {
+				sc.Next()
+				if sc.Peek() == '=' {
+					tok.Type = TIDivAssign
+					tok.Str = "~/="
+					sc.Next()
+				} else {
+					tok.Type = TIDiv
+					tok.Str = "~/"
+				}
 			} else {
-				err = sc.Error("~", "Invalid '~' token")
+				tok.Type = TBitXor
+				tok.Str = string(rune(ch))
 			}
 		case '<':
 			if sc.Peek() == '=' {
@@ -426,9 +543,15 @@ redo:
 				tok.Str = "<="
 				sc.Next()
 			} else if sc.Peek() == '<' {
-				tok.Type = TLeftShift
-				tok.Str = "<<"
 				sc.Next()
+				if sc.Peek() == '=' {
+					tok.Type = TLeftShiftAssign
+					tok.Str = "<<="
+					sc.Next()
+				} else {
+					tok.Type = TLeftShift
+					tok.Str = "<<"
+				}
 			} else {
 				tok.Type = TLt
 				tok.Str = string(rune(ch))
@@ -439,9 +562,15 @@ redo:
 				tok.Str = ">="
 				sc.Next()
 			} else if sc.Peek() == '>' {
-				tok.Type = TRightShift
-				tok.Str = ">>"
 				sc.Next()
+				if sc.Peek() == '=' {
+					tok.Type = TRightShiftAssign
+					tok.Str = ">>="
+					sc.Next()
+				} else {
+					tok.Type = TRightShift
+					tok.Str = ">>"
+				}
 			} else {
 				tok.Type = TGt
 				tok.Str = string(rune(ch))
@@ -539,6 +668,25 @@ redo:
 				tok.Type = TPow
 				tok.Str = string(rune(ch))
 			}
+		case '?':
+			switch sc.Peek() {
+			case '.':
+				tok.Type = TQuestionDot
+				tok.Str = "?."
+				sc.Next()
+			case '[':
+				tok.Type = TQuestionLBracket
+				tok.Str = "?["
+				sc.Next()
+			case '?':
+				tok.Type = T2Question
+				tok.Str = "??"
+				sc.Next()
+			default:
+				writeRune(buf, ch)
+				err = sc.Error(buf.String(), "Invalid token")
+				goto finally
+			}
 		case '#':
 			tok.Type = THash
 			tok.Str = string(rune(ch))
@@ -571,6 +719,10 @@ redo:
 				tok.Type = TAnd
 				tok.Str = "&&"
 				sc.Next()
+			} else if sc.Peek() == '=' {
+				tok.Type = TBitAndAssign
+				tok.Str = "&="
+				sc.Next()
 			} else {
 				tok.Type = TBitAnd
 				tok.Str = string(rune(ch))
@@ -580,6 +732,10 @@ redo:
 				tok.Type = TOr
 				tok.Str = "||"
 				sc.Next()
+			} else if sc.Peek() == '=' {
+				tok.Type = TBitOrAssign
+				tok.Str = "|="
+				sc.Next()
 			} else {
 				tok.Type = TBitOr
 				tok.Str = string(rune(ch))
@@ -616,6 +772,9 @@ func (lx *Lexer) Lex(lval *yySymType) int {
 		return 0
 	}
 	lval.token = tok
+	if tok.Type == TInterpString {
+		lval.expr = lx.scanner.interpolation
+	}
 	lx.Token = tok
 	return int(tok.Type)
 }
@@ -712,6 +871,18 @@ func Dump(chunk []ast.Stmt) string {
 // }}
 
 // auxiliary functions {{{
+// addTypedName appends a name and its type annotation to the list, typ is nil for a name without one.
+func addTypedName(list *ast.ParList, name string, typ ast.Expr) *ast.ParList {
+	if typ != nil && list.Types == nil {
+		list.Types = make([]ast.Expr, len(list.Names))
+	}
+	list.Names = append(list.Names, name)
+	if list.Types != nil {
+		list.Types = append(list.Types, typ)
+	}
+	return list
+}
+
 func makeBuiltinType(tok ast.Token) *ast.BuiltinType {
 	switch tok.Type {
 	case TTBool:
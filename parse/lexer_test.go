@@ -1,10 +1,13 @@
 package parse
 
 import (
+	"fmt"
 	"log"
 	"strings"
 	"testing"
 	"time"
+
+	"milklua/ast"
 )
 
 func TestScanner_ExtendedBasic(t *testing.T) {
@@ -258,3 +261,105 @@ func TestScanner_UnicodeIdentifiers(t *testing.T) {
 		}
 	}
 }
+
+func TestScanner_BitwiseOperators(t *testing.T) {
+	input := `a & b | c ~ ~d << 1 >> 2 ~= e ~/ f &= |= <<= >>= ~/=`
+	scanner := NewScanner(strings.NewReader(input), "test")
+	lexer := &Lexer{scanner: scanner}
+
+	expectedTokens := []struct {
+		typ int
+		str string
+	}{
+		{TIdent, "a"}, {TBitAnd, "&"}, {TIdent, "b"}, {TBitOr, "|"}, {TIdent, "c"},
+		{TBitXor, "~"}, {TBitXor, "~"}, {TIdent, "d"}, {TLeftShift, "<<"}, {TNumber, "1"},
+		{TRightShift, ">>"}, {TNumber, "2"}, {TNeq, "~="}, {TIdent, "e"}, {TIDiv, "~/"}, {TIdent, "f"},
+		{TBitAndAssign, "&="}, {TBitOrAssign, "|="}, {TLeftShiftAssign, "<<="}, {TRightShiftAssign, ">>="}, {TIDivAssign, "~/="},
+	}
+
+	for i, expected := range expectedTokens {
+		token, err := scanner.Scan(lexer)
+		if err != nil {
+			t.Fatalf("Unexpected error at token %d: %v", i, err)
+		}
+		if token.Type != expected.typ {
+			t.Errorf("Token %d: Expected token type %d, got %d", i, expected.typ, token.Type)
+		}
+		if token.Str != expected.str {
+			t.Errorf("Token %d: Expected token string '%s', got '%s'", i, expected.str, token.Str)
+		}
+	}
+}
+
+func TestScanner_SafeNavigation(t *testing.T) {
+	input := `a?.b?[c] ?? d`
+	scanner := NewScanner(strings.NewReader(input), "test")
+	lexer := &Lexer{scanner: scanner}
+
+	expectedTokens := []struct {
+		typ int
+		str string
+	}{
+		{TIdent, "a"}, {TQuestionDot, "?."}, {TIdent, "b"}, {TQuestionLBracket, "?["}, {TIdent, "c"}, {TRBracket, "]"},
+		{T2Question, "??"}, {TIdent, "d"},
+	}
+
+	for i, expected := range expectedTokens {
+		token, err := scanner.Scan(lexer)
+		if err != nil {
+			t.Fatalf("Unexpected error at token %d: %v", i, err)
+		}
+		if token.Type != expected.typ || token.Str != expected.str {
+			t.Errorf("Token %d: Expected %d '%s', got %d '%s'", i, expected.typ, expected.str, token.Type, token.Str)
+		}
+	}
+	if _, err := NewScanner(strings.NewReader("? b"), "test").Scan(lexer); err == nil {
+		t.Error("Expected an error for a single '?'")
+	}
+}
+
+func TestScanner_InterpolatedStrings(t *testing.T) {
+	input := "`plain $x` `a${b}c` `${ {x = \"}\"} }\\${d}`"
+	scanner := NewScanner(strings.NewReader(input), "test")
+	lexer := &Lexer{scanner: scanner}
+
+	token, err := scanner.Scan(lexer)
+	if err != nil || token.Type != TString || token.Str != "plain $x" {
+		t.Fatalf("Expected a plain string, got %v (%v)", token, err)
+	}
+	for _, parts := range [][]string{{"*ast.StringExpr", "*ast.IdentExpr", "*ast.StringExpr"}, {"*ast.TableExpr", "*ast.StringExpr"}} {
+		token, err = scanner.Scan(lexer)
+		if err != nil || token.Type != TInterpString {
+			t.Fatalf("Expected an interpolated string, got %v (%v)", token, err)
+		}
+		expr := scanner.interpolation.(*ast.InterpolatedStringExpr)
+		var types []string
+		for _, part := range expr.Parts {
+			types = append(types, fmt.Sprintf("%T", part))
+		}
+		if strings.Join(types, " ") != strings.Join(parts, " ") {
+			t.Errorf("Expected parts %v, got %v", parts, types)
+		}
+	}
+	if last := scanner.interpolation.(*ast.InterpolatedStringExpr).Parts[1]; last.(*ast.StringExpr).Value != "${d}" {
+		t.Errorf("Expected an escaped ${, got %q", last.(*ast.StringExpr).Value)
+	}
+}
+
+func TestParse_InterpolationErrors(t *testing.T) {
+	cases := []struct {
+		src     string
+		message string
+	}{
+		{"local s = `ab\n  ${x +* 2}`", "test line:2(column:8) near '*':   syntax error\n"},
+		{"local s = `${x + }`", "test line:1(column:18) near '}':   syntax error\n"},
+		{"local s = `${x, y}`", "test line:1(column:13) near 'x, y':   string interpolation must contain exactly one expression\n"},
+		{"local s = `${x", "test at EOF:   unterminated string interpolation\n"},
+	}
+	for _, c := range cases {
+		_, err := Parse(strings.NewReader(c.src), "test")
+		if err == nil || err.Error() != c.message {
+			t.Errorf("%q: expected error %q, got %q", c.src, c.message, err)
+		}
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"milklua/ast"
 )
 
-//line parse/parser.go.y:36
+//line parse/parser.go.y:39
 type yySymType struct {
 	yys   int
 	token ast.Token
@@ -20,6 +20,8 @@ type yySymType struct {
 	stmts []ast.Stmt
 	stmt  ast.Stmt
 
+	switchcases []*ast.SwitchCase
+
 	funcname *ast.FuncName
 	funcexpr *ast.FunctionExpr
 
@@ -36,74 +38,90 @@ type yySymType struct {
 
 const TAnd = 57346
 const TBreak = 57347
-const TElse = 57348
-const TElseIf = 57349
-const TFalse = 57350
-const TFor = 57351
-const TFunction = 57352
-const TIf = 57353
-const TIn = 57354
-const TLocal = 57355
-const TNil = 57356
-const TNot = 57357
-const TOr = 57358
-const TReturn = 57359
-const TRepeat = 57360
-const TTrue = 57361
-const TUntil = 57362
-const TWhile = 57363
-const TGoto = 57364
-const TIfThru = 57365
-const TEqeq = 57366
-const TNeq = 57367
-const TLte = 57368
-const TGte = 57369
-const T2Dot = 57370
-const T3Dot = 57371
-const TDot = 57372
-const T2Colon = 57373
-const TIdent = 57374
-const TNumber = 57375
-const TString = 57376
-const TLBrace = 57377
-const TRBrace = 57378
-const TLParen = 57379
-const TRParen = 57380
-const TLBracket = 57381
-const TRBracket = 57382
-const TComma = 57383
-const TSemi = 57384
-const TAssign = 57385
-const TAdd = 57386
-const TSub = 57387
-const TMul = 57388
-const TDiv = 57389
-const TMod = 57390
-const TPow = 57391
-const TColon = 57392
-const THash = 57393
-const TLeftShift = 57394
-const TRightShift = 57395
-const TBitAnd = 57396
-const TBitOr = 57397
-const TAddAssign = 57398
-const TSubAssign = 57399
-const TMulAssign = 57400
-const TDivAssign = 57401
-const TModAssign = 57402
-const TPowAssign = 57403
-const TDotLParen = 57404
-const TTBool = 57405
-const TTNumber = 57406
-const TTString = 57407
-const TTTable = 57408
-const TTFunction = 57409
-const TTUserdata = 57410
-const TTThread = 57411
-const TTChannel = 57412
-const TGt = 57413
-const TLt = 57414
-const UNARY = 57415
+const TContinue = 57348
+const TElse = 57349
+const TElseIf = 57350
+const TFalse = 57351
+const TFor = 57352
+const TFunction = 57353
+const TIf = 57354
+const TIn = 57355
+const TLocal = 57356
+const TNil = 57357
+const TNot = 57358
+const TOr = 57359
+const TReturn = 57360
+const TRepeat = 57361
+const TTrue = 57362
+const TUntil = 57363
+const TWhile = 57364
+const TGoto = 57365
+const TIfThru = 57366
+const TDefer = 57367
+const TSwitch = 57368
+const TCase = 57369
+const TDefault = 57370
+const TEqeq = 57371
+const TNeq = 57372
+const TLte = 57373
+const TGte = 57374
+const T2Dot = 57375
+const T3Dot = 57376
+const TDot = 57377
+const T2Colon = 57378
+const TIdent = 57379
+const TNumber = 57380
+const TString = 57381
+const TLBrace = 57382
+const TRBrace = 57383
+const TLParen = 57384
+const TRParen = 57385
+const TLBracket = 57386
+const TRBracket = 57387
+const TComma = 57388
+const TSemi = 57389
+const TAssign = 57390
+const TAdd = 57391
+const TSub = 57392
+const TMul = 57393
+const TDiv = 57394
+const TMod = 57395
+const TPow = 57396
+const TColon = 57397
+const THash = 57398
+const TLeftShift = 57399
+const TRightShift = 57400
+const TBitAnd = 57401
+const TBitOr = 57402
+const TBitXor = 57403
+const TIDiv = 57404
+const TAddAssign = 57405
+const TSubAssign = 57406
+const TMulAssign = 57407
+const TDivAssign = 57408
+const TModAssign = 57409
+const TPowAssign = 57410
+const TIDivAssign = 57411
+const TBitAndAssign = 57412
+const TBitOrAssign = 57413
+const TLeftShiftAssign = 57414
+const TRightShiftAssign = 57415
+const TDotLParen = 57416
+const TQuestionDot = 57417
+const TQuestionLBracket = 57418
+const T2Question = 57419
+const TInterpString = 57420
+const TTBool = 57421
+const TTNumber = 57422
+const TTString = 57423
+const TTTable = 57424
+const TTFunction = 57425
+const TTUserdata = 57426
+const TTThread = 57427
+const TTChannel = 57428
+const TGt = 57429
+const TLt = 57430
+const UNARY = 57431
 
 var yyToknames = [...]string{
 	"$end",
@@ -111,6 +129,7 @@ var yyToknames = [...]string{
 	"$unk",
 	"TAnd",
 	"TBreak",
+	"TContinue",
 	"TElse",
 	"TElseIf",
 	"TFalse",
@@ -129,6 +148,10 @@ var yyToknames = [...]string{
 	"TWhile",
 	"TGoto",
 	"TIfThru",
+	"TDefer",
+	"TSwitch",
+	"TCase",
+	"TDefault",
 	"TEqeq",
 	"TNeq",
 	"TLte",
@@ -161,13 +184,24 @@ var yyToknames = [...]string{
 	"TRightShift",
 	"TBitAnd",
 	"TBitOr",
+	"TBitXor",
+	"TIDiv",
 	"TAddAssign",
 	"TSubAssign",
 	"TMulAssign",
 	"TDivAssign",
 	"TModAssign",
 	"TPowAssign",
+	"TIDivAssign",
+	"TBitAndAssign",
+	"TBitOrAssign",
+	"TLeftShiftAssign",
+	"TRightShiftAssign",
 	"TDotLParen",
+	"TQuestionDot",
+	"TQuestionLBracket",
+	"T2Question",
+	"TInterpString",
 	"TTBool",
 	"TTNumber",
 	"TTString",
@@ -187,7 +221,7 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line parse/parser.go.y:630
+//line parse/parser.go.y:781
 
 func TokenName(c int) string {
 	if c >= TAnd && c-TAnd < len(yyToknames) {
@@ -203,243 +237,312 @@ var yyExca = [...]int16{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 8,
-	41, 44,
-	43, 44,
-	-2, 94,
-	-1, 33,
-	30, 96,
-	39, 96,
-	50, 96,
-	-2, 66,
-	-1, 113,
-	41, 45,
-	43, 45,
-	-2, 94,
-	-1, 197,
-	6, 35,
-	7, 35,
-	-2, 16,
+	-1, 9,
+	46, 61,
+	48, 61,
+	-2, 120,
+	-1, 36,
+	35, 122,
+	44, 122,
+	55, 122,
+	75, 122,
+	76, 122,
+	-2, 87,
+	-1, 86,
+	35, 123,
+	44, 123,
+	55, 123,
+	75, 123,
+	76, 123,
+	-2, 42,
+	-1, 137,
+	46, 62,
+	48, 62,
+	-2, 120,
+	-1, 233,
+	7, 44,
+	8, 44,
+	-2, 21,
 }
 
 const yyPrivate = 57344
 
-const yyLast = 928
-
-var yyAct = [...]uint8{
-	27, 102, 65, 26, 54, 57, 63, 44, 45, 46,
-	47, 48, 49, 59, 4, 61, 161, 162, 163, 164,
-	165, 166, 167, 168, 70, 74, 92, 93, 94, 95,
-	95, 130, 127, 51, 136, 50, 203, 173, 97, 98,
-	99, 125, 96, 96, 105, 106, 107, 108, 109, 110,
-	111, 129, 33, 115, 112, 22, 34, 169, 41, 10,
-	119, 8, 171, 172, 199, 177, 122, 128, 76, 126,
-	76, 191, 25, 76, 134, 188, 124, 140, 141, 142,
-	143, 144, 145, 146, 147, 148, 149, 150, 151, 152,
-	153, 154, 155, 156, 157, 158, 159, 133, 127, 186,
-	71, 139, 68, 67, 22, 174, 132, 67, 114, 56,
-	113, 78, 241, 238, 22, 235, 234, 232, 10, 40,
-	8, 227, 176, 77, 224, 216, 181, 178, 215, 180,
-	182, 87, 88, 86, 85, 89, 209, 197, 189, 195,
-	190, 20, 213, 137, 179, 239, 24, 120, 214, 233,
-	226, 90, 91, 92, 93, 94, 95, 217, 200, 81,
-	82, 80, 79, 187, 89, 60, 185, 202, 196, 96,
-	183, 105, 192, 69, 193, 184, 183, 135, 83, 84,
-	90, 91, 92, 93, 94, 95, 117, 53, 81, 82,
-	80, 79, 116, 201, 56, 71, 52, 204, 96, 206,
-	73, 72, 62, 23, 210, 207, 208, 55, 237, 229,
-	221, 211, 212, 218, 170, 220, 58, 1, 101, 219,
-	36, 131, 21, 222, 35, 160, 9, 66, 75, 228,
-	64, 230, 231, 3, 205, 78, 2, 0, 0, 236,
-	15, 16, 14, 0, 17, 240, 0, 77, 0, 13,
-	0, 0, 12, 19, 0, 87, 88, 86, 85, 89,
-	0, 0, 18, 20, 0, 0, 123, 0, 24, 0,
-	0, 0, 0, 0, 0, 90, 91, 92, 93, 94,
-	95, 0, 0, 81, 82, 80, 79, 78, 0, 0,
-	0, 0, 0, 96, 0, 0, 0, 0, 0, 77,
-	0, 0, 83, 84, 0, 0, 0, 87, 88, 86,
-	85, 89, 0, 0, 0, 0, 0, 0, 225, 0,
-	0, 0, 0, 0, 0, 0, 0, 90, 91, 92,
-	93, 94, 95, 0, 0, 81, 82, 80, 79, 78,
-	0, 0, 0, 0, 0, 96, 0, 0, 0, 0,
-	0, 77, 0, 0, 83, 84, 0, 0, 0, 87,
-	88, 86, 85, 89, 0, 0, 0, 0, 0, 0,
-	223, 0, 0, 0, 0, 0, 0, 0, 0, 90,
-	91, 92, 93, 94, 95, 0, 0, 81, 82, 80,
-	79, 78, 0, 0, 0, 0, 0, 96, 0, 0,
-	0, 0, 0, 77, 89, 0, 83, 84, 0, 0,
-	0, 87, 88, 86, 85, 89, 0, 0, 0, 0,
-	90, 91, 92, 93, 94, 95, 0, 0, 198, 0,
-	0, 90, 91, 92, 93, 94, 95, 0, 96, 81,
-	82, 80, 79, 78, 0, 0, 0, 0, 0, 96,
-	0, 0, 0, 0, 0, 77, 89, 0, 83, 84,
-	0, 0, 0, 87, 88, 86, 85, 89, 0, 0,
-	0, 0, 90, 91, 92, 93, 94, 95, 0, 194,
-	81, 82, 80, 90, 91, 92, 93, 94, 95, 0,
-	96, 81, 82, 80, 79, 78, 0, 0, 0, 0,
-	0, 96, 0, 0, 0, 0, 0, 77, 89, 0,
-	83, 84, 0, 0, 0, 87, 88, 86, 85, 89,
-	0, 0, 0, 0, 90, 91, 92, 93, 94, 95,
-	0, 175, 81, 82, 0, 90, 91, 92, 93, 94,
-	95, 0, 96, 81, 82, 80, 79, 78, 0, 0,
-	0, 0, 0, 96, 0, 0, 0, 0, 0, 77,
-	0, 0, 83, 84, 0, 0, 0, 87, 88, 86,
-	85, 89, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 138, 0, 0, 0, 0, 0, 90, 91, 92,
-	93, 94, 95, 0, 0, 81, 82, 80, 79, 78,
-	0, 0, 0, 0, 0, 96, 0, 0, 0, 0,
-	0, 77, 0, 0, 83, 84, 0, 0, 0, 87,
-	88, 86, 85, 89, 0, 0, 0, 0, 0, 0,
-	121, 0, 0, 0, 0, 0, 0, 0, 0, 90,
-	91, 92, 93, 94, 95, 0, 0, 81, 82, 80,
-	79, 78, 0, 0, 0, 0, 0, 96, 0, 0,
-	0, 0, 0, 77, 0, 0, 83, 84, 0, 0,
-	0, 87, 88, 86, 85, 89, 0, 0, 0, 0,
-	0, 0, 0, 78, 0, 0, 0, 0, 0, 0,
-	0, 90, 91, 92, 93, 94, 95, 0, 0, 81,
-	82, 80, 79, 87, 88, 86, 85, 89, 0, 96,
-	0, 0, 0, 0, 0, 0, 0, 0, 83, 84,
-	0, 0, 0, 90, 91, 92, 93, 94, 95, 0,
-	0, 81, 82, 80, 79, 87, 88, 86, 85, 89,
-	0, 96, 0, 0, 0, 0, 0, 0, 0, 0,
-	83, 84, 0, 0, 0, 90, 91, 92, 93, 94,
-	95, 0, 0, 81, 82, 80, 79, 0, 29, 0,
-	40, 0, 0, 96, 28, 38, 0, 0, 0, 30,
-	0, 0, 83, 84, 0, 0, 0, 0, 0, 32,
-	0, 0, 103, 31, 42, 43, 100, 24, 0, 104,
-	0, 29, 0, 40, 0, 37, 0, 28, 38, 0,
-	0, 39, 30, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 32, 0, 0, 103, 31, 42, 43, 29,
-	24, 40, 104, 0, 0, 28, 38, 0, 37, 0,
-	30, 0, 0, 0, 39, 0, 0, 0, 0, 0,
-	32, 0, 0, 20, 31, 42, 43, 0, 24, 118,
-	0, 0, 29, 0, 40, 0, 37, 0, 28, 38,
-	0, 0, 39, 30, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 32, 0, 0, 20, 31, 42, 43,
-	7, 24, 0, 0, 15, 16, 14, 0, 17, 37,
-	0, 0, 6, 13, 0, 39, 12, 19, 0, 0,
-	0, 0, 0, 0, 0, 0, 18, 20, 0, 0,
-	11, 0, 24, 0, 0, 0, 0, 5,
+const yyLast = 1258
+
+var yyAct = [...]int16{
+	30, 121, 66, 77, 29, 113, 69, 191, 241, 236,
+	163, 219, 245, 204, 71, 200, 73, 28, 155, 209,
+	202, 203, 91, 88, 237, 114, 220, 150, 89, 192,
+	193, 194, 195, 196, 197, 198, 199, 82, 154, 151,
+	271, 115, 116, 117, 118, 162, 272, 161, 4, 124,
+	125, 126, 127, 128, 129, 130, 131, 132, 133, 134,
+	135, 91, 221, 138, 45, 136, 141, 9, 61, 235,
+	60, 227, 152, 144, 218, 91, 167, 79, 68, 147,
+	153, 49, 50, 51, 52, 53, 54, 55, 56, 57,
+	58, 59, 168, 169, 170, 171, 172, 173, 174, 175,
+	176, 177, 178, 179, 180, 181, 182, 183, 184, 185,
+	186, 187, 188, 189, 190, 311, 308, 159, 109, 110,
+	111, 113, 149, 305, 205, 304, 137, 80, 63, 112,
+	243, 244, 79, 302, 94, 68, 36, 62, 9, 25,
+	158, 114, 297, 83, 242, 208, 44, 93, 67, 157,
+	296, 213, 295, 210, 294, 212, 214, 291, 25, 104,
+	105, 103, 102, 106, 222, 287, 223, 286, 64, 65,
+	265, 225, 23, 282, 268, 267, 266, 27, 253, 107,
+	108, 109, 110, 111, 113, 233, 231, 98, 99, 97,
+	95, 96, 112, 211, 145, 106, 309, 303, 25, 293,
+	276, 275, 124, 228, 114, 229, 269, 92, 261, 259,
+	25, 107, 108, 109, 110, 111, 113, 100, 101, 98,
+	99, 97, 95, 96, 112, 254, 238, 72, 239, 240,
+	81, 37, 224, 247, 11, 249, 114, 224, 217, 216,
+	215, 160, 250, 251, 257, 252, 260, 142, 140, 255,
+	139, 258, 85, 87, 84, 74, 83, 164, 307, 26,
+	299, 270, 280, 246, 232, 277, 273, 279, 274, 263,
+	264, 201, 278, 284, 70, 1, 281, 120, 283, 39,
+	285, 86, 288, 289, 156, 24, 38, 90, 75, 10,
+	78, 76, 3, 87, 256, 226, 94, 298, 248, 300,
+	301, 2, 16, 17, 15, 11, 18, 0, 0, 93,
+	306, 14, 0, 0, 13, 20, 310, 21, 22, 0,
+	0, 104, 105, 103, 102, 106, 0, 0, 19, 23,
+	0, 0, 148, 0, 27, 0, 0, 0, 0, 0,
+	0, 107, 108, 109, 110, 111, 113, 94, 0, 98,
+	99, 97, 95, 96, 112, 0, 0, 0, 0, 0,
+	93, 0, 0, 0, 0, 0, 114, 0, 0, 92,
+	0, 0, 104, 105, 103, 102, 106, 0, 0, 100,
+	101, 0, 0, 292, 0, 0, 0, 0, 0, 0,
+	0, 0, 107, 108, 109, 110, 111, 113, 94, 0,
+	98, 99, 97, 95, 96, 112, 0, 0, 0, 0,
+	0, 93, 0, 0, 0, 0, 0, 114, 0, 0,
+	92, 0, 0, 104, 105, 103, 102, 106, 0, 0,
+	100, 101, 0, 0, 290, 0, 0, 0, 0, 0,
+	0, 0, 0, 107, 108, 109, 110, 111, 113, 94,
+	0, 98, 99, 97, 95, 96, 112, 0, 0, 0,
+	0, 0, 93, 0, 0, 0, 0, 0, 114, 262,
+	0, 92, 0, 0, 104, 105, 103, 102, 106, 0,
+	0, 100, 101, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 107, 108, 109, 110, 111, 113,
+	94, 0, 98, 99, 97, 95, 96, 112, 0, 0,
+	0, 0, 0, 93, 0, 0, 0, 0, 0, 114,
+	0, 0, 92, 0, 0, 104, 105, 103, 102, 106,
+	0, 0, 100, 101, 0, 0, 0, 0, 0, 0,
+	0, 0, 234, 0, 0, 107, 108, 109, 110, 111,
+	113, 94, 0, 98, 99, 97, 95, 96, 112, 0,
+	0, 0, 0, 0, 93, 0, 0, 0, 0, 0,
+	114, 0, 0, 92, 0, 0, 104, 105, 103, 102,
+	106, 0, 0, 100, 101, 0, 0, 0, 0, 0,
+	0, 0, 230, 0, 0, 0, 107, 108, 109, 110,
+	111, 113, 94, 0, 98, 99, 97, 95, 96, 112,
+	0, 0, 0, 0, 0, 93, 0, 0, 0, 0,
+	0, 114, 0, 0, 92, 0, 0, 104, 105, 103,
+	102, 106, 0, 0, 100, 101, 0, 0, 0, 0,
+	0, 0, 0, 207, 0, 0, 0, 107, 108, 109,
+	110, 111, 113, 94, 0, 98, 99, 97, 95, 96,
+	112, 0, 0, 0, 0, 0, 93, 0, 0, 0,
+	0, 0, 114, 0, 0, 92, 0, 0, 104, 105,
+	103, 102, 106, 0, 0, 100, 101, 0, 0, 0,
+	0, 0, 0, 0, 206, 0, 0, 0, 107, 108,
+	109, 110, 111, 113, 94, 0, 98, 99, 97, 95,
+	96, 112, 0, 0, 0, 0, 0, 93, 0, 0,
+	0, 0, 0, 114, 0, 0, 92, 0, 0, 104,
+	105, 103, 102, 106, 0, 0, 100, 101, 0, 0,
+	0, 0, 0, 166, 0, 0, 0, 0, 0, 107,
+	108, 109, 110, 111, 113, 94, 0, 98, 99, 97,
+	95, 96, 112, 0, 0, 0, 0, 0, 93, 0,
+	0, 0, 0, 0, 114, 0, 0, 92, 0, 0,
+	104, 105, 103, 102, 106, 0, 0, 100, 101, 0,
+	0, 165, 0, 0, 0, 0, 0, 0, 0, 0,
+	107, 108, 109, 110, 111, 113, 94, 0, 98, 99,
+	97, 95, 96, 112, 0, 0, 0, 0, 0, 93,
+	0, 0, 0, 0, 0, 114, 0, 0, 92, 0,
+	0, 104, 105, 103, 102, 106, 0, 0, 100, 101,
+	0, 0, 146, 0, 0, 0, 0, 0, 0, 0,
+	0, 107, 108, 109, 110, 111, 113, 94, 0, 98,
+	99, 97, 95, 96, 112, 0, 0, 0, 0, 0,
+	93, 0, 0, 0, 0, 0, 114, 0, 0, 92,
+	106, 0, 104, 105, 103, 102, 106, 0, 0, 100,
+	101, 0, 0, 0, 0, 0, 107, 108, 109, 110,
+	111, 113, 107, 108, 109, 110, 111, 113, 0, 112,
+	98, 99, 97, 95, 96, 112, 0, 32, 0, 44,
+	0, 114, 0, 31, 41, 0, 94, 114, 33, 0,
+	92, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	100, 101, 35, 0, 0, 23, 34, 46, 48, 0,
+	27, 104, 105, 103, 102, 106, 0, 0, 40, 0,
+	0, 0, 0, 0, 42, 0, 0, 0, 0, 43,
+	0, 107, 108, 109, 110, 111, 113, 0, 0, 98,
+	99, 97, 95, 96, 112, 0, 47, 192, 193, 194,
+	195, 196, 197, 198, 199, 0, 114, 104, 105, 103,
+	102, 106, 0, 0, 0, 0, 0, 0, 0, 100,
+	101, 0, 0, 0, 0, 0, 0, 107, 108, 109,
+	110, 111, 113, 0, 0, 98, 99, 97, 95, 96,
+	112, 0, 32, 0, 44, 0, 0, 0, 31, 41,
+	0, 0, 114, 33, 0, 0, 0, 32, 0, 44,
+	0, 0, 0, 31, 41, 100, 101, 35, 33, 0,
+	122, 34, 46, 48, 119, 27, 0, 123, 0, 0,
+	0, 0, 35, 40, 0, 122, 34, 46, 48, 42,
+	27, 0, 123, 0, 43, 0, 0, 0, 40, 32,
+	0, 44, 0, 0, 42, 31, 41, 0, 0, 43,
+	33, 47, 0, 0, 32, 0, 44, 0, 0, 0,
+	31, 41, 0, 0, 35, 33, 47, 23, 34, 46,
+	48, 0, 27, 143, 0, 0, 0, 0, 0, 35,
+	40, 0, 23, 34, 46, 48, 42, 27, 0, 0,
+	0, 43, 0, 106, 0, 40, 0, 0, 0, 0,
+	0, 42, 0, 0, 0, 0, 43, 0, 47, 107,
+	108, 109, 110, 111, 113, 0, 0, 98, 99, 97,
+	106, 96, 112, 47, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 114, 106, 107, 108, 109, 110,
+	111, 113, 0, 0, 98, 99, 97, 0, 0, 112,
+	0, 107, 108, 109, 110, 111, 113, 0, 0, 98,
+	99, 114, 0, 0, 112, 7, 8, 0, 0, 0,
+	16, 17, 15, 0, 18, 0, 114, 0, 6, 14,
+	0, 0, 13, 20, 0, 21, 22, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 19, 23, 0, 0,
+	12, 0, 27, 0, 0, 0, 0, 5,
 }
 
 var yyPact = [...]int16{
-	-1000, -1000, 885, 30, -1000, -1000, 854, -1000, -49, -8,
-	157, -1000, 854, 130, 854, 170, 70, 163, 169, 168,
-	-1000, -1000, -1000, -1000, 854, -1000, 32, 647, -1000, -1000,
-	-1000, -1000, -1000, -1000, 157, -1000, -1000, 854, 854, 854,
-	66, -1000, -1000, 760, 854, 854, 854, 854, 854, 854,
-	854, 109, 854, 160, -1000, 154, 821, 111, -1000, 595,
-	-1000, 231, -2, 57, 66, -1000, 1, 68, -1000, 145,
-	-9, -1000, 112, -1000, 543, 63, 854, 854, 854, 854,
-	854, 854, 854, 854, 854, 854, 854, 854, 854, 854,
-	854, 854, 854, 854, 854, 854, -47, -19, -19, -19,
-	-1000, 21, -1000, -6, 854, 647, 647, 647, 647, 647,
-	647, 647, 32, -1000, 157, 491, -1000, 72, -1000, 27,
-	-1000, -1000, 108, -1000, -1000, 854, 854, 144, -1000, 143,
-	134, 61, 128, -1000, 34, 66, 854, -1000, -1000, -1000,
-	647, 679, 711, 428, 480, 376, 376, 136, 136, 136,
-	136, 136, 136, 376, -20, -20, -19, -19, -19, -19,
-	33, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	793, -1000, -1000, 854, 439, -1000, -1000, -1000, 103, 148,
-	101, 387, 29, -1000, -1000, -1000, 123, -1000, 138, -1000,
-	32, -1000, -1000, 647, -7, -1000, 854, -1000, 854, -1000,
-	-1000, 100, -1000, 854, 647, 205, 107, 92, 89, -1000,
-	647, 122, 854, -1000, 854, 187, -1000, -1000, 335, 88,
-	283, 115, 85, -1000, 186, -1000, -1000, -1000, 81, 114,
-	80, 79, -1000, -1000, 185, -1000, 77, 110, -1000, -1000,
-	76, -1000,
+	-1000, -1000, 1210, -30, -1000, -1000, 1095, -1000, -1000, 18,
+	22, 93, -1000, 1095, 187, 1095, 218, 90, 219, 217,
+	215, 135, 1095, -1000, -1000, -1000, -1000, 1095, -1000, 15,
+	853, -1000, -1000, -1000, -1000, -1000, -1000, 93, -1000, -1000,
+	1095, 1095, 1095, 1095, 35, -1000, -1000, -1000, 1023, 1095,
+	1095, 1095, 1095, 1095, 1095, 1095, 1095, 1095, 1095, 1095,
+	1095, 135, 1095, 213, 211, 1095, -1000, 210, 1080, 153,
+	-1000, 802, -1000, 292, -21, 26, 35, -1000, -17, 106,
+	-1000, 204, -1, -45, 221, -1000, -1000, 93, 751, 700,
+	33, 1095, 1095, 1095, 1095, 1095, 1095, 1095, 1095, 1095,
+	1095, 1095, 1095, 1095, 1095, 1095, 1095, 1095, 1095, 1095,
+	1095, 1095, 1095, 1095, -50, -49, -49, -49, -49, -1000,
+	-26, -1000, -35, 1095, 853, 853, 853, 853, 853, 853,
+	853, 853, 853, 853, 853, 853, 15, -1000, 649, -1000,
+	-1000, 598, 36, -1000, -24, -1000, -1000, 152, -1000, -1000,
+	1095, 1095, 203, -1000, 202, 201, 31, -29, -1000, 16,
+	35, 1095, 200, -50, -1000, -1000, -1000, -1000, 853, 853,
+	922, 968, 1110, 1137, 1152, 847, 847, 162, 162, 162,
+	162, 162, 162, 847, 67, 67, -49, -49, -49, -49,
+	-49, 28, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, 1038, -1000, -1000, 1095, 547, -1000, -1000, -1000, -1000,
+	145, 243, 144, 496, 29, -1000, -1000, -1000, -31, -1000,
+	-50, 195, -1000, 15, -47, -1000, 103, -1000, -1000, 853,
+	-36, 239, 1095, -1000, 1095, -1000, -1000, -50, 137, 185,
+	-1000, -50, -1000, 908, 169, 1095, 168, 445, 262, 130,
+	134, 133, 166, -1000, -1000, -1000, 0, 853, -1000, -1000,
+	853, -1000, 161, 160, 1095, -1000, 1095, 238, -1000, -1000,
+	132, -1000, 908, 126, 124, -1000, -1000, 394, 116, 343,
+	159, 113, -1000, 111, 853, -1000, -1000, -1000, 109, 101,
+	-1000, 236, -1000, -1000, -1000, -1000, -1000, -1000, 92, 157,
+	84, 82, -1000, -1000, 234, -1000, 75, 156, -1000, -1000,
+	74, -1000,
 }
 
-var yyPgo = [...]uint8{
-	0, 216, 236, 5, 14, 234, 233, 230, 227, 226,
-	58, 6, 3, 0, 225, 224, 56, 203, 222, 4,
-	52, 2, 221, 220, 218, 1, 214,
+var yyPgo = [...]int16{
+	0, 274, 301, 6, 48, 298, 295, 294, 292, 291,
+	290, 289, 64, 288, 4, 0, 7, 286, 231, 259,
+	285, 2, 136, 3, 284, 37, 279, 277, 1, 271,
 }
 
 var yyR1 = [...]int8{
 	0, 1, 1, 1, 2, 2, 2, 3, 4, 4,
 	4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
 	4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
-	4, 4, 4, 4, 4, 5, 5, 6, 6, 6,
-	7, 7, 8, 8, 9, 9, 10, 10, 10, 11,
-	11, 12, 12, 14, 14, 14, 14, 14, 14, 14,
-	14, 13, 13, 13, 13, 13, 13, 13, 13, 13,
-	13, 13, 13, 13, 13, 13, 13, 13, 13, 13,
-	13, 13, 13, 13, 13, 13, 13, 13, 13, 13,
-	13, 13, 13, 15, 16, 16, 16, 16, 16, 18,
-	17, 17, 19, 19, 20, 21, 21, 22, 22, 22,
-	23, 23, 24, 24, 24, 25, 25, 25, 26, 26,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 5, 5, 6, 6, 6, 7,
+	7, 7, 7, 8, 8, 8, 8, 9, 9, 10,
+	10, 11, 11, 12, 12, 12, 13, 13, 25, 25,
+	25, 25, 14, 14, 16, 16, 16, 16, 16, 16,
+	16, 16, 15, 15, 15, 15, 15, 15, 15, 15,
+	15, 15, 15, 15, 15, 15, 15, 15, 15, 15,
+	15, 15, 15, 15, 15, 15, 15, 15, 15, 15,
+	15, 15, 15, 15, 15, 15, 15, 15, 17, 17,
+	18, 18, 18, 18, 18, 18, 18, 20, 19, 19,
+	21, 21, 22, 23, 23, 23, 23, 24, 24, 24,
+	26, 26, 27, 27, 27, 28, 28, 28, 29, 29,
 }
 
 var yyR2 = [...]int8{
 	0, 1, 2, 3, 0, 2, 2, 1, 3, 3,
-	3, 3, 3, 3, 3, 1, 3, 5, 6, 5,
-	3, 6, 10, 13, 9, 15, 11, 11, 7, 3,
-	4, 4, 2, 3, 2, 0, 6, 1, 2, 1,
-	1, 3, 1, 3, 1, 3, 1, 4, 3, 1,
-	3, 1, 3, 1, 1, 1, 1, 1, 1, 1,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	1, 3, 9, 5, 10, 6, 5, 3, 6, 10,
+	13, 9, 15, 11, 11, 7, 3, 4, 4, 2,
+	3, 2, 2, 5, 0, 6, 0, 6, 5, 1,
+	1, 3, 3, 1, 2, 1, 1, 1, 3, 1,
+	3, 1, 3, 1, 4, 3, 1, 3, 1, 3,
+	3, 5, 1, 3, 1, 1, 1, 1, 1, 1,
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 3, 2,
-	2, 2, 4, 1, 1, 1, 1, 1, 3, 3,
-	2, 4, 2, 3, 2, 6, 5, 1, 1, 3,
+	3, 3, 3, 2, 2, 2, 2, 4, 1, 1,
+	1, 1, 1, 1, 3, 4, 3, 3, 2, 4,
+	2, 3, 2, 6, 5, 8, 7, 1, 1, 3,
 	2, 3, 1, 3, 2, 3, 5, 1, 1, 1,
 }
 
 var yyChk = [...]int16{
-	-1000, -1, -2, -6, -4, 42, 17, 5, -10, -9,
-	-16, 35, 21, 18, 11, 9, 10, 13, 31, 22,
-	32, -18, -20, -17, 37, 42, -12, -13, 14, 8,
-	19, 33, 29, -20, -16, -15, -23, 45, 15, 51,
-	10, -10, 34, 35, 56, 57, 58, 59, 60, 61,
-	43, 41, 39, 30, -19, 50, 37, -3, -1, -13,
-	35, -13, 32, -11, -7, -21, -8, 37, 32, 10,
-	-11, 32, 32, 32, -13, -17, 41, 16, 4, 55,
-	54, 52, 53, 71, 72, 27, 26, 24, 25, 28,
-	44, 45, 46, 47, 48, 49, 62, -13, -13, -13,
-	36, -24, -25, 32, 39, -13, -13, -13, -13, -13,
-	-13, -13, -12, -10, -16, -13, 32, 32, 38, -12,
-	36, 35, -3, 35, -4, 43, 12, 41, -21, 50,
-	30, -22, 38, 29, -11, 32, 43, 31, 38, 38,
-	-13, -13, -13, -13, -13, -13, -13, -13, -13, -13,
-	-13, -13, -13, -13, -13, -13, -13, -13, -13, -13,
-	-14, 63, 64, 65, 66, 67, 68, 69, 70, 36,
-	-26, 41, 42, 43, -13, 40, -19, 38, -3, 36,
-	-3, -13, -12, 32, 32, 32, 38, 35, 41, -21,
-	-12, 38, -25, -13, 40, 36, 20, 36, 41, 35,
-	35, -3, 29, 43, -13, -5, -13, -3, -3, 36,
-	-13, 6, 7, 35, 41, 36, 36, 35, -13, -3,
-	-13, 23, -3, 35, 36, 35, 35, 36, -3, 23,
-	-3, -3, 36, 35, 36, 36, -3, 23, 36, 35,
-	-3, 36,
+	-1000, -1, -2, -8, -4, 47, 18, 5, 6, -12,
+	-11, -18, 40, 22, 19, 12, 10, 11, 14, 36,
+	23, 25, 26, 37, -20, -22, -19, 42, 47, -14,
+	-15, 15, 9, 20, 38, 34, -22, -18, -17, -26,
+	50, 16, 56, 61, 11, -12, 39, 78, 40, 63,
+	64, 65, 66, 67, 68, 69, 70, 71, 72, 73,
+	48, 46, 44, 35, 75, 76, -21, 55, 42, -3,
+	-1, -15, 40, -15, 37, -13, -9, -23, -10, 42,
+	37, 11, -25, 37, 37, 37, -19, -18, -15, -15,
+	-19, 46, 77, 17, 4, 60, 61, 59, 57, 58,
+	87, 88, 32, 31, 29, 30, 33, 49, 50, 51,
+	52, 53, 62, 54, 74, -15, -15, -15, -15, 41,
+	-27, -28, 37, 44, -15, -15, -15, -15, -15, -15,
+	-15, -15, -15, -15, -15, -15, -14, -12, -15, 37,
+	37, -15, 37, 43, -14, 41, 40, -3, 40, -4,
+	48, 13, 46, -23, 55, 35, -24, 43, 34, -25,
+	37, 48, 46, 55, 36, 40, 43, 43, -15, -15,
+	-15, -15, -15, -15, -15, -15, -15, -15, -15, -15,
+	-15, -15, -15, -15, -15, -15, -15, -15, -15, -15,
+	-15, -16, 79, 80, 81, 82, 83, 84, 85, 86,
+	41, -29, 46, 47, 48, -15, 45, 45, -21, 43,
+	-3, 41, -3, -15, -14, 37, 37, 37, 43, 40,
+	55, 46, -23, -14, 37, -16, -6, 43, -28, -15,
+	45, 41, 21, 41, 46, 40, 40, 55, -3, -16,
+	34, 55, 41, 27, 28, 48, 24, -15, -5, -15,
+	-3, -3, -16, 41, 40, -16, -7, -15, -16, 40,
+	-15, 40, 24, 7, 8, 40, 46, 41, 41, 40,
+	-3, 40, 46, -3, -3, 40, 40, -15, -3, -15,
+	24, -3, 41, -3, -15, -16, 41, 41, -3, -3,
+	40, 41, 40, 40, 41, 41, 41, 41, -3, 24,
+	-3, -3, 41, 40, 41, 41, -3, 24, 41, 40,
+	-3, 41,
 }
 
-var yyDef = [...]int8{
-	4, -2, 1, 2, 5, 6, 37, 39, -2, 0,
-	15, 4, 0, 0, 0, 0, 0, 0, 0, 0,
-	46, 95, 96, 97, 0, 3, 38, 51, 61, 62,
-	63, 64, 65, -2, 67, 68, 69, 0, 0, 0,
-	0, 94, 93, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 100, 0, 0, 0, 7, 0,
-	4, 0, 49, 0, 0, 104, 40, 0, 42, 0,
-	32, 49, 0, 34, 0, 97, 0, 0, 0, 0,
+var yyDef = [...]int16{
+	4, -2, 1, 2, 5, 6, 53, 55, 56, -2,
+	0, 20, 4, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 63, 121, 122, 123, 0, 3, 54,
+	72, 82, 83, 84, 85, 86, -2, 88, 89, 90,
+	0, 0, 0, 0, 0, 120, 118, 119, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 128, 0, 0, 0,
+	7, 0, 4, 0, 66, 0, 0, 132, 57, 0,
+	59, 0, 39, 68, 0, 41, -2, 0, 0, 0,
+	123, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 89, 90, 91,
-	110, 0, 112, 46, 0, 117, 8, 9, 10, 11,
-	12, 13, 14, -2, 0, 0, 48, 0, 102, 0,
-	16, 4, 0, 4, 20, 0, 0, 0, 29, 0,
-	0, 0, 0, 107, 108, 0, 0, 33, 98, 99,
-	52, 70, 71, 72, 73, 74, 75, 76, 77, 78,
-	79, 80, 81, 82, 83, 84, 85, 86, 87, 88,
-	0, 53, 54, 55, 56, 57, 58, 59, 60, 111,
-	114, 118, 119, 0, 0, 47, 101, 103, 0, 0,
-	0, 0, 0, 50, 41, 43, 0, 4, 0, 30,
-	31, 92, 113, 115, 0, 17, 0, -2, 0, 4,
-	4, 0, 109, 0, 18, 21, 0, 0, 0, 106,
-	116, 0, 0, 4, 0, 28, 105, 4, 0, 0,
-	0, 0, 0, 4, 24, 4, 4, 22, 0, 0,
-	0, 0, 36, 4, 26, 27, 0, 0, 23, 4,
-	0, 25,
+	0, 0, 0, 0, 0, 113, 114, 115, 116, 140,
+	0, 142, 63, 0, 147, 8, 9, 10, 11, 12,
+	13, 14, 15, 16, 17, 18, 19, -2, 0, 65,
+	124, 0, 0, 130, 0, 21, 4, 0, 4, 27,
+	0, 0, 0, 36, 0, 0, 0, 0, 137, 138,
+	0, 0, 0, 0, 40, 46, 126, 127, 73, 91,
+	92, 93, 94, 95, 96, 97, 98, 99, 100, 101,
+	102, 103, 104, 105, 106, 107, 108, 109, 110, 111,
+	112, 0, 74, 75, 76, 77, 78, 79, 80, 81,
+	141, 144, 148, 149, 0, 0, 64, 125, 129, 131,
+	0, 0, 0, 0, 0, 67, 58, 60, 0, 4,
+	0, 0, 37, 38, 70, 69, 0, 117, 143, 145,
+	0, 23, 0, -2, 0, 4, 4, 0, 0, 0,
+	139, 0, 43, 0, 0, 0, 0, 25, 28, 0,
+	0, 0, 0, 134, 4, 71, 0, 49, 50, 4,
+	146, 4, 0, 0, 0, 4, 0, 35, 133, 4,
+	0, 4, 0, 0, 0, 4, 4, 0, 0, 0,
+	0, 0, 136, 0, 51, 52, 48, 22, 0, 0,
+	4, 31, 4, 4, 135, 47, 24, 29, 0, 0,
+	0, 0, 45, 4, 33, 34, 0, 0, 30, 4,
+	0, 32,
 }
 
 var yyTok1 = [...]int8{
@@ -454,7 +557,8 @@ var yyTok2 = [...]int8{
 	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
 	52, 53, 54, 55, 56, 57, 58, 59, 60, 61,
 	62, 63, 64, 65, 66, 67, 68, 69, 70, 71,
-	72, 73,
+	72, 73, 74, 75, 76, 77, 78, 79, 80, 81,
+	82, 83, 84, 85, 86, 87, 88, 89,
 }
 
 var yyTok3 = [...]int8{
@@ -800,7 +904,7 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:82
+//line parse/parser.go.y:92
 		{
 			yyVAL.stmts = yyDollar[1].stmts
 			if l, ok := yylex.(*Lexer); ok {
@@ -809,7 +913,7 @@ yydefault:
 		}
 	case 2:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:88
+//line parse/parser.go.y:98
 		{
 			yyVAL.stmts = append(yyDollar[1].stmts, yyDollar[2].stmt)
 			if l, ok := yylex.(*Lexer); ok {
@@ -818,7 +922,7 @@ yydefault:
 		}
 	case 3:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:94
+//line parse/parser.go.y:104
 		{
 			yyVAL.stmts = append(yyDollar[1].stmts, yyDollar[2].stmt)
 			if l, ok := yylex.(*Lexer); ok {
@@ -827,80 +931,115 @@ yydefault:
 		}
 	case 4:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line parse/parser.go.y:102
+//line parse/parser.go.y:112
 		{
 			yyVAL.stmts = []ast.Stmt{}
 		}
 	case 5:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:105
+//line parse/parser.go.y:115
 		{
 			yyVAL.stmts = append(yyDollar[1].stmts, yyDollar[2].stmt)
 		}
 	case 6:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:108
+//line parse/parser.go.y:118
 		{
 			yyVAL.stmts = yyDollar[1].stmts
 		}
 	case 7:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:113
+//line parse/parser.go.y:123
 		{
 			yyVAL.stmts = yyDollar[1].stmts
 		}
 	case 8:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:118
+//line parse/parser.go.y:128
 		{
 			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "+=", Rhs: yyDollar[3].expr}
 			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
 		}
 	case 9:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:122
+//line parse/parser.go.y:132
 		{
 			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "-=", Rhs: yyDollar[3].expr}
 			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
 		}
 	case 10:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:126
+//line parse/parser.go.y:136
 		{
 			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "*=", Rhs: yyDollar[3].expr}
 			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
 		}
 	case 11:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:130
+//line parse/parser.go.y:140
 		{
 			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "/=", Rhs: yyDollar[3].expr}
 			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
 		}
 	case 12:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:134
+//line parse/parser.go.y:144
 		{
 			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "%=", Rhs: yyDollar[3].expr}
 			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
 		}
 	case 13:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:138
+//line parse/parser.go.y:148
 		{
 			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "^=", Rhs: yyDollar[3].expr}
 			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
 		}
 	case 14:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:142
+//line parse/parser.go.y:152
+		{
+			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "~/=", Rhs: yyDollar[3].expr}
+			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
+		}
+	case 15:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:156
+		{
+			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "&=", Rhs: yyDollar[3].expr}
+			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
+		}
+	case 16:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:160
+		{
+			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "|=", Rhs: yyDollar[3].expr}
+			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
+		}
+	case 17:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:164
+		{
+			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: "<<=", Rhs: yyDollar[3].expr}
+			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
+		}
+	case 18:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:168
+		{
+			yyVAL.stmt = &ast.CompoundAssignStmt{Lhs: yyDollar[1].expr, Operator: ">>=", Rhs: yyDollar[3].expr}
+			yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
+		}
+	case 19:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:172
 		{
 			yyVAL.stmt = &ast.AssignStmt{Lhs: yyDollar[1].exprlist, Rhs: yyDollar[3].exprlist}
 			yyVAL.stmt.SetLine(yyDollar[1].exprlist[0].Line())
 		}
-	case 15:
+	case 20:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:147
+//line parse/parser.go.y:177
 		{
 			if _, ok := yyDollar[1].expr.(*ast.FuncCallExpr); !ok {
 				yylex.(*Lexer).Error(fmt.Sprintf("parse error: unexpected %s", yyDollar[1].expr))
@@ -909,49 +1048,65 @@ yydefault:
 				yyVAL.stmt.SetLine(yyDollar[1].expr.Line())
 			}
 		}
-	case 16:
+	case 21:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:155
+//line parse/parser.go.y:185
 		{
 			yyVAL.stmt = &ast.DoBlockStmt{Stmts: yyDollar[2].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[3].token.Pos.Line)
 		}
-	case 17:
+	case 22:
+		yyDollar = yyS[yypt-9 : yypt+1]
+//line parse/parser.go.y:190
+		{
+			yyVAL.stmt = &ast.WhileStmtWithIfThru{Condition: yyDollar[2].expr, Stmts: yyDollar[4].stmts, IfThruStmts: yyDollar[8].stmts}
+			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
+			yyVAL.stmt.SetLastLine(yyDollar[9].token.Pos.Line)
+		}
+	case 23:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parse/parser.go.y:160
+//line parse/parser.go.y:195
 		{
 			yyVAL.stmt = &ast.WhileStmt{Condition: yyDollar[2].expr, Stmts: yyDollar[4].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[5].token.Pos.Line)
 		}
-	case 18:
+	case 24:
+		yyDollar = yyS[yypt-10 : yypt+1]
+//line parse/parser.go.y:200
+		{
+			yyVAL.stmt = &ast.RepeatStmtWithIfThru{Condition: yyDollar[6].expr, Stmts: yyDollar[3].stmts, IfThruStmts: yyDollar[9].stmts}
+			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
+			yyVAL.stmt.SetLastLine(yyDollar[10].token.Pos.Line)
+		}
+	case 25:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parse/parser.go.y:165
+//line parse/parser.go.y:205
 		{
 			yyVAL.stmt = &ast.RepeatStmt{Condition: yyDollar[6].expr, Stmts: yyDollar[3].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[6].expr.Line())
 		}
-	case 19:
+	case 26:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parse/parser.go.y:170
+//line parse/parser.go.y:210
 		{
 			yyVAL.stmt = &ast.IfStmt{Condition: yyDollar[2].expr, Then: yyDollar[4].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[5].token.Pos.Line)
 		}
-	case 20:
+	case 27:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:175
+//line parse/parser.go.y:215
 		{ // single line if
 			yyVAL.stmt = &ast.IfStmt{Condition: yyDollar[2].expr, Then: []ast.Stmt{yyDollar[3].stmt}}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[3].stmt.Line())
 		}
-	case 21:
+	case 28:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parse/parser.go.y:180
+//line parse/parser.go.y:220
 		{
 			yyVAL.stmt = &ast.IfStmt{Condition: yyDollar[2].expr, Then: yyDollar[4].stmts}
 			cur := yyVAL.stmt
@@ -962,9 +1117,9 @@ yydefault:
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			/*$$.SetLastLine($6.Pos.Line)*/
 		}
-	case 22:
+	case 29:
 		yyDollar = yyS[yypt-10 : yypt+1]
-//line parse/parser.go.y:190
+//line parse/parser.go.y:230
 		{
 			yyVAL.stmt = &ast.IfStmt{Condition: yyDollar[2].expr, Then: yyDollar[4].stmts}
 			cur := yyVAL.stmt
@@ -976,154 +1131,233 @@ yydefault:
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[10].token.Pos.Line)
 		}
-	case 23:
+	case 30:
 		yyDollar = yyS[yypt-13 : yypt+1]
-//line parse/parser.go.y:201
+//line parse/parser.go.y:241
 		{
 			yyVAL.stmt = &ast.NumberForStmtWithIfThru{Name: yyDollar[2].token.Str, Init: yyDollar[4].expr, Limit: yyDollar[6].expr, Stmts: yyDollar[8].stmts, IfThruStmts: yyDollar[12].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[13].token.Pos.Line)
 		}
-	case 24:
+	case 31:
 		yyDollar = yyS[yypt-9 : yypt+1]
-//line parse/parser.go.y:206
+//line parse/parser.go.y:246
 		{
 			yyVAL.stmt = &ast.NumberForStmt{Name: yyDollar[2].token.Str, Init: yyDollar[4].expr, Limit: yyDollar[6].expr, Stmts: yyDollar[8].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[9].token.Pos.Line)
 		}
-	case 25:
+	case 32:
 		yyDollar = yyS[yypt-15 : yypt+1]
-//line parse/parser.go.y:211
+//line parse/parser.go.y:251
 		{
 			yyVAL.stmt = &ast.NumberForStmtWithIfThru{Name: yyDollar[2].token.Str, Init: yyDollar[4].expr, Limit: yyDollar[6].expr, Step: yyDollar[8].expr, Stmts: yyDollar[10].stmts, IfThruStmts: yyDollar[14].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[15].token.Pos.Line)
 		}
-	case 26:
+	case 33:
 		yyDollar = yyS[yypt-11 : yypt+1]
-//line parse/parser.go.y:216
+//line parse/parser.go.y:256
 		{
 			yyVAL.stmt = &ast.NumberForStmt{Name: yyDollar[2].token.Str, Init: yyDollar[4].expr, Limit: yyDollar[6].expr, Step: yyDollar[8].expr, Stmts: yyDollar[10].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[11].token.Pos.Line)
 		}
-	case 27:
+	case 34:
 		yyDollar = yyS[yypt-11 : yypt+1]
-//line parse/parser.go.y:221
+//line parse/parser.go.y:261
 		{
 			yyVAL.stmt = &ast.GenericForStmtWithIfThru{Names: yyDollar[2].namelist, Exprs: yyDollar[4].exprlist, Stmts: yyDollar[6].stmts, IfThruStmts: yyDollar[10].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[11].token.Pos.Line)
 		}
-	case 28:
+	case 35:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line parse/parser.go.y:226
+//line parse/parser.go.y:266
 		{
 			yyVAL.stmt = &ast.GenericForStmt{Names: yyDollar[2].namelist, Exprs: yyDollar[4].exprlist, Stmts: yyDollar[6].stmts}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[7].token.Pos.Line)
 		}
-	case 29:
+	case 36:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:231
+//line parse/parser.go.y:271
 		{
 			yyVAL.stmt = &ast.FuncDefStmt{Name: yyDollar[2].funcname, Func: yyDollar[3].funcexpr}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[3].funcexpr.LastLine())
 		}
-	case 30:
+	case 37:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parse/parser.go.y:236
+//line parse/parser.go.y:276
 		{
 			yyVAL.stmt = &ast.LocalAssignStmt{Names: []string{yyDollar[3].token.Str}, Exprs: []ast.Expr{yyDollar[4].funcexpr}}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.stmt.SetLastLine(yyDollar[4].funcexpr.LastLine())
 		}
-	case 31:
+	case 38:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parse/parser.go.y:241
+//line parse/parser.go.y:281
 		{
-			yyVAL.stmt = &ast.LocalAssignStmt{Names: yyDollar[2].namelist, Exprs: yyDollar[4].exprlist}
+			yyVAL.stmt = &ast.LocalAssignStmt{Names: yyDollar[2].parlist.Names, Exprs: yyDollar[4].exprlist, Types: yyDollar[2].parlist.Types}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 32:
+	case 39:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:245
+//line parse/parser.go.y:285
 		{
-			yyVAL.stmt = &ast.LocalAssignStmt{Names: yyDollar[2].namelist, Exprs: []ast.Expr{}}
+			yyVAL.stmt = &ast.LocalAssignStmt{Names: yyDollar[2].parlist.Names, Exprs: []ast.Expr{}, Types: yyDollar[2].parlist.Types}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 33:
+	case 40:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:249
+//line parse/parser.go.y:289
 		{
 			yyVAL.stmt = &ast.LabelStmt{Name: yyDollar[2].token.Str}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 34:
+	case 41:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:253
+//line parse/parser.go.y:293
 		{
 			yyVAL.stmt = &ast.GotoStmt{Label: yyDollar[2].token.Str}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 35:
+	case 42:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parse/parser.go.y:297
+		{
+			yyVAL.stmt = &ast.DeferStmt{Call: yyDollar[2].expr.(*ast.FuncCallExpr)}
+			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
+		}
+	case 43:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parse/parser.go.y:301
+		{
+			stmt := &ast.SwitchStmt{Expr: yyDollar[2].expr, Cases: []*ast.SwitchCase{}}
+			for _, cs := range yyDollar[4].switchcases {
+				if cs.Values == nil {
+					stmt.Default = cs.Stmts
+				} else {
+					stmt.Cases = append(stmt.Cases, cs)
+				}
+			}
+			yyVAL.stmt = stmt
+			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
+			yyVAL.stmt.SetLastLine(yyDollar[5].token.Pos.Line)
+		}
+	case 44:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line parse/parser.go.y:259
+//line parse/parser.go.y:316
 		{
 			yyVAL.stmts = []ast.Stmt{}
 		}
-	case 36:
+	case 45:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parse/parser.go.y:262
+//line parse/parser.go.y:319
 		{
 			yyVAL.stmts = append(yyDollar[1].stmts, &ast.IfStmt{Condition: yyDollar[3].expr, Then: yyDollar[5].stmts})
 			yyVAL.stmts[len(yyVAL.stmts)-1].SetLine(yyDollar[2].token.Pos.Line)
 		}
-	case 37:
+	case 46:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line parse/parser.go.y:325
+		{
+			yyVAL.switchcases = []*ast.SwitchCase{}
+		}
+	case 47:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parse/parser.go.y:328
+		{
+			yyVAL.switchcases = append(yyDollar[1].switchcases, &ast.SwitchCase{Values: yyDollar[3].exprlist, Stmts: yyDollar[5].stmts})
+			yyVAL.switchcases[len(yyVAL.switchcases)-1].SetLine(yyDollar[2].token.Pos.Line)
+		}
+	case 48:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parse/parser.go.y:332
+		{
+			for _, cs := range yyDollar[1].switchcases {
+				if cs.Values == nil {
+					yylex.(*Lexer).TokenError(yyDollar[2].token, "multiple defaults in switch statement")
+				}
+			}
+			yyVAL.switchcases = append(yyDollar[1].switchcases, &ast.SwitchCase{Stmts: yyDollar[4].stmts})
+			yyVAL.switchcases[len(yyVAL.switchcases)-1].SetLine(yyDollar[2].token.Pos.Line)
+		}
+	case 49:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:268
+//line parse/parser.go.y:343
+		{
+			yyVAL.exprlist = []ast.Expr{yyDollar[1].expr}
+		}
+	case 50:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parse/parser.go.y:346
+		{
+			yyVAL.exprlist = []ast.Expr{yyDollar[1].expr}
+		}
+	case 51:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:349
+		{
+			yyVAL.exprlist = append(yyDollar[1].exprlist, yyDollar[3].expr)
+		}
+	case 52:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:352
+		{
+			yyVAL.exprlist = append(yyDollar[1].exprlist, yyDollar[3].expr)
+		}
+	case 53:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parse/parser.go.y:357
 		{
 			yyVAL.stmt = &ast.ReturnStmt{Exprs: nil}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 38:
+	case 54:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:272
+//line parse/parser.go.y:361
 		{
 			yyVAL.stmt = &ast.ReturnStmt{Exprs: yyDollar[2].exprlist}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 39:
+	case 55:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:276
+//line parse/parser.go.y:365
 		{
 			yyVAL.stmt = &ast.BreakStmt{}
 			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 40:
+	case 56:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:282
+//line parse/parser.go.y:369
+		{
+			yyVAL.stmt = &ast.ContinueStmt{}
+			yyVAL.stmt.SetLine(yyDollar[1].token.Pos.Line)
+		}
+	case 57:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parse/parser.go.y:375
 		{
 			yyVAL.funcname = yyDollar[1].funcname
 		}
-	case 41:
+	case 58:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:285
+//line parse/parser.go.y:378
 		{
 			yyVAL.funcname = &ast.FuncName{Func: nil, Receiver: yyDollar[1].funcname.Func, Method: yyDollar[3].token.Str}
 		}
-	case 42:
+	case 59:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:290
+//line parse/parser.go.y:383
 		{
 			yyVAL.funcname = &ast.FuncName{Func: &ast.IdentExpr{Value: yyDollar[1].token.Str}}
 			yyVAL.funcname.Func.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 43:
+	case 60:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:294
+//line parse/parser.go.y:387
 		{
 			key := &ast.StringExpr{Value: yyDollar[3].token.Str}
 			key.SetLine(yyDollar[3].token.Pos.Line)
@@ -1131,329 +1365,381 @@ yydefault:
 			fn.SetLine(yyDollar[3].token.Pos.Line)
 			yyVAL.funcname = &ast.FuncName{Func: fn}
 		}
-	case 44:
+	case 61:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:303
+//line parse/parser.go.y:396
 		{
 			yyVAL.exprlist = []ast.Expr{yyDollar[1].expr}
 		}
-	case 45:
+	case 62:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:306
+//line parse/parser.go.y:399
 		{
 			yyVAL.exprlist = append(yyDollar[1].exprlist, yyDollar[3].expr)
 		}
-	case 46:
+	case 63:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:311
+//line parse/parser.go.y:404
 		{
 			yyVAL.expr = &ast.IdentExpr{Value: yyDollar[1].token.Str}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 47:
+	case 64:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parse/parser.go.y:315
+//line parse/parser.go.y:408
 		{
 			yyVAL.expr = &ast.AttrGetExpr{Object: yyDollar[1].expr, Key: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 48:
+	case 65:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:319
+//line parse/parser.go.y:412
 		{
 			key := &ast.StringExpr{Value: yyDollar[3].token.Str}
 			key.SetLine(yyDollar[3].token.Pos.Line)
 			yyVAL.expr = &ast.AttrGetExpr{Object: yyDollar[1].expr, Key: key}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 49:
+	case 66:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:327
+//line parse/parser.go.y:420
 		{
 			yyVAL.namelist = []string{yyDollar[1].token.Str}
 		}
-	case 50:
+	case 67:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:330
+//line parse/parser.go.y:423
 		{
 			yyVAL.namelist = append(yyDollar[1].namelist, yyDollar[3].token.Str)
 		}
-	case 51:
+	case 68:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:335
+//line parse/parser.go.y:429
+		{
+			yyVAL.parlist = addTypedName(&ast.ParList{Names: []string{}}, yyDollar[1].token.Str, nil)
+		}
+	case 69:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:432
+		{
+			yyVAL.parlist = addTypedName(&ast.ParList{Names: []string{}}, yyDollar[1].token.Str, yyDollar[3].expr)
+		}
+	case 70:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:435
+		{
+			yyVAL.parlist = addTypedName(yyDollar[1].parlist, yyDollar[3].token.Str, nil)
+		}
+	case 71:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parse/parser.go.y:438
+		{
+			yyVAL.parlist = addTypedName(yyDollar[1].parlist, yyDollar[3].token.Str, yyDollar[5].expr)
+		}
+	case 72:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parse/parser.go.y:443
 		{
 			yyVAL.exprlist = []ast.Expr{yyDollar[1].expr}
 		}
-	case 52:
+	case 73:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:338
+//line parse/parser.go.y:446
 		{
 			yyVAL.exprlist = append(yyDollar[1].exprlist, yyDollar[3].expr)
 		}
-	case 53:
+	case 74:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:343
+//line parse/parser.go.y:451
 		{
 			yyVAL.expr = makeBuiltinType(yyDollar[1].token)
 		}
-	case 54:
+	case 75:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:346
+//line parse/parser.go.y:454
 		{
 			yyVAL.expr = makeBuiltinType(yyDollar[1].token)
 		}
-	case 55:
+	case 76:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:349
+//line parse/parser.go.y:457
 		{
 			yyVAL.expr = makeBuiltinType(yyDollar[1].token)
 		}
-	case 56:
+	case 77:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:352
+//line parse/parser.go.y:460
 		{
 			yyVAL.expr = makeBuiltinType(yyDollar[1].token)
 		}
-	case 57:
+	case 78:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:355
+//line parse/parser.go.y:463
 		{
 			yyVAL.expr = makeBuiltinType(yyDollar[1].token)
 		}
-	case 58:
+	case 79:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:358
+//line parse/parser.go.y:466
 		{
 			yyVAL.expr = makeBuiltinType(yyDollar[1].token)
 		}
-	case 59:
+	case 80:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:361
+//line parse/parser.go.y:469
 		{
 			yyVAL.expr = makeBuiltinType(yyDollar[1].token)
 		}
-	case 60:
+	case 81:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:364
+//line parse/parser.go.y:472
 		{
 			yyVAL.expr = makeBuiltinType(yyDollar[1].token)
 		}
-	case 61:
+	case 82:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:370
+//line parse/parser.go.y:478
 		{
 			yyVAL.expr = &ast.NilExpr{}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 62:
+	case 83:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:374
+//line parse/parser.go.y:482
 		{
 			yyVAL.expr = &ast.FalseExpr{}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 63:
+	case 84:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:378
+//line parse/parser.go.y:486
 		{
 			yyVAL.expr = &ast.TrueExpr{}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 64:
+	case 85:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:382
+//line parse/parser.go.y:490
 		{
 			yyVAL.expr = &ast.NumberExpr{Value: yyDollar[1].token.Str}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 65:
+	case 86:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:386
+//line parse/parser.go.y:494
 		{
 			yyVAL.expr = &ast.Comma3Expr{}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 66:
+	case 87:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:390
+//line parse/parser.go.y:498
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 67:
+	case 88:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:393
+//line parse/parser.go.y:501
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 68:
+	case 89:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:396
+//line parse/parser.go.y:504
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 69:
+	case 90:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:399
+//line parse/parser.go.y:507
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 70:
+	case 91:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:402
+//line parse/parser.go.y:510
+		{
+			yyVAL.expr = &ast.NilCoalesceExpr{Lhs: yyDollar[1].expr, Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
+		}
+	case 92:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:514
 		{
 			yyVAL.expr = &ast.LogicalOpExpr{Lhs: yyDollar[1].expr, Operator: "or", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 71:
+	case 93:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:406
+//line parse/parser.go.y:518
 		{
 			yyVAL.expr = &ast.LogicalOpExpr{Lhs: yyDollar[1].expr, Operator: "and", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 72:
+	case 94:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:410
+//line parse/parser.go.y:522
 		{
 			yyVAL.expr = &ast.BitwiseOpExpr{Lhs: yyDollar[1].expr, Operator: "|", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 73:
+	case 95:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:414
+//line parse/parser.go.y:526
+		{
+			yyVAL.expr = &ast.BitwiseOpExpr{Lhs: yyDollar[1].expr, Operator: "~", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
+		}
+	case 96:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:530
 		{
 			yyVAL.expr = &ast.BitwiseOpExpr{Lhs: yyDollar[1].expr, Operator: "&", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 74:
+	case 97:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:418
+//line parse/parser.go.y:534
 		{
 			yyVAL.expr = &ast.BitwiseOpExpr{Lhs: yyDollar[1].expr, Operator: "<<", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 75:
+	case 98:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:422
+//line parse/parser.go.y:538
 		{
 			yyVAL.expr = &ast.BitwiseOpExpr{Lhs: yyDollar[1].expr, Operator: ">>", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 76:
+	case 99:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:426
+//line parse/parser.go.y:542
 		{
 			yyVAL.expr = &ast.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: ">", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 77:
+	case 100:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:430
+//line parse/parser.go.y:546
 		{
 			yyVAL.expr = &ast.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: "<", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 78:
+	case 101:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:434
+//line parse/parser.go.y:550
 		{
 			yyVAL.expr = &ast.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: ">=", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 79:
+	case 102:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:438
+//line parse/parser.go.y:554
 		{
 			yyVAL.expr = &ast.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: "<=", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 80:
+	case 103:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:442
+//line parse/parser.go.y:558
 		{
 			yyVAL.expr = &ast.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: "==", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 81:
+	case 104:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:446
+//line parse/parser.go.y:562
 		{
 			yyVAL.expr = &ast.RelationalOpExpr{Lhs: yyDollar[1].expr, Operator: "~=", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 82:
+	case 105:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:450
+//line parse/parser.go.y:566
 		{
 			yyVAL.expr = &ast.StringConcatOpExpr{Lhs: yyDollar[1].expr, Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 83:
+	case 106:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:454
+//line parse/parser.go.y:570
 		{
 			yyVAL.expr = &ast.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "+", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 84:
+	case 107:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:458
+//line parse/parser.go.y:574
 		{
 			yyVAL.expr = &ast.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "-", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 85:
+	case 108:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:462
+//line parse/parser.go.y:578
 		{
 			yyVAL.expr = &ast.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "*", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 86:
+	case 109:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:466
+//line parse/parser.go.y:582
 		{
 			yyVAL.expr = &ast.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "/", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 87:
+	case 110:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:470
+//line parse/parser.go.y:586
 		{
 			yyVAL.expr = &ast.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "%", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 88:
+	case 111:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:590
+		{
+			yyVAL.expr = &ast.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "~/", Rhs: yyDollar[3].expr}
+			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
+		}
+	case 112:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:474
+//line parse/parser.go.y:594
 		{
 			yyVAL.expr = &ast.ArithmeticOpExpr{Lhs: yyDollar[1].expr, Operator: "^", Rhs: yyDollar[3].expr}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 89:
+	case 113:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:478
+//line parse/parser.go.y:598
 		{
 			yyVAL.expr = &ast.UnaryMinusOpExpr{Expr: yyDollar[2].expr}
 			yyVAL.expr.SetLine(yyDollar[2].expr.Line())
 		}
-	case 90:
+	case 114:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:482
+//line parse/parser.go.y:602
 		{
 			yyVAL.expr = &ast.UnaryNotOpExpr{Expr: yyDollar[2].expr}
 			yyVAL.expr.SetLine(yyDollar[2].expr.Line())
 		}
-	case 91:
+	case 115:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:486
+//line parse/parser.go.y:606
 		{
 			yyVAL.expr = &ast.UnaryLenOpExpr{Expr: yyDollar[2].expr}
 			yyVAL.expr.SetLine(yyDollar[2].expr.Line())
 		}
-	case 92:
+	case 116:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parse/parser.go.y:610
+		{
+			yyVAL.expr = &ast.UnaryBitNotOpExpr{Expr: yyDollar[2].expr}
+			yyVAL.expr.SetLine(yyDollar[2].expr.Line())
+		}
+	case 117:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parse/parser.go.y:490
+//line parse/parser.go.y:614
 		{
 			yyVAL.expr = &ast.TypeAssertionExpr{
 				Expr: yyDollar[1].expr,
@@ -1461,190 +1747,232 @@ yydefault:
 			}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 93:
+	case 118:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:499
+//line parse/parser.go.y:623
 		{
 			yyVAL.expr = &ast.StringExpr{Value: yyDollar[1].token.Str}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 94:
+	case 119:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:505
+//line parse/parser.go.y:627
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 95:
+	case 120:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:508
+//line parse/parser.go.y:632
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 96:
+	case 121:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parse/parser.go.y:635
+		{
+			yyVAL.expr = yyDollar[1].expr
+		}
+	case 122:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:511
+//line parse/parser.go.y:638
 		{ /* 新增一个分支，允许匿名函数直接作为表达式 */
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 97:
+	case 123:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:514
+//line parse/parser.go.y:641
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 98:
+	case 124:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:517
+//line parse/parser.go.y:644
 		{
-			if ex, ok := yyDollar[2].expr.(*ast.Comma3Expr); ok {
+			key := &ast.StringExpr{Value: yyDollar[3].token.Str}
+			key.SetLine(yyDollar[3].token.Pos.Line)
+			yyVAL.expr = &ast.SafeAttrGetExpr{Object: yyDollar[1].expr, Key: key}
+			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
+		}
+	case 125:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parse/parser.go.y:650
+		{
+			yyVAL.expr = &ast.SafeAttrGetExpr{Object: yyDollar[1].expr, Key: yyDollar[3].expr}
+			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
+		}
+	case 126:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parse/parser.go.y:654
+		{
+			switch ex := yyDollar[2].expr.(type) {
+			case *ast.Comma3Expr:
 				ex.AdjustRet = true
+			case *ast.AttrGetExpr:
+				ex.Paren = true
+			case *ast.SafeAttrGetExpr:
+				ex.Paren = true
 			}
 			yyVAL.expr = yyDollar[2].expr
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 99:
+	case 127:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:526
+//line parse/parser.go.y:668
 		{
 			yyDollar[2].expr.(*ast.FuncCallExpr).AdjustRet = true
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 100:
+	case 128:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:532
+//line parse/parser.go.y:674
 		{
 			yyVAL.expr = &ast.FuncCallExpr{Func: yyDollar[1].expr, Args: yyDollar[2].exprlist}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 101:
+	case 129:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parse/parser.go.y:536
+//line parse/parser.go.y:678
 		{
 			yyVAL.expr = &ast.FuncCallExpr{Method: yyDollar[3].token.Str, Receiver: yyDollar[1].expr, Args: yyDollar[4].exprlist}
 			yyVAL.expr.SetLine(yyDollar[1].expr.Line())
 		}
-	case 102:
+	case 130:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:542
+//line parse/parser.go.y:684
 		{
 			if yylex.(*Lexer).PNewLine {
 				yylex.(*Lexer).TokenError(yyDollar[1].token, "ambiguous syntax (function call x new statement)")
 			}
 			yyVAL.exprlist = []ast.Expr{}
 		}
-	case 103:
+	case 131:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:548
+//line parse/parser.go.y:690
 		{
 			if yylex.(*Lexer).PNewLine {
 				yylex.(*Lexer).TokenError(yyDollar[1].token, "ambiguous syntax (function call x new statement)")
 			}
 			yyVAL.exprlist = yyDollar[2].exprlist
 		}
-	case 104:
+	case 132:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:556
+//line parse/parser.go.y:698
 		{
 			yyVAL.expr = &ast.FunctionExpr{ParList: yyDollar[2].funcexpr.ParList, Stmts: yyDollar[2].funcexpr.Stmts}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.expr.SetLastLine(yyDollar[2].funcexpr.LastLine())
 		}
-	case 105:
+	case 133:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parse/parser.go.y:563
+//line parse/parser.go.y:705
 		{
 			yyVAL.funcexpr = &ast.FunctionExpr{ParList: yyDollar[2].parlist, Stmts: yyDollar[5].stmts}
 			yyVAL.funcexpr.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.funcexpr.SetLastLine(yyDollar[6].token.Pos.Line)
 		}
-	case 106:
+	case 134:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parse/parser.go.y:568
+//line parse/parser.go.y:710
 		{
 			yyVAL.funcexpr = &ast.FunctionExpr{ParList: &ast.ParList{HasVargs: false, Names: []string{}}, Stmts: yyDollar[4].stmts}
 			yyVAL.funcexpr.SetLine(yyDollar[1].token.Pos.Line)
 			yyVAL.funcexpr.SetLastLine(yyDollar[5].token.Pos.Line)
 		}
-	case 107:
+	case 135:
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line parse/parser.go.y:715
+		{
+			yyVAL.funcexpr = &ast.FunctionExpr{ParList: yyDollar[2].parlist, Stmts: yyDollar[7].stmts, ReturnType: yyDollar[5].expr}
+			yyVAL.funcexpr.SetLine(yyDollar[1].token.Pos.Line)
+			yyVAL.funcexpr.SetLastLine(yyDollar[8].token.Pos.Line)
+		}
+	case 136:
+		yyDollar = yyS[yypt-7 : yypt+1]
+//line parse/parser.go.y:720
+		{
+			yyVAL.funcexpr = &ast.FunctionExpr{ParList: &ast.ParList{HasVargs: false, Names: []string{}}, Stmts: yyDollar[6].stmts, ReturnType: yyDollar[4].expr}
+			yyVAL.funcexpr.SetLine(yyDollar[1].token.Pos.Line)
+			yyVAL.funcexpr.SetLastLine(yyDollar[7].token.Pos.Line)
+		}
+	case 137:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:575
+//line parse/parser.go.y:727
 		{
 			yyVAL.parlist = &ast.ParList{HasVargs: true, Names: []string{}}
 		}
-	case 108:
+	case 138:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:578
+//line parse/parser.go.y:730
 		{
-			yyVAL.parlist = &ast.ParList{HasVargs: false, Names: []string{}}
-			yyVAL.parlist.Names = append(yyVAL.parlist.Names, yyDollar[1].namelist...)
+			yyVAL.parlist = yyDollar[1].parlist
 		}
-	case 109:
+	case 139:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:582
+//line parse/parser.go.y:733
 		{
-			yyVAL.parlist = &ast.ParList{HasVargs: true, Names: []string{}}
-			yyVAL.parlist.Names = append(yyVAL.parlist.Names, yyDollar[1].namelist...)
+			yyVAL.parlist = yyDollar[1].parlist
+			yyVAL.parlist.HasVargs = true
 		}
-	case 110:
+	case 140:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:589
+//line parse/parser.go.y:740
 		{
 			yyVAL.expr = &ast.TableExpr{Fields: []*ast.Field{}}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 111:
+	case 141:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:593
+//line parse/parser.go.y:744
 		{
 			yyVAL.expr = &ast.TableExpr{Fields: yyDollar[2].fieldlist}
 			yyVAL.expr.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 112:
+	case 142:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:600
+//line parse/parser.go.y:751
 		{
 			yyVAL.fieldlist = []*ast.Field{yyDollar[1].field}
 		}
-	case 113:
+	case 143:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:603
+//line parse/parser.go.y:754
 		{
 			yyVAL.fieldlist = append(yyDollar[1].fieldlist, yyDollar[3].field)
 		}
-	case 114:
+	case 144:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parse/parser.go.y:606
+//line parse/parser.go.y:757
 		{
 			yyVAL.fieldlist = yyDollar[1].fieldlist
 		}
-	case 115:
+	case 145:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parse/parser.go.y:611
+//line parse/parser.go.y:762
 		{
 			yyVAL.field = &ast.Field{Key: &ast.StringExpr{Value: yyDollar[1].token.Str}, Value: yyDollar[3].expr}
 			yyVAL.field.Key.SetLine(yyDollar[1].token.Pos.Line)
 		}
-	case 116:
+	case 146:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parse/parser.go.y:615
+//line parse/parser.go.y:766
 		{
 			yyVAL.field = &ast.Field{Key: yyDollar[2].expr, Value: yyDollar[5].expr}
 		}
-	case 117:
+	case 147:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:618
+//line parse/parser.go.y:769
 		{
 			yyVAL.field = &ast.Field{Value: yyDollar[1].expr}
 		}
-	case 118:
+	case 148:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:623
+//line parse/parser.go.y:774
 		{
 			yyVAL.fieldsep = ","
 		}
-	case 119:
+	case 149:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parse/parser.go.y:626
+//line parse/parser.go.y:777
 		{
 			yyVAL.fieldsep = ";"
 		}
@@ -11,6 +11,8 @@ import (
 %type<stmts> block
 %type<stmt>  stat
 %type<stmts> elseifs
+%type<switchcases> switchcases
+%type<exprlist> caselist
 %type<stmt>  laststat
 %type<funcname> funcname
 %type<funcname> funcname1
@@ -28,6 +30,7 @@ import (
 %type<expr> function
 %type<funcexpr> funcbody
 %type<parlist> parlist
+%type<parlist> typednamelist
 %type<expr> tableconstructor
 %type<fieldlist> fieldlist
 %type<field> field
@@ -39,6 +42,8 @@ import (
   stmts    []ast.Stmt
   stmt     ast.Stmt
 
+  switchcases []*ast.SwitchCase
+
   funcname *ast.FuncName
   funcexpr *ast.FunctionExpr
 
@@ -54,26 +59,31 @@ import (
 }
 
 /* Reserved words */
-%token<token> TAnd TBreak TElse TElseIf TFalse TFor TFunction TIf TIn TLocal TNil TNot TOr TReturn TRepeat TTrue TUntil TWhile TGoto TIfThru
+%token<token> TAnd TBreak TContinue TElse TElseIf TFalse TFor TFunction TIf TIn TLocal TNil TNot TOr TReturn TRepeat TTrue TUntil TWhile TGoto TIfThru TDefer TSwitch TCase TDefault
 
 /* Literals */
-%token<token> TEqeq TNeq TLte TGte T2Dot T3Dot TDot T2Colon TIdent TNumber TString TLBrace TRBrace TLParen TRParen TLBracket TRBracket TComma TSemi TAssign TAdd TSub TMul TDiv TMod TPow TColon THash TLeftShift TRightShift TBitAnd TBitOr TAddAssign TSubAssign TMulAssign TDivAssign TModAssign TPowAssign TDotLParen
+%token<token> TEqeq TNeq TLte TGte T2Dot T3Dot TDot T2Colon TIdent TNumber TString TLBrace TRBrace TLParen TRParen TLBracket TRBracket TComma TSemi TAssign TAdd TSub TMul TDiv TMod TPow TColon THash TLeftShift TRightShift TBitAnd TBitOr TBitXor TIDiv TAddAssign TSubAssign TMulAssign TDivAssign TModAssign TPowAssign TIDivAssign TBitAndAssign TBitOrAssign TLeftShiftAssign TRightShiftAssign TDotLParen TQuestionDot TQuestionLBracket T2Question
+
+/* Interpolated strings */
+%token<expr> TInterpString
 
 /* Types */
 %token<token> TTBool TTNumber TTString TTTable TTFunction TTUserdata TTThread TTChannel
 
 /* Operators */
-%right TAddAssign TSubAssign TMulAssign TDivAssign TModAssign TPowAssign
+%right TAddAssign TSubAssign TMulAssign TDivAssign TModAssign TPowAssign TIDivAssign TBitAndAssign TBitOrAssign TLeftShiftAssign TRightShiftAssign
+%right T2Question
 %left TOr
 %left TAnd
 %left TGt TLt TGte TLte TEqeq TNeq
 %left TBitOr
+%left TBitXor
 %left TBitAnd
 %left TLeftShift TRightShift
 %right T2Dot
 %left TAdd TSub
-%left TMul TDiv TMod
-%right UNARY /* not # -(unary) */
+%left TMul TDiv TMod TIDiv
+%right UNARY /* not # -(unary) ~(unary) */
 %right TPow
 
 %%
@@ -139,6 +149,26 @@ stat:
             $$ = &ast.CompoundAssignStmt{Lhs: $1, Operator: "^=", Rhs: $3}
             $$.SetLine($1.Line())
         } |
+        var TIDivAssign expr {
+            $$ = &ast.CompoundAssignStmt{Lhs: $1, Operator: "~/=", Rhs: $3}
+            $$.SetLine($1.Line())
+        } |
+        var TBitAndAssign expr {
+            $$ = &ast.CompoundAssignStmt{Lhs: $1, Operator: "&=", Rhs: $3}
+            $$.SetLine($1.Line())
+        } |
+        var TBitOrAssign expr {
+            $$ = &ast.CompoundAssignStmt{Lhs: $1, Operator: "|=", Rhs: $3}
+            $$.SetLine($1.Line())
+        } |
+        var TLeftShiftAssign expr {
+            $$ = &ast.CompoundAssignStmt{Lhs: $1, Operator: "<<=", Rhs: $3}
+            $$.SetLine($1.Line())
+        } |
+        var TRightShiftAssign expr {
+            $$ = &ast.CompoundAssignStmt{Lhs: $1, Operator: ">>=", Rhs: $3}
+            $$.SetLine($1.Line())
+        } |
         varlist TAssign exprlist {
             $$ = &ast.AssignStmt{Lhs: $1, Rhs: $3}
             $$.SetLine($1[0].Line())
@@ -157,11 +187,21 @@ stat:
             $$.SetLine($1.Pos.Line)
             $$.SetLastLine($3.Pos.Line)
         } |
+        TWhile expr TLBrace block TRBrace TIfThru TLBrace block TRBrace {
+            $$ = &ast.WhileStmtWithIfThru{Condition: $2, Stmts: $4, IfThruStmts: $8}
+            $$.SetLine($1.Pos.Line)
+            $$.SetLastLine($9.Pos.Line)
+        } |
         TWhile expr TLBrace block TRBrace {
             $$ = &ast.WhileStmt{Condition: $2, Stmts: $4}
             $$.SetLine($1.Pos.Line)
             $$.SetLastLine($5.Pos.Line)
         } |
+        TRepeat TLBrace block TRBrace TUntil expr TIfThru TLBrace block TRBrace {
+            $$ = &ast.RepeatStmtWithIfThru{Condition: $6, Stmts: $3, IfThruStmts: $9}
+            $$.SetLine($1.Pos.Line)
+            $$.SetLastLine($10.Pos.Line)
+        } |
         TRepeat TLBrace block TRBrace TUntil expr {
             $$ = &ast.RepeatStmt{Condition: $6, Stmts: $3}
             $$.SetLine($1.Pos.Line)
@@ -238,12 +278,12 @@ stat:
             $$.SetLine($1.Pos.Line)
             $$.SetLastLine($4.LastLine())
         } | 
-        TLocal namelist TAssign exprlist {
-            $$ = &ast.LocalAssignStmt{Names: $2, Exprs:$4}
+        TLocal typednamelist TAssign exprlist {
+            $$ = &ast.LocalAssignStmt{Names: $2.Names, Exprs:$4, Types: $2.Types}
             $$.SetLine($1.Pos.Line)
         } |
-        TLocal namelist {
-            $$ = &ast.LocalAssignStmt{Names: $2, Exprs:[]ast.Expr{}}
+        TLocal typednamelist {
+            $$ = &ast.LocalAssignStmt{Names: $2.Names, Exprs:[]ast.Expr{}, Types: $2.Types}
             $$.SetLine($1.Pos.Line)
         } |
         T2Colon TIdent T2Colon {
@@ -253,6 +293,23 @@ stat:
         TGoto TIdent {
             $$ = &ast.GotoStmt{Label: $2.Str}
             $$.SetLine($1.Pos.Line)
+        } |
+        TDefer functioncall {
+            $$ = &ast.DeferStmt{Call: $2.(*ast.FuncCallExpr)}
+            $$.SetLine($1.Pos.Line)
+        } |
+        TSwitch expr TLBrace switchcases TRBrace {
+            stmt := &ast.SwitchStmt{Expr: $2, Cases: []*ast.SwitchCase{}}
+            for _, cs := range $4 {
+                if cs.Values == nil {
+                    stmt.Default = cs.Stmts
+                } else {
+                    stmt.Cases = append(stmt.Cases, cs)
+                }
+            }
+            $$ = stmt
+            $$.SetLine($1.Pos.Line)
+            $$.SetLastLine($5.Pos.Line)
         }
 
 elseifs: 
@@ -264,6 +321,38 @@ elseifs:
             $$[len($$)-1].SetLine($2.Pos.Line)
         } 
 
+switchcases:
+        {
+            $$ = []*ast.SwitchCase{}
+        } |
+        switchcases TCase caselist TLBrace block TRBrace {
+            $$ = append($1, &ast.SwitchCase{Values: $3, Stmts: $5})
+            $$[len($$)-1].SetLine($2.Pos.Line)
+        } |
+        switchcases TDefault TLBrace block TRBrace {
+            for _, cs := range $1 {
+                if cs.Values == nil {
+                    yylex.(*Lexer).TokenError($2, "multiple defaults in switch statement")
+                }
+            }
+            $$ = append($1, &ast.SwitchCase{Stmts: $4})
+            $$[len($$)-1].SetLine($2.Pos.Line)
+        }
+
+caselist:
+        expr {
+            $$ = []ast.Expr{$1}
+        } |
+        type_expr {
+            $$ = []ast.Expr{$1}
+        } |
+        caselist TComma expr {
+            $$ = append($1, $3)
+        } |
+        caselist TComma type_expr {
+            $$ = append($1, $3)
+        }
+
 laststat:
         TReturn {
             $$ = &ast.ReturnStmt{Exprs:nil}
@@ -276,6 +365,10 @@ laststat:
         TBreak  {
             $$ = &ast.BreakStmt{}
             $$.SetLine($1.Pos.Line)
+        } |
+        TContinue {
+            $$ = &ast.ContinueStmt{}
+            $$.SetLine($1.Pos.Line)
         }
 
 funcname: 
@@ -331,6 +424,21 @@ namelist:
             $$ = append($1, $3.Str)
         }
 
+/* names with optional type annotations, 'name: type' */
+typednamelist:
+        TIdent {
+            $$ = addTypedName(&ast.ParList{Names: []string{}}, $1.Str, nil)
+        } |
+        TIdent TColon type_expr {
+            $$ = addTypedName(&ast.ParList{Names: []string{}}, $1.Str, $3)
+        } |
+        typednamelist TComma TIdent {
+            $$ = addTypedName($1, $3.Str, nil)
+        } |
+        typednamelist TComma TIdent TColon type_expr {
+            $$ = addTypedName($1, $3.Str, $5)
+        }
+
 exprlist:
         expr {
             $$ = []ast.Expr{$1}
@@ -399,6 +507,10 @@ expr:
         tableconstructor {
             $$ = $1
         } |
+        expr T2Question expr {
+            $$ = &ast.NilCoalesceExpr{Lhs: $1, Rhs: $3}
+            $$.SetLine($1.Line())
+        } |
         expr TOr expr {
             $$ = &ast.LogicalOpExpr{Lhs: $1, Operator: "or", Rhs: $3}
             $$.SetLine($1.Line())
@@ -411,6 +523,10 @@ expr:
             $$ = &ast.BitwiseOpExpr{Lhs: $1, Operator: "|", Rhs: $3}
             $$.SetLine($1.Line())
         } |
+        expr TBitXor expr {
+            $$ = &ast.BitwiseOpExpr{Lhs: $1, Operator: "~", Rhs: $3}
+            $$.SetLine($1.Line())
+        } |
         expr TBitAnd expr {
             $$ = &ast.BitwiseOpExpr{Lhs: $1, Operator: "&", Rhs: $3}
             $$.SetLine($1.Line())
@@ -471,6 +587,10 @@ expr:
             $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "%", Rhs: $3}
             $$.SetLine($1.Line())
         } |
+        expr TIDiv expr {
+            $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "~/", Rhs: $3}
+            $$.SetLine($1.Line())
+        } |
         expr TPow expr {
             $$ = &ast.ArithmeticOpExpr{Lhs: $1, Operator: "^", Rhs: $3}
             $$.SetLine($1.Line())
@@ -487,6 +607,10 @@ expr:
             $$ = &ast.UnaryLenOpExpr{Expr: $2}
             $$.SetLine($2.Line())
         } |
+        TBitXor expr %prec UNARY {
+            $$ = &ast.UnaryBitNotOpExpr{Expr: $2}
+            $$.SetLine($2.Line())
+        } |
         expr TDotLParen type_expr TRParen {
             $$ = &ast.TypeAssertionExpr{
                 Expr: $1,
@@ -499,7 +623,10 @@ string:
         TString {
             $$ = &ast.StringExpr{Value: $1.Str}
             $$.SetLine($1.Pos.Line)
-        } 
+        } |
+        TInterpString {
+            $$ = $1
+        }
 
 prefixexp:
         var {
@@ -514,9 +641,24 @@ prefixexp:
         functioncall {
             $$ = $1
         } |
+        prefixexp TQuestionDot TIdent {
+            key := &ast.StringExpr{Value:$3.Str}
+            key.SetLine($3.Pos.Line)
+            $$ = &ast.SafeAttrGetExpr{Object: $1, Key: key}
+            $$.SetLine($1.Line())
+        } |
+        prefixexp TQuestionLBracket expr TRBracket {
+            $$ = &ast.SafeAttrGetExpr{Object: $1, Key: $3}
+            $$.SetLine($1.Line())
+        } |
         TLParen expr TRParen {
-            if ex, ok := $2.(*ast.Comma3Expr); ok {
+            switch ex := $2.(type) {
+            case *ast.Comma3Expr:
                 ex.AdjustRet = true
+            case *ast.AttrGetExpr:
+                ex.Paren = true
+            case *ast.SafeAttrGetExpr:
+                ex.Paren = true
             }
             $$ = $2
             $$.SetLine($1.Pos.Line)
@@ -569,19 +711,28 @@ funcbody:
             $$ = &ast.FunctionExpr{ParList: &ast.ParList{HasVargs: false, Names: []string{}}, Stmts: $4}
             $$.SetLine($1.Pos.Line)
             $$.SetLastLine($5.Pos.Line)
+        } |
+        TLParen parlist TRParen TColon type_expr TLBrace block TRBrace {
+            $$ = &ast.FunctionExpr{ParList: $2, Stmts: $7, ReturnType: $5}
+            $$.SetLine($1.Pos.Line)
+            $$.SetLastLine($8.Pos.Line)
+        } | 
+        TLParen TRParen TColon type_expr TLBrace block TRBrace {
+            $$ = &ast.FunctionExpr{ParList: &ast.ParList{HasVargs: false, Names: []string{}}, Stmts: $6, ReturnType: $4}
+            $$.SetLine($1.Pos.Line)
+            $$.SetLastLine($7.Pos.Line)
         }
 
 parlist:
         T3Dot {
             $$ = &ast.ParList{HasVargs: true, Names: []string{}}
         } | 
-        namelist {
-          $$ = &ast.ParList{HasVargs: false, Names: []string{}}
-          $$.Names = append($$.Names, $1...)
+        typednamelist {
+          $$ = $1
         } | 
-        namelist TComma T3Dot {
-          $$ = &ast.ParList{HasVargs: true, Names: []string{}}
-          $$.Names = append($$.Names, $1...)
+        typednamelist TComma T3Dot {
+          $$ = $1
+          $$.HasVargs = true
         }
 
 
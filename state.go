@@ -2,6 +2,7 @@ package lua
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -10,7 +11,6 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
-	"time"
 
 	"milklua/parse"
 )
@@ -49,6 +49,11 @@ func (e *ApiError) Error() string {
 	return e.Object.String()
 }
 
+// Unwrap returns the underlying error, so errors.Is(err, context.Canceled) works for ApiErrorCancel.
+func (e *ApiError) Unwrap() error {
+	return e.Cause
+}
+
 type ApiErrorType int
 
 const (
@@ -57,8 +62,24 @@ const (
 	ApiErrorRun
 	ApiErrorError
 	ApiErrorPanic
+	// ApiErrorCancel is raised when the context of the LState is canceled or its deadline is exceeded.
+	// The Cause attribute is the context error.
+	ApiErrorCancel
+	// ApiErrorMemory is raised when the memory used by the LState exceeds Options.MemoryLimit.
+	ApiErrorMemory
+	// ApiErrorBudget is raised when Options.InstructionLimit or the budget of CallWithBudget is exhausted.
+	// Scripts can not catch it with pcall.
+	ApiErrorBudget
 )
 
+// ContextErrorPrefix is the prefix of the error message scripts see when the context is done.
+const ContextErrorPrefix = "context error: "
+
+func isCancelError(err error) bool {
+	var apiErr *ApiError
+	return errors.As(err, &apiErr) && apiErr.Type == ApiErrorCancel
+}
+
 /* }}} */
 
 /* ResumeState {{{ */
@@ -105,6 +126,20 @@ type Options struct {
 	// If `MinimizeStackMemory` is set, the call stack will be automatically grown or shrank up to a limit of
 	// `CallStackSize` in order to minimize memory usage. This does incur a slight performance penalty.
 	MinimizeStackMemory bool
+	// Maximum memory in bytes that tables, strings, functions and userdata of this LState (and the threads sharing
+	// its Global) may use. Exceeding the limit raises an error that can be caught with pcall. 0 means no limit.
+	// Allocations are checked before they happen, except for the strings returned by Go functions, which are
+	// only accounted once returned. strlib.Rep, concatenation and file reads check their result size first.
+	MemoryLimit int64
+	// Maximum number of VM instructions the LState may execute. Exceeding the limit raises an ApiErrorBudget error,
+	// which only Go callers can recover from. 0 means no limit. Each thread created by NewThread has its own limit.
+	InstructionLimit int64
+	// If `StrictTypes` is set, a failed type assertion such as `x.(number)` raises an error instead of
+	// yielding nil.
+	StrictTypes bool
+	// If `SkipOptimization` is set, loaded chunks are compiled as written, without folding constants
+	// and removing dead code first.
+	SkipOptimization bool
 }
 
 /* }}} */
@@ -137,6 +172,17 @@ type callFrame struct {
 	NArgs      int
 	NRet       int
 	TailCall   int
+	// the inline caches of Fn, set on first use
+	caches []inlineCache
+	// the calls deferred by the blocks of Fn which are running, the last one is called first
+	defers []deferredCall
+}
+
+type deferredCall struct {
+	// the depth of the block of the defer statement
+	level int
+	fn    LValue
+	args  []LValue
 }
 
 type callFrameStack interface {
@@ -628,6 +674,17 @@ func (rg *registry) SetNumber(regi int, vali LNumber) { // +inline-start
 	}
 } // +inline-end
 
+func (rg *registry) SetInteger(regi int, vali LInteger) {
+	newSize := regi + 1
+	if newSize > cap(rg.array) {
+		rg.resize(newSize)
+	}
+	rg.array[regi] = rg.alloc.LInteger2I(vali)
+	if regi >= rg.top {
+		rg.top = regi + 1
+	}
+}
+
 func (rg *registry) IsFull() bool {
 	return rg.top >= cap(rg.array)
 }
@@ -686,6 +743,11 @@ func newLState(options Options) *LState {
 	}
 	ls.reg = newRegistry(ls, options.RegistrySize, options.RegistryGrowStep, options.RegistryMaxSize, al)
 	ls.Env = ls.G.Global
+	ls.G.memLimit.Store(options.MemoryLimit)
+	ls.G.memCheck.Store(options.MemoryLimit)
+	if options.InstructionLimit > 0 {
+		ls.setBudget(newExecBudget(options.InstructionLimit, 0, nil))
+	}
 	return ls
 }
 
@@ -718,9 +780,6 @@ func (ls *LState) closeAllUpvalues() { // +inline-start
 } // +inline-end
 
 func (ls *LState) raiseError(level int, format string, args ...interface{}) {
-	if !ls.hasErrorFunc {
-		ls.closeAllUpvalues()
-	}
 	message := format
 	if len(args) > 0 {
 		message = fmt.Sprintf(format, args...)
@@ -930,6 +989,43 @@ func (ls *LState) closeUpvalues(idx int) { // +inline-start
 	}
 } // +inline-end
 
+// runDefers calls the functions deferred by the blocks of cf at depth level or deeper.
+// An error raised by a deferred function leaves the remaining ones to the PCall recovering from it.
+func (ls *LState) runDefers(cf *callFrame, level int) {
+	if len(cf.defers) == 0 {
+		return
+	}
+	top := ls.reg.Top()
+	// the registers of the function may be above the top, the deferred functions must not overwrite them
+	if used := cf.LocalBase + int(cf.Fn.Proto.NumUsedRegisters); used > top {
+		ls.reg.top = used
+	}
+	for n := len(cf.defers); n > 0 && cf.defers[n-1].level >= level; n = len(cf.defers) {
+		dc := cf.defers[n-1]
+		cf.defers = cf.defers[:n-1]
+		ls.Push(dc.fn)
+		for _, arg := range dc.args {
+			ls.Push(arg)
+		}
+		ls.Call(len(dc.args), 0)
+	}
+	ls.reg.SetTop(top)
+}
+
+// pendingDefers removes the deferred calls of the frames above sp from them and returns them
+// in the order they should be called.
+func (ls *LState) pendingDefers(sp int) []deferredCall {
+	var pending []deferredCall
+	for i := ls.stack.Sp() - 1; i >= sp; i-- {
+		cf := ls.stack.At(i)
+		for j := len(cf.defers) - 1; j >= 0; j-- {
+			pending = append(pending, cf.defers[j])
+		}
+		cf.defers = nil
+	}
+	return pending
+}
+
 func (ls *LState) findUpvalue(idx int) *Upvalue {
 	var prev *Upvalue
 	var next *Upvalue
@@ -1096,11 +1192,12 @@ func (ls *LState) initCallFrame(cf *callFrame) { // +inline-start
 			if CompatVarArg {
 				ls.reg.SetTop(cf.LocalBase + nargs + np + 1)
 				if (proto.IsVarArg & VarArgNeedsArg) != 0 {
+					ls.allocMemory(tableMemSize(nvarargs, 1))
 					argtb := newLTable(nvarargs, 0)
 					for i := 0; i < nvarargs; i++ {
 						argtb.RawSetInt(i+1, ls.reg.Get(cf.LocalBase+np+i))
 					}
-					argtb.RawSetString("n", LNumber(nvarargs))
+					argtb.RawSetString("n", LInteger(nvarargs))
 					//ls.reg.Set(cf.LocalBase+nargs+np, argtb)
 					ls.reg.array[cf.LocalBase+nargs+np] = argtb
 				} else {
@@ -1208,11 +1305,12 @@ func (ls *LState) pushCallFrame(cf callFrame, fn LValue, meta bool) { // +inline
 				if CompatVarArg {
 					ls.reg.SetTop(cf.LocalBase + nargs + np + 1)
 					if (proto.IsVarArg & VarArgNeedsArg) != 0 {
+						ls.allocMemory(tableMemSize(nvarargs, 1))
 						argtb := newLTable(nvarargs, 0)
 						for i := 0; i < nvarargs; i++ {
 							argtb.RawSetInt(i+1, ls.reg.Get(cf.LocalBase+np+i))
 						}
-						argtb.RawSetString("n", LNumber(nvarargs))
+						argtb.RawSetString("n", LInteger(nvarargs))
 						//ls.reg.Set(cf.LocalBase+nargs+np, argtb)
 						ls.reg.array[cf.LocalBase+nargs+np] = argtb
 					} else {
@@ -1325,6 +1423,7 @@ func (ls *LState) setField(obj LValue, key LValue, value LValue) {
 	for i := 0; i < MaxTableGetLoop; i++ {
 		tb, istable := curobj.(*LTable)
 		if istable {
+			ls.checkWritable(tb)
 			if tb.RawGet(key) != LNil {
 				ls.RawSet(tb, key, value)
 				return
@@ -1335,6 +1434,9 @@ func (ls *LState) setField(obj LValue, key LValue, value LValue) {
 			if !istable {
 				ls.RaiseError("attempt to index a non-table object(%v) with key '%s'", curobj.Type().String(), key.String())
 			}
+			if value != LNil {
+				ls.allocMemory(memTableEntrySize)
+			}
 			ls.RawSet(tb, key, value)
 			return
 		}
@@ -1357,6 +1459,7 @@ func (ls *LState) setFieldString(obj LValue, key string, value LValue) {
 	for i := 0; i < MaxTableGetLoop; i++ {
 		tb, istable := curobj.(*LTable)
 		if istable {
+			ls.checkWritable(tb)
 			if tb.RawGetString(key) != LNil {
 				tb.RawSetString(key, value)
 				return
@@ -1367,6 +1470,9 @@ func (ls *LState) setFieldString(obj LValue, key string, value LValue) {
 			if !istable {
 				ls.RaiseError("attempt to index a non-table object(%v) with key '%s'", curobj.Type().String(), key)
 			}
+			if value != LNil {
+				ls.allocMemory(memTableEntrySize)
+			}
 			tb.RawSetString(key, value)
 			return
 		}
@@ -1384,6 +1490,110 @@ func (ls *LState) setFieldString(obj LValue, key string, value LValue) {
 	ls.RaiseError("too many recursions in settable")
 }
 
+func (ls *LState) checkWritable(tb *LTable) {
+	if tb.frozen {
+		ls.RaiseError("attempt to modify a frozen table")
+	}
+}
+
+/* inline caches {{{ */
+
+// maxCachedProtos limits the number of functions an LState keeps inline caches for.
+const maxCachedProtos = 1024
+
+// inlineCache remembers the value a string-key table access of an instruction found, so that
+// the next access of the same table, or of a table with the same metatable, can skip the map
+// lookups. An entry is valid as long as the versions of the tables it depends on are unchanged.
+type inlineCache struct {
+	table   *LTable
+	version uint64
+	value   LValue
+	// if the value was found in the __index table of the metatable of table,
+	// meta is the metatable and holder is the __index table
+	meta          *LTable
+	metaVersion   uint64
+	holder        *LTable
+	holderVersion uint64
+}
+
+// inlineCache returns the inline cache of the instruction being executed in cf.
+// The caches belong to the LState, as a function may run in several goroutines.
+func (ls *LState) inlineCache(cf *callFrame) *inlineCache {
+	if cf.caches == nil {
+		proto := cf.Fn.Proto
+		caches, ok := ls.icaches[proto]
+		if !ok {
+			if ls.icaches == nil || len(ls.icaches) >= maxCachedProtos {
+				ls.icaches = make(map[*FunctionProto][]inlineCache)
+			}
+			caches = make([]inlineCache, proto.numCaches)
+			ls.icaches[proto] = caches
+		}
+		cf.caches = caches
+	}
+	return &cf.caches[cf.Fn.Proto.cacheSlots[cf.Pc-1]]
+}
+
+// getFieldStringCached is getFieldString with an inline cache.
+func (ls *LState) getFieldStringCached(obj LValue, key string, ic *inlineCache) LValue {
+	tb, ok := obj.(*LTable)
+	if !ok {
+		return ls.getFieldString(obj, key)
+	}
+	if tb == ic.table && tb.version == ic.version {
+		if ic.holder == nil {
+			return ic.value
+		}
+	} else if v := tb.RawGetString(key); v != LNil {
+		*ic = inlineCache{table: tb, version: tb.version, value: v}
+		return v
+	}
+	// tb does not have the key, look it up in the __index table of its metatable
+	mt, ok := tb.Metatable.(*LTable)
+	if !ok {
+		return ls.getFieldString(obj, key)
+	}
+	if mt == ic.meta && mt.version == ic.metaVersion && ic.holder.version == ic.holderVersion {
+		ic.table, ic.version = tb, tb.version
+		return ic.value
+	}
+	if holder, ok := mt.RawGetString("__index").(*LTable); ok {
+		if v := holder.RawGetString(key); v != LNil {
+			*ic = inlineCache{table: tb, version: tb.version, value: v,
+				meta: mt, metaVersion: mt.version, holder: holder, holderVersion: holder.version}
+			return v
+		}
+	}
+	return ls.getFieldString(obj, key)
+}
+
+// setFieldStringCached is setFieldString with an inline cache.
+func (ls *LState) setFieldStringCached(obj LValue, key string, value LValue, ic *inlineCache) {
+	tb, ok := obj.(*LTable)
+	if !ok || value == LNil || tb.frozen {
+		ls.setFieldString(obj, key, value)
+		return
+	}
+	if tb == ic.table && tb.version == ic.version && ic.holder == nil {
+		// tb has the key, so __newindex is not called
+		tb.strdict[key] = value
+		tb.version++
+		ic.version, ic.value = tb.version, value
+		return
+	}
+	if tb.RawGetString(key) == LNil {
+		if tb.Metatable != LNil {
+			ls.setFieldString(obj, key, value)
+			return
+		}
+		ls.allocMemory(memTableEntrySize)
+	}
+	tb.RawSetString(key, value)
+	*ic = inlineCache{table: tb, version: tb.version, value: value}
+}
+
+/* }}} */
+
 /* }}} */
 
 /* api methods {{{ */
@@ -1434,6 +1644,7 @@ func (ls *LState) IsClosed() bool {
 }
 
 func (ls *LState) Close() {
+	ls.runFinalizers()
 	atomic.AddInt32(&ls.stop, 1)
 	for _, file := range ls.G.tempFiles {
 		// ignore errors in these operations
@@ -1596,10 +1807,12 @@ func (ls *LState) Remove(index int) {
 /* object allocation {{{ */
 
 func (ls *LState) NewTable() *LTable {
+	ls.allocMemory(tableMemSize(defaultArrayCap, defaultHashCap))
 	return newLTable(defaultArrayCap, defaultHashCap)
 }
 
 func (ls *LState) CreateTable(acap, hcap int) *LTable {
+	ls.allocMemory(tableMemSize(acap, hcap))
 	return newLTable(acap, hcap)
 }
 
@@ -1608,23 +1821,27 @@ func (ls *LState) CreateTable(acap, hcap int) *LTable {
 // the new state has a new child context of the original state
 // and this function returns its cancel function.
 func (ls *LState) NewThread() (*LState, context.CancelFunc) {
+	ls.allocMemory(memThreadSize)
 	thread := newLState(ls.Options)
 	thread.G = ls.G
 	thread.Env = ls.Env
 	var f context.CancelFunc = nil
 	if ls.ctx != nil {
-		thread.mainLoop = mainLoopWithContext
 		thread.ctx, f = context.WithCancel(ls.ctx)
 		thread.ctxCancelFn = f
+		thread.updateMainLoop()
 	}
+	ls.inheritHook(thread)
 	return thread, f
 }
 
 func (ls *LState) NewFunctionFromProto(proto *FunctionProto) *LFunction {
+	ls.allocMemory(functionMemSize(int(proto.NumUpvalues)))
 	return newLFunctionL(proto, ls.Env, int(proto.NumUpvalues))
 }
 
 func (ls *LState) NewUserData() *LUserData {
+	ls.allocMemory(memUserDataSize)
 	return &LUserData{
 		Env:       ls.currentEnv(),
 		Metatable: LNil,
@@ -1654,6 +1871,9 @@ func (ls *LState) ToBool(n int) bool {
 }
 
 func (ls *LState) ToInt(n int) int {
+	if lv, ok := ls.Get(n).(LInteger); ok {
+		return int(lv)
+	}
 	if lv, ok := ls.Get(n).(LNumber); ok {
 		return int(lv)
 	}
@@ -1666,12 +1886,18 @@ func (ls *LState) ToInt(n int) int {
 }
 
 func (ls *LState) ToInt64(n int) int64 {
+	if lv, ok := ls.Get(n).(LInteger); ok {
+		return int64(lv)
+	}
 	if lv, ok := ls.Get(n).(LNumber); ok {
 		return int64(lv)
 	}
 	if lv, ok := ls.Get(n).(LString); ok {
-		if num, err := parseNumber(string(lv)); err == nil {
-			return int64(num)
+		if num, err := parseNumberValue(string(lv)); err == nil {
+			if iv, ok := num.(LInteger); ok {
+				return int64(iv)
+			}
+			return int64(num.(LNumber))
 		}
 	}
 	return 0
@@ -1726,14 +1952,48 @@ func (ls *LState) RaiseError(format string, args ...interface{}) {
 	ls.raiseError(1, format, args...)
 }
 
+// raiseContextError raises an ApiErrorCancel error for the done context of this LState.
+// The error object is a string starting with ContextErrorPrefix and has no position information.
+func (ls *LState) raiseContextError() {
+	cause := ls.ctx.Err()
+	if cause == nil {
+		cause = context.Canceled
+	}
+	err := &ApiError{ApiErrorCancel, LString(ContextErrorPrefix + cause.Error()), "", cause}
+	err.StackTrace = ls.stackTrace(0)
+	panic(err)
+}
+
+// CheckContext raises an ApiErrorCancel error if the context of this LState is done.
+// Blocking Go functions should call this after they are interrupted by the context.
+func (ls *LState) CheckContext() {
+	if ls.ctx != nil && ls.ctx.Err() != nil {
+		ls.raiseContextError()
+	}
+}
+
+// ContextDone returns the Done channel of the context, or nil if this LState has no context.
+// Receiving from a nil channel blocks forever, so the result can be used in a select directly.
+func (ls *LState) ContextDone() <-chan struct{} {
+	if ls.ctx == nil {
+		return nil
+	}
+	return ls.ctx.Done()
+}
+
+// contextOrBackground returns the context of this LState, or context.Background() if there is none.
+func (ls *LState) contextOrBackground() context.Context {
+	if ls.ctx == nil {
+		return context.Background()
+	}
+	return ls.ctx
+}
+
 // This function is equivalent to lua_error( http://www.lua.org/manual/5.1/manual.html#lua_error ).
 func (ls *LState) Error(lv LValue, level int) {
 	if str, ok := lv.(LString); ok {
 		ls.raiseError(level, "%s", string(str))
 	} else {
-		if !ls.hasErrorFunc {
-			ls.closeAllUpvalues()
-		}
 		ls.Push(lv)
 		ls.Panic(ls)
 	}
@@ -1914,10 +2174,12 @@ func (ls *LState) RawSet(tb *LTable, key LValue, value LValue) {
 	} else if key == LNil {
 		ls.RaiseError("table index is nil")
 	}
+	ls.checkWritable(tb)
 	tb.RawSet(key, value)
 }
 
 func (ls *LState) RawSetInt(tb *LTable, key int, value LValue) {
+	ls.checkWritable(tb)
 	tb.RawSetInt(key, value)
 }
 
@@ -1960,7 +2222,7 @@ func (ls *LState) ObjLen(v1 LValue) int {
 		ls.Call(1, 1)
 		ret := ls.reg.Pop()
 		if ret.Type() == LTNumber {
-			return int(ret.(LNumber))
+			return int(LVAsNumber(ret))
 		}
 	} else if v1.Type() == LTTable {
 		return v1.(*LTable).Len()
@@ -2011,6 +2273,9 @@ func (ls *LState) Load(reader io.Reader, name string) (*LFunction, error) {
 	if err != nil {
 		return nil, newApiErrorE(ApiErrorSyntax, err)
 	}
+	if !ls.Options.SkipOptimization {
+		chunk = Optimize(chunk)
+	}
 	proto, err := Compile(chunk, name)
 	if err != nil {
 		return nil, newApiErrorE(ApiErrorSyntax, err)
@@ -2066,8 +2331,8 @@ func (ls *LState) PCall(nargs, nret int, errfunc *LFunction) (err error) {
 				apiErr = errApi
 			}
 
-			// if there is an error function, call it
-			if errfunc != nil {
+			// if there is an error function, call it. Budget errors can not be handled by Lua code
+			if errfunc != nil && apiErr.Type != ApiErrorBudget {
 				ls.Push(errfunc)
 				ls.Push(apiErr.Object)
 				ls.Panic = panicWithoutTraceback
@@ -2088,11 +2353,31 @@ func (ls *LState) PCall(nargs, nret int, errfunc *LFunction) (err error) {
 					}
 				}()
 				ls.Call(1, 1)
-				apiErr = newApiError(ApiErrorError, ls.Get(-1))
+				if apiErr.Type == ApiErrorCancel || apiErr.Type == ApiErrorMemory {
+					apiErr = &ApiError{apiErr.Type, ls.Get(-1), "", apiErr.Cause}
+				} else {
+					apiErr = newApiError(ApiErrorError, ls.Get(-1))
+				}
 			} else if len(apiErr.StackTrace) == 0 {
 				apiErr.StackTrace = ls.stackTrace(0)
 			}
+			pending := ls.pendingDefers(sp)
+			// only the upvalues of the frames being unwound are closed, the deferred functions
+			// and the caller may still change the locals of the others
+			ls.closeUpvalues(base)
 			resetState()
+			for _, dc := range pending {
+				ls.Push(dc.fn)
+				for _, arg := range dc.args {
+					ls.Push(arg)
+				}
+				// like in Go, an error raised by a deferred function replaces the one being handled,
+				// unless the script must stop
+				if derr := ls.PCall(len(dc.args), 0, nil); derr != nil &&
+					apiErr.Type != ApiErrorBudget && apiErr.Type != ApiErrorCancel && apiErr.Type != ApiErrorMemory {
+					apiErr = derr.(*ApiError)
+				}
+			}
 			err = apiErr
 		}
 
@@ -2142,9 +2427,14 @@ func (ls *LState) SetMetatable(obj LValue, mt LValue) {
 
 	switch v := obj.(type) {
 	case *LTable:
+		ls.checkWritable(v)
 		v.Metatable = mt
 	case *LUserData:
 		v.Metatable = mt
+		if hasFinalizer(mt) {
+			v.finalized = false
+			ls.registerFinalizer(v)
+		}
 	default:
 		ls.G.builtinMts[int(obj.Type())] = mt
 	}
@@ -2190,6 +2480,9 @@ func (ls *LState) Resume(th *LState, fn *LFunction, args ...LValue) (ResumeState
 		return ResumeError, newApiErrorS(ApiErrorRun, "can not resume a dead thread"), nil
 	}
 	th.Parent = ls
+	if th.budget != ls.budget {
+		th.setBudget(ls.budget)
+	}
 	ls.G.CurrentThread = th
 	if !isstarted {
 		cf := th.stack.Last()
@@ -2250,29 +2543,19 @@ func (ls *LState) XMoveTo(other *LState, n int) {
 
 /* GopherLua original APIs {{{ */
 
-// Set maximum memory size. This function can only be called from the main thread.
+// Set maximum memory size in MB. This function can only be called from the main thread.
+// It is a shorthand for SetMemoryLimit.
 func (ls *LState) SetMx(mx int) {
 	if ls.Parent != nil {
 		ls.RaiseError("sub threads are not allowed to set a memory limit")
 	}
-	go func() {
-		limit := uint64(mx * 1024 * 1024) //MB
-		var s runtime.MemStats
-		for atomic.LoadInt32(&ls.stop) == 0 {
-			runtime.ReadMemStats(&s)
-			if s.Alloc >= limit {
-				fmt.Println("out of memory")
-				os.Exit(3)
-			}
-			time.Sleep(10 * time.Millisecond)
-		}
-	}()
+	ls.SetMemoryLimit(int64(mx) * 1024 * 1024)
 }
 
 // SetContext set a context ctx to this LState. The provided ctx must be non-nil.
 func (ls *LState) SetContext(ctx context.Context) {
-	ls.mainLoop = mainLoopWithContext
 	ls.ctx = ctx
+	ls.updateMainLoop()
 }
 
 // Context returns the LState's context. To change the context, use WithContext.
@@ -2283,8 +2566,8 @@ func (ls *LState) Context() context.Context {
 // RemoveContext removes the context associated with this LState and returns this context.
 func (ls *LState) RemoveContext() context.Context {
 	oldctx := ls.ctx
-	ls.mainLoop = mainLoop
 	ls.ctx = nil
+	ls.updateMainLoop()
 	return oldctx
 }
 
@@ -0,0 +1,709 @@
+package lua
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestContextCancelsBlockingCalls(t *testing.T) {
+	scripts := map[string]string{
+		"sleep":   `timelib.Sleep(10)`,
+		"receive": `local ch = chnlib.Make() ch:Receive()`,
+		"send":    `local ch = chnlib.Make() ch:Send(1)`,
+		"select":  `local ch = chnlib.Make() chnlib.Select({"|<-", ch})`,
+		"http": `
+			local srv = httplib.NewServer("127.0.0.1:0")
+			srv:Handle("/", func(req) { timelib.Sleep(10) })
+			httplib.Get("http://" .. srv:Start() .. "/")`,
+	}
+	for name, script := range scripts {
+		t.Run(name, func(t *testing.T) {
+			L := NewState()
+			defer L.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			L.SetContext(ctx)
+
+			start := time.Now()
+			err := L.DoString(script)
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Fatalf("script was not interrupted promptly: %v", elapsed)
+			}
+			var apiErr *ApiError
+			if !errors.As(err, &apiErr) || apiErr.Type != ApiErrorCancel {
+				t.Fatalf("expected ApiErrorCancel, got %#v", err)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected errors.Is(err, context.DeadlineExceeded): %v", err)
+			}
+		})
+	}
+}
+
+func TestContextErrorVisibleToScripts(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	L.SetContext(ctx)
+	L.SetGlobal("cancel", L.NewFunction(func(L *LState) int {
+		cancel()
+		return 0
+	}))
+
+	err := L.DoString(`
+		local ok, err = PCall(func() {
+			cancel()
+			timelib.Sleep(10)
+		})
+	`)
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) || apiErr.Type != ApiErrorCancel {
+		t.Fatalf("expected ApiErrorCancel after pcall, got %#v", err)
+	}
+	if !strings.HasPrefix(apiErr.Object.String(), ContextErrorPrefix) {
+		t.Errorf("unexpected error object: %q", apiErr.Object.String())
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	L := NewState(Options{MemoryLimit: 4 << 20})
+	defer L.Close()
+	path := filepath.Join(t.TempDir(), "big.txt")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 5<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	L.SetGlobal("path", LString(path))
+
+	err := L.DoString(`
+		local ok, err = PCall(func() {
+			local t = {}
+			for i = 1, 1000000 {
+				t[i] = {i}
+			}
+		})
+		Assert(not ok)
+		Assert(strlib.Find(err, "memory limit exceeded", 1, true))
+		local parts = {}
+		ok, err = PCall(func() {
+			for i = 1, 1000 {
+				parts[i] = strlib.Rep("0123456789", 10000) .. i
+			}
+		})
+		Assert(not ok)
+		Assert(strlib.Find(err, "memory limit exceeded", 1, true))
+		parts = nil
+		big = {}
+		for i = 1, 1000 {
+			big[i] = {i}
+		}
+		// a string returned by a Go function is only counted once
+		local s = strlib.Rep("x", 3 << 20)
+		Assert(#s == 3 << 20)
+		s = nil
+		// results too large for the limit are not built at all
+		ok, err = PCall(strlib.Rep, "x", 1 << 40)
+		Assert(not ok and strlib.Find(err, "memory limit exceeded", 1, true))
+		local f = iolib.Open(path, "r")
+		ok, err = PCall(f.Read, f, 1 << 40)
+		Assert(not ok and strlib.Find(err, "memory limit exceeded", 1, true))
+		ok, err = PCall(f.Read, f, "*a")
+		Assert(not ok and strlib.Find(err, "memory limit exceeded", 1, true))
+		f:Close()
+	`)
+	if err != nil {
+		t.Fatalf("memory errors must be catchable and recoverable: %v", err)
+	}
+
+	err = L.DoString(`
+		local t = {}
+		while true {
+			t[#t + 1] = "x" .. #t
+		}
+	`)
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) || apiErr.Type != ApiErrorMemory {
+		t.Fatalf("expected ApiErrorMemory, got %#v", err)
+	}
+	if !strings.HasPrefix(apiErr.Object.String(), MemoryErrorPrefix) {
+		t.Errorf("unexpected error object: %q", apiErr.Object.String())
+	}
+	if L.MemoryUsage() <= 0 {
+		t.Errorf("memory usage must be accounted, got %d", L.MemoryUsage())
+	}
+}
+
+func TestInstructionLimit(t *testing.T) {
+	L := NewState(Options{InstructionLimit: 10000})
+	defer L.Close()
+
+	err := L.DoString(`
+		local ok = PCall(func() {
+			while true { }
+		})
+		caught = true
+	`)
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) || apiErr.Type != ApiErrorBudget {
+		t.Fatalf("expected ApiErrorBudget, got %#v", err)
+	}
+	if !strings.HasPrefix(apiErr.Object.String(), BudgetErrorPrefix) {
+		t.Errorf("unexpected error object: %q", apiErr.Object.String())
+	}
+	if L.GetGlobal("caught") != LNil {
+		t.Error("script must not recover from a budget error")
+	}
+}
+
+func TestCallWithBudget(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		func spin(n) {
+			local i = 0
+			while n == nil or i < n { i = i + 1 }
+			return i
+		}
+		func spinInCoroutine() {
+			local co = coroutlib.Create(func() { spin() })
+			local ok = coroutlib.Resume(co)
+			return "recovered"
+		}
+		func spinXPCall() {
+			XpCall(spin, func(err) { return err })
+			return "recovered"
+		}
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	L.Push(LNumber(100))
+	if err := L.CallWithBudget(L.GetGlobal("spin"), 1, 1, 100000, 0); err != nil {
+		t.Fatalf("call within budget failed: %v", err)
+	}
+	if ret := L.Get(-1); ret != LInteger(100) {
+		t.Errorf("unexpected result: %v", ret)
+	}
+	L.Pop(1)
+
+	for _, name := range []string{"spin", "spinInCoroutine", "spinXPCall"} {
+		for _, limits := range []struct {
+			steps   int64
+			timeout time.Duration
+		}{{100000, 0}, {0, 50 * time.Millisecond}} {
+			err := L.CallWithBudget(L.GetGlobal(name), 0, 1, limits.steps, limits.timeout)
+			if !isBudgetError(err) {
+				t.Fatalf("%s: expected budget error, got %v", name, err)
+			}
+			if L.GetTop() != 0 {
+				t.Fatalf("%s: stack not restored, top is %d", name, L.GetTop())
+			}
+		}
+	}
+
+	// the state is usable again after the budget is exhausted
+	L.Push(LNumber(10))
+	if err := L.CallWithBudget(L.GetGlobal("spin"), 1, 1, 1000, time.Second); err != nil {
+		t.Fatalf("call after exhausted budget failed: %v", err)
+	}
+	L.Pop(1)
+	if L.InstructionCount() != 0 {
+		t.Errorf("budget must be removed after the call")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+
+	var events []string
+	L.SetHook(func(L *LState, ev HookEvent) {
+		events = append(events, fmt.Sprintf("%v:%d", ev.Type, ev.Line))
+	}, HookMaskCall|HookMaskReturn|HookMaskLine, 0)
+	err := L.DoString(`local func add(a, b) {
+		return a + b
+	}
+	local x = add(1, 2)
+	Type(x)`)
+	L.SetHook(nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"call:1", "line:1", "line:4",
+		"call:2", "line:2", "return:2",
+		"line:5", "call:-1", "return:-1", "line:6", "return:6",
+	}
+	if strings.Join(events, " ") != strings.Join(expected, " ") {
+		t.Errorf("unexpected events:\n got: %v\nwant: %v", events, expected)
+	}
+
+	count := 0
+	L.SetHook(func(L *LState, ev HookEvent) {
+		if ev.Type != HookCount {
+			t.Errorf("unexpected event %v", ev.Type)
+		}
+		count++
+	}, 0, 10)
+	if err := L.DoString(`for i = 1, 100 { }`); err != nil {
+		t.Fatal(err)
+	}
+	L.SetHook(nil, 0, 0)
+	if count < 10 {
+		t.Errorf("count hook called %d times", count)
+	}
+}
+
+func TestDbglibSetHook(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	err := L.DoString(`
+		local lines = {}
+		local calls = 0
+		func work() {
+			local s = 0
+			for i = 1, 3 {
+				s = s + i
+			}
+			return s
+		}
+		dbglib.SetHook(func(event, line) {
+			if event == "line" {
+				lines[#lines + 1] = line
+			} elseif event == "call" {
+				calls = calls + 1
+			}
+		}, "cl")
+		local fn, mask, count = dbglib.GetHook()
+		work()
+		dbglib.SetHook()
+		Assert(mask == "cl" and count == 0)
+		Assert(dbglib.GetHook() == nil)
+		Assert(calls >= 2)
+		local loops = 0
+		for _, line in IPairs(lines) {
+			if line == 7 { loops = loops + 1 }
+		}
+		Assert(loops == 3, "line 7 executed " .. loops .. " times")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	err := L.DoString(`
+		local name, items = "milk", {1, 2, 3}
+		local t = SetMetatable({}, {__tostring = func() { return "T" }})
+		Assert(` + "`Hello ${name}, you have ${#items} items`" + ` == "Hello milk, you have 3 items")
+		Assert(` + "`${t}|${nil}|${items[2] * 1.5}|${ ({x = \"}\"}).x }`" + ` == "T|nil|3|}")
+		Assert("<" .. ` + "`${name}`" + ` .. ` + "`a${1}b`" + ` .. ">" == "<milka1b>")
+		Assert(` + "`\\${name}`" + ` == "${name}")
+		Assert("a" .. name .. "=" .. ` + "`${#items};`" + ` == "amilk=3;")
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFrozenTables(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ch := make(chan LValue, 1)
+	L.SetGlobal("ch", LChannel(ch))
+	if err := L.DoString(`
+		local src = {name = "cfg", hosts = {"a", "b"}, [1] = 10}
+		src.self = src
+		cfg = tbllib.Freeze(src)
+		Assert(tbllib.IsFrozen(cfg) and tbllib.IsFrozen(cfg.hosts) and not tbllib.IsFrozen(src))
+		Assert(cfg.self == cfg and cfg.hosts[2] == "b" and cfg[1] == 10)
+		Assert(tbllib.Freeze(cfg) == cfg)
+		src.name = "changed"
+		Assert(cfg.name == "cfg")
+		ch:Send(cfg)
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []string{
+		`cfg.name = "x"`,
+		`cfg.hosts[3] = "c"`,
+		`cfg.missing = 1`,
+		`RawSet(cfg, "name", "x")`,
+		`tbllib.Insert(cfg.hosts, "c")`,
+		`tbllib.Sort(cfg.hosts)`,
+		`SetMetatable(cfg, {})`,
+		`local func set(t) { t.name = "x" } set({name = 1}) set(cfg)`,
+		`tbllib.Freeze({f = func() { }})`,
+		`tbllib.Freeze(SetMetatable({}, {}))`,
+	} {
+		if err := L.DoString(src); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+
+	cfg := <-ch
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			co := NewState()
+			defer co.Close()
+			co.SetGlobal("cfg", cfg)
+			errs <- co.DoString(`
+				for i = 1, 1000 {
+					local n = 0
+					for _, h in IPairs(cfg.hosts) { n = n + #h }
+					Assert(cfg.name == "cfg" and n == 2)
+				}
+			`)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDeferStatement(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local log = {}
+		local func add(s) { log[#log + 1] = s }
+		local func take() {
+			local s = tbllib.Concat(log, ",")
+			log = {}
+			return s
+		}
+
+		local func f(n) {
+			defer add("f1")
+			defer add("f2:" .. n)
+			n = n + 1
+			{
+				defer add("inner")
+				add("body")
+			}
+			return n * 2
+		}
+		Assert(f(1) == 4)
+		Assert(take() == "body,inner,f2:1,f1")
+
+		for i = 1, 3 {
+			defer add("it" .. i)
+			if i == 2 { break }
+			add("b" .. i)
+		}
+		Assert(take() == "b1,it1,it2")
+
+		local func jump() {
+			{
+				defer add("a")
+				{
+					defer add("b")
+					goto out
+				}
+			}
+			::out::
+			add("c")
+		}
+		jump()
+		Assert(take() == "b,a,c")
+
+		local obj = {name = "obj"}
+		func obj:Close() { add("closed " .. self.name) }
+		{
+			defer obj:Close()
+			add("use")
+		}
+		Assert(take() == "use,closed obj")
+
+		local closed = false
+		local ok, err = PCall(func() {
+			defer func() { closed = true }()
+			defer add("second")
+			Error("boom")
+		})
+		Assert(not ok and err:Find("boom") and closed)
+		Assert(take() == "second")
+
+		// an error raised by a deferred call replaces the one being handled
+		ok, err = PCall(func() {
+			defer Error("deferred")
+			defer add("still called")
+			Error("original")
+		})
+		Assert(not ok and err:Find("deferred") and not err:Find("original"))
+		Assert(take() == "still called")
+
+		// an error ending a coroutine runs the calls deferred in its frames, even across yields
+		local co = coroutlib.Create(func() {
+			defer add("outer")
+			local func g() {
+				defer add("g")
+				coroutlib.Yield()
+				Error("in coroutine")
+			}
+			g()
+		})
+		Assert(coroutlib.Resume(co) and take() == "")
+		ok, err = coroutlib.Resume(co)
+		Assert(not ok and err:Find("in coroutine") and coroutlib.Status(co) == "dead")
+		Assert(take() == "g,outer")
+		ok, err = coroutlib.Resume(coroutlib.Create(func() { defer Error("deferred") Error("original") }))
+		Assert(not ok and err:Find("deferred"))
+		ok, err = PCall(coroutlib.Wrap(func() { defer add("wrapped") Error("e") }))
+		Assert(not ok and take() == "wrapped")
+	`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContinueAndIfThru(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local log = {}
+		local func add(s) { log[#log + 1] = s }
+		local func take() {
+			local s = tbllib.Concat(log, ",")
+			log = {}
+			return s
+		}
+
+		for i = 1, 6 { if i % 2 == 0 { continue } add(i) }
+		for _, v in IPairs({1, 2, 3}) { if v == 2 { continue } add("g" .. v) }
+		local n = 0
+		while n < 5 { n = n + 1 if n == 3 { continue } add("w" .. n) } ifthru { add("done") }
+		Assert(take() == "1,3,5,g1,g3,w1,w2,w4,w5,done")
+
+		// continue evaluates the condition of repeat loops
+		local m = 0
+		repeat { m = m + 1 if m == 2 { continue } add("r" .. m) } until m >= 3 ifthru { add("done") }
+		while true { break } ifthru { add("skipped") }
+		repeat { break } until true ifthru { add("skipped") }
+		Assert(take() == "r1,r3,done")
+
+		// the locals of each iteration are captured separately, also when the loop is continued or left
+		// from a nested block
+		local fns = {}
+		for i = 1, 3 {
+			local x = i * 10
+			fns[i] = func() { return x }
+			if i == 2 { continue }
+			x = x + 1
+		}
+		Assert(fns[1]() == 11 and fns[2]() == 20 and fns[3]() == 31)
+		local j = 0
+		while j < 3 {
+			j = j + 1
+			{
+				local y = j
+				fns[j] = func() { return y }
+				if j == 2 { break }
+				continue
+			}
+		}
+		Assert(fns[1]() == 1 and fns[2]() == 2)
+
+		// deferred calls run when the iteration is continued, and continue in an ifthru block
+		// continues the enclosing loop
+		for i = 1, 2 {
+			defer add("d" .. i)
+			{
+				defer add("in" .. i)
+				if i == 1 { continue }
+			}
+			add(i)
+		}
+		for i = 1, 2 { while false { } ifthru { if i == 1 { continue } add("t" .. i) } }
+		Assert(take() == "in1,d1,in2,2,d2,t2")
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	for src, msg := range map[string]string{
+		`continue`: "no loop to continue",
+		`repeat { if x { continue } local y = 1 } until y`: "<continue> at line 1 jumps into the scope of local 'y'",
+	} {
+		if err := L.DoString(src); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected an error containing %q, got %v", src, msg, err)
+		}
+	}
+}
+
+func TestSwitchStatement(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local func kind(v) {
+			switch v {
+				case 1, 2 { return "small" }
+				case 3, 4, 5, 6 { return "medium" }
+				case "x", "y" { return "letter" }
+				case false { return "false" }
+				case number { return "number" }
+				case table, function { return "object" }
+				default { return "other" }
+			}
+		}
+		Assert(kind(1) == "small" and kind(2.0) == "small" and kind(5) == "medium")
+		Assert(kind("y") == "letter" and kind(false) == "false" and kind(7.5) == "number")
+		Assert(kind({}) == "object" and kind(kind) == "object")
+		Assert(kind(nil) == "other" and kind(true) == "other" and kind("1") == "other")
+
+		// sparse keys and keys after a type case
+		local func sparse(v) {
+			local r = "none"
+			switch v {
+				case -1000 { r = "low" }
+				case 1 << 40 { r = "high" }
+				case string { r = "string" }
+				case "shadowed" { r = "never" }
+			}
+			return r
+		}
+		Assert(sparse(-1000) == "low" and sparse(1099511627776.0) == "high")
+		Assert(sparse("shadowed") == "string" and sparse(0) == "none")
+
+		// other cases are compared in order and the value is evaluated once
+		local calls, limit = 0, 10
+		local func get(v) {
+			calls = calls + 1
+			return v
+		}
+		local func dynamic(v) {
+			switch get(v) {
+				case 1 { return "one" }
+				case limit, limit + 1 { return "limit" }
+				case 12 { return "twelve" }
+			}
+			return "none"
+		}
+		Assert(dynamic(1) == "one" and dynamic(11) == "limit" and dynamic(12) == "twelve" and dynamic(2) == "none")
+		Assert(calls == 4)
+
+		// break leaves the enclosing loop, and each case has its own scope
+		local fns, seen = {}, {}
+		local func add(v) { seen[#seen + 1] = v }
+		for i = 1, 5 {
+			switch i % 3 {
+				case 0 {
+					local n = i
+					fns[#fns + 1] = func() { return n }
+				}
+				case 1 {
+					defer add("d" .. i)
+					add(i)
+				}
+				default {
+					if i == 5 { break }
+				}
+			}
+		}
+		Assert(#fns == 1 and fns[1]() == 3 and tbllib.Concat(seen, ",") == "1,d1,4,d4")
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	for src, msg := range map[string]string{
+		`switch x { case 1 { } case 1.0 { } }`:            "duplicate case 1",
+		`switch x { case number, string, number { } }`:    "duplicate case number",
+		`switch x { default { } case 2 { } default { } }`: "multiple defaults",
+	} {
+		if err := L.DoString(src); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected an error containing %q, got %v", src, msg, err)
+		}
+	}
+}
+
+func TestSafeNavigation(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		L := NewState(Options{SkipOptimization: skip})
+		testSafeNavigation(t, L)
+		L.Close()
+	}
+}
+
+func testSafeNavigation(t *testing.T, L *LState) {
+	if err := L.DoString(`
+		local cfg = {server = {port = 8080, tls = false}, hosts = {"a", "b"}}
+		local none
+		Assert(cfg?.server?.port == 8080 and cfg?["hosts"]?[2] == "b")
+		Assert(none?.server == nil and none?.server?.port == nil)
+		// the key of a nil object is not evaluated
+		Assert(none?[Error("evaluated")] == nil)
+
+		// ?? has a lower precedence than or
+		Assert((cfg.server.tls ?? true) == false and (cfg.server.tls or true) == true)
+		Assert((none ?? "default") == "default" and (none?.x ?? cfg?.server?.port) == 8080)
+		local x
+		x = x ?? 5
+		x = none ?? x + 1
+		Assert(x == 6)
+		local t = {}
+		t[none ?? "k"] = cfg?.hosts ?? {}
+		Assert(t.k == cfg.hosts)
+		local func pair() { return nil, 2 }
+		Assert((pair() ?? "nil") == "nil")
+		local calls = 0
+		local func get() {
+			calls = calls + 1
+			return cfg
+		}
+		Assert(get()?.server?.port == 8080 and calls == 1)
+
+		// a nil object skips the rest of the chain
+		Assert((nil)?.b.c == nil and none?.b.c == nil and none?.b[Error("evaluated")].c == nil)
+		Assert(none?.b:m() == nil and none?.f(Error("evaluated")) == nil)
+		none?.b.f()
+		Assert(cfg?.server.port == 8080 and cfg?.hosts[1] == "a")
+		local obj = {n = 1}
+		obj.self = obj
+		func obj:inc(d) { self.n = self.n + d return self.n, "more" }
+		Assert(obj?.n == 1 and obj?.self:inc(2) == 3)
+		Assert(Select("#", none?.b:inc(1)) == 1)
+		// a call ending a chain keeps its results unless the chain stops
+		local r = {obj?.inc(obj, 1)}
+		Assert(#r == 2 and r[1] == 4 and r[2] == "more")
+		local func chain(o) { return o?.self:inc(1) }
+		Assert(Select("#", chain(obj)) == 2 and Select("#", chain(none)) == 1 and chain(none) == nil)
+		local a, b = obj?.inc(obj, 1)
+		Assert(a == 6 and b == "more")
+		a, b = none?.inc(obj, 1)
+		Assert(a == nil and b == nil)
+		local c, d = obj?.n
+		Assert(c == 6 and d == nil)
+
+		// the locals following a chain are cleared
+		for i = 1, 3 {
+			local v = cfg?.server.port
+			local w
+			Assert(w == nil)
+			w = i
+		}
+		local e, f = cfg?.server.port
+		Assert(e == 8080 and f == nil)
+
+		// parentheses end a chain
+		Assert(not PCall(func() { return (none?.b).c }) and not PCall(func() { return (none?.b:m()).c }))
+		Assert((none?.b)?.c == nil)
+	`); err != nil {
+		t.Fatal(err)
+	}
+}
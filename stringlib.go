@@ -109,13 +109,13 @@ func strByte(L *LState) int {
 
 	// if only one index, return the code of the character
 	if L.GetTop() == 2 {
-		L.Push(LNumber(runes[start]))
+		L.Push(LInteger(runes[start]))
 		return 1
 	}
 
 	// return multiple values
 	for i := start; i < end; i++ {
-		L.Push(LNumber(runes[i]))
+		L.Push(LInteger(runes[i]))
 	}
 	return end - start
 }
@@ -185,8 +185,8 @@ func strFind(L *LState) int {
 	str := L.CheckString(1)
 	pattern := L.CheckString(2)
 	if len(pattern) == 0 {
-		L.Push(LNumber(1))
-		L.Push(LNumber(0))
+		L.Push(LInteger(1))
+		L.Push(LInteger(0))
 		return 2
 	}
 	init := luaIndex2StringIndex(str, L.OptInt(3, 1), true)
@@ -201,8 +201,8 @@ func strFind(L *LState) int {
 			L.Push(LNil)
 			return 1
 		}
-		L.Push(LNumber(init+pos) + 1)
-		L.Push(LNumber(init + pos + len(pattern)))
+		L.Push(LInteger(init+pos) + 1)
+		L.Push(LInteger(init + pos + len(pattern)))
 		return 2
 	}
 
@@ -215,11 +215,11 @@ func strFind(L *LState) int {
 		return 1
 	}
 	md := mds[0]
-	L.Push(LNumber(md.Capture(0) + 1))
-	L.Push(LNumber(md.Capture(1)))
+	L.Push(LInteger(md.Capture(0) + 1))
+	L.Push(LInteger(md.Capture(1)))
 	for i := 2; i < md.CaptureLength(); i += 2 {
 		if md.IsPosCapture(i) {
-			L.Push(LNumber(md.Capture(i)))
+			L.Push(LInteger(md.Capture(i)))
 		} else {
 			L.Push(LString(str[md.Capture(i):md.Capture(i+1)]))
 		}
@@ -271,7 +271,7 @@ func strGsub(L *LState) int {
 	}
 	if len(mds) == 0 {
 		L.SetTop(1)
-		L.Push(LNumber(0))
+		L.Push(LInteger(0))
 		return 2
 	}
 	switch lv := repl.(type) {
@@ -282,7 +282,7 @@ func strGsub(L *LState) int {
 	case *LFunction:
 		L.Push(LString(strGsubFunc(L, str, lv, mds)))
 	}
-	L.Push(LNumber(len(mds)))
+	L.Push(LInteger(len(mds)))
 	return 2
 }
 
@@ -377,7 +377,7 @@ func strGsubTable(L *LState, str string, repl *LTable, matches []*pm.MatchData)
 		}
 		var value LValue
 		if match.IsPosCapture(idx) {
-			value = L.GetTable(repl, LNumber(match.Capture(idx)))
+			value = L.GetTable(repl, LInteger(match.Capture(idx)))
 		} else {
 			value = L.GetField(repl, str[match.Capture(idx):match.Capture(idx+1)])
 		}
@@ -397,7 +397,7 @@ func strGsubFunc(L *LState, str string, repl *LFunction, matches []*pm.MatchData
 		if match.CaptureLength() > 2 { // has captures
 			for i := 2; i < match.CaptureLength(); i += 2 {
 				if match.IsPosCapture(i) {
-					L.Push(LNumber(match.Capture(i)))
+					L.Push(LInteger(match.Capture(i)))
 				} else {
 					L.Push(LString(capturedString(L, match, str, i)))
 				}
@@ -440,7 +440,7 @@ func strGmatchIter(L *LState) int {
 
 	for i := 2; i < match.CaptureLength(); i += 2 {
 		if match.IsPosCapture(i) {
-			L.Push(LNumber(match.Capture(i)))
+			L.Push(LInteger(match.Capture(i)))
 		} else {
 			L.Push(LString(str[match.Capture(i):match.Capture(i+1)]))
 		}
@@ -509,7 +509,7 @@ func strGmatch(L *LState) int {
 //  1. 返回字符串的长度
 func strLen(L *LState) int {
 	str := L.CheckString(1)
-	L.Push(LNumber(utf8.RuneCountInString(str)))
+	L.Push(LInteger(utf8.RuneCountInString(str)))
 	return 1
 }
 
@@ -591,7 +591,7 @@ func strMatch(L *LState) int {
 	default:
 		for i := 2; i < md.CaptureLength(); i += 2 {
 			if md.IsPosCapture(i) {
-				L.Push(LNumber(md.Capture(i)))
+				L.Push(LInteger(md.Capture(i)))
 			} else {
 				L.Push(LString(str[md.Capture(i):md.Capture(i+1)]))
 			}
@@ -627,6 +627,9 @@ func strRep(L *LState) int {
 	if n < 0 {
 		L.Push(emptyLString)
 	} else {
+		if len(str) > 0 && n > 0 {
+			L.reserveMemory(stringMemSize(str) + int64(len(str))*int64(n-1))
+		}
 		L.Push(LString(strings.Repeat(str, n)))
 	}
 	return 1
@@ -46,6 +46,11 @@ func newLTable(acap int, hcap int) *LTable {
 	return tb
 }
 
+// IsFrozen returns true if this LTable was created by tbllib.Freeze and can not be modified.
+func (tb *LTable) IsFrozen() bool {
+	return tb.frozen
+}
+
 // Len returns length of this LTable without using __len.
 func (tb *LTable) Len() int {
 	if tb.array == nil {
@@ -93,7 +98,7 @@ func (tb *LTable) Insert(i int, value LValue) {
 		return
 	}
 	if i <= 0 {
-		tb.RawSet(LNumber(i), value)
+		tb.RawSet(LInteger(i), value)
 		return
 	}
 	i -= 1
@@ -145,9 +150,12 @@ func (tb *LTable) Remove(pos int) LValue {
 // It is recommended to use `RawSetString` or `RawSetInt` for performance
 // if you already know the given LValue is a string or number.
 func (tb *LTable) RawSet(key LValue, value LValue) {
+	if f, ok := key.(LNumber); ok {
+		key = numberKey(f)
+	}
 	switch v := key.(type) {
-	case LNumber:
-		if isArrayKey(v) {
+	case LInteger:
+		if v > 0 && v < LInteger(MaxArrayIndex) {
 			if tb.array == nil {
 				tb.array = make([]LValue, 0, defaultArrayCap)
 			}
@@ -177,7 +185,7 @@ func (tb *LTable) RawSet(key LValue, value LValue) {
 // RawSetInt sets a given LValue at a position `key` without the __newindex metamethod.
 func (tb *LTable) RawSetInt(key int, value LValue) {
 	if key < 1 || key >= MaxArrayIndex {
-		tb.RawSetH(LNumber(key), value)
+		tb.RawSetH(LInteger(key), value)
 		return
 	}
 	if tb.array == nil {
@@ -200,6 +208,7 @@ func (tb *LTable) RawSetInt(key int, value LValue) {
 
 // RawSetString sets a given LValue to a given string index without the __newindex metamethod.
 func (tb *LTable) RawSetString(key string, value LValue) {
+	tb.version++
 	if tb.strdict == nil {
 		tb.strdict = make(map[string]LValue, defaultHashCap)
 	}
@@ -227,6 +236,9 @@ func (tb *LTable) RawSetH(key LValue, value LValue) {
 		tb.RawSetString(string(s), value)
 		return
 	}
+	if f, ok := key.(LNumber); ok {
+		key = numberKey(f)
+	}
 	if tb.dict == nil {
 		tb.dict = make(map[LValue]LValue, len(tb.strdict))
 	}
@@ -249,9 +261,12 @@ func (tb *LTable) RawSetH(key LValue, value LValue) {
 
 // RawGet returns an LValue associated with a given key without __index metamethod.
 func (tb *LTable) RawGet(key LValue) LValue {
+	if f, ok := key.(LNumber); ok {
+		key = numberKey(f)
+	}
 	switch v := key.(type) {
-	case LNumber:
-		if isArrayKey(v) {
+	case LInteger:
+		if v > 0 && v < LInteger(MaxArrayIndex) {
 			if tb.array == nil {
 				return LNil
 			}
@@ -302,6 +317,9 @@ func (tb *LTable) RawGetH(key LValue) LValue {
 		}
 		return LNil
 	}
+	if f, ok := key.(LNumber); ok {
+		key = numberKey(f)
+	}
 	if tb.dict == nil {
 		return LNil
 	}
@@ -327,7 +345,7 @@ func (tb *LTable) ForEach(cb func(LValue, LValue)) {
 	if tb.array != nil {
 		for i, v := range tb.array {
 			if v != LNil {
-				cb(LNumber(i+1), v)
+				cb(LInteger(i+1), v)
 			}
 		}
 	}
@@ -351,17 +369,19 @@ func (tb *LTable) ForEach(cb func(LValue, LValue)) {
 func (tb *LTable) Next(key LValue) (LValue, LValue) {
 	init := false
 	if key == LNil {
-		key = LNumber(0)
+		key = LInteger(0)
 		init = true
+	} else if f, ok := key.(LNumber); ok {
+		key = numberKey(f)
 	}
 
-	if init || key != LNumber(0) {
-		if kv, ok := key.(LNumber); ok && isInteger(kv) && int(kv) >= 0 && kv < LNumber(MaxArrayIndex) {
+	if init || key != LInteger(0) {
+		if kv, ok := key.(LInteger); ok && kv >= 0 && kv < LInteger(MaxArrayIndex) {
 			index := int(kv)
 			if tb.array != nil {
 				for ; index < len(tb.array); index++ {
 					if v := tb.array[index]; v != LNil {
-						return LNumber(index + 1), v
+						return LInteger(index + 1), v
 					}
 				}
 			}
@@ -385,3 +405,12 @@ func (tb *LTable) Next(key LValue) (LValue, LValue) {
 	}
 	return LNil, LNil
 }
+
+// numberKey converts a float key with an integer value to an integer, so that t[1] and t[1.0] are the
+// same field.
+func numberKey(v LNumber) LValue {
+	if i, ok := float2integer(v); ok {
+		return i
+	}
+	return v
+}
@@ -27,23 +27,36 @@ var TblLibFuncDoc = map[string]libFuncDoc{
 			"Sort",
 			"Unpack",
 			"Pack",
+			"Freeze",
+			"IsFrozen",
 		},
 	},
 }
 
 var tableFuncs = map[string]LGFunction{
-	"GetN":   tableGetN,
-	"SetN":   tableSetN,
-	"GetLen": tableGetLen,
-	"Concat": tableConcat,
-	"Clone":  tableClone,
-	"Equal":  tableEqual,
-	"Insert": tableInsert,
-	"MaxN":   tableMaxN,
-	"Remove": tableRemove,
-	"Sort":   tableSort,
-	"Unpack": tableUnpack,
-	"Pack":   tablePack,
+	"GetN":     tableGetN,
+	"SetN":     tableSetN,
+	"GetLen":   tableGetLen,
+	"Concat":   tableConcat,
+	"Clone":    tableClone,
+	"Equal":    tableEqual,
+	"Insert":   tableInsert,
+	"MaxN":     tableMaxN,
+	"Remove":   tableRemove,
+	"Sort":     tableSort,
+	"Unpack":   tableUnpack,
+	"Pack":     tablePack,
+	"Freeze":   tableFreeze,
+	"IsFrozen": tableIsFrozen,
+}
+
+// checkWritableTable 检查第 n 个参数是否为可修改的表
+func checkWritableTable(L *LState, n int) *LTable {
+	tbl := L.CheckTable(n)
+	if tbl.frozen {
+		L.ArgError(n, "table is frozen")
+	}
+	return tbl
 }
 
 // tableSort 模块函数，用于对表进行排序
@@ -75,7 +88,7 @@ var tableFuncs = map[string]LGFunction{
 //  7. 排序函数的返回值为其他值时，表示 a 和 b 的关系不确定
 //  8. 排序函数的返回值为其他类型时，会导致排序失败
 func tableSort(L *LState) int {
-	tbl := L.CheckTable(1)
+	tbl := checkWritableTable(L, 1)
 	sorter := lValueArraySorter{L, nil, tbl.array}
 	if L.GetTop() != 1 {
 		sorter.Fn = L.CheckFunction(2)
@@ -104,7 +117,7 @@ func tableSort(L *LState) int {
 //  1. 获取表的长度，即表中元素的个数
 //  2. 如果表中存在 nil 元素，则不会计入长度
 func tableGetN(L *LState) int {
-	L.Push(LNumber(L.CheckTable(1).Len()))
+	L.Push(LInteger(L.CheckTable(1).Len()))
 	return 1
 }
 
@@ -133,7 +146,7 @@ func tableGetN(L *LState) int {
 //  3. 如果新的长度小于原长度，则会删除多余的元素
 //  4. 如果新的长度小于 0，则会返回错误信息
 func tableSetN(L *LState) int {
-	tbl := L.CheckTable(1)
+	tbl := checkWritableTable(L, 1)
 	n := L.CheckInt(2)
 	if n < 0 {
 		L.Push(LString(fmt.Sprintf("invalid length %d", n)))
@@ -174,7 +187,7 @@ func tableGetLen(L *LState) int {
 			cnt++
 		}
 	})
-	L.Push(LNumber(cnt))
+	L.Push(LInteger(cnt))
 	return 1
 }
 
@@ -198,7 +211,7 @@ func tableGetLen(L *LState) int {
 //  1. 获取表的最大索引，即表中最大的整数索引
 //  2. 如果表中存在非整数索引，则不会计入最大索引
 func tableMaxN(L *LState) int {
-	L.Push(LNumber(L.CheckTable(1).MaxN()))
+	L.Push(LInteger(L.CheckTable(1).MaxN()))
 	return 1
 }
 
@@ -225,7 +238,7 @@ func tableMaxN(L *LState) int {
 //  2. 如果未提供索引，则默认移除最后一个元素
 //  3. 如果索引超出范围，则返回 nil
 func tableRemove(L *LState) int {
-	tbl := L.CheckTable(1)
+	tbl := checkWritableTable(L, 1)
 	if L.GetTop() == 1 {
 		L.Push(tbl.Remove(-1))
 	} else {
@@ -387,7 +400,7 @@ func deepEqual(v1, v2 LValue) bool {
 	case LTBool:
 		return v1 == v2
 	case LTNumber:
-		return v1 == v2
+		return numberEquals(v1, v2)
 	case LTString:
 		return v1 == v2
 	case LTTable:
@@ -423,7 +436,7 @@ func deepEqual(v1, v2 LValue) bool {
 // 调用方式：
 //  1. tbllib.Insert(tbl, idx, v)
 func tableInsert(L *LState) int {
-	tbl := L.CheckTable(1)
+	tbl := checkWritableTable(L, 1)
 	nargs := L.GetTop()
 	if nargs == 1 {
 		L.Push(LString(fmt.Sprintf("missing argument #2")))
@@ -503,3 +516,79 @@ func tablePack(L *LState) int {
 	L.Push(t)
 	return 1
 }
+
+// tableFreeze 模块函数，用于创建不可修改的表
+// 参数：
+//  1. tbl (table) - 待冻结的表
+//
+// 返回值：
+//  1. table（冻结后的表）
+//
+// 调用方式：
+//  1. local frozen = tbllib.Freeze(tbl)
+//
+// 示例：
+//
+//	local cfg = tbllib.Freeze({port = 8080, hosts = {"a", "b"}})
+//	local ch = chnlib.Make(1)
+//	ch:Send(cfg)
+//	cfg.port = 80 // 报错：attempt to modify a frozen table
+//
+// 备注：
+//  1. 返回表的深拷贝，拷贝及其中所有的子表都不可修改，原表不受影响
+//  2. 冻结的表可以通过通道发送，并被多个 LState 同时读取，无需再次拷贝
+//  3. 修改冻结的表（包括 RawSet、tbllib.Insert 等）会报错
+//  4. 表中只能包含 nil、布尔值、数字、字符串、通道和表，且表不能有元表
+//  5. 如果表已经被冻结，则直接返回该表
+func tableFreeze(L *LState) int {
+	L.Push(freezeTable(L, L.CheckTable(1), map[*LTable]*LTable{}))
+	return 1
+}
+
+// freezeTable 返回 tbl 的冻结拷贝，copies 记录已拷贝的表，以保留共享和循环引用
+func freezeTable(L *LState, tbl *LTable, copies map[*LTable]*LTable) *LTable {
+	if tbl.frozen {
+		return tbl
+	}
+	if frozen, ok := copies[tbl]; ok {
+		return frozen
+	}
+	if tbl.Metatable != LNil {
+		L.ArgError(1, "can not freeze a table that has a metatable")
+	}
+	frozen := L.CreateTable(len(tbl.array), len(tbl.strdict))
+	copies[tbl] = frozen
+	freeze := func(v LValue) LValue {
+		switch lv := v.(type) {
+		case *LTable:
+			return freezeTable(L, lv, copies)
+		case *LFunction, *LUserData, *LState:
+			L.ArgError(1, "can not freeze a function, userdata or thread")
+		}
+		return v
+	}
+	tbl.ForEach(func(key, value LValue) {
+		frozen.RawSet(freeze(key), freeze(value))
+	})
+	frozen.frozen = true
+	return frozen
+}
+
+// tableIsFrozen 模块函数，用于判断表是否被冻结
+// 参数：
+//  1. tbl (table) - 待判断的表
+//
+// 返回值：
+//  1. boolean（是否被冻结）
+//
+// 调用方式：
+//  1. local ok = tbllib.IsFrozen(tbl)
+//
+// 示例：
+//
+//	PrintLn(tbllib.IsFrozen(tbllib.Freeze({}))) // 输出：true
+//	PrintLn(tbllib.IsFrozen({}))                // 输出：false
+func tableIsFrozen(L *LState) int {
+	L.Push(LBool(L.CheckTable(1).frozen))
+	return 1
+}
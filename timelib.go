@@ -74,7 +74,7 @@ func timeUnix(L *LState) int {
 		L.Push(LString(fmt.Sprintf("invalid time unit %q", unit)))
 		return 2
 	}
-	L.Push(LNumber(time.Now().UnixNano() / int64(dur)))
+	L.Push(LInteger(time.Now().UnixNano() / int64(dur)))
 	return 1
 }
 
@@ -96,6 +96,7 @@ func timeUnix(L *LState) int {
 //  4. 如果 unit 为 "h"，则休眠小时数
 //  5. 如果 unit 为其他值，则会返回错误信息
 //  6. 如果不传入 unit 参数，则默认为 "s"
+//  7. 如果 LState 的 context 在休眠期间结束，则立即抛出 context 错误
 func timeSleep(L *LState) int {
 	duration := L.CheckNumber(1)
 	unit := L.OptString(2, defaultTimeUnit)
@@ -104,7 +105,13 @@ func timeSleep(L *LState) int {
 		L.Push(LString(fmt.Sprintf("invalid time unit %q", unit)))
 		return 1
 	}
-	time.Sleep(time.Duration(duration) * dur)
+	timer := time.NewTimer(time.Duration(duration) * dur)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-L.ContextDone():
+		L.CheckContext()
+	}
 	return 0
 }
 
@@ -149,14 +156,14 @@ func timeDate(L *LState) int {
 	// if format starts with "*t" return a table with time fields
 	if strings.HasPrefix(format, "*t") {
 		ret := L.NewTable()
-		ret.RawSetString("year", LNumber(t.Year()))
-		ret.RawSetString("month", LNumber(t.Month()))
-		ret.RawSetString("day", LNumber(t.Day()))
-		ret.RawSetString("hour", LNumber(t.Hour()))
-		ret.RawSetString("min", LNumber(t.Minute()))
-		ret.RawSetString("sec", LNumber(t.Second()))
-		ret.RawSetString("wday", LNumber(int(t.Weekday())+1))
-		ret.RawSetString("yday", LNumber(t.YearDay()))
+		ret.RawSetString("year", LInteger(t.Year()))
+		ret.RawSetString("month", LInteger(t.Month()))
+		ret.RawSetString("day", LInteger(t.Day()))
+		ret.RawSetString("hour", LInteger(t.Hour()))
+		ret.RawSetString("min", LInteger(t.Minute()))
+		ret.RawSetString("sec", LInteger(t.Second()))
+		ret.RawSetString("wday", LInteger(int(t.Weekday())+1))
+		ret.RawSetString("yday", LInteger(t.YearDay()))
 		ret.RawSetString("isdst", LBool(t.IsDST()))
 		L.Push(ret)
 	} else {
@@ -183,7 +190,7 @@ func timeDate(L *LState) int {
 func timeTime(L *LState) int {
 	// return current timestamp if no argument is given
 	if L.GetTop() == 0 || L.CheckAny(1) == LNil {
-		L.Push(LNumber(time.Now().Unix()))
+		L.Push(LInteger(time.Now().Unix()))
 		return 1
 	}
 
@@ -215,7 +222,7 @@ func timeTime(L *LState) int {
 			t = t.Add(-time.Hour)
 		}
 	}
-	L.Push(LNumber(t.Unix()))
+	L.Push(LInteger(t.Unix()))
 	return 1
 }
 
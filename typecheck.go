@@ -0,0 +1,536 @@
+package lua
+
+import (
+	"fmt"
+
+	"milklua/ast"
+)
+
+/* type checker {{{ */
+
+// TypeError is a type error found by CheckTypes.
+type TypeError struct {
+	Source  string
+	Line    int
+	Message string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("type error near line(%v) %v: %v", e.Line, e.Source, e.Message)
+}
+
+// CheckTypes checks the type annotations of chunk without running it, and returns the type errors found.
+//
+// The checker only reasons about values whose type is known statically: literals, operators, annotated
+// locals and parameters, calls of functions with an annotated return type and type assertions.
+// Everything else has an unknown type, which is compatible with any type. Annotations have no effect at
+// runtime.
+func CheckTypes(chunk []ast.Stmt, name string) []*TypeError {
+	tc := &typeChecker{source: name, globals: map[string]*ast.FunctionExpr{}}
+	tc.collectGlobals(chunk)
+	tc.block(chunk)
+	return tc.errors
+}
+
+// the type of values whose type is not known statically
+const typeUnknown = ""
+
+// tcSymbol is a local variable.
+type tcSymbol struct {
+	// the annotated type, typeUnknown if not annotated
+	typ string
+	// the function the variable is bound to, nil if not known
+	fn *ast.FunctionExpr
+}
+
+type tcScope struct {
+	parent *tcScope
+	names  map[string]*tcSymbol
+}
+
+type typeChecker struct {
+	source string
+	scope  *tcScope
+	// global functions defined once at the top level of the chunk
+	globals map[string]*ast.FunctionExpr
+	// the function being checked, nil for the main chunk
+	fn     *ast.FunctionExpr
+	errors []*TypeError
+}
+
+func (tc *typeChecker) errorf(line int, format string, args ...interface{}) {
+	tc.errors = append(tc.errors, &TypeError{Source: tc.source, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (tc *typeChecker) openScope() {
+	tc.scope = &tcScope{parent: tc.scope, names: map[string]*tcSymbol{}}
+}
+
+func (tc *typeChecker) closeScope() {
+	tc.scope = tc.scope.parent
+}
+
+func (tc *typeChecker) declare(name string, sym *tcSymbol) {
+	tc.scope.names[name] = sym
+}
+
+func (tc *typeChecker) lookup(name string) *tcSymbol {
+	for scope := tc.scope; scope != nil; scope = scope.parent {
+		if sym, ok := scope.names[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// collectGlobals records the global functions of the chunk, so they can be called before their definition.
+// Globals that are defined more than once or assigned at the top level are left out.
+func (tc *typeChecker) collectGlobals(chunk []ast.Stmt) {
+	defined := map[string]bool{}
+	for _, stmt := range chunk {
+		switch st := stmt.(type) {
+		case *ast.FuncDefStmt:
+			if ident, ok := st.Name.Func.(*ast.IdentExpr); ok {
+				if defined[ident.Value] {
+					delete(tc.globals, ident.Value)
+				} else {
+					tc.globals[ident.Value] = st.Func
+				}
+				defined[ident.Value] = true
+			}
+		case *ast.AssignStmt:
+			for _, lhs := range st.Lhs {
+				if ident, ok := lhs.(*ast.IdentExpr); ok {
+					delete(tc.globals, ident.Value)
+					defined[ident.Value] = true
+				}
+			}
+		}
+	}
+}
+
+// annotation returns the type named by a type annotation, typeUnknown for nil.
+func annotation(typ ast.Expr) string {
+	if bt, ok := typ.(*ast.BuiltinType); ok {
+		return bt.Kind
+	}
+	return typeUnknown
+}
+
+func annotationAt(types []ast.Expr, i int) string {
+	if i < len(types) {
+		return annotation(types[i])
+	}
+	return typeUnknown
+}
+
+// isNilAt reports whether the i-th expression is the nil literal.
+func isNilAt(exprs []ast.Expr, i int) bool {
+	if i < len(exprs) {
+		_, ok := exprs[i].(*ast.NilExpr)
+		return ok
+	}
+	return false
+}
+
+func typeCompatible(expected, actual string) bool {
+	return expected == typeUnknown || actual == typeUnknown || expected == actual
+}
+
+func (tc *typeChecker) block(stmts []ast.Stmt) {
+	tc.openScope()
+	tc.stmts(stmts)
+	tc.closeScope()
+}
+
+func (tc *typeChecker) stmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		tc.stmt(stmt)
+	}
+}
+
+func (tc *typeChecker) stmt(stmt ast.Stmt) {
+	switch st := stmt.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range st.Lhs {
+			if _, ok := lhs.(*ast.IdentExpr); !ok {
+				tc.expr(lhs)
+			}
+		}
+		types := tc.exprTypes(st.Rhs, len(st.Lhs))
+		for i, lhs := range st.Lhs {
+			var value ast.Expr
+			if i < len(st.Rhs) {
+				value = st.Rhs[i]
+			}
+			tc.assign(lhs, types[i], value, st.Line())
+		}
+	case *ast.CompoundAssignStmt:
+		typ := tc.arithType(st.Operator, tc.expr(st.Lhs), tc.expr(st.Rhs), st.Line())
+		tc.assign(st.Lhs, typ, nil, st.Line())
+	case *ast.LocalAssignStmt:
+		if len(st.Names) == 1 && len(st.Exprs) == 1 {
+			if fn, ok := st.Exprs[0].(*ast.FunctionExpr); ok {
+				// local functions can call themselves
+				sym := &tcSymbol{typ: annotationAt(st.Types, 0), fn: fn}
+				tc.declare(st.Names[0], sym)
+				tc.checkAssignable(st.Names[0], sym.typ, tc.expr(fn), st.Line())
+				return
+			}
+		}
+		types := tc.exprTypes(st.Exprs, len(st.Names))
+		for i, name := range st.Names {
+			sym := &tcSymbol{typ: annotationAt(st.Types, i)}
+			// annotated locals without any value are declarations, and so are those initialized to nil
+			if len(st.Exprs) > 0 && !isNilAt(st.Exprs, i) {
+				if i < len(st.Exprs) {
+					sym.fn, _ = st.Exprs[i].(*ast.FunctionExpr)
+				}
+				tc.checkAssignable(name, sym.typ, types[i], st.Line())
+			}
+			tc.declare(name, sym)
+		}
+	case *ast.FuncCallStmt:
+		tc.expr(st.Expr)
+	case *ast.DeferStmt:
+		tc.expr(st.Call)
+	case *ast.DoBlockStmt:
+		tc.block(st.Stmts)
+	case *ast.WhileStmt:
+		tc.expr(st.Condition)
+		tc.block(st.Stmts)
+	case *ast.WhileStmtWithIfThru:
+		tc.expr(st.Condition)
+		tc.block(st.Stmts)
+		tc.block(st.IfThruStmts)
+	case *ast.RepeatStmt:
+		tc.openScope()
+		tc.stmts(st.Stmts)
+		tc.expr(st.Condition)
+		tc.closeScope()
+	case *ast.RepeatStmtWithIfThru:
+		tc.openScope()
+		tc.stmts(st.Stmts)
+		tc.expr(st.Condition)
+		tc.closeScope()
+		tc.block(st.IfThruStmts)
+	case *ast.IfStmt:
+		tc.expr(st.Condition)
+		tc.block(st.Then)
+		tc.block(st.Else)
+	case *ast.NumberForStmt:
+		tc.numberFor(st.Name, st.Init, st.Limit, st.Step, st.Stmts, st.Line())
+	case *ast.NumberForStmtWithIfThru:
+		tc.numberFor(st.Name, st.Init, st.Limit, st.Step, st.Stmts, st.Line())
+		tc.block(st.IfThruStmts)
+	case *ast.GenericForStmt:
+		tc.genericFor(st.Names, st.Exprs, st.Stmts)
+	case *ast.GenericForStmtWithIfThru:
+		tc.genericFor(st.Names, st.Exprs, st.Stmts)
+		tc.block(st.IfThruStmts)
+	case *ast.FuncDefStmt:
+		if st.Name.Func == nil {
+			// methods have an implicit self parameter
+			tc.expr(st.Name.Receiver)
+			tc.function(st.Func, "self")
+			return
+		}
+		if ident, ok := st.Name.Func.(*ast.IdentExpr); ok {
+			tc.assign(ident, "function", st.Func, st.Line())
+		} else {
+			tc.expr(st.Name.Func)
+		}
+		tc.function(st.Func)
+	case *ast.SwitchStmt:
+		typ := tc.expr(st.Expr)
+		for _, cs := range st.Cases {
+			for _, value := range cs.Values {
+				if _, ok := value.(*ast.BuiltinType); !ok {
+					tc.expr(value)
+				} else if expected := annotation(value); !typeCompatible(expected, typ) {
+					tc.errorf(cs.Line(), "impossible type case: %s value is never %s", typ, expected)
+				}
+			}
+			tc.block(cs.Stmts)
+		}
+		tc.block(st.Default)
+	case *ast.ReturnStmt:
+		types := tc.exprTypes(st.Exprs, 1)
+		if tc.fn == nil || tc.fn.ReturnType == nil {
+			return
+		}
+		expected := annotation(tc.fn.ReturnType)
+		if len(st.Exprs) == 0 {
+			tc.errorf(st.Line(), "missing return value, %s expected", expected)
+		} else if !typeCompatible(expected, types[0]) {
+			tc.errorf(st.Line(), "cannot return %s, %s expected", types[0], expected)
+		}
+	}
+}
+
+// assign checks the assignment of a value of type typ to the variable lhs. value is the assigned expression
+// if it is known.
+func (tc *typeChecker) assign(lhs ast.Expr, typ string, value ast.Expr, line int) {
+	ident, ok := lhs.(*ast.IdentExpr)
+	if !ok {
+		return
+	}
+	fn, _ := value.(*ast.FunctionExpr)
+	if sym := tc.lookup(ident.Value); sym != nil {
+		tc.checkAssignable(ident.Value, sym.typ, typ, line)
+		sym.fn = fn
+	} else if tc.globals[ident.Value] != fn {
+		delete(tc.globals, ident.Value)
+	}
+}
+
+func (tc *typeChecker) checkAssignable(name, expected, actual string, line int) {
+	if !typeCompatible(expected, actual) {
+		tc.errorf(line, "cannot assign %s to '%s' (%s)", actual, name, expected)
+	}
+}
+
+func (tc *typeChecker) numberFor(name string, init, limit, step ast.Expr, stmts []ast.Stmt, line int) {
+	for i, ex := range []ast.Expr{init, limit, step} {
+		if ex == nil {
+			continue
+		}
+		if typ := tc.expr(ex); !typeCompatible("number", typ) && typ != "string" {
+			tc.errorf(line, "'for' %s must be a number, got %s", [...]string{"initial value", "limit", "step"}[i], typ)
+		}
+	}
+	tc.openScope()
+	tc.declare(name, &tcSymbol{typ: "number"})
+	tc.stmts(stmts)
+	tc.closeScope()
+}
+
+func (tc *typeChecker) genericFor(names []string, exprs []ast.Expr, stmts []ast.Stmt) {
+	tc.exprTypes(exprs, 0)
+	tc.openScope()
+	for _, name := range names {
+		tc.declare(name, &tcSymbol{})
+	}
+	tc.stmts(stmts)
+	tc.closeScope()
+}
+
+// function checks the body of fn. implicit holds the names of implicit parameters.
+func (tc *typeChecker) function(fn *ast.FunctionExpr, implicit ...string) {
+	outer := tc.fn
+	tc.fn = fn
+	tc.openScope()
+	for _, name := range implicit {
+		tc.declare(name, &tcSymbol{})
+	}
+	for i, name := range fn.ParList.Names {
+		tc.declare(name, &tcSymbol{typ: annotationAt(fn.ParList.Types, i)})
+	}
+	tc.stmts(fn.Stmts)
+	tc.closeScope()
+	tc.fn = outer
+}
+
+// exprTypes checks the expressions and returns the types of the first n values they evaluate to.
+func (tc *typeChecker) exprTypes(exprs []ast.Expr, n int) []string {
+	types := make([]string, 0, n)
+	for i, ex := range exprs {
+		typ := tc.expr(ex)
+		if i == len(exprs)-1 && isVarArgReturnExpr(ex) {
+			// the remaining values come from a function call or '...'
+			for len(types) < n {
+				types = append(types, typ)
+				typ = typeUnknown
+			}
+		} else {
+			types = append(types, typ)
+		}
+	}
+	for len(types) < n {
+		types = append(types, "nil")
+	}
+	return types
+}
+
+// expr checks the expression and returns its type.
+func (tc *typeChecker) expr(expr ast.Expr) string {
+	switch ex := expr.(type) {
+	case *ast.TrueExpr, *ast.FalseExpr:
+		return "bool"
+	case *ast.NilExpr:
+		return "nil"
+	case *ast.NumberExpr:
+		return "number"
+	case *ast.StringExpr:
+		return "string"
+	case *ast.InterpolatedStringExpr:
+		for _, part := range ex.Parts {
+			tc.expr(part)
+		}
+		return "string"
+	case *ast.Comma3Expr:
+		return typeUnknown
+	case *ast.IdentExpr:
+		if sym := tc.lookup(ex.Value); sym != nil {
+			if sym.typ == typeUnknown && sym.fn != nil {
+				return "function"
+			}
+			return sym.typ
+		}
+		if tc.globals[ex.Value] != nil {
+			return "function"
+		}
+		return typeUnknown
+	case *ast.AttrGetExpr:
+		typ := tc.expr(ex.Object)
+		tc.expr(ex.Key)
+		switch typ {
+		case "nil", "bool", "number", "function":
+			tc.errorf(ex.Line(), "attempt to index a %s value", typ)
+		}
+		return typeUnknown
+	case *ast.SafeAttrGetExpr:
+		typ := tc.expr(ex.Object)
+		tc.expr(ex.Key)
+		switch typ {
+		case "bool", "number", "function":
+			tc.errorf(ex.Line(), "attempt to index a %s value", typ)
+		}
+		return typeUnknown
+	case *ast.TableExpr:
+		for _, field := range ex.Fields {
+			if field.Key != nil {
+				tc.expr(field.Key)
+			}
+			tc.expr(field.Value)
+		}
+		return "table"
+	case *ast.FuncCallExpr:
+		return tc.call(ex)
+	case *ast.LogicalOpExpr:
+		lhs, rhs := tc.expr(ex.Lhs), tc.expr(ex.Rhs)
+		if lhs == rhs {
+			return lhs
+		}
+		return typeUnknown
+	case *ast.NilCoalesceExpr:
+		lhs, rhs := tc.expr(ex.Lhs), tc.expr(ex.Rhs)
+		if lhs == rhs || lhs == "nil" {
+			return rhs
+		}
+		return typeUnknown
+	case *ast.BitwiseOpExpr:
+		tc.expr(ex.Lhs)
+		tc.expr(ex.Rhs)
+		return "number"
+	case *ast.RelationalOpExpr:
+		tc.expr(ex.Lhs)
+		tc.expr(ex.Rhs)
+		return "bool"
+	case *ast.StringConcatOpExpr:
+		lhs, rhs := tc.expr(ex.Lhs), tc.expr(ex.Rhs)
+		for _, typ := range []string{lhs, rhs} {
+			switch typ {
+			case "nil", "bool", "function":
+				tc.errorf(ex.Line(), "attempt to concatenate a %s value", typ)
+				return typeUnknown
+			}
+		}
+		if isStringOrNumber(lhs) && isStringOrNumber(rhs) {
+			return "string"
+		}
+		return typeUnknown
+	case *ast.ArithmeticOpExpr:
+		return tc.arithType(ex.Operator, tc.expr(ex.Lhs), tc.expr(ex.Rhs), ex.Line())
+	case *ast.UnaryMinusOpExpr:
+		typ := tc.expr(ex.Expr)
+		return tc.arithType("-", typ, typ, ex.Line())
+	case *ast.UnaryNotOpExpr:
+		tc.expr(ex.Expr)
+		return "bool"
+	case *ast.UnaryBitNotOpExpr:
+		tc.expr(ex.Expr)
+		return "number"
+	case *ast.UnaryLenOpExpr:
+		switch typ := tc.expr(ex.Expr); typ {
+		case "string", "table":
+			return "number"
+		case "nil", "bool", "number", "function":
+			tc.errorf(ex.Line(), "attempt to get length of a %s value", typ)
+		}
+		return typeUnknown
+	case *ast.FunctionExpr:
+		tc.function(ex)
+		return "function"
+	case *ast.TypeAssertionExpr:
+		typ, expected := tc.expr(ex.Expr), annotation(ex.Type)
+		if !typeCompatible(expected, typ) {
+			tc.errorf(ex.Line(), "impossible type assertion: %s value is never %s", typ, expected)
+		}
+		return expected
+	}
+	return typeUnknown
+}
+
+func isStringOrNumber(typ string) bool {
+	return typ == "string" || typ == "number"
+}
+
+// arithType returns the type of an arithmetic operation on values of type lhs and rhs.
+func (tc *typeChecker) arithType(op, lhs, rhs string, line int) string {
+	for _, typ := range []string{lhs, rhs} {
+		switch typ {
+		case "nil", "bool", "function":
+			tc.errorf(line, "attempt to perform arithmetic (%s) on a %s value", op, typ)
+			return typeUnknown
+		}
+	}
+	if isStringOrNumber(lhs) && isStringOrNumber(rhs) {
+		return "number"
+	}
+	return typeUnknown
+}
+
+// call checks a function call and returns the type of its first result.
+func (tc *typeChecker) call(ex *ast.FuncCallExpr) string {
+	if ex.Func == nil {
+		tc.expr(ex.Receiver)
+		tc.exprTypes(ex.Args, 0)
+		return typeUnknown
+	}
+
+	typ := tc.expr(ex.Func)
+	switch typ {
+	case "nil", "bool", "number", "string":
+		tc.errorf(ex.Line(), "attempt to call a %s value", typ)
+	}
+	var fn *ast.FunctionExpr
+	name := "?"
+	if ident, ok := ex.Func.(*ast.IdentExpr); ok {
+		name = ident.Value
+		if sym := tc.lookup(ident.Value); sym != nil {
+			fn = sym.fn
+		} else {
+			fn = tc.globals[ident.Value]
+		}
+	}
+	if fn == nil {
+		tc.exprTypes(ex.Args, 0)
+		return typeUnknown
+	}
+
+	params := fn.ParList
+	args := tc.exprTypes(ex.Args, len(params.Names))
+	for i := range params.Names {
+		expected := annotationAt(params.Types, i)
+		if actual := args[i]; !typeCompatible(expected, actual) {
+			if i >= len(ex.Args) && actual == "nil" {
+				actual = "no value"
+			}
+			tc.errorf(ex.Line(), "bad argument #%d to '%s' (%s expected, got %s)", i+1, name, expected, actual)
+		}
+	}
+	return annotation(fn.ReturnType)
+}
+
+/* }}} */
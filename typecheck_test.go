@@ -0,0 +1,130 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+
+	"milklua/parse"
+)
+
+func checkTypes(t *testing.T, src string) []*TypeError {
+	t.Helper()
+	chunk, err := parse.Parse(strings.NewReader(src), "<check>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CheckTypes(chunk, "<check>")
+}
+
+func TestCheckTypes(t *testing.T) {
+	cases := []struct {
+		src string
+		// the expected error messages, in order
+		errors []string
+	}{
+		{`local x: number = 1 local s: string = "a" .. x local b: bool = x > 1`, nil},
+		{`local x: number, y: string = 1`, []string{"cannot assign nil to 'y' (string)"}},
+		// an explicit nil declares the local like an omitted value
+		{`local x: number = nil local y: string, z: bool = "a", nil x = 1 y = nil`, []string{
+			"cannot assign nil to 'y' (string)",
+		}},
+		{`local x: number x = "a"`, []string{"cannot assign string to 'x' (number)"}},
+		{`local x: number x += 1 local s: string s += 1`, []string{"cannot assign number to 's' (string)"}},
+		{`local func f(a: number, b: string): table { return {} }
+		  f(1, "a") f("a", "b") f(1)`, []string{
+			"bad argument #1 to 'f' (number expected, got string)",
+			"bad argument #2 to 'f' (string expected, got no value)",
+		}},
+		{`func f(): number { if true { return "a" } return }`, []string{
+			"cannot return string, number expected",
+			"missing return value, number expected",
+		}},
+		// global functions can be called before they are defined
+		{`func g() { local s: string = f() } func f(): number { return 1 }`, []string{"cannot assign number to 's' (string)"}},
+		// calls of functions without annotations and of reassigned globals are not checked
+		{`func f(a) { return a } f = func(a: string): bool { return true } local n: number = f(1)`, nil},
+		{`local n = (1).(string) local s: string = ("a").(string)`, []string{"impossible type assertion: number value is never string"}},
+		{`local n = 1 + true local s = nil .. "a" local l = #1 local c = (1)()`, []string{
+			"attempt to perform arithmetic (+) on a bool value",
+			"attempt to concatenate a nil value",
+			"attempt to get length of a number value",
+			"attempt to call a number value",
+		}},
+		{`for i = 1, 10 { local s: string = i } for k, v in IPairs({}) { local s: string = v }`, []string{
+			"cannot assign number to 's' (string)",
+		}},
+		// an inner local shadows the annotated one
+		{`local x: number = 1 { local x = "a" x = true }`, nil},
+		{"local n: number = `${1}`", []string{"cannot assign string to 'n' (number)"}},
+		{`local n: number = nil ?? 1 local s: string = f() ?? 1 local v = (1)?.x`, []string{
+			"attempt to index a number value",
+		}},
+		{`local n: number = 1 switch n { case 1, "a" { local s: string = n } case string, number { } }`, []string{
+			"cannot assign number to 's' (string)",
+			"impossible type case: number value is never string",
+		}},
+	}
+	for _, c := range cases {
+		errs := checkTypes(t, c.src)
+		var msgs []string
+		for _, err := range errs {
+			msgs = append(msgs, err.Message)
+		}
+		if strings.Join(msgs, "\n") != strings.Join(c.errors, "\n") {
+			t.Errorf("%s\nexpected errors:\n%s\ngot:\n%s", c.src, strings.Join(c.errors, "\n"), strings.Join(msgs, "\n"))
+		}
+	}
+
+	errs := checkTypes(t, "\nlocal x: number = \"a\"")
+	if len(errs) != 1 || errs[0].Line != 2 || errs[0].Error() != `type error near line(2) <check>: cannot assign string to 'x' (number)` {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestTypeAnnotationsAreErased(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		local func join(a: string, b: string, ...): string {
+			return a .. b
+		}
+		local n: number, s: string = 1
+		result = join(n, "x", 3)
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if result := L.GetGlobal("result"); result != LString("1x") {
+		t.Errorf("unexpected result %v", result)
+	}
+}
+
+func TestStrictTypes(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	if err := L.DoString(`result = ("a").(number)`); err != nil {
+		t.Fatal(err)
+	}
+	if result := L.GetGlobal("result"); result != LNil {
+		t.Errorf("failed assertion should yield nil, got %v", result)
+	}
+
+	L = NewState(Options{StrictTypes: true})
+	defer L.Close()
+	if err := L.DoString(`result = (1).(number) + #("ab").(string)`); err != nil {
+		t.Fatal(err)
+	}
+	if result := L.GetGlobal("result"); result != LInteger(3) {
+		t.Errorf("unexpected result %v", result)
+	}
+	err := L.DoString(`local t = {} local ok, err = PCall(func() { return t.x.(string) }) msg = err`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := L.GetGlobal("msg").String(); !strings.Contains(msg, "type assertion failed: string expected, got nil") {
+		t.Errorf("unexpected error %q", msg)
+	}
+	co, _ := L.NewThread()
+	if _, err, _ := L.Resume(co, L.NewFunctionFromProto(compileTestProto(t, L, `return (true).(table)`))); err == nil {
+		t.Error("threads should inherit strict mode")
+	}
+}
@@ -17,13 +17,17 @@ var URLLibFuncDoc = map[string]libFuncDoc{
 		libFuncName: []string{
 			"Encode",
 			"Decode",
+			"EncodeQuery",
+			"DecodeQuery",
 		},
 	},
 }
 
 var urlFuncs = map[string]LGFunction{
-	"Encode": urlEncode,
-	"Decode": urlDecode,
+	"Encode":      urlEncode,
+	"Decode":      urlDecode,
+	"EncodeQuery": urlEncodeQuery,
+	"DecodeQuery": urlDecodeQuery,
 }
 
 // urlEncode 模块函数，用于将字符串进行 URL 编码
@@ -69,3 +73,46 @@ func urlDecode(L *LState) int {
 	L.Push(LString(decoded))
 	return 1
 }
+
+// urlEncodeQuery 模块函数，用于将 table 编码为 URL 查询字符串
+// 参数：
+//  1. fields (table) - 键值表，值可以是 string、number 或由它们组成的数组
+//
+// 返回值：
+//  1. string（编码后的查询字符串，按键名排序）
+//
+// 调用方式：
+//  1. local query = urllib.EncodeQuery(fields)
+//
+// 示例：
+//  1. urllib.EncodeQuery({q="milk lua", tag={"a", "b"}}) -- "q=milk+lua&tag=a&tag=b"
+func urlEncodeQuery(L *LState) int {
+	fields := L.CheckTable(1)
+	L.Push(LString(tableToValues(L, fields).Encode()))
+	return 1
+}
+
+// urlDecodeQuery 模块函数，用于将 URL 查询字符串解析为 table
+// 参数：
+//  1. query (string) - 查询字符串，例如 "a=1&b=2"
+//
+// 返回值：
+//  1. table（解析后的键值表，同名的多个值解析为数组）
+//  2. string（错误信息）
+//
+// 调用方式：
+//  1. local fields, err = urllib.DecodeQuery(query)
+//
+// 备注：
+//  1. 如果解析过程中出现错误，则会返回 nil 和错误信息
+func urlDecodeQuery(L *LState) int {
+	query := L.CheckString(1)
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		L.Push(LNil)
+		L.Push(LString(fmt.Sprintf("URL decode error: %v", err)))
+		return 2
+	}
+	L.Push(headerToTable(L, values))
+	return 1
+}
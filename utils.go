@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -136,10 +137,6 @@ func isInteger(v LNumber) bool {
 	//return frac == 0.0
 }
 
-func isArrayKey(v LNumber) bool {
-	return isInteger(v) && v < LNumber(int((^uint(0))>>1)) && v > LNumber(0) && v < LNumber(MaxArrayIndex)
-}
-
 func parseNumber(number string) (LNumber, error) {
 	var value LNumber
 	number = strings.Trim(number, " \t\n")
@@ -155,6 +152,34 @@ func parseNumber(number string) (LNumber, error) {
 	return value, nil
 }
 
+// parseNumberValue converts a numeral to an integer if it has no fraction or exponent and fits in 64 bits,
+// and to a float otherwise. Hexadecimal integers wrap around like in Lua 5.3.
+func parseNumberValue(number string) (LValue, error) {
+	number = strings.Trim(number, " \t\n")
+	if v, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return LInteger(v), nil
+	}
+	if len(number) > 2 && number[0] == '0' && (number[1] == 'x' || number[1] == 'X') {
+		if v, err := strconv.ParseUint(number, 0, 64); err == nil {
+			return LInteger(int64(v)), nil
+		}
+	}
+	v, err := strconv.ParseFloat(number, LNumberBit)
+	if err != nil {
+		return LNumber(0), err
+	}
+	return LNumber(v), nil
+}
+
+// float2integer converts a float to an integer if it has an exact integer representation.
+func float2integer(v LNumber) (LInteger, bool) {
+	f := float64(v)
+	if f >= -(1<<63) && f < 1<<63 && f == math.Trunc(f) {
+		return LInteger(f), true
+	}
+	return 0, false
+}
+
 func popenArgs(arg string) (string, []string) {
 	cmd := "/bin/sh"
 	args := []string{"-c"}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type LValueType int
@@ -41,7 +44,7 @@ func LVAsBool(v LValue) bool { return v != LNil && v != LFalse }
 // if the LValue is a string or number, otherwise an empty string.
 func LVAsString(v LValue) string {
 	switch sn := v.(type) {
-	case LString, LNumber:
+	case LString, LNumber, LInteger:
 		return sn.String()
 	default:
 		return ""
@@ -52,7 +55,7 @@ func LVAsString(v LValue) string {
 // otherwise false.
 func LVCanConvToString(v LValue) bool {
 	switch v.(type) {
-	case LString, LNumber:
+	case LString, LNumber, LInteger:
 		return true
 	default:
 		return false
@@ -64,6 +67,8 @@ func LVAsNumber(v LValue) LNumber {
 	switch lv := v.(type) {
 	case LNumber:
 		return lv
+	case LInteger:
+		return LNumber(lv)
 	case LString:
 		if num, err := parseNumber(string(lv)); err == nil {
 			return num
@@ -72,6 +77,35 @@ func LVAsNumber(v LValue) LNumber {
 	return LNumber(0)
 }
 
+// LVToNumber returns the value of a number, which may be an LNumber or an LInteger. Strings are not converted.
+// Host code which used v.(LNumber) to read numbers must use it, as integer values such as the 1 in
+// `return 1` are LIntegers.
+func LVToNumber(v LValue) (LNumber, bool) {
+	switch lv := v.(type) {
+	case LNumber:
+		return lv, true
+	case LInteger:
+		return LNumber(lv), true
+	}
+	return 0, false
+}
+
+// LVAsInteger tries to convert a given LValue to an integer. Floats and strings are converted only if
+// they have an exact integer representation, otherwise ok is false.
+func LVAsInteger(v LValue) (LInteger, bool) {
+	switch lv := v.(type) {
+	case LInteger:
+		return lv, true
+	case LNumber:
+		return float2integer(lv)
+	case LString:
+		if num, err := parseNumberValue(string(lv)); err == nil {
+			return LVAsInteger(num)
+		}
+	}
+	return 0, false
+}
+
 type LNilType struct{}
 
 func (nl *LNilType) String() string   { return "nil" }
@@ -125,7 +159,10 @@ func (nm LNumber) Format(f fmt.State, c rune) {
 	switch c {
 	case 'q', 's':
 		defaultFormat(nm.String(), f, c)
-	case 'b', 'c', 'd', 'o', 'x', 'X', 'U':
+	case 'o', 'x', 'X':
+		// like Lua, negative numbers are formatted as their two's complement
+		defaultFormat(uint64(int64(nm)), f, c)
+	case 'b', 'c', 'd', 'U':
 		defaultFormat(int64(nm), f, c)
 	case 'e', 'E', 'f', 'F', 'g', 'G':
 		defaultFormat(float64(nm), f, c)
@@ -140,6 +177,27 @@ func (nm LNumber) Format(f fmt.State, c rune) {
 	}
 }
 
+func (i LInteger) String() string { return strconv.FormatInt(int64(i), 10) }
+
+func (i LInteger) Type() LValueType { return LTNumber }
+
+// fmt.Formatter interface
+func (i LInteger) Format(f fmt.State, c rune) {
+	switch c {
+	case 'q', 's':
+		defaultFormat(i.String(), f, c)
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		defaultFormat(float64(i), f, c)
+	case 'i':
+		defaultFormat(int64(i), f, 'd')
+	case 'o', 'x', 'X':
+		// like Lua, negative integers are formatted as their two's complement
+		defaultFormat(uint64(i), f, c)
+	default:
+		defaultFormat(int64(i), f, c)
+	}
+}
+
 type LTable struct {
 	Metatable LValue
 
@@ -148,6 +206,10 @@ type LTable struct {
 	strdict map[string]LValue
 	keys    []LValue
 	k2i     map[LValue]int
+	// version changes whenever a string key is set, which invalidates the inline caches of the VM.
+	version uint64
+	// frozen tables are immutable, so they can be read from several LStates at once.
+	frozen bool
 }
 
 func (tb *LTable) String() string   { return fmt.Sprintf("table: %p", tb) }
@@ -174,6 +236,17 @@ type Global struct {
 	builtinMts map[int]LValue
 	tempFiles  []*os.File
 	gccount    int32
+	// memory accounting, shared with the threads running in other goroutines
+	memUsed  atomic.Int64
+	memLimit atomic.Int64
+	memCheck atomic.Int64
+
+	// userdata waiting to be finalized by a collection cycle, with their registration order
+	gcMutex    sync.Mutex
+	finalizers map[*LUserData]uint64
+	gcSeq      uint64
+	// values held by Go code, which collection cycles treat as reachable
+	gcRoots map[LValue]int
 }
 
 type LState struct {
@@ -195,6 +268,9 @@ type LState struct {
 	mainLoop     func(*LState, *callFrame)
 	ctx          context.Context
 	ctxCancelFn  context.CancelFunc
+	budget       *execBudget
+	hook         *lHook
+	icaches      map[*FunctionProto][]inlineCache
 }
 
 func (ls *LState) String() string   { return fmt.Sprintf("thread: %p", ls) }
@@ -204,6 +280,8 @@ type LUserData struct {
 	Value     interface{}
 	Env       *LTable
 	Metatable LValue
+	// set once the __gc metamethod has been called, see gc.go
+	finalized bool
 }
 
 func (ud *LUserData) String() string   { return fmt.Sprintf("userdata: %p", ud) }
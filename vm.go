@@ -22,8 +22,13 @@ func mainLoop(L *LState, baseframe *callFrame) {
 	}
 
 	for {
+		if L.hook != nil {
+			// a hook was set by the running code
+			mainLoopWithHooks(L, baseframe)
+			return
+		}
 		cf = L.currentFrame
-		inst = cf.Fn.Proto.Code[cf.Pc]
+		inst = cf.Fn.Proto.code[cf.Pc]
 		cf.Pc++
 		if jumpTable[int(inst>>26)](L, inst, baseframe) == 1 {
 			return
@@ -46,12 +51,17 @@ func mainLoopWithContext(L *LState, baseframe *callFrame) {
 	}
 
 	for {
+		if L.hook != nil {
+			// a hook was set by the running code
+			mainLoopWithHooks(L, baseframe)
+			return
+		}
 		cf = L.currentFrame
-		inst = cf.Fn.Proto.Code[cf.Pc]
+		inst = cf.Fn.Proto.code[cf.Pc]
 		cf.Pc++
 		select {
 		case <-L.ctx.Done():
-			L.RaiseError("context error: %v", L.ctx.Err().Error())
+			L.raiseContextError()
 			return
 		default:
 			if jumpTable[int(inst>>26)](L, inst, baseframe) == 1 {
@@ -61,6 +71,44 @@ func mainLoopWithContext(L *LState, baseframe *callFrame) {
 	}
 }
 
+func mainLoopWithHooks(L *LState, baseframe *callFrame) {
+	var inst uint32
+	var cf *callFrame
+
+	if L.stack.IsEmpty() {
+		return
+	}
+
+	L.currentFrame = L.stack.Last()
+	if L.currentFrame.Fn.IsG {
+		callGFunction(L, false)
+		return
+	}
+
+	for {
+		cf = L.currentFrame
+		inst = cf.Fn.Proto.Code[cf.Pc]
+		cf.Pc++
+		if L.ctx != nil {
+			select {
+			case <-L.ctx.Done():
+				L.raiseContextError()
+				return
+			default:
+			}
+		}
+		if L.budget != nil {
+			L.budget.step(L)
+		}
+		if L.hook != nil {
+			L.hook.trace(L, cf, cf.Pc-1)
+		}
+		if jumpTable[int(inst>>26)](L, inst, baseframe) == 1 {
+			return
+		}
+	}
+}
+
 /*
 // regv is the first target register to copy the return values to.
 // It can be reg.top, indicating that the copied values are going into new registers, or it can be below reg.top
@@ -198,7 +246,16 @@ func switchToParentThread(L *LState, nargs int, haserror bool, kill bool) {
 
 func callGFunction(L *LState, tailcall bool) bool {
 	frame := L.currentFrame
+	if L.hook != nil {
+		L.hook.traceG(L, HookCall)
+	}
 	gfnret := frame.Fn.GFunction(L)
+	if gfnret >= 0 && L.hook != nil {
+		L.hook.traceG(L, HookReturn)
+	}
+	if gfnret > 0 {
+		L.allocStrings(gfnret)
+	}
 	if tailcall {
 		L.currentFrame = L.RemoveCallerFrame()
 	}
@@ -270,12 +327,30 @@ func threadRun(L *LState) {
 
 	defer func() {
 		if rcv := recover(); rcv != nil {
+			var pending []deferredCall
+			if L.Parent != nil {
+				pending = L.pendingDefers(0)
+			}
+			L.closeAllUpvalues()
 			var lv LValue
-			if v, ok := rcv.(*ApiError); ok {
-				lv = v.Object
+			apiErr, isApiErr := rcv.(*ApiError)
+			if isApiErr {
+				lv = apiErr.Object
 			} else {
 				lv = LString(fmt.Sprint(rcv))
 			}
+			// the calls deferred by the coroutine run before it dies, and like in PCall an error they raise
+			// replaces the one being handled unless the script must stop
+			for _, dc := range pending {
+				L.Push(dc.fn)
+				for _, arg := range dc.args {
+					L.Push(arg)
+				}
+				if derr := L.PCall(len(dc.args), 0, nil); derr != nil && !(isApiErr &&
+					(apiErr.Type == ApiErrorBudget || apiErr.Type == ApiErrorCancel || apiErr.Type == ApiErrorMemory)) {
+					lv = derr.(*ApiError).Object
+				}
+			}
 			if parent := L.Parent; parent != nil {
 				if L.wrapped {
 					L.Push(lv)
@@ -295,10 +370,10 @@ func threadRun(L *LState) {
 
 type instFunc func(*LState, uint32, *callFrame) int
 
-var jumpTable [opCodeMax + 1]instFunc
+var jumpTable [opSuperMax + 1]instFunc
 
 func init() {
-	jumpTable = [opCodeMax + 1]instFunc{
+	jumpTable = [opSuperMax + 1]instFunc{
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_MOVE
 			reg := L.reg
 			cf := L.currentFrame
@@ -504,6 +579,10 @@ func init() {
 					}
 				}
 			}
+			if C := int(inst>>9) & 0x1ff; C != 0 { //GETC
+				// the nils are the results of a call, so they are the last values
+				reg.SetTop(lbase + B + 1)
+			}
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_GETUPVAL
@@ -544,7 +623,7 @@ func init() {
 			RA := lbase + A
 			Bx := int(inst & 0x3ffff) //GETBX
 			//reg.Set(RA, L.getField(cf.Fn.Env, cf.Fn.Proto.Constants[Bx]))
-			v := L.getFieldString(cf.Fn.Env, cf.Fn.Proto.stringConstants[Bx])
+			v := L.getFieldStringCached(cf.Fn.Env, cf.Fn.Proto.stringConstants[Bx], L.inlineCache(cf))
 			// this section is inlined by go-inline
 			// source function is 'func (rg *registry) Set(regi int, vali LValue) ' in '_state.go'
 			{
@@ -579,7 +658,7 @@ func init() {
 			key := L.rkValue(C)
 			var v LValue
 			if lstr, ok := obj.(LString); ok {
-				if lnum, ok := key.(LNumber); ok {
+				if lnum, ok := LVAsInteger(key); ok && key.Type() == LTNumber {
 					index := int(lnum) - 1
 					runeSlice := []rune(lstr)
 					if index >= 0 && index < len(runeSlice) {
@@ -643,7 +722,7 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
-			v := L.getFieldString(reg.Get(lbase+B), L.rkString(C))
+			v := L.getFieldStringCached(reg.Get(lbase+B), L.rkString(C), L.inlineCache(cf))
 			// this section is inlined by go-inline
 			// source function is 'func (rg *registry) Set(regi int, vali LValue) ' in '_state.go'
 			{
@@ -674,7 +753,7 @@ func init() {
 			RA := lbase + A
 			Bx := int(inst & 0x3ffff) //GETBX
 			//L.setField(cf.Fn.Env, cf.Fn.Proto.Constants[Bx], reg.Get(RA))
-			L.setFieldString(cf.Fn.Env, cf.Fn.Proto.stringConstants[Bx], reg.Get(RA))
+			L.setFieldStringCached(cf.Fn.Env, cf.Fn.Proto.stringConstants[Bx], reg.Get(RA), L.inlineCache(cf))
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_SETUPVAL
@@ -706,7 +785,7 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
-			L.setFieldString(reg.Get(RA), L.rkString(B), L.rkValue(C))
+			L.setFieldStringCached(reg.Get(RA), L.rkString(B), L.rkValue(C), L.inlineCache(cf))
 			return 0
 		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_NEWTABLE
@@ -717,6 +796,7 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
+			L.allocMemory(tableMemSize(B, C))
 			v := newLTable(B, C)
 			// this section is inlined by go-inline
 			// source function is 'func (rg *registry) Set(regi int, vali LValue) ' in '_state.go'
@@ -749,7 +829,7 @@ func init() {
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
 			selfobj := reg.Get(lbase + B)
-			v := L.getFieldString(selfobj, L.rkString(C))
+			v := L.getFieldStringCached(selfobj, L.rkString(C), L.inlineCache(cf))
 			// this section is inlined by go-inline
 			// source function is 'func (rg *registry) Set(regi int, vali LValue) ' in '_state.go'
 			{
@@ -806,7 +886,9 @@ func init() {
 			RA := lbase + A
 			B := int(inst & 0x1ff) //GETB
 			unaryv := L.rkValue(B)
-			if nm, ok := unaryv.(LNumber); ok {
+			if nm, ok := unaryv.(LInteger); ok {
+				reg.SetInteger(RA, -nm)
+			} else if nm, ok := unaryv.(LNumber); ok {
 				// this section is inlined by go-inline
 				// source function is 'func (rg *registry) Set(regi int, vali LValue) ' in '_state.go'
 				{
@@ -951,7 +1033,7 @@ func init() {
 				{
 					rg := reg
 					regi := RA
-					vali := LNumber(runeCount)
+					vali := LInteger(runeCount)
 					newSize := regi + 1
 					// this section is inlined by go-inline
 					// source function is 'func (rg *registry) checkSize(requiredSize int) ' in '_state.go'
@@ -961,7 +1043,7 @@ func init() {
 							rg.resize(requiredSize)
 						}
 					}
-					rg.array[regi] = rg.alloc.LNumber2I(vali)
+					rg.array[regi] = rg.alloc.LInteger2I(vali)
 					if regi >= rg.top {
 						rg.top = regi + 1
 					}
@@ -973,48 +1055,24 @@ func init() {
 					reg.Push(lv)
 					L.Call(1, 1)
 					ret := reg.Pop()
-					if ret.Type() == LTNumber {
-						v, _ := ret.(LNumber)
+					// this section is inlined by go-inline
+					// source function is 'func (rg *registry) Set(regi int, vali LValue) ' in '_state.go'
+					{
+						rg := reg
+						regi := RA
+						vali := ret
+						newSize := regi + 1
 						// this section is inlined by go-inline
-						// source function is 'func (rg *registry) SetNumber(regi int, vali LNumber) ' in '_state.go'
+						// source function is 'func (rg *registry) checkSize(requiredSize int) ' in '_state.go'
 						{
-							rg := reg
-							regi := RA
-							vali := v
-							newSize := regi + 1
-							// this section is inlined by go-inline
-							// source function is 'func (rg *registry) checkSize(requiredSize int) ' in '_state.go'
-							{
-								requiredSize := newSize
-								if requiredSize > cap(rg.array) {
-									rg.resize(requiredSize)
-								}
-							}
-							rg.array[regi] = rg.alloc.LNumber2I(vali)
-							if regi >= rg.top {
-								rg.top = regi + 1
+							requiredSize := newSize
+							if requiredSize > cap(rg.array) {
+								rg.resize(requiredSize)
 							}
 						}
-					} else {
-						// this section is inlined by go-inline
-						// source function is 'func (rg *registry) Set(regi int, vali LValue) ' in '_state.go'
-						{
-							rg := reg
-							regi := RA
-							vali := ret
-							newSize := regi + 1
-							// this section is inlined by go-inline
-							// source function is 'func (rg *registry) checkSize(requiredSize int) ' in '_state.go'
-							{
-								requiredSize := newSize
-								if requiredSize > cap(rg.array) {
-									rg.resize(requiredSize)
-								}
-							}
-							rg.array[regi] = vali
-							if regi >= rg.top {
-								rg.top = regi + 1
-							}
+						rg.array[regi] = vali
+						if regi >= rg.top {
+							rg.top = regi + 1
 						}
 					}
 				} else if lv.Type() == LTTable {
@@ -1023,7 +1081,7 @@ func init() {
 					{
 						rg := reg
 						regi := RA
-						vali := LNumber(lv.(*LTable).Len())
+						vali := LInteger(lv.(*LTable).Len())
 						newSize := regi + 1
 						// this section is inlined by go-inline
 						// source function is 'func (rg *registry) checkSize(requiredSize int) ' in '_state.go'
@@ -1033,7 +1091,7 @@ func init() {
 								rg.resize(requiredSize)
 							}
 						}
-						rg.array[regi] = rg.alloc.LNumber2I(vali)
+						rg.array[regi] = rg.alloc.LInteger2I(vali)
 						if regi >= rg.top {
 							rg.top = regi + 1
 						}
@@ -1118,36 +1176,7 @@ func init() {
 			A := int(inst>>18) & 0xff //GETA
 			B := int(inst & 0x1ff)    //GETB
 			C := int(inst>>9) & 0x1ff //GETC
-			lhs := L.rkValue(B)
-			rhs := L.rkValue(C)
-			ret := false
-
-			if v1, ok1 := lhs.(LNumber); ok1 {
-				if v2, ok2 := rhs.(LNumber); ok2 {
-					ret = v1 <= v2
-				} else {
-					L.RaiseError("attempt to compare %v with %v", lhs.Type().String(), rhs.Type().String())
-				}
-			} else {
-				if lhs.Type() != rhs.Type() {
-					L.RaiseError("attempt to compare %v with %v", lhs.Type().String(), rhs.Type().String())
-				}
-				switch lhs.Type() {
-				case LTString:
-					// ret = strCmp(string(lhs.(LString)), string(rhs.(LString))) <= 0
-					ret = strings.Compare(string(lhs.(LString)), string(rhs.(LString))) <= 0
-				default:
-					switch objectRational(L, lhs, rhs, "__le") {
-					case 1:
-						ret = true
-					case 0:
-						ret = false
-					default:
-						ret = !objectRationalWithError(L, rhs, lhs, "__lt")
-					}
-				}
-			}
-
+			ret := lessEqual(L, L.rkValue(B), L.rkValue(C))
 			v := 1
 			if ret {
 				v = 0
@@ -1324,11 +1353,12 @@ func init() {
 							if CompatVarArg {
 								ls.reg.SetTop(cf.LocalBase + nargs + np + 1)
 								if (proto.IsVarArg & VarArgNeedsArg) != 0 {
+									ls.allocMemory(tableMemSize(nvarargs, 1))
 									argtb := newLTable(nvarargs, 0)
 									for i := 0; i < nvarargs; i++ {
 										argtb.RawSetInt(i+1, ls.reg.Get(cf.LocalBase+np+i))
 									}
-									argtb.RawSetString("n", LNumber(nvarargs))
+									argtb.RawSetString("n", LInteger(nvarargs))
 									//ls.reg.Set(cf.LocalBase+nargs+np, argtb)
 									ls.reg.array[cf.LocalBase+nargs+np] = argtb
 								} else {
@@ -1413,6 +1443,7 @@ func init() {
 			} else {
 				base := cf.Base
 				cf.Fn = callable
+				cf.caches = nil
 				cf.Pc = 0
 				cf.Base = RA
 				cf.LocalBase = RA + 1
@@ -1504,11 +1535,12 @@ func init() {
 							if CompatVarArg {
 								ls.reg.SetTop(cf.LocalBase + nargs + np + 1)
 								if (proto.IsVarArg & VarArgNeedsArg) != 0 {
+									ls.allocMemory(tableMemSize(nvarargs, 1))
 									argtb := newLTable(nvarargs, 0)
 									for i := 0; i < nvarargs; i++ {
 										argtb.RawSetInt(i+1, ls.reg.Get(cf.LocalBase+np+i))
 									}
-									argtb.RawSetString("n", LNumber(nvarargs))
+									argtb.RawSetString("n", LInteger(nvarargs))
 									//ls.reg.Set(cf.LocalBase+nargs+np, argtb)
 									ls.reg.array[cf.LocalBase+nargs+np] = argtb
 								} else {
@@ -1831,6 +1863,20 @@ func init() {
 			lbase := cf.LocalBase
 			A := int(inst>>18) & 0xff //GETA
 			RA := lbase + A
+			if index, ok := reg.Get(RA).(LInteger); ok {
+				// integer loop, R(A+1) is the number of remaining iterations
+				if count := uint64(reg.Get(RA + 1).(LInteger)); count > 0 {
+					index += reg.Get(RA + 2).(LInteger)
+					reg.SetInteger(RA+1, LInteger(count-1))
+					reg.SetInteger(RA, index)
+					reg.SetInteger(RA+3, index)
+					Sbx := int(inst&0x3ffff) - opMaxArgSbx //GETSBX
+					cf.Pc += Sbx
+				} else {
+					reg.SetTop(RA + 1)
+				}
+				return 0
+			}
 			if init, ok1 := reg.Get(RA).(LNumber); ok1 {
 				if limit, ok2 := reg.Get(RA + 1).(LNumber); ok2 {
 					if step, ok3 := reg.Get(RA + 2).(LNumber); ok3 {
@@ -1929,34 +1975,34 @@ func init() {
 			A := int(inst>>18) & 0xff //GETA
 			RA := lbase + A
 			Sbx := int(inst&0x3ffff) - opMaxArgSbx //GETSBX
-			if init, ok1 := reg.Get(RA).(LNumber); ok1 {
-				if step, ok2 := reg.Get(RA + 2).(LNumber); ok2 {
-					// this section is inlined by go-inline
-					// source function is 'func (rg *registry) SetNumber(regi int, vali LNumber) ' in '_state.go'
-					{
-						rg := reg
-						regi := RA
-						vali := LNumber(init - step)
-						newSize := regi + 1
-						// this section is inlined by go-inline
-						// source function is 'func (rg *registry) checkSize(requiredSize int) ' in '_state.go'
-						{
-							requiredSize := newSize
-							if requiredSize > cap(rg.array) {
-								rg.resize(requiredSize)
-							}
-						}
-						rg.array[regi] = rg.alloc.LNumber2I(vali)
-						if regi >= rg.top {
-							rg.top = regi + 1
-						}
+			init, limit, step := reg.Get(RA), reg.Get(RA+1), reg.Get(RA+2)
+			if init.Type() != LTNumber {
+				L.RaiseError("for statement init must be a number")
+			}
+			if limit.Type() != LTNumber {
+				L.RaiseError("for statement limit must be a number")
+			}
+			if step.Type() != LTNumber {
+				L.RaiseError("for statement step must be a number")
+			}
+			if LVAsNumber(step) == 0 {
+				L.RaiseError("for statement step is zero")
+			}
+			if iinit, ok := init.(LInteger); ok {
+				if istep, ok := step.(LInteger); ok {
+					// counting the iterations in advance avoids overflows of the loop index
+					if count, ok := forLoopCount(iinit, limit, istep); ok {
+						reg.SetInteger(RA+1, LInteger(count))
+						reg.SetInteger(RA+3, iinit)
+					} else {
+						cf.Pc += Sbx + 1
 					}
-				} else {
-					L.RaiseError("for statement step must be a number")
+					return 0
 				}
-			} else {
-				L.RaiseError("for statement init must be a number")
 			}
+			reg.SetNumber(RA+1, LVAsNumber(limit))
+			reg.SetNumber(RA+2, LVAsNumber(step))
+			reg.SetNumber(RA, LVAsNumber(init)-LVAsNumber(step))
 			cf.Pc += Sbx
 			return 0
 		},
@@ -2104,6 +2150,9 @@ func init() {
 			if B == 0 {
 				nelem = reg.Top() - RA - 1
 			}
+			if grow := offset + nelem - cap(table.array); grow > 0 {
+				L.allocMemory(int64(grow) * memTableSlotSize)
+			}
 			for i := 1; i <= nelem; i++ {
 				table.RawSetInt(offset+i, reg.Get(RA+i))
 			}
@@ -2144,6 +2193,7 @@ func init() {
 			RA := lbase + A
 			Bx := int(inst & 0x3ffff) //GETBX
 			proto := cf.Fn.Proto.FunctionPrototypes[Bx]
+			L.allocMemory(functionMemSize(int(proto.NumUpvalues)))
 			closure := newLFunctionL(proto, cf.Fn.Env, int(proto.NumUpvalues))
 			// this section is inlined by go-inline
 			// source function is 'func (rg *registry) Set(regi int, vali LValue) ' in '_state.go'
@@ -2240,6 +2290,23 @@ func init() {
 		opBitwise, // OP_BOR
 		opBitwise, // OP_SHL
 		opBitwise, // OP_SHR
+		opBitwise, // OP_BXOR
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_BNOT
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			B := int(inst & 0x1ff) //GETB
+			v := reg.Get(lbase + B)
+			if iv, ok := v.(LInteger); ok {
+				reg.SetInteger(RA, ^iv)
+			} else {
+				reg.Set(RA, objectBitwise(L, OP_BNOT, v, v))
+			}
+			return 0
+		},
+		opArith, // OP_IDIV
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_TYPEASSERT
 			reg := L.reg
 			cf := L.currentFrame
@@ -2258,12 +2325,11 @@ func init() {
 				_, typeCheckOK = v.(LBool)
 				defaultValue = LNil
 			case 1: //number
-				num, ok := v.(LNumber)
-				typeCheckOK = ok
-				if !ok {
+				typeCheckOK = v.Type() == LTNumber
+				if !typeCheckOK {
 					defaultValue = LNil
 				} else {
-					defaultValue = num
+					defaultValue = v
 				}
 			case 2: //string
 				str, ok := v.(LString)
@@ -2291,6 +2357,9 @@ func init() {
 			default:
 				panic("invalid type in type assertion")
 			}
+			if !typeCheckOK && L.Options.StrictTypes {
+				L.RaiseError("type assertion failed: %s expected, got %s", typeKindNames[C], v.Type().String())
+			}
 
 			if typeCheckOK {
 				// this section is inlined by go-inline
@@ -2337,13 +2406,122 @@ func init() {
 			}
 			return 0
 		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_TOSTRING
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			B := int(inst & 0x1ff) //GETB
+			v := reg.Get(lbase + B)
+			if _, ok := v.(LString); !ok {
+				v = L.ToStringMeta(v)
+			}
+			reg.Set(RA, v)
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_DEFER
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			B := int(inst & 0x1ff)    //GETB
+			C := int(inst>>9) & 0x1ff //GETC
+			nargs := B - 1
+			if B == 0 {
+				nargs = reg.Top() - (RA + 1)
+			}
+			fn := reg.Get(RA)
+			if _, ok := fn.(*LFunction); !ok {
+				if _, meta := L.metaCall(fn); !meta {
+					L.RaiseError("attempt to defer a non-function object")
+				}
+			}
+			args := make([]LValue, nargs)
+			for i := range args {
+				args[i] = reg.Get(RA + 1 + i)
+			}
+			cf.defers = append(cf.defers, deferredCall{level: C, fn: fn, args: args})
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_RUNDEFER
+			A := int(inst>>18) & 0xff //GETA
+			L.runDefers(L.currentFrame, A)
+			return 0
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_SWITCH
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			Bx := int(inst & 0x3ffff) //GETBX
+			cf.Pc += cf.Fn.Proto.SwitchTables[Bx].jump(reg.Get(RA))
+			return 0
+		},
 		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_NOP
 			return 0
 		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_EQJMP
+			cf := L.currentFrame
+			A := int(inst>>18) & 0xff //GETA
+			B := int(inst & 0x1ff)    //GETB
+			C := int(inst>>9) & 0x1ff //GETC
+			return superJump(cf, equals(L, L.rkValue(B), L.rkValue(C), false) == (A != 0))
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_LTJMP
+			cf := L.currentFrame
+			A := int(inst>>18) & 0xff //GETA
+			B := int(inst & 0x1ff)    //GETB
+			C := int(inst>>9) & 0x1ff //GETC
+			return superJump(cf, lessThan(L, L.rkValue(B), L.rkValue(C)) == (A != 0))
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_LEJMP
+			cf := L.currentFrame
+			A := int(inst>>18) & 0xff //GETA
+			B := int(inst & 0x1ff)    //GETB
+			C := int(inst>>9) & 0x1ff //GETC
+			return superJump(cf, lessEqual(L, L.rkValue(B), L.rkValue(C)) == (A != 0))
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_TESTJMP
+			reg := L.reg
+			cf := L.currentFrame
+			lbase := cf.LocalBase
+			A := int(inst>>18) & 0xff //GETA
+			RA := lbase + A
+			C := int(inst>>9) & 0x1ff //GETC
+			return superJump(cf, LVAsBool(reg.Get(RA)) != (C == 0))
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_GETTABLEKSCALL
+			jumpTable[OP_GETTABLEKS](L, inst, baseframe)
+			return superCall(L, baseframe)
+		},
+		func(L *LState, inst uint32, baseframe *callFrame) int { //OP_SELFCALL
+			jumpTable[OP_SELF](L, inst, baseframe)
+			return superCall(L, baseframe)
+		},
+	}
+}
+
+// superJump executes the JMP following a fused test instruction if jump is true, and skips it otherwise.
+func superJump(cf *callFrame, jump bool) int {
+	if jump {
+		cf.Pc += int(cf.Fn.Proto.code[cf.Pc]&0x3ffff) - opMaxArgSbx //GETSBX
 	}
+	cf.Pc++
+	return 0
+}
+
+// superCall executes the CALL following a fused instruction.
+func superCall(L *LState, baseframe *callFrame) int {
+	cf := L.currentFrame
+	inst := cf.Fn.Proto.code[cf.Pc]
+	cf.Pc++
+	return jumpTable[OP_CALL](L, inst, baseframe)
 }
 
-func opArith(L *LState, inst uint32, baseframe *callFrame) int { //OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW
+func opArith(L *LState, inst uint32, baseframe *callFrame) int { //OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW, OP_IDIV
 	reg := L.reg
 	cf := L.currentFrame
 	lbase := cf.LocalBase
@@ -2354,6 +2532,12 @@ func opArith(L *LState, inst uint32, baseframe *callFrame) int { //OP_ADD, OP_SU
 	C := int(inst>>9) & 0x1ff //GETC
 	lhs := L.rkValue(B)
 	rhs := L.rkValue(C)
+	if i1, ok1 := lhs.(LInteger); ok1 {
+		if i2, ok2 := rhs.(LInteger); ok2 {
+			reg.Set(RA, integerArith(L, opcode, i1, i2))
+			return 0
+		}
+	}
 	v1, ok1 := lhs.(LNumber)
 	v2, ok2 := rhs.(LNumber)
 	if ok1 && ok2 {
@@ -2404,38 +2588,149 @@ func opArith(L *LState, inst uint32, baseframe *callFrame) int { //OP_ADD, OP_SU
 	return 0
 }
 
-func opBitwise(L *LState, inst uint32, _ *callFrame) int {
+func opBitwise(L *LState, inst uint32, _ *callFrame) int { //OP_BAND, OP_BOR, OP_BXOR, OP_SHL, OP_SHR
 	reg := L.reg
 	cf := L.currentFrame
 	lbase := cf.LocalBase
 	A := int(inst>>18) & 0xff //GETA
 	RA := lbase + A
+	opcode := int(inst >> 26) //GETOPCODE
 	B := int(inst & 0x1ff)    //GETB
 	C := int(inst>>9) & 0x1ff //GETC
 	lhs := L.rkValue(B)
 	rhs := L.rkValue(C)
+	if v1, ok1 := lhs.(LInteger); ok1 {
+		if v2, ok2 := rhs.(LInteger); ok2 {
+			reg.SetInteger(RA, integerBitwise(opcode, v1, v2))
+			return 0
+		}
+	}
+	reg.Set(RA, objectBitwise(L, opcode, lhs, rhs))
+	return 0
+}
 
-	v1, ok1 := lhs.(LNumber)
-	v2, ok2 := rhs.(LNumber)
+func integerBitwise(opcode int, lhs, rhs LInteger) LInteger {
+	switch opcode {
+	case OP_BAND:
+		return lhs & rhs
+	case OP_BOR:
+		return lhs | rhs
+	case OP_BXOR:
+		return lhs ^ rhs
+	case OP_SHL:
+		return shiftLeft(lhs, rhs)
+	case OP_SHR:
+		return shiftLeft(lhs, -rhs)
+	case OP_BNOT:
+		return ^lhs
+	}
+	panic("bitwise operation not supported")
+}
 
-	if !ok1 || !ok2 {
-		L.RaiseError("attempt to perform bitwise operation on non-number value")
+// shiftLeft shifts x left by n bits, or right if n is negative. Like in Lua 5.3, right shifts fill the
+// vacant bits with zeros, and shifting by 64 bits or more gives 0.
+func shiftLeft(x, n LInteger) LInteger {
+	if n < 0 {
+		if n <= -64 {
+			return 0
+		}
+		return LInteger(uint64(x) >> uint64(-n))
+	}
+	if n >= 64 {
+		return 0
 	}
+	return x << uint64(n)
+}
 
-	var result LNumber
-	switch opcode := int(inst >> 26); opcode {
+// objectBitwise performs a bitwise operation on operands that are not both integers. Floats with an
+// integer value and numeric strings are converted to integers, other operands need a metamethod.
+func objectBitwise(L *LState, opcode int, lhs, rhs LValue) LValue {
+	event := ""
+	switch opcode {
 	case OP_BAND:
-		result = LNumber(int64(v1) & int64(v2))
+		event = "__band"
 	case OP_BOR:
-		result = LNumber(int64(v1) | int64(v2))
+		event = "__bor"
+	case OP_BXOR:
+		event = "__bxor"
 	case OP_SHL:
-		result = LNumber(int64(v1) << uint64(v2))
+		event = "__shl"
 	case OP_SHR:
-		result = LNumber(int64(v1) >> uint64(v2))
+		event = "__shr"
+	case OP_BNOT:
+		event = "__bnot"
+	}
+	lnum, rnum := lhs, rhs
+	if str, ok := lnum.(LString); ok {
+		if v, err := parseNumberValue(string(str)); err == nil {
+			lnum = v
+		}
+	}
+	if str, ok := rnum.(LString); ok {
+		if v, err := parseNumberValue(string(str)); err == nil {
+			rnum = v
+		}
 	}
+	v1, ok1 := LVAsInteger(lnum)
+	v2, ok2 := LVAsInteger(rnum)
+	if ok1 && ok2 {
+		return integerBitwise(opcode, v1, v2)
+	}
+	op := L.metaOp2(lhs, rhs, event)
+	if _, ok := op.(*LFunction); ok {
+		L.reg.Push(op)
+		L.reg.Push(lhs)
+		L.reg.Push(rhs)
+		L.Call(2, 1)
+		return L.reg.Pop()
+	}
+	if lnum.Type() == LTNumber && rnum.Type() == LTNumber {
+		L.RaiseError("number has no integer representation")
+	}
+	bad := lhs
+	if lnum.Type() == LTNumber {
+		bad = rhs
+	}
+	L.RaiseError("attempt to perform bitwise operation on a %v value", bad.Type().String())
+	return LNil
+}
 
-	reg.SetNumber(RA, result)
-	return 0
+// forLoopCount returns the number of iterations after the first one of an integer for loop,
+// or false if the loop does not run at all.
+func forLoopCount(init LInteger, limit LValue, step LInteger) (uint64, bool) {
+	var ilimit LInteger
+	switch lv := limit.(type) {
+	case LInteger:
+		ilimit = lv
+	case LNumber:
+		f := float64(lv)
+		if step > 0 {
+			f = math.Floor(f)
+		} else {
+			f = math.Ceil(f)
+		}
+		switch {
+		case math.IsNaN(f):
+			return 0, false
+		case f >= 1<<63:
+			ilimit = math.MaxInt64
+		case f < -(1 << 63):
+			ilimit = math.MinInt64
+		default:
+			ilimit = LInteger(f)
+		}
+	}
+	if step > 0 {
+		if init > ilimit {
+			return 0, false
+		}
+		return (uint64(ilimit) - uint64(init)) / uint64(step), true
+	}
+	if init < ilimit {
+		return 0, false
+	}
+	// -(step+1)+1 avoids overflowing the negation of math.MinInt64
+	return (uint64(init) - uint64(ilimit)) / (uint64(-(step + 1)) + 1), true
 }
 
 func luaModulo(lhs, rhs LNumber) LNumber {
@@ -2464,10 +2759,63 @@ func numberArith(_ *LState, opcode int, lhs, rhs LNumber) LNumber {
 		flhs := float64(lhs)
 		frhs := float64(rhs)
 		return LNumber(math.Pow(flhs, frhs))
+	case OP_IDIV:
+		return LNumber(math.Floor(float64(lhs / rhs)))
 	}
 	panic("arithmetic operation not supported")
 }
 
+// integerArith performs an arithmetic operation on two integers. Additions, subtractions and
+// multiplications wrap around on overflow, divisions and exponentiations always yield floats.
+func integerArith(L *LState, opcode int, lhs, rhs LInteger) LValue {
+	switch opcode {
+	case OP_ADD:
+		return lhs + rhs
+	case OP_SUB:
+		return lhs - rhs
+	case OP_MUL:
+		return lhs * rhs
+	case OP_MOD:
+		if rhs == 0 {
+			L.RaiseError("%s", "attempt to perform 'n%0'")
+		}
+		return integerModulo(lhs, rhs)
+	case OP_IDIV:
+		if rhs == 0 {
+			L.RaiseError("attempt to perform 'n~/0'")
+		}
+		return integerFloorDiv(lhs, rhs)
+	}
+	return numberArith(L, opcode, LNumber(lhs), LNumber(rhs))
+}
+
+func integerModulo(lhs, rhs LInteger) LInteger {
+	m := lhs % rhs
+	if m != 0 && (m^rhs) < 0 {
+		m += rhs
+	}
+	return m
+}
+
+func integerFloorDiv(lhs, rhs LInteger) LInteger {
+	q := lhs / rhs
+	if lhs%rhs != 0 && (lhs^rhs) < 0 {
+		q--
+	}
+	return q
+}
+
+// arithNumbers performs an arithmetic operation on two numbers of any subtype.
+// Mixed operands are converted to floats.
+func arithNumbers(L *LState, opcode int, lhs, rhs LValue) LValue {
+	if i1, ok1 := lhs.(LInteger); ok1 {
+		if i2, ok2 := rhs.(LInteger); ok2 {
+			return integerArith(L, opcode, i1, i2)
+		}
+	}
+	return numberArith(L, opcode, LVAsNumber(lhs), LVAsNumber(rhs))
+}
+
 func objectArith(L *LState, opcode int, lhs, rhs LValue) LValue {
 	event := ""
 	switch opcode {
@@ -2483,6 +2831,8 @@ func objectArith(L *LState, opcode int, lhs, rhs LValue) LValue {
 		event = "__mod"
 	case OP_POW:
 		event = "__pow"
+	case OP_IDIV:
+		event = "__idiv"
 	}
 	op := L.metaOp2(lhs, rhs, event)
 	if _, ok := op.(*LFunction); ok {
@@ -2493,19 +2843,17 @@ func objectArith(L *LState, opcode int, lhs, rhs LValue) LValue {
 		return L.reg.Pop()
 	}
 	if str, ok := lhs.(LString); ok {
-		if lnum, err := parseNumber(string(str)); err == nil {
+		if lnum, err := parseNumberValue(string(str)); err == nil {
 			lhs = lnum
 		}
 	}
 	if str, ok := rhs.(LString); ok {
-		if rnum, err := parseNumber(string(str)); err == nil {
+		if rnum, err := parseNumberValue(string(str)); err == nil {
 			rhs = rnum
 		}
 	}
-	if v1, ok1 := lhs.(LNumber); ok1 {
-		if v2, ok2 := rhs.(LNumber); ok2 {
-			return numberArith(L, opcode, LNumber(v1), LNumber(v2))
-		}
+	if lhs.Type() == LTNumber && rhs.Type() == LTNumber {
+		return arithNumbers(L, opcode, lhs, rhs)
 	}
 	L.RaiseError("%s", fmt.Sprintf("cannot perform %v operation between %v and %v",
 		strings.TrimLeft(event, "_"), lhs.Type().String(), rhs.Type().String()))
@@ -2544,6 +2892,11 @@ func stringConcat(L *LState, total, last int) LValue {
 				i--
 				total--
 			}
+			size := int64(memStringSize)
+			for _, str := range buf {
+				size += int64(len(str))
+			}
+			L.allocMemory(size)
 			rhs = LString(strings.Join(buf, ""))
 		}
 	}
@@ -2552,9 +2905,9 @@ func stringConcat(L *LState, total, last int) LValue {
 
 func lessThan(L *LState, lhs, rhs LValue) bool {
 	// optimization for numbers
-	if v1, ok1 := lhs.(LNumber); ok1 {
-		if v2, ok2 := rhs.(LNumber); ok2 {
-			return v1 < v2
+	if lhs.Type() == LTNumber {
+		if rhs.Type() == LTNumber {
+			return numberLess(lhs, rhs, false)
 		}
 		L.RaiseError("attempt to compare %v with %v", lhs.Type().String(), rhs.Type().String())
 	}
@@ -2573,6 +2926,92 @@ func lessThan(L *LState, lhs, rhs LValue) bool {
 	return ret
 }
 
+func lessEqual(L *LState, lhs, rhs LValue) bool {
+	if lhs.Type() == LTNumber {
+		if rhs.Type() == LTNumber {
+			return numberLess(lhs, rhs, true)
+		}
+		L.RaiseError("attempt to compare %v with %v", lhs.Type().String(), rhs.Type().String())
+	}
+	if lhs.Type() != rhs.Type() {
+		L.RaiseError("attempt to compare %v with %v", lhs.Type().String(), rhs.Type().String())
+	}
+	switch lhs.Type() {
+	case LTString:
+		// ret = strCmp(string(lhs.(LString)), string(rhs.(LString))) <= 0
+		return strings.Compare(string(lhs.(LString)), string(rhs.(LString))) <= 0
+	default:
+		switch objectRational(L, lhs, rhs, "__le") {
+		case 1:
+			return true
+		case 0:
+			return false
+		default:
+			return !objectRationalWithError(L, rhs, lhs, "__lt")
+		}
+	}
+}
+
+// numberLess compares two numbers of any subtype exactly, without converting integers to floats.
+func numberLess(lhs, rhs LValue, orEqual bool) bool {
+	switch l := lhs.(type) {
+	case LInteger:
+		switch r := rhs.(type) {
+		case LInteger:
+			return l < r || orEqual && l == r
+		case LNumber:
+			return intFloatLess(l, float64(r), orEqual)
+		}
+	case LNumber:
+		switch r := rhs.(type) {
+		case LNumber:
+			return l < r || orEqual && l == r
+		case LInteger:
+			// a <= b is not (b < a) and a < b is not (b <= a), unless a is NaN
+			return !math.IsNaN(float64(l)) && !intFloatLess(r, float64(l), !orEqual)
+		}
+	}
+	return false
+}
+
+// intFloatLess reports whether i < f, or i <= f if orEqual is true.
+func intFloatLess(i LInteger, f float64, orEqual bool) bool {
+	switch {
+	case math.IsNaN(f):
+		return false
+	case f >= 1<<63:
+		return true
+	case f < -(1 << 63):
+		return false
+	case orEqual:
+		return i <= LInteger(math.Floor(f))
+	}
+	return i < LInteger(math.Ceil(f))
+}
+
+// numberEquals compares two numbers of any subtype exactly.
+func numberEquals(lhs, rhs LValue) bool {
+	switch l := lhs.(type) {
+	case LInteger:
+		switch r := rhs.(type) {
+		case LInteger:
+			return l == r
+		case LNumber:
+			ri, ok := float2integer(r)
+			return ok && ri == l
+		}
+	case LNumber:
+		switch r := rhs.(type) {
+		case LNumber:
+			return l == r
+		case LInteger:
+			li, ok := float2integer(l)
+			return ok && li == r
+		}
+	}
+	return false
+}
+
 func equals(L *LState, lhs, rhs LValue, raw bool) bool {
 	lt := lhs.Type()
 	if lt != rhs.Type() {
@@ -2584,9 +3023,7 @@ func equals(L *LState, lhs, rhs LValue, raw bool) bool {
 	case LTNil:
 		ret = true
 	case LTNumber:
-		v1, _ := lhs.(LNumber)
-		v2, _ := rhs.(LNumber)
-		ret = v1 == v2
+		ret = numberEquals(lhs, rhs)
 	case LTBool:
 		ret = bool(lhs.(LBool)) == bool(rhs.(LBool))
 	case LTString:
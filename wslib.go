@@ -1,27 +1,58 @@
 package lua
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 const (
-	wsConnClass = "WS*"
+	wsConnClass   = "WS*"
+	wsServerClass = "WSSERVER*"
 )
 
-// wsModuleFuncs 定义模块级别的函数（这里只包含 Connect 和 SetTimeout）
+// wsModuleFuncs 定义模块级别的函数
 var wsModuleFuncs = map[string]LGFunction{
 	"Connect":    wsConnect,
 	"SetTimeout": wsSetTimeout,
+	"NewServer":  wsNewServer,
+	"Serve":      wsServe,
 }
 
 // wsConnMethods 定义 websocket 连接的实例方法（面向对象调用）
 var wsConnMethods = map[string]LGFunction{
-	"Send":    wsConnSend,
-	"Receive": wsConnReceive,
-	"Close":   wsConnClose,
+	"Send":       wsConnSend,
+	"SendBinary": wsConnSendBinary,
+	"Receive":    wsConnReceive,
+	"Ping":       wsConnPing,
+	"Pong":       wsConnPong,
+	"Close":      wsConnClose,
+	"Channel":    wsConnChannel,
+	"__gc":       wsConnGC,
+}
+
+// wsServerMethods 定义 websocket 服务器的实例方法，除 Handle 外与 httplib 的服务器相同
+var wsServerMethods = map[string]LGFunction{
+	"Handle":   wsServerHandle,
+	"Start":    httpServerStart,
+	"Serve":    httpServerServe,
+	"Addr":     httpServerAddr,
+	"Shutdown": httpServerShutdown,
+}
+
+// websocket 消息类型名称
+var wsMessageTypeNames = map[int]string{
+	websocket.TextMessage:   "text",
+	websocket.BinaryMessage: "binary",
+	websocket.CloseMessage:  "close",
+	websocket.PingMessage:   "ping",
+	websocket.PongMessage:   "pong",
 }
 
 // WsLibFuncDoc 记录模块文档信息（仅供生成文档或调试使用）
@@ -31,6 +62,8 @@ var WsLibFuncDoc = map[string]libFuncDoc{
 		libFuncName: []string{
 			"Connect",
 			"SetTimeout",
+			"NewServer",
+			"Serve",
 		},
 	},
 }
@@ -43,13 +76,101 @@ func OpenWs(L *LState) int {
 	mt := L.NewTypeMetatable(wsConnClass)
 	mt.RawSetString("__index", mt)
 	L.SetFuncs(mt, wsConnMethods)
+	// 建立 wsServer 类型的元表
+	mt = L.NewTypeMetatable(wsServerClass)
+	mt.RawSetString("__index", mt)
+	L.SetFuncs(mt, wsServerMethods)
 	L.Push(wsmod)
 	return 1
 }
 
 // wsConn 用于封装 websocket.Conn 对象
 type wsConn struct {
-	conn *websocket.Conn
+	conn   *websocket.Conn
+	closed bool
+
+	// 调用 Channel 后由后台 goroutine 读取消息并写入 ch
+	once sync.Once
+	ch   LChannel
+	done chan struct{}
+}
+
+// 发送控制帧（Ping、Pong、Close）的超时时间
+var wsControlTimeout = 10 * time.Second
+
+func newWsConnUserData(L *LState, conn *websocket.Conn) *LUserData {
+	ud := L.NewUserData()
+	ud.Value = &wsConn{conn: conn, done: make(chan struct{})}
+	L.SetMetatable(ud, L.GetTypeMetatable(wsConnClass))
+	return ud
+}
+
+// channel 返回接收消息的通道，首次调用时启动后台读取
+// 每条消息为 {type=, data=} 形式的 table，连接关闭时为 {type="close", code=, reason=}，
+// 读取出错时为 {type="error", error=}，随后通道被关闭
+func (ws *wsConn) channel() LChannel {
+	ws.once.Do(func() {
+		ws.ch = make(chan LValue)
+		go ws.readLoop()
+	})
+	return ws.ch
+}
+
+func (ws *wsConn) readLoop() {
+	defer close(ws.ch)
+	for {
+		msg := newLTable(0, 3)
+		typ, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			if ce, ok := err.(*websocket.CloseError); ok {
+				msg.RawSetString("type", LString(wsMessageTypeNames[websocket.CloseMessage]))
+				msg.RawSetString("code", LInteger(ce.Code))
+				msg.RawSetString("reason", LString(ce.Text))
+			} else {
+				msg.RawSetString("type", LString("error"))
+				msg.RawSetString("error", LString(err.Error()))
+			}
+		} else {
+			msg.RawSetString("type", LString(wsMessageTypeNames[typ]))
+			msg.RawSetString("data", LString(string(data)))
+		}
+		select {
+		case ws.ch <- msg:
+		case <-ws.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// stop 通知后台读取的 goroutine 退出
+func (ws *wsConn) stop() {
+	select {
+	case <-ws.done:
+	default:
+		close(ws.done)
+	}
+}
+
+// toWsConn 判断 LValue 是否为 websocket 连接
+func toWsConn(lv LValue) (*wsConn, bool) {
+	if ud, ok := lv.(*LUserData); ok {
+		ws, ok := ud.Value.(*wsConn)
+		return ws, ok && ws != nil
+	}
+	return nil, false
+}
+
+func checkWsConn(L *LState) *wsConn {
+	ud := L.CheckUserData(1)
+	ws, ok := ud.Value.(*wsConn)
+	if !ok || ws == nil {
+		L.RaiseError("invalid websocket connection")
+		return nil
+	}
+	return ws
 }
 
 // 默认握手超时和心跳超时时间
@@ -86,8 +207,9 @@ func wsConnect(L *LState) int {
 	dialer := websocket.Dialer{
 		HandshakeTimeout: wsDialTimeout,
 	}
-	conn, _, err := dialer.Dial(url, hdr)
+	conn, _, err := dialer.DialContext(L.contextOrBackground(), url, hdr)
 	if err != nil {
+		L.CheckContext()
 		L.RaiseError("failed to connect to %q: %v", url, err)
 		return 0
 	}
@@ -99,10 +221,7 @@ func wsConnect(L *LState) int {
 		return nil
 	})
 
-	ud := L.NewUserData()
-	ud.Value = &wsConn{conn: conn}
-	L.SetMetatable(ud, L.GetTypeMetatable(wsConnClass))
-	L.Push(ud)
+	L.Push(newWsConnUserData(L, conn))
 	return 1
 }
 
@@ -118,12 +237,7 @@ func wsConnect(L *LState) int {
 //  1. 发送消息失败时，会抛出错误信息
 //  2. 发送消息成功后，不会有返回值
 func wsConnSend(L *LState) int {
-	ud := L.CheckUserData(1)
-	ws, ok := ud.Value.(*wsConn)
-	if !ok || ws == nil {
-		L.RaiseError("invalid websocket connection")
-		return 0
-	}
+	ws := checkWsConn(L)
 	message := L.CheckString(2)
 	if err := ws.conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
 		L.RaiseError("send message failed: %v", err)
@@ -132,51 +246,322 @@ func wsConnSend(L *LState) int {
 	return 0
 }
 
+// wsConnSendBinary 为 wsConn 的实例方法，用于发送二进制消息
+// 参数：
+//  1. 消息内容（string）
+//
+// 返回值：无
+// 调用方式：
+//  1. wsconn:SendBinary(data)
+func wsConnSendBinary(L *LState) int {
+	ws := checkWsConn(L)
+	data := L.CheckString(2)
+	if err := ws.conn.WriteMessage(websocket.BinaryMessage, []byte(data)); err != nil {
+		L.RaiseError("send message failed: %v", err)
+		return 0
+	}
+	return 0
+}
+
 // wsConnReceive 为 wsConn 的实例方法，用于接收消息
 // 参数：无
 // 返回值：
-//  1. string（消息内容）
+//  1. string（消息内容，连接关闭时为 nil）
+//  2. string（消息类型，"text"、"binary" 或 "close"）
+//  3. number（连接关闭时的关闭码）
+//  4. string（连接关闭时的关闭原因）
 //
 // 调用方式：
-//  1. local msg = wsconn:Receive()
+//  1. local msg, typ = wsconn:Receive()
 //
 // 备注：
-//  1. 接收消息失败时，会抛出错误信息
-//  2. 接收消息成功后，返回消息内容
+//  1. 对方正常发送关闭帧时返回 nil、"close"、关闭码和原因，而不是抛出错误
+//  2. 其他接收失败的情况会抛出错误信息
+//  3. 收到的 Ping 会自动回复 Pong，不会作为消息返回
 func wsConnReceive(L *LState) int {
-	ud := L.CheckUserData(1)
-	ws, ok := ud.Value.(*wsConn)
-	if !ok || ws == nil {
-		L.RaiseError("invalid websocket connection")
-		return 0
+	ws := checkWsConn(L)
+	if ws.ch != nil {
+		return wsConnReceiveChannel(L, ws)
 	}
-	_, message, err := ws.conn.ReadMessage()
+	release := interruptReadOnDone(L, ws.conn.NetConn())
+	typ, message, err := ws.conn.ReadMessage()
+	release()
 	if err != nil {
+		L.CheckContext()
+		if ce, ok := err.(*websocket.CloseError); ok {
+			ws.closed = true
+			ws.conn.Close()
+			L.cancelFinalizer(L.CheckUserData(1))
+			L.Push(LNil)
+			L.Push(LString(wsMessageTypeNames[websocket.CloseMessage]))
+			L.Push(LInteger(ce.Code))
+			L.Push(LString(ce.Text))
+			return 4
+		}
 		L.RaiseError("receive message failed: %v", err)
 		return 0
 	}
 	L.Push(LString(string(message)))
+	L.Push(LString(wsMessageTypeNames[typ]))
+	return 2
+}
+
+// wsConnReceiveChannel 在已启动后台读取时从通道中接收消息，返回值与 Receive 相同
+func wsConnReceiveChannel(L *LState, ws *wsConn) int {
+	var lv LValue
+	var ok bool
+	select {
+	case lv, ok = <-ws.ch:
+	case <-L.ContextDone():
+		L.CheckContext()
+	}
+	if !ok {
+		L.RaiseError("receive message failed: connection closed")
+		return 0
+	}
+	msg := lv.(*LTable)
+	switch typ := msg.RawGetString("type"); string(typ.(LString)) {
+	case "close":
+		ws.closed = true
+		ws.conn.Close()
+		L.cancelFinalizer(L.CheckUserData(1))
+		L.Push(LNil)
+		L.Push(typ)
+		L.Push(msg.RawGetString("code"))
+		L.Push(msg.RawGetString("reason"))
+		return 4
+	case "error":
+		L.RaiseError("receive message failed: %v", msg.RawGetString("error"))
+		return 0
+	default:
+		L.Push(msg.RawGetString("data"))
+		L.Push(typ)
+		return 2
+	}
+}
+
+// wsConnChannel 为 wsConn 的实例方法，用于获取接收消息的通道
+// 参数：无
+// 返回值：
+//  1. channel（接收消息的通道）
+//
+// 调用方式：
+//  1. local ch = wsconn:Channel()
+//
+// 示例：
+//  1. chnlib.Select(
+//     {"|<-", ws1:Channel(), func(ok, msg) { PrintLn(msg.data) }},
+//     {"|<-", ws2, func(ok, msg) { PrintLn(msg.data) }},
+//     {"|<-", timeout, func(ok, v) { PrintLn("timeout") }}
+//     )
+//
+// 备注：
+//  1. 通道中的每条消息为 {type="text"|"binary", data=} 形式的 table
+//  2. 连接关闭时收到 {type="close", code=, reason=}，读取出错时收到 {type="error", error=}，随后通道被关闭
+//  3. 连接对象也可以直接作为 chnlib.Select 的 "|<-" 分支，效果与传入 Channel() 相同
+//  4. 调用 Channel 后 Receive 也改为从该通道读取，避免两处同时读取连接
+func wsConnChannel(L *LState) int {
+	ws := checkWsConn(L)
+	L.Push(ws.channel())
 	return 1
 }
 
+// wsConnPing 为 wsConn 的实例方法，用于发送 Ping 控制帧
+// 参数：
+//  1. 附带数据（string，可选，不超过 125 字节）
+//
+// 返回值：无
+// 调用方式：
+//  1. wsconn:Ping(data)
+func wsConnPing(L *LState) int {
+	return wsConnWriteControl(L, websocket.PingMessage)
+}
+
+// wsConnPong 为 wsConn 的实例方法，用于发送 Pong 控制帧
+// 参数：
+//  1. 附带数据（string，可选，不超过 125 字节）
+//
+// 返回值：无
+// 调用方式：
+//  1. wsconn:Pong(data)
+func wsConnPong(L *LState) int {
+	return wsConnWriteControl(L, websocket.PongMessage)
+}
+
+func wsConnWriteControl(L *LState, typ int) int {
+	ws := checkWsConn(L)
+	data := L.OptString(2, "")
+	if err := ws.conn.WriteControl(typ, []byte(data), time.Now().Add(wsControlTimeout)); err != nil {
+		L.RaiseError("send %s failed: %v", wsMessageTypeNames[typ], err)
+		return 0
+	}
+	return 0
+}
+
 // wsConnClose 为 wsConn 的实例方法，用于关闭 websocket 连接
-// 参数：无
+// 参数：
+//  1. 关闭码（number，可选，默认为 1000）
+//  2. 关闭原因（string，可选）
+//
 // 返回值：无
-// 调用方式：wsconn:Close()
+// 调用方式：
+//  1. wsconn:Close()
+//  2. wsconn:Close(4000, "bye")
+//
+// 备注：
+//  1. 关闭前会先向对方发送关闭帧，对方已关闭时直接关闭底层连接
 func wsConnClose(L *LState) int {
-	ud := L.CheckUserData(1)
-	ws, ok := ud.Value.(*wsConn)
-	if !ok || ws == nil {
-		L.RaiseError("invalid websocket connection")
-		return 0
+	ws := checkWsConn(L)
+	L.cancelFinalizer(L.CheckUserData(1))
+	code := L.OptInt(2, websocket.CloseNormalClosure)
+	reason := L.OptString(3, "")
+	ws.stop()
+	if !ws.closed {
+		ws.closed = true
+		msg := websocket.FormatCloseMessage(code, reason)
+		ws.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsControlTimeout))
 	}
-	if err := ws.conn.Close(); err != nil {
+	if err := ws.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 		L.RaiseError("close connection failed: %v", err)
 		return 0
 	}
 	return 0
 }
 
+// wsConnGC 为 wsConn 的 __gc 元方法，回收时关闭尚未关闭的连接
+func wsConnGC(L *LState) int {
+	ws := checkWsConn(L)
+	ws.stop()
+	if !ws.closed {
+		ws.closed = true
+		ws.conn.Close()
+	}
+	return 0
+}
+
+// wsNewServer 模块函数，用于创建 websocket 服务器
+// 参数：
+//  1. addr (string) - 监听地址，例如 ":8080" 或 "127.0.0.1:0"
+//
+// 返回值：
+//  1. userdata（可调用 Handle、Start、Serve、Addr、Shutdown 方法，用法与 httplib.NewServer 相同）
+//
+// 调用方式：
+//  1. local srv = wslib.NewServer(addr)
+//
+// 示例：
+//  1. local srv = wslib.NewServer(":8080")
+//     srv:Handle("/echo", func(conn, req) {
+//     while true {
+//     local msg, typ = conn:Receive()
+//     if typ == "close" { break }
+//     if typ == "binary" { conn:SendBinary(msg) } else { conn:Send(msg) }
+//     }
+//     })
+//     srv:Serve()
+//
+// 备注：
+//  1. 每个连接都在由 LState.NewThread 创建的独立 LState 中执行
+//  2. 处理函数的参数为连接对象和请求表（格式同 httplib 服务器的请求表）
+//  3. 处理函数返回后连接会被自动关闭
+func wsNewServer(L *LState) int {
+	addr := L.CheckString(1)
+	ud := L.NewUserData()
+	ud.Value = newHttpServer(L, addr)
+	L.SetMetatable(ud, L.GetTypeMetatable(wsServerClass))
+	L.Push(ud)
+	return 1
+}
+
+// wsServe 模块函数，用于按路由表启动 websocket 服务器并阻塞直到服务器关闭
+// 参数：
+//  1. addr (string) - 监听地址
+//  2. routes (table) - 路由表，键为路由模式，值为处理函数
+//
+// 返回值：无
+// 调用方式：
+//  1. wslib.Serve(addr, routes)
+func wsServe(L *LState) int {
+	addr := L.CheckString(1)
+	routes := L.CheckTable(2)
+	s := newHttpServer(L, addr)
+	routes.ForEach(func(k, v LValue) {
+		pattern, ok := k.(LString)
+		if !ok {
+			L.ArgError(2, "route pattern must be a string")
+		}
+		fn, ok := v.(*LFunction)
+		if !ok {
+			L.ArgError(2, fmt.Sprintf("handler for %q must be a function", string(pattern)))
+		}
+		addWsRoute(L, s, string(pattern), fn)
+	})
+	serveHttpServer(L, s)
+	return 0
+}
+
+// wsServerHandle 为 wsServer 的实例方法，用于注册 websocket 路由
+// 参数：
+//  1. pattern (string) - 路由模式
+//  2. handler (function) - 处理函数，参数为连接对象和请求表
+//
+// 返回值：无
+// 调用方式：
+//  1. srv:Handle(pattern, handler)
+func wsServerHandle(L *LState) int {
+	s := checkHttpServer(L)
+	pattern := L.CheckString(2)
+	fn := L.CheckFunction(3)
+	addWsRoute(L, s, pattern, fn)
+	return 0
+}
+
+func addWsRoute(L *LState, s *httpServer, pattern string, fn *LFunction) {
+	defer func() {
+		// http.ServeMux 对非法或重复的路由模式会 panic
+		if rcv := recover(); rcv != nil {
+			L.RaiseError("invalid route %q: %v", pattern, rcv)
+		}
+	}()
+	s.mux.Handle(pattern, wsHandler(s, fn))
+	s.addHandler(fn)
+}
+
+// wsHandler 将 Lua 函数包装为 websocket 处理器，每个连接在独立的 LState 中执行
+func wsHandler(s *httpServer, fn *LFunction) http.HandlerFunc {
+	upgrader := websocket.Upgrader{HandshakeTimeout: wsDialTimeout}
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade 失败时已向客户端返回错误响应
+			return
+		}
+		defer conn.Close()
+
+		L, cancel := s.L.NewThread()
+		if cancel != nil {
+			defer cancel()
+		} else {
+			L.SetContext(r.Context())
+		}
+
+		ud := newWsConnUserData(L, conn)
+		defer ud.Value.(*wsConn).stop()
+		// 处理函数返回后连接即被关闭，无需再调用 __gc 元方法
+		defer L.cancelFinalizer(ud)
+		if err := L.CallByParam(P{Fn: fn, NRet: 0, Protect: true}, ud, httpRequestToTable(L, r, nil)); err != nil {
+			if !isCancelError(err) {
+				fmt.Fprintf(os.Stderr, "wslib: %s: %v\n", r.URL.Path, err)
+			}
+			if ws := ud.Value.(*wsConn); !ws.closed {
+				ws.closed = true
+				msg := websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "")
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsControlTimeout))
+			}
+		}
+	}
+}
+
 // wsSetTimeout 模块函数，用于设置建立 websocket 连接时的握手超时时间
 // 参数：
 //  1. 时间长度（number）
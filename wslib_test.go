@@ -0,0 +1,94 @@
+package lua
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWsEchoServer(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	err := L.DoString(`
+		local srv = wslib.NewServer("127.0.0.1:0")
+		srv:Handle("/echo", func(conn, req) {
+			while true {
+				local msg, typ, code, reason = conn:Receive()
+				if typ == "close" {
+					break
+				}
+				if msg == "bye" {
+					conn:Close(4000, "see you")
+					break
+				}
+				if typ == "binary" {
+					conn:SendBinary(msg)
+				} else {
+					conn:Send(msg)
+				}
+			}
+		})
+		local addr = srv:Start()
+
+		local ws = wslib.Connect("ws://" .. addr .. "/echo")
+		ws:Send("hello")
+		local msg, typ = ws:Receive()
+		Assert(msg == "hello" and typ == "text", "text echo")
+
+		ws:SendBinary("bin\tdata")
+		msg, typ = ws:Receive()
+		Assert(msg == "bin\tdata" and typ == "binary", "binary echo")
+
+		ws:Ping("p")
+		ws:Send("bye")
+		local code, reason
+		msg, typ, code, reason = ws:Receive()
+		Assert(msg == nil and typ == "close", "close frame")
+		Assert(code == 4000 and reason == "see you", "close code")
+		ws:Close()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWsSelect(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	L.SetContext(ctx)
+
+	err := L.DoString(`
+		local srv = wslib.NewServer("127.0.0.1:0")
+		srv:Handle("/greet", func(conn, req) {
+			conn:Send("hi " .. req.query.name)
+			conn:Receive()
+		})
+		local addr = srv:Start()
+
+		local a = wslib.Connect("ws://" .. addr .. "/greet?name=a")
+		local b = wslib.Connect("ws://" .. addr .. "/greet?name=b")
+		local got = {}
+		for i = 1, 2 {
+			chnlib.Select(
+				{"|<-", a, func(ok, msg) { got[msg.data] = msg.type }},
+				{"|<-", b:Channel(), func(ok, msg) { got[msg.data] = msg.type }}
+			)
+		}
+		Assert(got["hi a"] == "text" and got["hi b"] == "text", "select")
+
+		local idle = chnlib.Make()
+		local idx = chnlib.Select({"|<-", a}, {"|<-", idle}, {"default"})
+		Assert(idx == 3, "default case")
+
+		a:Close()
+		b:Close()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}